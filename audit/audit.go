@@ -0,0 +1,159 @@
+// Package audit keeps a record of the issuance and verification of SMART
+// Health Cards as JSON lines, identifying patients only by salted hashes of
+// their names and birth dates so that the record does not itself hold any
+// health data or personally identifiable information in plaintext. See
+// https://jsonlines.org.
+package audit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/fhirbundle"
+	"github.com/amitkgupta/go-smarthealthcards/v2/store"
+)
+
+// EventType is the kind of event recorded in an audit log.
+type EventType string
+
+// Kinds of events recorded in an audit log.
+const (
+	Issuance     EventType = "issuance"
+	Verification EventType = "verification"
+)
+
+// Event is a single entry in an audit log.
+type Event struct {
+	// Time is when the event occurred.
+	Time time.Time `json:"time"`
+
+	// Type is the kind of event.
+	Type EventType `json:"type"`
+
+	// PatientHash identifies the patient, as returned by
+	// Log.PatientHash, or is empty if the patient is not known.
+	PatientHash string `json:"patientHash,omitempty"`
+
+	// Issuer is the issuer URL of the card.
+	Issuer string `json:"issuer,omitempty"`
+
+	// CardHash is the hex-encoded SHA-256 hash of the card's JWS.
+	CardHash string `json:"cardHash,omitempty"`
+
+	// Identity identifies who issued or verified the card, if known.
+	Identity string `json:"identity,omitempty"`
+
+	// RequestID identifies the HTTP request which caused the event, if
+	// any, e.g. as assigned by webhandlers.
+	RequestID string `json:"requestId,omitempty"`
+
+	// Error describes why the event failed, e.g. why a card could not be
+	// verified, or is empty if it succeeded.
+	Error string `json:"error,omitempty"`
+}
+
+// Log writes audit events as JSON lines. It is safe for concurrent use.
+type Log struct {
+	mu   sync.Mutex
+	w    io.Writer
+	salt []byte
+}
+
+// New returns a Log writing events to w, hashing patient identities with
+// the given salt. The salt should be a secret, random value of at least 32
+// bytes, kept for as long as events need to be correlated with patients;
+// without it, hashes cannot be matched to patients by guessing their names
+// and birth dates.
+func New(w io.Writer, salt []byte) *Log {
+	return &Log{w: w, salt: salt}
+}
+
+// PatientHash returns the hex-encoded HMAC-SHA256, keyed with the log's
+// salt, of the patient's case-folded names and birth date, so that events
+// concerning the same patient can be correlated without recording who the
+// patient is.
+func (l *Log) PatientHash(p fhirbundle.Patient) string {
+	mac := hmac.New(sha256.New, l.salt)
+	mac.Write([]byte(strings.ToLower(p.Name.Family)))
+	for _, given := range p.Name.Givens {
+		mac.Write([]byte{0})
+		mac.Write([]byte(strings.ToLower(given)))
+	}
+	mac.Write([]byte{0})
+	if !p.BirthDate.IsZero() {
+		mac.Write([]byte(p.BirthDate.Format("2006-01-02")))
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Record writes the event as a single line of JSON, setting its time to
+// the current time if it is zero.
+func (l *Log) Record(e Event) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Time = e.Time.UTC()
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, err = l.w.Write(append(line, '\n'))
+	return err
+}
+
+// Issued records that a card with the given JWS was issued to the given
+// patient on behalf of the given issuer, at the request of the given
+// identity.
+func (l *Log) Issued(p fhirbundle.Patient, issuer, healthCardJWS, identity string) error {
+	return l.Record(Event{
+		Type:        Issuance,
+		PatientHash: l.PatientHash(p),
+		Issuer:      issuer,
+		CardHash:    store.CardHash(healthCardJWS),
+		Identity:    identity,
+	})
+}
+
+// Verified records that a card with the given JWS, purporting to be issued
+// to the given patient on behalf of the given issuer, was checked by the
+// given identity, and the error, if any, with which verification failed.
+func (l *Log) Verified(p fhirbundle.Patient, issuer, healthCardJWS, identity string, verifyErr error) error {
+	e := Event{
+		Type:        Verification,
+		PatientHash: l.PatientHash(p),
+		Issuer:      issuer,
+		CardHash:    store.CardHash(healthCardJWS),
+		Identity:    identity,
+	}
+	if verifyErr != nil {
+		e.Error = verifyErr.Error()
+	}
+	return l.Record(e)
+}
+
+// ReadEvents reads the events of an audit log written by a Log, e.g. to
+// export them for an auditor.
+func ReadEvents(r io.Reader) ([]Event, error) {
+	var events []Event
+	d := json.NewDecoder(r)
+	for {
+		var e Event
+		if err := d.Decode(&e); err == io.EOF {
+			return events, nil
+		} else if err != nil {
+			return events, err
+		}
+		events = append(events, e)
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/fhirbundle"
+	"github.com/amitkgupta/go-smarthealthcards/v2/issuer"
+	"github.com/amitkgupta/go-smarthealthcards/v2/qrcode"
+)
+
+// patientJSON is the format of the patient data read by "shc issue" from
+// a JSON file or standard input, unless it is an FHIR bundle.
+type patientJSON struct {
+	FamilyName    string             `json:"familyName"`
+	GivenNames    []string           `json:"givenNames"`
+	BirthDate     string             `json:"birthDate"`
+	Immunizations []immunizationJSON `json:"immunizations"`
+}
+
+type immunizationJSON struct {
+	Date        string `json:"date"`
+	VaccineType string `json:"vaccineType"`
+	Performer   string `json:"performer"`
+	LotNumber   string `json:"lotNumber"`
+}
+
+// immunizationsFlag collects repeated -immunization flags.
+type immunizationsFlag []immunizationJSON
+
+func (f *immunizationsFlag) String() string {
+	return fmt.Sprint(*f)
+}
+
+func (f *immunizationsFlag) Set(value string) error {
+	fields := strings.Split(value, ",")
+	if len(fields) != 4 {
+		return errors.New(`must be "date,vaccine type,performer,lot number"`)
+	}
+	*f = append(*f, immunizationJSON{
+		Date:        strings.TrimSpace(fields[0]),
+		VaccineType: strings.TrimSpace(fields[1]),
+		Performer:   strings.TrimSpace(fields[2]),
+		LotNumber:   strings.TrimSpace(fields[3]),
+	})
+	return nil
+}
+
+func runIssue(args []string) error {
+	fs := flag.NewFlagSet("issue", flag.ExitOnError)
+	iss := fs.String("issuer", "", "issuer URL, the \"iss\" of the card (required)")
+	input := fs.String("input", "", `JSON file of patient data or an FHIR bundle, or "-" for standard input`)
+	family := fs.String("family", "", "patient's family name")
+	given := fs.String("given", "", "patient's given names, separated by spaces")
+	dob := fs.String("dob", "", "patient's date of birth, as YYYY-MM-DD")
+	var immunizations immunizationsFlag
+	fs.Var(&immunizations, "immunization", `immunization as "YYYY-MM-DD,vaccine type,performer,lot number"; may be repeated`)
+	output := fs.String("output", "png", `what to write: "png", "jws", or "file" for a .smart-health-card file`)
+	out := fs.String("out", "card", `path to write to, without extension, or "-" for standard output`)
+	terminal := fs.Bool("terminal", false, "print the QR codes to the terminal rather than writing any files")
+	keys := addKeyFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: shc issue -issuer URL [-input FILE | -family NAME -given NAMES -dob DATE -immunization ...] [flags]")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Unless -key or -key-command is given, the signing key is read from the")
+		fmt.Fprintln(fs.Output(), "SMART_HEALTH_CARDS_KEY_D, _X, and _Y environment variables.")
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *iss == "" {
+		fs.Usage()
+		return errors.New("-issuer is required")
+	}
+
+	key, err := keys.load()
+	if err != nil {
+		return err
+	}
+
+	i := issuer.New(key, *iss)
+	ctx := context.Background()
+
+	var card issuer.Card
+	if *input != "" {
+		data, err := readInput(*input)
+		if err != nil {
+			return err
+		}
+
+		var resource struct {
+			ResourceType string `json:"resourceType"`
+		}
+		if err := json.Unmarshal(data, &resource); err != nil {
+			return fmt.Errorf("invalid input JSON: %w", err)
+		}
+
+		if resource.ResourceType == "Bundle" {
+			if err := fhirbundle.ValidateJSON(data); err != nil {
+				return err
+			}
+			card, err = i.IssueJSON(ctx, data)
+		} else {
+			var p patientJSON
+			if err := json.Unmarshal(data, &p); err != nil {
+				return fmt.Errorf("invalid input JSON: %w", err)
+			}
+			var fb fhirbundle.FHIRBundle
+			if fb, err = p.bundle(); err != nil {
+				return err
+			}
+			card, err = i.Issue(ctx, fb)
+		}
+		if err != nil {
+			return err
+		}
+	} else {
+		p := patientJSON{
+			FamilyName:    *family,
+			GivenNames:    strings.Fields(*given),
+			BirthDate:     *dob,
+			Immunizations: immunizations,
+		}
+		fb, err := p.bundle()
+		if err != nil {
+			return err
+		}
+		if card, err = i.Issue(ctx, fb); err != nil {
+			return err
+		}
+	}
+
+	if *terminal {
+		texts, err := qrcode.EncodeToTerminal(card.JWS, qrcode.Options{})
+		if err != nil {
+			return err
+		}
+		for n, text := range texts {
+			if len(texts) > 1 {
+				fmt.Printf("QR code %d of %d:\n", n+1, len(texts))
+			}
+			fmt.Print(text)
+		}
+		return nil
+	}
+
+	switch *output {
+	case "jws":
+		return writeOutput(*out, ".jws", []byte(card.JWS+"\n"))
+	case "file":
+		return writeOutput(*out, ".smart-health-card", card.File)
+	case "png":
+		return writeImages(*out, ".png", card.QRPNGs)
+	}
+	return fmt.Errorf("unknown -output %q", *output)
+}
+
+// bundle validates the patient data and constructs an FHIR bundle from it.
+func (p patientJSON) bundle() (fhirbundle.FHIRBundle, error) {
+	if p.FamilyName == "" || len(p.GivenNames) == 0 || p.BirthDate == "" {
+		return fhirbundle.FHIRBundle{}, errors.New("family name, given names, and date of birth are required")
+	}
+	if len(p.Immunizations) == 0 {
+		return fhirbundle.FHIRBundle{}, errors.New("at least one immunization is required")
+	}
+
+	birthDate, err := time.Parse("2006-01-02", p.BirthDate)
+	if err != nil {
+		return fhirbundle.FHIRBundle{}, fmt.Errorf("invalid date of birth: %w", err)
+	}
+
+	fb := fhirbundle.FHIRBundle{
+		Patient: fhirbundle.Patient{
+			Name:      fhirbundle.Name{Family: p.FamilyName, Givens: p.GivenNames},
+			BirthDate: birthDate,
+		},
+	}
+
+	for n, immunization := range p.Immunizations {
+		date, err := time.Parse("2006-01-02", immunization.Date)
+		if err != nil {
+			return fhirbundle.FHIRBundle{}, fmt.Errorf("immunization %d: invalid date: %w", n+1, err)
+		}
+
+		vaccineType := fhirbundle.VaccineType(immunization.VaccineType)
+		switch vaccineType {
+		case fhirbundle.Pfizer, fhirbundle.Moderna, fhirbundle.JohnsonAndJohnson,
+			fhirbundle.AstraZeneca, fhirbundle.Sinopharm, fhirbundle.COVAXIN:
+		default:
+			return fhirbundle.FHIRBundle{}, fmt.Errorf("immunization %d: unsupported vaccine type %q", n+1, immunization.VaccineType)
+		}
+
+		if immunization.Performer == "" || immunization.LotNumber == "" {
+			return fhirbundle.FHIRBundle{}, fmt.Errorf("immunization %d: performer and lot number are required", n+1)
+		}
+
+		fb.Immunizations = append(fb.Immunizations, fhirbundle.Immunization{
+			DatePerformed: date,
+			Performer:     immunization.Performer,
+			LotNumber:     immunization.LotNumber,
+			VaccineType:   vaccineType,
+		})
+	}
+
+	return fb, nil
+}
+
+func readInput(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
+
+// writeOutput writes data to path plus the given extension, or to standard
+// output if path is "-".
+func writeOutput(path, ext string, data []byte) error {
+	if path == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path+ext, data, 0644)
+}
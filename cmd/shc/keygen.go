@@ -0,0 +1,145 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/jws"
+)
+
+func runKeygen(args []string) error {
+	fs := flag.NewFlagSet("keygen", flag.ExitOnError)
+	format := fs.String("format", "env", `how to write the key: "env" for shell exports of the SMART_HEALTH_CARDS_KEY_* variables, "pem" for a PKCS #8 PEM block, or "jwk" for a private JSON Web Key`)
+	out := fs.String("out", "-", `file to write the key to, or "-" for standard output`)
+	printKID := fs.Bool("kid", false, "print the key's kid to standard error")
+	jwksPath := fs.String("jwks", "", "file to write the JSON Web Key Set of the key's public key to, ready to be served at /.well-known/jwks.json")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: shc keygen [flags]")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Generates an ECDSA P-256 signing key. For example:")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "  eval `shc keygen`")
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var encode func(*ecdsa.PrivateKey) ([]byte, error)
+	switch *format {
+	case "env":
+		encode = envExports
+	case "pem":
+		encode = pemBlock
+	case "jwk":
+		encode = privateJWK
+	default:
+		return fmt.Errorf("unknown -format %q", *format)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	encoded, err := encode(key)
+	if err != nil {
+		return err
+	}
+
+	if *out == "-" {
+		if _, err := os.Stdout.Write(encoded); err != nil {
+			return err
+		}
+	} else if err := os.WriteFile(*out, encoded, 0600); err != nil {
+		return err
+	}
+
+	if *printKID {
+		fmt.Fprintf(os.Stderr, "kid: %s\n", jws.KeyID(&key.PublicKey))
+	}
+
+	if *jwksPath != "" {
+		jwksJSON, err := jws.JWKSJSON(key)
+		if err != nil {
+			return err
+		}
+		if err := writeOutput(*jwksPath, "", jwksJSON); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// envExports encodes the key as shell exports of the environment variables
+// read by the issue and serve commands and by the example server.
+func envExports(key *ecdsa.PrivateKey) ([]byte, error) {
+	var params [3][]byte
+	for i, n := range []interface{ MarshalText() ([]byte, error) }{key.D, key.X, key.Y} {
+		text, err := n.MarshalText()
+		if err != nil {
+			return nil, err
+		}
+		params[i] = text
+	}
+
+	return []byte(fmt.Sprintf(
+		"export SMART_HEALTH_CARDS_KEY_D=%s\nexport SMART_HEALTH_CARDS_KEY_X=%s\nexport SMART_HEALTH_CARDS_KEY_Y=%s\n",
+		params[0], params[1], params[2],
+	)), nil
+}
+
+func pemBlock(key *ecdsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// privateJWK encodes the key as a JSON Web Key including the private
+// parameter "d", with the same kid as in the key's JWKS.
+func privateJWK(key *ecdsa.PrivateKey) ([]byte, error) {
+	k, err := publicJWK(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	k["d"] = base64.RawURLEncoding.EncodeToString(key.D.FillBytes(make([]byte, 32)))
+
+	encoded, err := json.MarshalIndent(k, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(encoded, '\n'), nil
+}
+
+// publicJWK returns the members of the JSON Web Key of the given public
+// key, as it appears in the key's JWKS.
+func publicJWK(key *ecdsa.PublicKey) (map[string]any, error) {
+	jwksJSON, err := jws.PublicJWKSJSON(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var set struct {
+		Keys []map[string]any `json:"keys"`
+	}
+	if err := json.Unmarshal(jwksJSON, &set); err != nil {
+		return nil, err
+	}
+	if len(set.Keys) != 1 {
+		return nil, errors.New("unexpected JWKS")
+	}
+	return set.Keys[0], nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+
+	shcecdsa "github.com/amitkgupta/go-smarthealthcards/v2/ecdsa"
+)
+
+// keyFlags are the flags from which commands which sign cards load their
+// signing key.
+type keyFlags struct {
+	file    *string
+	command *string
+}
+
+func addKeyFlags(fs *flag.FlagSet) keyFlags {
+	return keyFlags{
+		file:    fs.String("key", "", `file holding the signing key, as written by "shc keygen" in any -format`),
+		command: fs.String("key-command", "", "shell command printing the signing key as PEM, a JWK, or environment variables, e.g. one fetching it from a secrets manager or KMS"),
+	}
+}
+
+// load loads the signing key from the file or command given by the flags,
+// or else from the SMART_HEALTH_CARDS_KEY_D, _X, and _Y environment
+// variables written by "shc keygen -format env".
+func (f keyFlags) load() (*ecdsa.PrivateKey, error) {
+	switch {
+	case *f.file != "" && *f.command != "":
+		return nil, errors.New("only one of -key and -key-command may be given")
+	case *f.file != "":
+		return shcecdsa.LoadKeyFromFile(*f.file)
+	case *f.command != "":
+		var stderr bytes.Buffer
+		cmd := exec.Command("sh", "-c", *f.command)
+		cmd.Stderr = &stderr
+		data, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("-key-command: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+		}
+		key, err := shcecdsa.ParseKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("-key-command: %w", err)
+		}
+		return key, nil
+	}
+
+	d, x, y := os.Getenv(shcecdsa.EnvD), os.Getenv(shcecdsa.EnvX), os.Getenv(shcecdsa.EnvY)
+	if d == "" || x == "" || y == "" {
+		return nil, errors.New("-key or -key-command must be given, or SMART_HEALTH_CARDS_KEY_D, _X, and _Y must be set")
+	}
+	return shcecdsa.LoadKey(d, x, y)
+}
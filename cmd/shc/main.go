@@ -0,0 +1,68 @@
+// Command shc issues SMART Health Cards from the command line.
+//
+// Usage:
+//
+//	shc <command> [flags]
+//
+// The commands are:
+//
+//	issue    issue a card from flags, a JSON file, or standard input
+//	keygen   generate a signing key
+//	verify   verify a card from a JWS, a .smart-health-card file, or QR codes
+//	qr       encode a JWS as QR code images, or decode QR code images
+//	poster   lay out QR codes on a printable poster, as a PDF or PNG
+//	serve    serve the issuance endpoints over HTTP or HTTPS
+//	snapshot write a signed snapshot of issuers' JWKS for offline verification
+//
+// Run "shc <command> -h" for the flags of each command.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+var commands = []command{
+	{"issue", "issue a card from flags, a JSON file, or standard input", runIssue},
+	{"keygen", "generate a signing key", runKeygen},
+	{"verify", "verify a card from a JWS, a .smart-health-card file, or QR codes", runVerify},
+	{"qr", "encode a JWS as QR code images, or decode QR code images", runQR},
+	{"poster", "lay out QR codes on a printable poster, as a PDF or PNG", runPoster},
+	{"serve", "serve the issuance endpoints over HTTP or HTTPS", runServe},
+	{"snapshot", "write a signed snapshot of issuers' JWKS for offline verification", runSnapshot},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	for _, c := range commands {
+		if c.name == os.Args[1] {
+			if err := c.run(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "shc %s: %v\n", c.name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: shc <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", c.name, c.summary)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"strings"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/pdf"
+	"github.com/amitkgupta/go-smarthealthcards/v2/qrcode"
+)
+
+func runPoster(args []string) error {
+	fs := flag.NewFlagSet("poster", flag.ExitOnError)
+	input := fs.String("input", "-", `file holding the JWS, or "-" for standard input; ignored if QR code images are given`)
+	format := fs.String("format", "pdf", `poster format: "pdf" or "png"`)
+	size := fs.String("size", "letter", `page size: "letter" or "a4"`)
+	title := fs.String("title", "", `title above the QR codes; "SMART Health Card" by default`)
+	instructions := fs.String("instructions", "", `instructions beneath the QR codes; "Scan to save your vaccination record" by default`)
+	issuer := fs.String("issuer", "", "issuer's name, beneath its logo")
+	logo := fs.String("logo", "", "PNG or JPEG file of the issuer's logo; a dashed box is drawn in its place by default")
+	out := fs.String("out", "poster", `path to write to, without extension, or "-" for standard output`)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: shc poster [flags] [IMAGE...]")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Lays out the QR codes encoding a JWS, or the given QR code images, e.g. of a")
+		fmt.Fprintln(fs.Output(), "link to cards, on a printable poster with the issuer's logo and instructions.")
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var pageSize pdf.PageSize
+	var pixels image.Point
+	switch *size {
+	case "letter":
+		pageSize, pixels = pdf.Letter, qrcode.LetterPoster
+	case "a4":
+		pageSize, pixels = pdf.A4, qrcode.A4Poster
+	default:
+		return fmt.Errorf("unknown -size %q", *size)
+	}
+	if *format != "pdf" && *format != "png" {
+		return fmt.Errorf("unknown -format %q", *format)
+	}
+
+	var logoImage image.Image
+	if *logo != "" {
+		f, err := os.Open(*logo)
+		if err != nil {
+			return err
+		}
+		logoImage, _, err = image.Decode(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("-logo: %w", err)
+		}
+	}
+
+	// QR code images given as arguments are laid out as they are;
+	// otherwise the JWS is encoded.
+	var qrs []image.Image
+	for _, path := range fs.Args() {
+		data, err := readInput(path)
+		if err != nil {
+			return err
+		}
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		qrs = append(qrs, img)
+	}
+	var healthCardJWS string
+	if len(qrs) == 0 {
+		data, err := readInput(*input)
+		if err != nil {
+			return err
+		}
+		healthCardJWS = strings.TrimSpace(string(data))
+	}
+
+	if *format == "png" {
+		poster := qrcode.Poster{
+			Size:         pixels,
+			Title:        *title,
+			Instructions: *instructions,
+			Issuer:       *issuer,
+			Logo:         logoImage,
+		}
+		var buf bytes.Buffer
+		if len(qrs) == 0 {
+			if err := poster.Encode(&buf, healthCardJWS, qrcode.Options{}); err != nil {
+				return err
+			}
+		} else if err := png.Encode(&buf, poster.Image(qrs)); err != nil {
+			return err
+		}
+		return writeOutput(*out, ".png", buf.Bytes())
+	}
+
+	var qrPNGs [][]byte
+	if len(qrs) == 0 {
+		var err error
+		if qrPNGs, err = qrcode.EncodeWithOptions(healthCardJWS, qrcode.Options{}); err != nil {
+			return err
+		}
+	}
+	for _, img := range qrs {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			return err
+		}
+		qrPNGs = append(qrPNGs, buf.Bytes())
+	}
+
+	document, err := pdf.Poster(qrPNGs, pdf.PosterOptions{
+		Size:         pageSize,
+		Title:        *title,
+		Instructions: *instructions,
+		Issuer:       *issuer,
+		Logo:         logoImage,
+	})
+	if err != nil {
+		return err
+	}
+	return writeOutput(*out, ".pdf", document)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"os"
+	"strings"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/qrcode"
+)
+
+func runQR(args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "encode":
+			return runQREncode(args[1:])
+		case "decode":
+			return runQRDecode(args[1:])
+		}
+	}
+	return errors.New(`usage: shc qr encode|decode [flags]; run "shc qr encode -h" or "shc qr decode -h" for details`)
+}
+
+func runQREncode(args []string) error {
+	fs := flag.NewFlagSet("qr encode", flag.ExitOnError)
+	input := fs.String("input", "-", `file holding the JWS, or "-" for standard input`)
+	format := fs.String("format", "png", `image format: "png" or "svg"`)
+	size := fs.Int("size", qrcode.DefaultSize, "width and height of each PNG in pixels")
+	ec := fs.String("ec", "M", "error correction level: L, M, Q, or H")
+	fg := fs.String("fg", "", `color of the dark modules, as "#rgb" or "#rrggbb"; black by default`)
+	bg := fs.String("bg", "", `color of the light modules, as "#rgb" or "#rrggbb"; white by default`)
+	shape := fs.String("shape", "square", `shape of the dark modules of PNGs: "square", "rounded", or "dots"`)
+	logo := fs.String("logo", "", "PNG or JPEG file of a logo to draw over the center of each PNG")
+	out := fs.String("out", "qr", `path to write to, without extension, or "-" for standard output; multiple QR codes are numbered, e.g. qr-1.png`)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: shc qr encode [flags]")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Encodes a JWS as one or more QR code images.")
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	opts := qrcode.Options{Size: *size}
+	switch strings.ToUpper(*ec) {
+	case "L":
+		opts.ErrorCorrection = qrcode.Low
+	case "M":
+		opts.ErrorCorrection = qrcode.Medium
+	case "Q":
+		opts.ErrorCorrection = qrcode.Quartile
+	case "H":
+		opts.ErrorCorrection = qrcode.High
+	default:
+		return fmt.Errorf("unknown -ec %q", *ec)
+	}
+
+	var err error
+	if *fg != "" {
+		if opts.Foreground, err = qrcode.ParseColor(*fg); err != nil {
+			return err
+		}
+	}
+	if *bg != "" {
+		if opts.Background, err = qrcode.ParseColor(*bg); err != nil {
+			return err
+		}
+	}
+	if opts.Shape, err = qrcode.ParseModuleShape(*shape); err != nil {
+		return err
+	}
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	if *logo != "" {
+		f, err := os.Open(*logo)
+		if err != nil {
+			return err
+		}
+		opts.Logo, _, err = image.Decode(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("-logo: %w", err)
+		}
+	}
+
+	data, err := readInput(*input)
+	if err != nil {
+		return err
+	}
+	healthCardJWS := strings.TrimSpace(string(data))
+
+	var images [][]byte
+	switch *format {
+	case "png":
+		images, err = qrcode.EncodeWithOptions(healthCardJWS, opts)
+	case "svg":
+		images, err = qrcode.EncodeSVG(healthCardJWS, opts)
+	default:
+		return fmt.Errorf("unknown -format %q", *format)
+	}
+	if err != nil {
+		return err
+	}
+
+	return writeImages(*out, "."+*format, images)
+}
+
+func runQRDecode(args []string) error {
+	fs := flag.NewFlagSet("qr decode", flag.ExitOnError)
+	printJWS := fs.Bool("jws", false, "print the JWS reassembled from all the QR codes, rather than each QR code's shc:/ string")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: shc qr decode [flags] IMAGE...")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), `Prints the shc:/ string encoded by each QR code image, or "-" for standard input.`)
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no images given")
+	}
+
+	shcStrings := make([]string, fs.NArg())
+	for i, path := range fs.Args() {
+		data, err := readInput(path)
+		if err != nil {
+			return err
+		}
+		if shcStrings[i], err = readQRCode(data); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	if !*printJWS {
+		for _, s := range shcStrings {
+			fmt.Println(s)
+		}
+		return nil
+	}
+
+	healthCardJWS, err := qrcode.DecodeStrings(shcStrings)
+	if err != nil {
+		return err
+	}
+	fmt.Println(healthCardJWS)
+	return nil
+}
+
+// readQRCode returns the text encoded by the QR code in the given image.
+func readQRCode(data []byte) (string, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	return qrcode.DecodeImage(img)
+}
+
+// writeImages writes one or more images to path plus the given extension,
+// numbering them if there are several, or writes a single image to
+// standard output if path is "-".
+func writeImages(path, ext string, images [][]byte) error {
+	if len(images) == 1 {
+		return writeOutput(path, ext, images[0])
+	}
+	if path == "-" {
+		return errors.New("the card needs multiple QR codes, which cannot be written to standard output")
+	}
+	for n, img := range images {
+		if err := writeOutput(fmt.Sprintf("%s-%d", path, n+1), ext, img); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"regexp"
+	"sort"
+	"syscall"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/config"
+	shcecdsa "github.com/amitkgupta/go-smarthealthcards/v2/ecdsa"
+	"github.com/amitkgupta/go-smarthealthcards/v2/jws"
+	"github.com/amitkgupta/go-smarthealthcards/v2/keyring"
+	"github.com/amitkgupta/go-smarthealthcards/v2/server"
+	"github.com/amitkgupta/go-smarthealthcards/v2/verifier"
+	"github.com/amitkgupta/go-smarthealthcards/v2/webhandlers"
+)
+
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	iss := fs.String("issuer", "", "issuer URL, the \"iss\" of the cards, whose /.well-known/jwks.json must reach this server (required)")
+	addr := fs.String("addr", ":8080", "address to listen on")
+	tlsCert := fs.String("tls-cert", "", "file holding the TLS certificate chain, in PEM form; serves HTTPS if given along with -tls-key")
+	tlsKey := fs.String("tls-key", "", "file holding the TLS private key, in PEM form")
+	acmeDomain := fs.String("acme-domain", "", "domain, e.g. the issuer URL's host, for which to obtain certificates from Let's Encrypt, serving HTTPS on :443 and HTTP-01 challenges on :80 instead of -addr")
+	acmeCache := fs.String("acme-cache", "acme-cache", "directory in which to cache the certificates obtained for -acme-domain")
+	compress := fs.Bool("compress", false, "compress JSON, HTML, and text responses with gzip or deflate, as negotiated by Accept-Encoding")
+	singleQR := fs.Bool("single-qr", false, "reject cards which would need more than one QR code, for verifiers which cannot scan chunked cards")
+	name := fs.String("issuer-name", "", "issuer's name, served with its logo, website, and contact as display metadata for wallet apps")
+	logo := fs.String("issuer-logo", "", "URL of the issuer's logo, served as display metadata if -issuer-name is given")
+	website := fs.String("issuer-website", "", "URL of the issuer's website, served as display metadata if -issuer-name is given")
+	contact := fs.String("issuer-contact", "", "how to contact the issuer, served as display metadata if -issuer-name is given")
+	label := fs.Bool("label", false, "label QR code PNGs with the patient's name and birth date and, for multi-part cards, the part number")
+	normalizeNames := fs.Bool("normalize-names", false, "normalize patients' names to Unicode NFC, for verifiers which fail to match differently encoded names")
+	performers := fs.String("performers", "", "file listing the known immunization performers, one per line, which the form suggests and submitted performers must match")
+	twoStep := fs.Bool("two-step", false, "issue cards from the form only after their contents have been reviewed and confirmed")
+	lotPattern := fs.String("lot-pattern", "", "regular expression, e.g. ^[A-Z0-9-]{4,20}$, which submitted lot numbers must match")
+	asciiNames := fs.Bool("ascii-names", false, "transliterate patients' names to ASCII, for verifiers matching cards to IDs with ASCII names")
+	drainTimeout := fs.Duration("drain-timeout", server.DefaultDrainTimeout, "how long in-flight requests may take to complete on SIGTERM or interrupt before their connections are closed")
+	debugAddr := fs.String("debug-addr", "", "address, e.g. localhost:6060, on which to serve pprof profiles and expvar variables to operators; keep it private")
+	configFile := fs.String("config", "", "YAML or TOML file configuring the server, as described by the config package; flags override it")
+	keyReload := fs.Duration("key-reload-interval", 0, "how often to check the -key file for a new key, e.g. one mounted as a Kubernetes secret; the file is also reloaded on SIGHUP")
+	publicKeys := fs.String("public-keys", "", "JWKS file, e.g. the issuer's /.well-known/jwks.json, holding the public keys to publish and verify cards with, instead of a signing key; only the JWKS, issuer metadata, verification, and OpenAPI endpoints are served")
+	keys := addKeyFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: shc serve -issuer URL [flags]")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Serves the issuance endpoints at the paths of webhandlers.DefaultRoutes:")
+		fmt.Fprintln(fs.Output(), "the form at /, the preview at /preview, CSV batches at /batch, FHIR bundles")
+		fmt.Fprintln(fs.Output(), "at /bundle, the JWKS at /.well-known/jwks.json, and the OpenAPI document at")
+		fmt.Fprintln(fs.Output(), "/openapi.json. Unless -key or -key-command is given, the signing key is read")
+		fmt.Fprintln(fs.Output(), "from the SMART_HEALTH_CARDS_KEY_D, _X, and _Y environment variables. A -key")
+		fmt.Fprintln(fs.Output(), "file is reloaded on SIGHUP, and every -key-reload-interval if given; the")
+		fmt.Fprintln(fs.Output(), "previous keys remain in the JWKS, so that cards signed with them still verify.")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "With -public-keys, no signing key is loaded, and only the endpoints publishing")
+		fmt.Fprintln(fs.Output(), "and verifying with the public keys are served, for verification services.")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "With -config, settings are read from the file, and from SHC_ environment")
+		fmt.Fprintln(fs.Output(), "variables overriding it, e.g. SHC_ISSUER_URL; the flags given override both.")
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var cfg config.Config
+	if *configFile != "" {
+		var err error
+		if cfg, err = config.Load(*configFile); err != nil {
+			return err
+		}
+	}
+
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	for _, f := range []struct {
+		name          string
+		flag, setting *string
+	}{
+		{"issuer", iss, &cfg.Issuer.URL},
+		{"issuer-name", name, &cfg.Issuer.Name},
+		{"issuer-logo", logo, &cfg.Issuer.LogoURL},
+		{"issuer-website", website, &cfg.Issuer.Website},
+		{"issuer-contact", contact, &cfg.Issuer.Contact},
+		{"addr", addr, &cfg.Server.Addr},
+		{"tls-cert", tlsCert, &cfg.Server.TLSCert},
+		{"tls-key", tlsKey, &cfg.Server.TLSKey},
+		{"acme-domain", acmeDomain, &cfg.Server.ACMEDomain},
+		{"acme-cache", acmeCache, &cfg.Server.ACMECache},
+		{"debug-addr", debugAddr, &cfg.Server.DebugAddr},
+		{"performers", performers, &cfg.Form.Performers},
+		{"lot-pattern", lotPattern, &cfg.Form.LotPattern},
+	} {
+		if given[f.name] || *f.setting == "" {
+			*f.setting = *f.flag
+		}
+	}
+	for _, f := range []struct {
+		name          string
+		flag, setting *bool
+	}{
+		{"compress", compress, &cfg.Output.Compress},
+		{"single-qr", singleQR, &cfg.Output.SingleQR},
+		{"label", label, &cfg.Output.Label},
+		{"normalize-names", normalizeNames, &cfg.Output.NormalizeNames},
+		{"ascii-names", asciiNames, &cfg.Output.ASCIINames},
+		{"two-step", twoStep, &cfg.Form.TwoStep},
+	} {
+		if given[f.name] {
+			*f.setting = *f.flag
+		}
+	}
+	if given["drain-timeout"] || cfg.Server.DrainTimeout == 0 {
+		cfg.Server.DrainTimeout = *drainTimeout
+	}
+	if !given["key"] && !given["key-command"] {
+		*keys.file, *keys.command = cfg.Key.File, cfg.Key.Command
+	}
+	if given["key-reload-interval"] || cfg.Key.ReloadInterval == 0 {
+		cfg.Key.ReloadInterval = *keyReload
+	}
+
+	if cfg.Issuer.URL == "" {
+		fs.Usage()
+		return errors.New("-issuer is required")
+	}
+	if (cfg.Server.TLSCert == "") != (cfg.Server.TLSKey == "") {
+		return errors.New("-tls-cert and -tls-key must be given together")
+	}
+	if cfg.Server.ACMEDomain != "" && cfg.Server.TLSCert != "" {
+		return errors.New("-acme-domain cannot be given with -tls-cert")
+	}
+	if cfg.Form.LotPattern != "" {
+		if _, err := regexp.Compile(cfg.Form.LotPattern); err != nil {
+			return fmt.Errorf("-lot-pattern: %w", err)
+		}
+	}
+
+	opts, err := cfg.Options()
+	if err != nil {
+		return err
+	}
+
+	// A key file is reloaded when it changes, into a keyring, so that the
+	// previous keys remain published.
+	var handlers webhandlers.Handlers
+	var keyFile *shcecdsa.KeyFile
+	var ring *keyring.Keyring
+	switch {
+	case *publicKeys != "":
+		if *keys.file != "" || *keys.command != "" {
+			return errors.New("-public-keys cannot be given with -key or -key-command")
+		}
+		pub, err := loadPublicKeys(*publicKeys)
+		if err != nil {
+			return err
+		}
+		handlers = webhandlers.NewVerifier(cfg.Issuer.URL, pub, opts...)
+	case *keys.file != "" && *keys.command == "":
+		if keyFile, err = shcecdsa.OpenKeyFile(*keys.file); err != nil {
+			return err
+		}
+		if err := jws.SelfTest(keyFile.Key()); err != nil {
+			return err
+		}
+		ring = keyring.New(keyFile.Key())
+		handlers = webhandlers.NewWithKeyring(ring, cfg.Issuer.URL, opts...)
+	default:
+		key, err := keys.load()
+		if err != nil {
+			return err
+		}
+		if err := jws.SelfTest(key); err != nil {
+			return err
+		}
+		handlers = webhandlers.New(key, cfg.Issuer.URL, opts...)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		log.Printf("shutting down, waiting up to %s for in-flight requests", cfg.Server.DrainTimeout)
+	}()
+
+	if keyFile != nil {
+		go keyFile.Watch(ctx, cfg.Key.ReloadInterval, func(key *ecdsa.PrivateKey, err error) {
+			if err == nil {
+				err = jws.SelfTest(key)
+			}
+			if err != nil {
+				log.Printf("reloading the signing key: %v; still signing with the previous key", err)
+				return
+			}
+			log.Printf("reloaded the signing key %s", ring.Activate(key).ID)
+		})
+	}
+
+	if cfg.Server.DebugAddr != "" {
+		debug := &http.Server{Addr: cfg.Server.DebugAddr, Handler: server.DebugHandler()}
+		log.Printf("serving profiles and variables over HTTP on %s", cfg.Server.DebugAddr)
+		go func() {
+			if err := server.Graceful(ctx, debug, debug.ListenAndServe, cfg.Server.DrainTimeout); err != nil {
+				log.Printf("serving profiles and variables: %v", err)
+			}
+		}()
+	}
+
+	if cfg.Server.ACMEDomain != "" {
+		log.Printf("serving %s over HTTPS with certificates for %s from Let's Encrypt", cfg.Issuer.URL, cfg.Server.ACMEDomain)
+		m := server.NewCertManager(cfg.Server.ACMECache, cfg.Server.ACMEDomain)
+		return server.ListenAndServeTLSContext(ctx, handlers.Handler(), m, cfg.Server.DrainTimeout)
+	}
+
+	s := server.New(handlers.Handler(), nil)
+	s.Addr = cfg.Server.Addr
+	serve := s.ListenAndServe
+	if cfg.Server.TLSCert != "" {
+		serve = func() error { return s.ListenAndServeTLS(cfg.Server.TLSCert, cfg.Server.TLSKey) }
+		log.Printf("serving %s over HTTPS on %s", cfg.Issuer.URL, cfg.Server.Addr)
+	} else {
+		log.Printf("serving %s over HTTP on %s", cfg.Issuer.URL, cfg.Server.Addr)
+	}
+	return server.Graceful(ctx, s, serve, cfg.Server.DrainTimeout)
+}
+
+// loadPublicKeys reads the public keys of the JWKS file at the given path,
+// in the order of their kids.
+func loadPublicKeys(path string) ([]*ecdsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	set, err := verifier.ParseJWKS(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(set) == 0 {
+		return nil, fmt.Errorf("%s: no ECDSA P-256 keys", path)
+	}
+
+	kids := make([]string, 0, len(set))
+	for kid := range set {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+	keys := make([]*ecdsa.PublicKey, len(kids))
+	for i, kid := range kids {
+		keys[i] = set[kid]
+	}
+	return keys, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/verifier"
+)
+
+func runSnapshot(args []string) error {
+	fs := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	out := fs.String("out", "-", `file to write the snapshot to, or "-" for standard output`)
+	timeout := fs.Duration("timeout", 30*time.Second, "timeout for fetching all the issuers' JWKS")
+	keys := addKeyFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: shc snapshot [flags] ISSUER...")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Fetches the JWKS of each ISSUER URL and writes them, signed with the given key,")
+		fmt.Fprintln(fs.Output(), "to a single file with which \"shc verify -snapshot\" verifies cards offline.")
+		fmt.Fprintln(fs.Output(), "Unless -key or -key-command is given, the signing key is read from the")
+		fmt.Fprintln(fs.Output(), "SMART_HEALTH_CARDS_KEY_D, _X, and _Y environment variables.")
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no issuers given")
+	}
+
+	key, err := keys.load()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	snapshot, err := verifier.FetchSnapshot(ctx, nil, fs.Args()...)
+	if err != nil {
+		return err
+	}
+
+	signed, err := snapshot.Sign(key)
+	if err != nil {
+		return err
+	}
+	return writeOutput(*out, "", signed)
+}
+
+// loadSnapshot loads the keys of a snapshot written by "shc snapshot",
+// verifying it with the key in the given file, as loaded by
+// loadVerificationKey.
+func loadSnapshot(path, keyPath string) (verifier.KeySource, error) {
+	if keyPath == "" {
+		return nil, errors.New("-snapshot-key must be given along with -snapshot")
+	}
+	snapshotKey, err := loadVerificationKey(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := readInput(path)
+	if err != nil {
+		return nil, err
+	}
+	snapshot, err := verifier.LoadSnapshot(context.Background(), data, snapshotKey)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return snapshot.Keys()
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/qrcode"
+	"github.com/amitkgupta/go-smarthealthcards/v2/store"
+	"github.com/amitkgupta/go-smarthealthcards/v2/summary"
+	"github.com/amitkgupta/go-smarthealthcards/v2/verifier"
+)
+
+func runVerify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	keyPath := fs.String("key", "", "file holding the issuer's key, as a JWKS, a JWK, or a PEM public or private key; by default the issuer's JWKS is fetched from its URL")
+	snapshotPath := fs.String("snapshot", "", `file holding a snapshot of issuers' JWKS, as written by "shc snapshot", with which to verify cards offline`)
+	snapshotKeyPath := fs.String("snapshot-key", "", "file holding the key which signed the -snapshot, as a JWKS, a JWK, or a PEM public or private key")
+	timeout := fs.Duration("timeout", 10*time.Second, "timeout for fetching the issuer's JWKS")
+	issuers := fs.String("trusted-issuers", "", "comma-separated issuer URLs of the only cards to accept; by default cards from any issuer are accepted")
+	clockSkew := fs.Duration("clock-skew", time.Minute, "how far the issuer's clock may be ahead of, or behind, this one when checking when cards are valid")
+	maxAge := fs.Duration("max-age", 0, "how long ago cards may have been issued; by default cards of any age are accepted")
+	rootsPath := fs.String("trusted-roots", "", "PEM file of the root certificates of a trust framework, to which the x5c certificate chains of issuers' keys, if published, must verify")
+	types := fs.String("require-types", "", "comma-separated verifiable credential types, e.g. https://smarthealth.cards#immunization, which cards must have")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: shc verify [flags] FILE...")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), `Each FILE, or "-" for standard input, holds a JWS, a .smart-health-card file,`)
+		fmt.Fprintln(fs.Output(), "shc:/ strings one per line, or a QR code image. The QR codes and shc:/ strings")
+		fmt.Fprintln(fs.Output(), "of all the files are reassembled into a single card.")
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no files given")
+	}
+
+	var keys verifier.KeySource = verifier.IssuerJWKS{}
+	switch {
+	case *keyPath != "" && *snapshotPath != "":
+		return errors.New("only one of -key and -snapshot may be given")
+	case *keyPath != "":
+		var err error
+		if keys, err = loadVerificationKey(*keyPath); err != nil {
+			return err
+		}
+	case *snapshotPath != "":
+		var err error
+		if keys, err = loadSnapshot(*snapshotPath, *snapshotKeyPath); err != nil {
+			return err
+		}
+	}
+
+	policy := verifier.VerifyOptions{
+		Issuers:       splitList(*issuers),
+		ClockSkew:     *clockSkew,
+		MaxAge:        *maxAge,
+		RequiredTypes: splitList(*types),
+	}
+	if *rootsPath != "" {
+		data, err := os.ReadFile(*rootsPath)
+		if err != nil {
+			return err
+		}
+		policy.TrustedRoots = x509.NewCertPool()
+		if !policy.TrustedRoots.AppendCertsFromPEM(data) {
+			return fmt.Errorf("%s: no PEM certificates found", *rootsPath)
+		}
+	}
+
+	var healthCardJWSs, shcStrings []string
+	for _, path := range fs.Args() {
+		data, err := readInput(path)
+		if err != nil {
+			return err
+		}
+
+		trimmed := strings.TrimSpace(string(data))
+		switch {
+		case isImage(data):
+			s, err := readQRCode(data)
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			shcStrings = append(shcStrings, s)
+		case strings.HasPrefix(trimmed, "{"):
+			jwss, err := verifier.ParseFile(data)
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			healthCardJWSs = append(healthCardJWSs, jwss...)
+		case strings.HasPrefix(trimmed, "shc:/"):
+			shcStrings = append(shcStrings, strings.Fields(trimmed)...)
+		default:
+			healthCardJWSs = append(healthCardJWSs, trimmed)
+		}
+	}
+
+	if len(shcStrings) > 0 {
+		healthCardJWS, err := qrcode.DecodeStrings(shcStrings)
+		if err != nil {
+			return err
+		}
+		healthCardJWSs = append(healthCardJWSs, healthCardJWS)
+	}
+
+	failed := 0
+	for i, healthCardJWS := range healthCardJWSs {
+		if i > 0 {
+			fmt.Println()
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		card, err := verifier.VerifyWithOptions(ctx, healthCardJWS, keys, policy)
+		cancel()
+		if errors.Is(err, verifier.ErrMalformed) {
+			fmt.Printf("Signature:     FAIL (%v)\n", err)
+			failed++
+			continue
+		}
+
+		printCard(card)
+		fmt.Printf("Card hash:     %s\n", store.CardHash(healthCardJWS))
+		switch {
+		case errors.Is(err, verifier.ErrUntrustedIssuer):
+			fmt.Printf("Policy:        FAIL (%v)\n", err)
+			failed++
+		case errors.Is(err, verifier.ErrRejected):
+			fmt.Println("Signature:     PASS")
+			fmt.Printf("Policy:        FAIL (%v)\n", err)
+			failed++
+		case err != nil:
+			fmt.Printf("Signature:     FAIL (%v)\n", err)
+			failed++
+		default:
+			fmt.Println("Signature:     PASS")
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d cards failed verification", failed, len(healthCardJWSs))
+	}
+	return nil
+}
+
+// splitList splits a comma-separated flag value, ignoring empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func printCard(card verifier.Card) {
+	fmt.Printf("Issuer:        %s\n", card.Issuer)
+	fmt.Printf("Key ID:        %s\n", card.KeyID)
+	fmt.Printf("Issued:        %s\n", card.NotBefore.UTC().Format(time.RFC3339))
+	if !card.Expires.IsZero() {
+		fmt.Printf("Expires:       %s\n", card.Expires.UTC().Format(time.RFC3339))
+	}
+
+	name := card.FHIRBundle.Patient.Name
+	fmt.Printf("Patient:       %s\n", summary.Name(name))
+	fmt.Printf("Date of birth: %s\n", formatDate(card.FHIRBundle.Patient.BirthDate))
+
+	for i, immunization := range card.FHIRBundle.Immunizations {
+		fmt.Printf("Immunization:  %s\n", summary.Dose(i, immunization))
+	}
+
+	for _, cert := range card.Certificates {
+		fmt.Printf("Certificate:   %s (expires %s)\n", cert.Subject, cert.NotAfter.UTC().Format(time.RFC3339))
+	}
+}
+
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return "unknown"
+	}
+	return t.Format("2006-01-02")
+}
+
+func isImage(data []byte) bool {
+	_, _, err := image.DecodeConfig(bytes.NewReader(data))
+	return err == nil
+}
+
+// loadVerificationKey loads a KeySource from a file holding a JWKS, a
+// single JWK such as one written by "shc keygen -format jwk", or a PEM
+// public or private key. A single key is used regardless of the card's
+// kid.
+func loadVerificationKey(path string) (verifier.KeySource, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if block, _ := pem.Decode(data); block != nil {
+		var key any
+		switch block.Type {
+		case "PUBLIC KEY":
+			key, err = x509.ParsePKIXPublicKey(block.Bytes)
+		case "PRIVATE KEY":
+			key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		case "EC PRIVATE KEY":
+			key, err = x509.ParseECPrivateKey(block.Bytes)
+		default:
+			return nil, fmt.Errorf("%s: unsupported PEM block %q", path, block.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		var pub *ecdsa.PublicKey
+		switch k := key.(type) {
+		case *ecdsa.PublicKey:
+			pub = k
+		case *ecdsa.PrivateKey:
+			pub = &k.PublicKey
+		default:
+			return nil, fmt.Errorf("%s: not an ECDSA key", path)
+		}
+		return verifier.KeySourceFunc(func(context.Context, string, string) (*ecdsa.PublicKey, error) {
+			return pub, nil
+		}), nil
+	}
+
+	var probe struct {
+		KeyType string `json:"kty"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, fmt.Errorf("%s: not a JWKS, JWK, or PEM key", path)
+	}
+	if probe.KeyType != "" {
+		data = []byte(`{"keys":[` + string(data) + `]}`)
+	}
+
+	keys, err := verifier.ParseJWKS(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s: no P-256 keys found", path)
+	}
+	return keys, nil
+}
@@ -0,0 +1,388 @@
+// Package config loads the configuration of an issuance server, e.g. the
+// one run by "shc serve", from a YAML or TOML file, with overrides from
+// environment variables, so that deployments need not pass long lists of
+// flags:
+//
+//	issuer:
+//	  url: https://example.com
+//	  name: Example Health
+//	key:
+//	  file: /run/secrets/shc-key.pem
+//	output:
+//	  compress: true
+//	cors:
+//	  allowed_origins: [https://clinic.example.com]
+//	  max_age: 10m
+//	rate_limit:
+//	  per_second: 5
+//	  burst: 10
+//
+// Each key can be overridden by the environment variable named by EnvPrefix
+// followed by the key's path in upper case with dots replaced by
+// underscores, e.g. SHC_ISSUER_URL or SHC_RATE_LIMIT_PER_SECOND; lists are
+// comma-separated.
+//
+// Only the subsets of YAML and TOML needed for such files are supported:
+// nested mappings or tables of strings, numbers, booleans, and lists of
+// strings.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix is the prefix of the environment variables overriding
+// configuration keys.
+const EnvPrefix = "SHC_"
+
+// Config is the configuration of an issuance server.
+type Config struct {
+	Issuer    Issuer    `config:"issuer"`
+	Server    Server    `config:"server"`
+	Key       Key       `config:"key"`
+	Output    Output    `config:"output"`
+	Form      Form      `config:"form"`
+	CORS      CORS      `config:"cors"`
+	RateLimit RateLimit `config:"rate_limit"`
+}
+
+// Issuer describes the issuer on whose behalf cards are issued.
+type Issuer struct {
+	// URL is the issuer URL, the "iss" value of its cards.
+	URL string `config:"url"`
+
+	// Name, LogoURL, Website, and Contact are served as display metadata
+	// for wallet apps, if Name is given.
+	Name    string `config:"name"`
+	LogoURL string `config:"logo"`
+	Website string `config:"website"`
+	Contact string `config:"contact"`
+}
+
+// Server describes how the handlers are served.
+type Server struct {
+	// Addr is the address to listen on, e.g. ":8080".
+	Addr string `config:"addr"`
+
+	// TLSCert and TLSKey are files holding the TLS certificate chain and
+	// private key, in PEM form, to serve HTTPS.
+	TLSCert string `config:"tls_cert"`
+	TLSKey  string `config:"tls_key"`
+
+	// ACMEDomain, if given instead of TLSCert and TLSKey, is the domain,
+	// e.g. the host of the issuer URL, for which to obtain certificates
+	// from Let's Encrypt, as with server.NewCertManager, caching them in
+	// the ACMECache directory, "acme-cache" by default.
+	ACMEDomain string `config:"acme_domain"`
+	ACMECache  string `config:"acme_cache"`
+
+	// DrainTimeout is how long in-flight requests may take to complete on
+	// shutdown, as with server.Graceful.
+	DrainTimeout time.Duration `config:"drain_timeout"`
+
+	// DebugAddr is the address, e.g. "localhost:6060", on which to serve
+	// runtime profiles and variables, as with server.DebugHandler; they
+	// are not served if it is empty.
+	DebugAddr string `config:"debug_addr"`
+}
+
+// Key describes where the signing key is loaded from: a file, or the output
+// of a command, e.g. one fetching it from a secrets manager or KMS. If
+// neither is given, it is read from the SMART_HEALTH_CARDS_KEY_D, _X, and
+// _Y environment variables.
+type Key struct {
+	File    string `config:"file"`
+	Command string `config:"command"`
+
+	// ReloadInterval, if positive, is how often the file is checked for a
+	// new key, as with (*ecdsa.KeyFile).Watch.
+	ReloadInterval time.Duration `config:"reload_interval"`
+}
+
+// Output describes the cards issued.
+type Output struct {
+	// Compress compresses responses, as with webhandlers.CompressResponses.
+	Compress bool `config:"compress"`
+
+	// SingleQR rejects cards needing more than one QR code, as with
+	// webhandlers.SingleQROnly.
+	SingleQR bool `config:"single_qr"`
+
+	// Label labels QR code PNGs, as with webhandlers.LabelQRCodes.
+	Label bool `config:"label"`
+
+	// NormalizeNames and ASCIINames normalize patients' names, as with
+	// webhandlers.NormalizeNames.
+	NormalizeNames bool `config:"normalize_names"`
+	ASCIINames     bool `config:"ascii_names"`
+
+	// Bucket, e.g. "s3://bucket/cards/" or "gs://bucket/cards/", is where
+	// the cards of CSV batches are written, as with webhandlers.OutputSink
+	// and sink.FromURL, in place of the response.
+	Bucket string `config:"bucket"`
+
+	// QRForeground and QRBackground, as "#rgb" or "#rrggbb", QRShape, as
+	// "square", "rounded", or "dots", and QRLogo, a PNG or JPEG file,
+	// style QR code PNGs, as with webhandlers.QRStyle.
+	QRForeground string `config:"qr_foreground"`
+	QRBackground string `config:"qr_background"`
+	QRShape      string `config:"qr_shape"`
+	QRLogo       string `config:"qr_logo"`
+}
+
+// Form describes how form data is validated.
+type Form struct {
+	// Performers is a file listing the known immunization performers, one
+	// per line, as with webhandlers.Performers.
+	Performers string `config:"performers"`
+
+	// TwoStep issues cards only after review, as with
+	// webhandlers.TwoStepIssuance.
+	TwoStep bool `config:"two_step"`
+
+	// LotPattern is a regular expression which lot numbers must match, as
+	// with webhandlers.LotNumberPattern.
+	LotPattern string `config:"lot_pattern"`
+}
+
+// CORS is the policy applied to cross-origin requests, as with
+// webhandlers.CORS, if any origins are allowed.
+type CORS struct {
+	AllowedOrigins   []string      `config:"allowed_origins"`
+	AllowedMethods   []string      `config:"allowed_methods"`
+	AllowedHeaders   []string      `config:"allowed_headers"`
+	AllowCredentials bool          `config:"allow_credentials"`
+	MaxAge           time.Duration `config:"max_age"`
+}
+
+// RateLimit limits the rate of requests, as with webhandlers.RateLimit, if
+// PerSecond is positive.
+type RateLimit struct {
+	PerSecond float64 `config:"per_second"`
+
+	// Burst is the number of requests allowed at once; the default is 1.
+	Burst int `config:"burst"`
+
+	// Header is the request header by which requests are grouped, e.g.
+	// "X-Api-Key"; by default they are grouped by the client's IP address.
+	Header string `config:"header"`
+}
+
+// Format is a configuration file format.
+type Format string
+
+// Supported configuration file formats.
+const (
+	YAML Format = "yaml"
+	TOML Format = "toml"
+)
+
+// FormatOf returns the format of the file with the given path, by its
+// extension: ".yaml" or ".yml" for YAML, and ".toml" for TOML.
+func FormatOf(path string) (Format, bool) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return YAML, true
+	case ".toml":
+		return TOML, true
+	}
+	return "", false
+}
+
+// Load reads the configuration file with the given path, in the format
+// given by its extension, and applies the overrides of the process's
+// environment variables.
+func Load(path string) (Config, error) {
+	format, ok := FormatOf(path)
+	if !ok {
+		return Config{}, fmt.Errorf("config: %s: unknown format; use .yaml, .yml, or .toml", path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("config: %w", err)
+	}
+
+	c, err := Parse(data, format, os.LookupEnv)
+	if err != nil {
+		return Config{}, fmt.Errorf("config: %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Parse parses configuration in the given format, and applies the
+// overrides of the environment variables looked up with the given
+// function, e.g. os.LookupEnv, if it is not nil.
+func Parse(data []byte, format Format, lookupEnv func(string) (string, bool)) (Config, error) {
+	var values map[string]value
+	var err error
+	switch format {
+	case YAML:
+		values, err = parseYAML(string(data))
+	case TOML:
+		values, err = parseTOML(string(data))
+	default:
+		return Config{}, fmt.Errorf("unknown format %q", format)
+	}
+	if err != nil {
+		return Config{}, err
+	}
+
+	var c Config
+	fields := map[string]reflect.Value{}
+	collectFields(reflect.ValueOf(&c).Elem(), "", fields)
+
+	for key, v := range values {
+		field, ok := fields[key]
+		if !ok {
+			return Config{}, fmt.Errorf("unknown key %q", key)
+		}
+		if err := set(field, v); err != nil {
+			return Config{}, fmt.Errorf("%s: %w", key, err)
+		}
+	}
+
+	if lookupEnv != nil {
+		for key, field := range fields {
+			name := EnvName(key)
+			s, ok := lookupEnv(name)
+			if !ok {
+				continue
+			}
+			if err := set(field, envValue(field, s)); err != nil {
+				return Config{}, fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	}
+
+	if err := c.validate(); err != nil {
+		return Config{}, err
+	}
+	return c, nil
+}
+
+// EnvName returns the name of the environment variable overriding the
+// given key, e.g. SHC_RATE_LIMIT_PER_SECOND for "rate_limit.per_second".
+func EnvName(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+func (c Config) validate() error {
+	if c.Key.File != "" && c.Key.Command != "" {
+		return errors.New("only one of key.file and key.command may be given")
+	}
+	if (c.Server.TLSCert == "") != (c.Server.TLSKey == "") {
+		return errors.New("server.tls_cert and server.tls_key must be given together")
+	}
+	if c.Server.ACMEDomain != "" && c.Server.TLSCert != "" {
+		return errors.New("server.acme_domain cannot be given with server.tls_cert")
+	}
+	if c.Form.LotPattern != "" {
+		if _, err := regexp.Compile(c.Form.LotPattern); err != nil {
+			return fmt.Errorf("form.lot_pattern: %w", err)
+		}
+	}
+	if c.Server.DrainTimeout < 0 {
+		return errors.New("server.drain_timeout: must not be negative")
+	}
+	if c.Key.ReloadInterval < 0 {
+		return errors.New("key.reload_interval: must not be negative")
+	}
+	if c.RateLimit.PerSecond < 0 || c.RateLimit.Burst < 0 {
+		return errors.New("rate_limit: must not be negative")
+	}
+	if _, err := c.Output.qrStyle(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// value is the value of a key in a configuration file: a scalar, as text,
+// or a list of scalars.
+type value struct {
+	scalar string
+	list   []string
+	isList bool
+}
+
+// collectFields records the settable fields of the given struct, and of
+// the structs nested in it, by their dotted keys.
+func collectFields(v reflect.Value, prefix string, fields map[string]reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		key := prefix + t.Field(i).Tag.Get("config")
+		if f := v.Field(i); f.Kind() == reflect.Struct {
+			collectFields(f, key+".", fields)
+		} else {
+			fields[key] = f
+		}
+	}
+}
+
+// envValue returns the value given by an environment variable for the
+// given field, splitting lists on commas.
+func envValue(field reflect.Value, s string) value {
+	if field.Kind() != reflect.Slice {
+		return value{scalar: s}
+	}
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return value{list: list, isList: true}
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func set(field reflect.Value, v value) error {
+	if field.Kind() == reflect.Slice {
+		if !v.isList {
+			v.list = []string{v.scalar}
+		}
+		field.Set(reflect.ValueOf(append([]string(nil), v.list...)))
+		return nil
+	}
+	if v.isList {
+		return errors.New("must not be a list")
+	}
+
+	switch {
+	case field.Type() == durationType:
+		d, err := time.ParseDuration(v.scalar)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+	case field.Kind() == reflect.String:
+		field.SetString(v.scalar)
+	case field.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(v.scalar)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", v.scalar)
+		}
+		field.SetBool(b)
+	case field.Kind() == reflect.Int:
+		n, err := strconv.Atoi(strings.ReplaceAll(v.scalar, "_", ""))
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", v.scalar)
+		}
+		field.SetInt(int64(n))
+	case field.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(strings.ReplaceAll(v.scalar, "_", ""), 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", v.scalar)
+		}
+		field.SetFloat(f)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/qrcode"
+	"github.com/amitkgupta/go-smarthealthcards/v2/sink"
+	"github.com/amitkgupta/go-smarthealthcards/v2/verifier"
+	"github.com/amitkgupta/go-smarthealthcards/v2/webhandlers"
+)
+
+// Options returns the webhandlers options configured by c, reading the file
+// of known performers if one is given. The signing key, issuer URL, and
+// server settings are left to the caller.
+func (c Config) Options() ([]webhandlers.Option, error) {
+	var opts []webhandlers.Option
+
+	if c.Issuer.Name != "" {
+		opts = append(opts, webhandlers.IssuerMetadata(map[string]verifier.IssuerMetadata{
+			c.Issuer.URL: {Name: c.Issuer.Name, LogoURL: c.Issuer.LogoURL, Website: c.Issuer.Website, Contact: c.Issuer.Contact},
+		}))
+	}
+
+	if c.Output.Compress {
+		opts = append(opts, webhandlers.CompressResponses())
+	}
+	opts = append(opts, webhandlers.RejectMultiChunk(c.Output.SingleQR))
+	if c.Output.Label {
+		opts = append(opts, webhandlers.LabelQRCodes())
+	}
+	if c.Output.NormalizeNames || c.Output.ASCIINames {
+		opts = append(opts, webhandlers.NormalizeNames(c.Output.ASCIINames))
+	}
+
+	style, err := c.Output.qrStyle()
+	if err != nil {
+		return nil, err
+	}
+	if c.Output.QRLogo != "" {
+		f, err := os.Open(c.Output.QRLogo)
+		if err != nil {
+			return nil, err
+		}
+		style.Logo, _, err = image.Decode(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("output.qr_logo: %w", err)
+		}
+	}
+	opts = append(opts, webhandlers.QRStyle(style))
+
+	if c.Output.Bucket != "" {
+		s, err := sink.FromURL(c.Output.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, webhandlers.OutputSink(s))
+	}
+
+	if c.Form.Performers != "" {
+		data, err := os.ReadFile(c.Form.Performers)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, webhandlers.Performers(strings.Split(string(data), "\n")))
+	}
+	if c.Form.TwoStep {
+		opts = append(opts, webhandlers.TwoStepIssuance(nil, 0))
+	}
+	if c.Form.LotPattern != "" {
+		pattern, err := regexp.Compile(c.Form.LotPattern)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, webhandlers.LotNumberPattern(pattern))
+	}
+
+	if len(c.CORS.AllowedOrigins) > 0 {
+		opts = append(opts, webhandlers.CORS(webhandlers.CORSPolicy{
+			AllowedOrigins:   c.CORS.AllowedOrigins,
+			AllowedMethods:   c.CORS.AllowedMethods,
+			AllowedHeaders:   c.CORS.AllowedHeaders,
+			AllowCredentials: c.CORS.AllowCredentials,
+			MaxAge:           c.CORS.MaxAge,
+		}))
+	}
+
+	if c.RateLimit.PerSecond > 0 {
+		burst := c.RateLimit.Burst
+		if burst == 0 {
+			burst = 1
+		}
+		var key webhandlers.RateLimitKey = webhandlers.ByRemoteIP
+		if c.RateLimit.Header != "" {
+			key = webhandlers.ByHeader(c.RateLimit.Header)
+		}
+		opts = append(opts, webhandlers.RateLimit(webhandlers.NewRateLimiter(c.RateLimit.PerSecond, burst, key)))
+	}
+
+	return opts, nil
+}
+
+// qrStyle returns the style of QR codes configured by o, without its logo.
+func (o Output) qrStyle() (qrcode.Style, error) {
+	var style qrcode.Style
+	var err error
+	if o.QRForeground != "" {
+		if style.Foreground, err = qrcode.ParseColor(o.QRForeground); err != nil {
+			return qrcode.Style{}, fmt.Errorf("output.qr_foreground: %w", err)
+		}
+	}
+	if o.QRBackground != "" {
+		if style.Background, err = qrcode.ParseColor(o.QRBackground); err != nil {
+			return qrcode.Style{}, fmt.Errorf("output.qr_background: %w", err)
+		}
+	}
+	if style.Shape, err = qrcode.ParseModuleShape(o.QRShape); err != nil {
+		return qrcode.Style{}, fmt.Errorf("output.qr_shape: %w", err)
+	}
+	if err := style.Validate(); err != nil {
+		return qrcode.Style{}, fmt.Errorf("output.qr_foreground, output.qr_background: %w", err)
+	}
+	return style, nil
+}
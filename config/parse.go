@@ -0,0 +1,319 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseYAML parses the subset of YAML described in the package
+// documentation into values by their dotted keys: block mappings nested by
+// indentation, whose values are scalars, flow sequences such as "[a, b]",
+// or block sequences of scalars.
+func parseYAML(data string) (map[string]value, error) {
+	type mapping struct {
+		indent int
+		prefix string
+	}
+	values := map[string]value{}
+	stack := []mapping{{indent: -1}}
+
+	// list is the key of the last mapping entry without a value, whose
+	// value may be a block sequence, and listIndent its indentation.
+	list, listIndent := "", 0
+
+	for n, line := range strings.Split(data, "\n") {
+		lineErr := func(err error) error {
+			return fmt.Errorf("line %d: %w", n+1, err)
+		}
+
+		line = strings.TrimRight(stripComment(line), " \t\r")
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, lineErr(errors.New("tabs must not be used for indentation"))
+		}
+		indent := len(line) - len(trimmed)
+
+		if trimmed == "-" || strings.HasPrefix(trimmed, "- ") {
+			if list == "" || indent < listIndent {
+				return nil, lineErr(errors.New("unexpected sequence entry"))
+			}
+			item, err := yamlScalar(strings.TrimSpace(trimmed[1:]))
+			if err != nil {
+				return nil, lineErr(err)
+			}
+			v := values[list]
+			v.list, v.isList = append(v.list, item), true
+			values[list] = v
+			continue
+		}
+
+		for len(stack) > 1 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		list = ""
+
+		k, rest, ok := cutKey(trimmed, ':')
+		if !ok || (rest != "" && rest[0] != ' ') {
+			return nil, lineErr(errors.New(`expected "key: value"`))
+		}
+		name, err := yamlScalar(k)
+		if err != nil {
+			return nil, lineErr(err)
+		}
+		key := stack[len(stack)-1].prefix + name
+		if _, ok := values[key]; ok {
+			return nil, lineErr(fmt.Errorf("duplicate key %q", key))
+		}
+
+		rest = strings.TrimSpace(rest)
+		switch {
+		case rest == "":
+			stack = append(stack, mapping{indent: indent, prefix: key + "."})
+			list, listIndent = key, indent
+		case rest == "~" || rest == "null":
+		case strings.HasPrefix(rest, "["):
+			items, err := flowList(rest, yamlScalar)
+			if err != nil {
+				return nil, lineErr(err)
+			}
+			values[key] = value{list: items, isList: true}
+		default:
+			s, err := yamlScalar(rest)
+			if err != nil {
+				return nil, lineErr(err)
+			}
+			values[key] = value{scalar: s}
+		}
+	}
+	return values, nil
+}
+
+// yamlScalar returns the text of a plain, single-quoted, or double-quoted
+// YAML scalar.
+func yamlScalar(s string) (string, error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		return strconv.Unquote(s)
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return "", fmt.Errorf("unterminated string %s", s)
+		}
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	case strings.HasPrefix(s, "{"), strings.HasPrefix(s, "&"), strings.HasPrefix(s, "*"),
+		strings.HasPrefix(s, "|"), strings.HasPrefix(s, ">"):
+		return "", fmt.Errorf("unsupported value %s", s)
+	}
+	return s, nil
+}
+
+// parseTOML parses the subset of TOML described in the package
+// documentation into values by their dotted keys: tables, and key/value
+// pairs whose values are strings, numbers, booleans, or arrays of them,
+// which may span lines.
+func parseTOML(data string) (map[string]value, error) {
+	values := map[string]value{}
+	prefix := ""
+
+	lines := strings.Split(data, "\n")
+	for n := 0; n < len(lines); n++ {
+		lineErr := func(err error) error {
+			return fmt.Errorf("line %d: %w", n+1, err)
+		}
+
+		line := strings.TrimSpace(stripComment(lines[n]))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if strings.HasPrefix(line, "[[") || !strings.HasSuffix(line, "]") {
+				return nil, lineErr(fmt.Errorf("unsupported table header %s", line))
+			}
+			table, err := tomlKey(line[1 : len(line)-1])
+			if err != nil {
+				return nil, lineErr(err)
+			}
+			prefix = table + "."
+			continue
+		}
+
+		k, rest, ok := cutKey(line, '=')
+		if !ok {
+			return nil, lineErr(errors.New(`expected "key = value"`))
+		}
+		name, err := tomlKey(k)
+		if err != nil {
+			return nil, lineErr(err)
+		}
+		key := prefix + name
+		if _, ok := values[key]; ok {
+			return nil, lineErr(fmt.Errorf("duplicate key %q", key))
+		}
+
+		rest = strings.TrimSpace(rest)
+		if strings.HasPrefix(rest, "[") {
+			start := n
+			for !balanced(rest) {
+				if n++; n == len(lines) {
+					return nil, fmt.Errorf("line %d: unterminated array", start+1)
+				}
+				rest += " " + strings.TrimSpace(stripComment(lines[n]))
+			}
+			items, err := flowList(rest, tomlScalar)
+			if err != nil {
+				return nil, lineErr(err)
+			}
+			values[key] = value{list: items, isList: true}
+			continue
+		}
+
+		s, err := tomlScalar(rest)
+		if err != nil {
+			return nil, lineErr(err)
+		}
+		values[key] = value{scalar: s}
+	}
+	return values, nil
+}
+
+// tomlKey returns the dotted form of a bare, quoted, or dotted TOML key.
+func tomlKey(s string) (string, error) {
+	var parts []string
+	for _, part := range splitOutsideQuotes(s, '.') {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			return "", fmt.Errorf("invalid key %q", s)
+		}
+		p, err := tomlScalar(part)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, p)
+	}
+	return strings.Join(parts, "."), nil
+}
+
+// tomlScalar returns the text of a TOML basic or literal string, or of
+// another scalar, such as a number or boolean, as written.
+func tomlScalar(s string) (string, error) {
+	switch {
+	case strings.HasPrefix(s, `"""`), strings.HasPrefix(s, "'''"), strings.HasPrefix(s, "{"):
+		return "", fmt.Errorf("unsupported value %s", s)
+	case strings.HasPrefix(s, `"`):
+		return strconv.Unquote(s)
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return "", fmt.Errorf("unterminated string %s", s)
+		}
+		return s[1 : len(s)-1], nil
+	case s == "":
+		return "", errors.New("missing value")
+	}
+	return s, nil
+}
+
+// flowList returns the items of a single-line list such as "[a, 'b']",
+// each parsed with the given function.
+func flowList(s string, scalar func(string) (string, error)) ([]string, error) {
+	if !strings.HasSuffix(s, "]") {
+		return nil, fmt.Errorf("unterminated list %s", s)
+	}
+	items := []string{}
+	for _, item := range splitOutsideQuotes(s[1:len(s)-1], ',') {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		if strings.HasPrefix(item, "[") {
+			return nil, errors.New("nested lists are not supported")
+		}
+		v, err := scalar(item)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+	}
+	return items, nil
+}
+
+// stripComment removes a comment, starting with "#" outside a quoted
+// string, from the end of a line.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// cutKey splits a line at the first separator outside a quoted string.
+func cutKey(line string, sep byte) (key, rest string, ok bool) {
+	parts := splitOutsideQuotes(line, sep)
+	if len(parts) < 2 {
+		return "", "", false
+	}
+	key = strings.TrimSpace(parts[0])
+	return key, line[len(parts[0])+1:], key != ""
+}
+
+// splitOutsideQuotes splits s at each separator outside a quoted string.
+func splitOutsideQuotes(s string, sep byte) []string {
+	var parts []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// balanced reports whether the brackets outside quoted strings in s are
+// balanced.
+func balanced(s string) bool {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		}
+	}
+	return depth <= 0
+}
@@ -0,0 +1,151 @@
+// Package conformance checks SMART Health Cards, and this module's encoding
+// of them, against reference examples: the examples published with the
+// specification at https://spec.smarthealth.cards/examples/, and golden
+// examples generated by this module which catch regressions in encoding
+// details such as base64url padding, DEFLATE framing, and chunk prefixes.
+package conformance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/jws"
+	"github.com/amitkgupta/go-smarthealthcards/v2/qrcode"
+	"github.com/amitkgupta/go-smarthealthcards/v2/verifier"
+)
+
+// Example is a reference health card in each of the forms in which the
+// specification publishes its examples.
+type Example struct {
+	// Name identifies the example, e.g. "example-00".
+	Name string
+
+	// JWKS is the JSON Web Key Set of the example's issuer.
+	JWKS []byte
+
+	// JWS is the compact serialization of the card's JSON Web Signature.
+	JWS string
+
+	// File is the contents of a .smart-health-card file holding the JWS,
+	// if any.
+	File []byte
+
+	// SHCStrings are the numeric "shc:/" strings of the card's QR codes,
+	// one per chunk.
+	SHCStrings []string
+}
+
+// JWKSPath is where LoadExample looks for the issuer's JWKS, as in the
+// specification's examples directory.
+const JWKSPath = "issuer/.well-known/jwks.json"
+
+// LoadExample reads the example with the given name from a directory laid
+// out like https://spec.smarthealth.cards/examples/, i.e. holding
+// "<name>-d-jws.txt", optionally "<name>-e-file.smart-health-card", and
+// "<name>-f-qr-code-numeric-value-0.txt", "-1.txt", and so on, along with
+// the issuer's JWKS at JWKSPath.
+func LoadExample(fsys fs.FS, name string) (Example, error) {
+	ex := Example{Name: name}
+
+	var err error
+	if ex.JWKS, err = fs.ReadFile(fsys, JWKSPath); err != nil {
+		return Example{}, err
+	}
+
+	jws, err := fs.ReadFile(fsys, name+"-d-jws.txt")
+	if err != nil {
+		return Example{}, err
+	}
+	ex.JWS = strings.TrimSpace(string(jws))
+
+	if ex.File, err = fs.ReadFile(fsys, name+"-e-file.smart-health-card"); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return Example{}, err
+	}
+
+	for i := 0; ; i++ {
+		shc, err := fs.ReadFile(fsys, fmt.Sprintf("%s-f-qr-code-numeric-value-%d.txt", name, i))
+		if errors.Is(err, fs.ErrNotExist) && i > 0 {
+			break
+		}
+		if err != nil {
+			return Example{}, err
+		}
+		ex.SHCStrings = append(ex.SHCStrings, strings.TrimSpace(string(shc)))
+	}
+
+	return ex, nil
+}
+
+// LoadExamples reads every example in the given directory, as by
+// LoadExample.
+func LoadExamples(fsys fs.FS) ([]Example, error) {
+	paths, err := fs.Glob(fsys, "*-d-jws.txt")
+	if err != nil {
+		return nil, err
+	}
+
+	examples := make([]Example, len(paths))
+	for i, p := range paths {
+		if examples[i], err = LoadExample(fsys, strings.TrimSuffix(path.Base(p), "-d-jws.txt")); err != nil {
+			return nil, err
+		}
+	}
+	return examples, nil
+}
+
+// Check checks that the given example verifies and round-trips through
+// this module: its JWS is unpadded base64url, is signed by a key in its
+// JWKS, whose kids are the thumbprints computed by jws.KeyID, and is held
+// by its .smart-health-card file; and its "shc:/" strings decode to the
+// JWS and are exactly those which this module encodes for it. It returns
+// all of the failed checks, joined.
+func Check(ctx context.Context, ex Example) error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: "+format, append([]any{ex.Name}, args...)...))
+	}
+
+	if strings.ContainsAny(ex.JWS, "=+/") {
+		fail("JWS is not unpadded base64url")
+	}
+
+	if keys, err := verifier.ParseJWKS(ex.JWKS); err != nil {
+		fail("invalid JWKS: %v", err)
+	} else {
+		if _, err := verifier.Verify(ctx, ex.JWS, keys); err != nil {
+			fail("JWS does not verify: %v", err)
+		}
+		for kid, key := range keys {
+			if jws.KeyID(key) != kid {
+				fail("kid %q in JWKS is not the RFC 7638 thumbprint of its key", kid)
+			}
+		}
+	}
+
+	if ex.File != nil {
+		if jwss, err := verifier.ParseFile(ex.File); err != nil {
+			fail("invalid .smart-health-card file: %v", err)
+		} else if !slices.Equal(jwss, []string{ex.JWS}) {
+			fail(".smart-health-card file does not hold the JWS")
+		}
+	}
+
+	if jws, err := qrcode.DecodeStrings(ex.SHCStrings); err != nil {
+		fail("invalid shc:/ strings: %v", err)
+	} else if jws != ex.JWS {
+		fail("shc:/ strings do not decode to the JWS")
+	}
+
+	if shcStrings, err := qrcode.EncodeToStrings(ex.JWS); err != nil {
+		fail("encoding shc:/ strings: %v", err)
+	} else if !slices.Equal(shcStrings, ex.SHCStrings) {
+		fail("encoded %d shc:/ strings which differ from the example's %d", len(shcStrings), len(ex.SHCStrings))
+	}
+
+	return errors.Join(errs...)
+}
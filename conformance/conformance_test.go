@@ -0,0 +1,66 @@
+package conformance
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCheckGolden(t *testing.T) {
+	if err := CheckGolden(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCheckSpec(t *testing.T) {
+	err := CheckSpec(context.Background())
+	if errors.Is(err, ErrNoSpecExamples) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	examples, err := Golden()
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := map[string]Example{}
+	for _, ex := range examples {
+		byName[ex.Name] = ex
+	}
+
+	tests := []struct {
+		name    string
+		example string
+		mutate  func(*Example)
+		wantErr string
+	}{
+		{"padded JWS", "example-00", func(ex *Example) { ex.JWS += "=" }, "not unpadded base64url"},
+		{
+			"chunk prefix on a single chunk", "example-00",
+			func(ex *Example) { ex.SHCStrings[0] = strings.Replace(ex.SHCStrings[0], "shc:/", "shc:/1/1/", 1) },
+			"differ from the example's",
+		},
+		{"missing chunk", "example-01", func(ex *Example) { ex.SHCStrings = ex.SHCStrings[:1] }, "invalid shc:/ strings"},
+		{"file of another JWS", "example-00", func(ex *Example) { ex.File = byName["example-01"].File }, "does not hold the JWS"},
+		{"JWKS of another key", "example-00", func(ex *Example) { ex.JWKS = []byte(`{"keys":[]}`) }, "does not verify"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ex := byName[tt.example]
+			ex.SHCStrings = append([]string(nil), ex.SHCStrings...)
+			if err := Check(context.Background(), ex); err != nil {
+				t.Fatalf("unmodified %s: %v", ex.Name, err)
+			}
+
+			tt.mutate(&ex)
+			if err := Check(context.Background(), ex); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
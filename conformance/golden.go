@@ -0,0 +1,186 @@
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"slices"
+	"time"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/fhirbundle"
+	"github.com/amitkgupta/go-smarthealthcards/v2/issuer"
+	"github.com/amitkgupta/go-smarthealthcards/v2/jws"
+)
+
+// The golden examples are issued by GoldenIssuer at GoldenTime with the
+// key returned by GoldenKey. The key is public; never use it to issue real
+// cards.
+const GoldenIssuer = "https://example.com/issuer"
+
+// GoldenTime is the issuance time of the golden examples.
+var GoldenTime = time.Date(2021, time.June, 1, 0, 0, 0, 0, time.UTC)
+
+// GoldenKey returns the key which signed the golden examples.
+func GoldenKey() *ecdsa.PrivateKey {
+	d, _ := new(big.Int).SetString("07e3818c95c36210b6139bb7ef385d0be1c1e7d9fabfa11535fe7e5ab2569619", 16)
+	key := &ecdsa.PrivateKey{D: d}
+	key.Curve = elliptic.P256()
+	key.X, key.Y = key.Curve.ScalarBaseMult(d.FillBytes(make([]byte, 32)))
+	return key
+}
+
+// goldenBundles are the FHIR bundles of the golden examples: a card which
+// fits in a single QR code and one which needs two.
+var goldenBundles = map[string]fhirbundle.FHIRBundle{
+	"example-00": {
+		Patient: fhirbundle.Patient{
+			Name:      fhirbundle.Name{Family: "Salk", Givens: []string{"Jonas"}},
+			BirthDate: time.Date(1914, time.October, 28, 0, 0, 0, 0, time.UTC),
+		},
+		Immunizations: []fhirbundle.Immunization{
+			{
+				DatePerformed: time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC),
+				Performer:     "MyLocalHospital",
+				LotNumber:     "LN01234",
+				VaccineType:   fhirbundle.Pfizer,
+			},
+			{
+				DatePerformed: time.Date(2021, time.January, 29, 0, 0, 0, 0, time.UTC),
+				Performer:     "MyLocalHospital",
+				LotNumber:     "LN56789",
+				VaccineType:   fhirbundle.Pfizer,
+			},
+		},
+	},
+	"example-01": {
+		Patient: fhirbundle.Patient{
+			Name: fhirbundle.Name{
+				Family: "Montagu-Wortley-Pierrepont",
+				Givens: []string{"Mary", "Wilhelmina", "Anastasia", "Konstantinopoulou"},
+			},
+			BirthDate: time.Date(1689, time.May, 15, 0, 0, 0, 0, time.UTC),
+		},
+		Immunizations: []fhirbundle.Immunization{
+			{
+				DatePerformed: time.Date(2021, time.March, 2, 0, 0, 0, 0, time.UTC),
+				Performer:     "Kingston General Hospital Mass Vaccination Clinic, Building A",
+				LotNumber:     "MOD-2021-03-0001-XYZ",
+				VaccineType:   fhirbundle.Moderna,
+			},
+			{
+				DatePerformed: time.Date(2021, time.April, 6, 0, 0, 0, 0, time.UTC),
+				Performer:     "Queen's University Pharmacy Pop-Up Clinic, Student Life Centre",
+				LotNumber:     "MOD-2021-04-0002-ABC",
+				VaccineType:   fhirbundle.Moderna,
+			},
+			{
+				DatePerformed: time.Date(2021, time.November, 15, 0, 0, 0, 0, time.UTC),
+				Performer:     "Shoppers Drug Mart #1234, 123 Princess Street, Kingston, Ontario",
+				LotNumber:     "PFZ-2021-11-0003-DEF",
+				VaccineType:   fhirbundle.Pfizer,
+			},
+			{
+				DatePerformed: time.Date(2022, time.September, 20, 0, 0, 0, 0, time.UTC),
+				Performer:     "Rexall Pharmacy #5678, 456 Bath Road, Kingston, Ontario",
+				LotNumber:     "MOD-2022-09-0004-GHI",
+				VaccineType:   fhirbundle.Moderna,
+			},
+			{
+				DatePerformed: time.Date(2023, time.October, 12, 0, 0, 0, 0, time.UTC),
+				Performer:     "Loblaw Pharmacy Wellness Clinic, 1100 Princess Street, Kingston",
+				LotNumber:     "PFZ-2023-10-0005-JKL",
+				VaccineType:   fhirbundle.Pfizer,
+			},
+			{
+				DatePerformed: time.Date(2024, time.November, 4, 0, 0, 0, 0, time.UTC),
+				Performer:     "Providence Care Hospital Community Immunization Program",
+				LotNumber:     "MOD-2024-11-0006-MNO",
+				VaccineType:   fhirbundle.Moderna,
+			},
+		},
+	},
+}
+
+//go:embed all:golden
+var golden embed.FS
+
+// Golden returns the golden examples, which were issued by this module with
+// GoldenKey at GoldenTime using deterministic signatures.
+func Golden() ([]Example, error) {
+	fsys, err := fs.Sub(golden, "golden")
+	if err != nil {
+		return nil, err
+	}
+	return LoadExamples(fsys)
+}
+
+// CheckGolden checks the kids of reference keys with CheckKeyIDs, each
+// golden example with Check, and that reissuing it with this module yields
+// it exactly. Since the golden examples are this module's own output, they
+// catch changes to it, but not encoding errors it always made; CheckSpec
+// checks the specification's examples for those. Since compress/flate does
+// not promise identical output across Go releases, a mismatched JWS after
+// upgrading Go calls for a look at the DEFLATE stream before regenerating
+// the examples.
+func CheckGolden(ctx context.Context) error {
+	examples, err := Golden()
+	if err != nil {
+		return err
+	}
+	if len(examples) != len(goldenBundles) {
+		return fmt.Errorf("found %d golden examples, want %d", len(examples), len(goldenBundles))
+	}
+
+	var errs []error
+	if err := CheckKeyIDs(); err != nil {
+		errs = append(errs, err)
+	}
+	for _, ex := range examples {
+		if err := Check(ctx, ex); err != nil {
+			errs = append(errs, err)
+		}
+
+		card, err := reissue(ctx, ex.Name)
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Errorf("%s: %w", ex.Name, err))
+		case card.JWS != ex.JWS:
+			errs = append(errs, fmt.Errorf("%s: reissued JWS differs", ex.Name))
+		case !slices.Equal(card.SHCStrings, ex.SHCStrings):
+			errs = append(errs, fmt.Errorf("%s: reissued shc:/ strings differ", ex.Name))
+		case !bytes.Equal(card.File, ex.File):
+			errs = append(errs, fmt.Errorf("%s: reissued .smart-health-card file differs", ex.Name))
+		}
+	}
+
+	jwks, err := jws.JWKSJSON(GoldenKey())
+	if err != nil {
+		return err
+	}
+	if len(examples) > 0 && !bytes.Equal(jwks, bytes.TrimSpace(examples[0].JWKS)) {
+		errs = append(errs, errors.New("JWKS of GoldenKey differs"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// reissue issues the card of the golden example with the given name.
+func reissue(ctx context.Context, name string) (issuer.Card, error) {
+	fb, ok := goldenBundles[name]
+	if !ok {
+		return issuer.Card{}, fmt.Errorf("unknown golden example %q", name)
+	}
+
+	i := issuer.New(GoldenKey(), GoldenIssuer,
+		issuer.WithoutPNGs(),
+		issuer.Deterministic(),
+		issuer.Clock(func() time.Time { return GoldenTime }),
+	)
+	return i.Issue(ctx, fb)
+}
@@ -0,0 +1,90 @@
+// Command fetchspec downloads the examples published with the SMART Health
+// Cards specification into the given directory, laid out as
+// conformance.LoadExamples expects. It is run by go generate in the
+// conformance package:
+//
+//	go run ./internal/fetchspec spec
+//
+// The -base flag gives another URL from which to download them, e.g. that
+// of a mirror.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var baseURL = flag.String("base", "https://spec.smarthealth.cards/examples/", "URL of the examples directory")
+
+// examples are the names of the specification's examples.
+var examples = []string{"example-00", "example-01", "example-02"}
+
+// errNotFound is returned by fetch for a file which does not exist.
+var errNotFound = errors.New("not found")
+
+var client = &http.Client{Timeout: 30 * time.Second}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("fetchspec: ")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		log.Fatal("usage: fetchspec [-base url] <directory>")
+	}
+	dir := flag.Arg(0)
+
+	if err := fetch(dir, "issuer/.well-known/jwks.json"); err != nil {
+		log.Fatal(err)
+	}
+	for _, name := range examples {
+		if err := fetch(dir, name+"-d-jws.txt"); err != nil {
+			log.Fatal(err)
+		}
+		if err := fetch(dir, name+"-e-file.smart-health-card"); err != nil && !errors.Is(err, errNotFound) {
+			log.Fatal(err)
+		}
+		for i := 0; ; i++ {
+			err := fetch(dir, fmt.Sprintf("%s-f-qr-code-numeric-value-%d.txt", name, i))
+			if errors.Is(err, errNotFound) && i > 0 {
+				break
+			}
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+}
+
+// fetch downloads the file with the given path relative to the base URL
+// into the same path relative to dir.
+func fetch(dir, name string) error {
+	resp, err := client.Get(strings.TrimSuffix(*baseURL, "/") + "/" + name)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%s: %w", name, errNotFound)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: unexpected status %s", name, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
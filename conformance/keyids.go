@@ -0,0 +1,55 @@
+package conformance
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/jws"
+)
+
+// referenceKeys are public keys along with the kids published for them
+// independently of this module.
+var referenceKeys = []struct {
+	name, x, y, kid string
+}{
+	{
+		name: "https://spec.smarthealth.cards/examples/jwks.json",
+		x:    "11XvRWy1I2S0EyJlyf_bWfw_TQ5CJJNLw78bHXNxcgw",
+		y:    "eZXwxvO1hvCY0KucrPfKo7yAyMT6Ajc3N7OkAB6VYy8",
+		kid:  specKeyID,
+	},
+}
+
+// CheckKeyIDs checks that jws.KeyID computes the published kids of
+// reference keys, such as the specification's example issuer key, and that
+// jws.LegacyKeyID agrees with it, so that the kids of keys already in use
+// do not change. It returns all of the failed checks, joined.
+func CheckKeyIDs() error {
+	var errs []error
+	for _, ref := range referenceKeys {
+		x, errX := base64.RawURLEncoding.DecodeString(ref.x)
+		y, errY := base64.RawURLEncoding.DecodeString(ref.y)
+		if errX != nil || errY != nil {
+			errs = append(errs, fmt.Errorf("%s: invalid coordinates", ref.name))
+			continue
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+
+		if kid := jws.KeyID(key); kid != ref.kid {
+			errs = append(errs, fmt.Errorf("%s: computed kid %q, want %q", ref.name, kid, ref.kid))
+		}
+		if kid := jws.LegacyKeyID(key); kid != ref.kid {
+			errs = append(errs, fmt.Errorf("%s: computed legacy kid %q, want %q", ref.name, kid, ref.kid))
+		}
+	}
+
+	golden := &GoldenKey().PublicKey
+	if jws.KeyID(golden) != jws.LegacyKeyID(golden) {
+		errs = append(errs, errors.New("GoldenKey: kid differs from its legacy kid"))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,70 @@
+package conformance
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/verifier"
+)
+
+//go:generate go run ./internal/fetchspec spec
+
+// specKeyID is the kid of the key which signed the specification's
+// examples.
+const specKeyID = "3Kfdg-XwP-7gXyywtUfUADwBumDOPKMQx-iELL11W9s"
+
+// ErrNoSpecExamples is returned by CheckSpec if the specification's
+// examples have not been vendored.
+var ErrNoSpecExamples = errors.New("the specification's examples are not vendored; run go generate in the conformance package")
+
+//go:embed all:spec
+var spec embed.FS
+
+// Spec returns the examples published with the specification at
+// https://spec.smarthealth.cards/examples/, as vendored into the spec
+// directory of this package by go generate.
+func Spec() ([]Example, error) {
+	fsys, err := fs.Sub(spec, "spec")
+	if err != nil {
+		return nil, err
+	}
+	return LoadExamples(fsys)
+}
+
+// CheckSpec checks each of the specification's examples with Check, and
+// that it is signed by the specification's example issuer key. Unlike the
+// golden examples, these were not produced by this module, so they catch
+// regressions in its encoding which its own output would share. It returns
+// ErrNoSpecExamples if they have not been vendored, and otherwise all of
+// the failed checks, joined.
+func CheckSpec(ctx context.Context) error {
+	examples, err := Spec()
+	if err != nil {
+		return err
+	}
+	if len(examples) == 0 {
+		return ErrNoSpecExamples
+	}
+
+	var errs []error
+	for _, ex := range examples {
+		if err := Check(ctx, ex); err != nil {
+			errs = append(errs, err)
+		}
+
+		keys, err := verifier.ParseJWKS(ex.JWKS)
+		if err != nil {
+			continue // reported by Check
+		}
+		if _, ok := keys[specKeyID]; !ok {
+			errs = append(errs, fmt.Errorf("%s: JWKS does not hold the specification's key %s", ex.Name, specKeyID))
+		}
+		if card, _ := verifier.Verify(ctx, ex.JWS, keys); card.KeyID != specKeyID {
+			errs = append(errs, fmt.Errorf("%s: JWS is signed by %q, not the specification's key", ex.Name, card.KeyID))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,21 @@
+package dcc
+
+const base45Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ $%*+-./:"
+
+// base45 encodes data as per RFC 9285, as required for the alphanumeric
+// mode QR codes of EU Digital COVID Certificates.
+func base45(data []byte) string {
+	out := make([]byte, 0, (len(data)/2)*3+2)
+
+	for i := 0; i+1 < len(data); i += 2 {
+		n := int(data[i])<<8 | int(data[i+1])
+		out = append(out, base45Alphabet[n%45], base45Alphabet[(n/45)%45], base45Alphabet[n/(45*45)])
+	}
+
+	if len(data)%2 == 1 {
+		n := int(data[len(data)-1])
+		out = append(out, base45Alphabet[n%45], base45Alphabet[n/45])
+	}
+
+	return string(out)
+}
@@ -0,0 +1,101 @@
+package dcc
+
+import (
+	"fmt"
+	"math"
+)
+
+// The DCC payload and its COSE envelope only require a small subset of CBOR
+// (RFC 8949), so this file implements just enough of an encoder for them.
+
+// cborMap is a CBOR map whose entries are encoded in the given order.
+type cborMap []cborEntry
+
+type cborEntry struct {
+	key   interface{}
+	value interface{}
+}
+
+// cborTag is a CBOR tagged data item.
+type cborTag struct {
+	number  uint64
+	content interface{}
+}
+
+const (
+	majorUnsigned = 0
+	majorNegative = 1
+	majorBytes    = 2
+	majorText     = 3
+	majorArray    = 4
+	majorMap      = 5
+	majorTag      = 6
+)
+
+func cborMarshal(v interface{}) ([]byte, error) {
+	return cborAppend(nil, v)
+}
+
+func cborAppend(b []byte, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case int:
+		return cborAppendInt(b, int64(v)), nil
+	case int64:
+		return cborAppendInt(b, v), nil
+	case string:
+		b = cborAppendHead(b, majorText, uint64(len(v)))
+		return append(b, v...), nil
+	case []byte:
+		b = cborAppendHead(b, majorBytes, uint64(len(v)))
+		return append(b, v...), nil
+	case []interface{}:
+		b = cborAppendHead(b, majorArray, uint64(len(v)))
+		for _, item := range v {
+			var err error
+			if b, err = cborAppend(b, item); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case cborMap:
+		b = cborAppendHead(b, majorMap, uint64(len(v)))
+		for _, entry := range v {
+			var err error
+			if b, err = cborAppend(b, entry.key); err != nil {
+				return nil, err
+			}
+			if b, err = cborAppend(b, entry.value); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case cborTag:
+		b = cborAppendHead(b, majorTag, v.number)
+		return cborAppend(b, v.content)
+	}
+
+	return nil, fmt.Errorf("cannot encode %T as CBOR", v)
+}
+
+func cborAppendInt(b []byte, n int64) []byte {
+	if n < 0 {
+		return cborAppendHead(b, majorNegative, uint64(-1-n))
+	}
+	return cborAppendHead(b, majorUnsigned, uint64(n))
+}
+
+func cborAppendHead(b []byte, major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return append(b, major<<5|byte(n))
+	case n <= math.MaxUint8:
+		return append(b, major<<5|24, byte(n))
+	case n <= math.MaxUint16:
+		return append(b, major<<5|25, byte(n>>8), byte(n))
+	case n <= math.MaxUint32:
+		return append(b, major<<5|26, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(b, major<<5|27,
+		byte(n>>56), byte(n>>48), byte(n>>40), byte(n>>32),
+		byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
@@ -0,0 +1,255 @@
+// Package dcc converts the same core relevant data used for SMART Health
+// Cards into an EU Digital COVID Certificate (DCC): a CBOR Web Token signed
+// with COSE, compressed, Base45-encoded, prefixed with "HC1:", and embedded
+// in a QR code. See
+// https://ec.europa.eu/health/sites/default/files/ehealth/docs/digital-green-certificates_v3_en.pdf
+// and
+// https://ec.europa.eu/health/sites/default/files/ehealth/docs/covid-certificate_json_specification_en.pdf.
+package dcc
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	qrcode "github.com/skip2/go-qrcode"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/fhirbundle"
+)
+
+const schemaVersion = "1.3.0"
+
+// Config holds the issuing authority's identity and signing key.
+type Config struct {
+	// Country is the ISO 3166-1 alpha-2 code of the issuing country, e.g.
+	// "DE".
+	Country string
+
+	// Issuer is the name of the certificate issuer, e.g. a ministry of
+	// health.
+	Issuer string
+
+	// Key is the ECDSA P-256 private key of the issuer's Document Signer
+	// Certificate (DSC), and KeyID is the DSC's key identifier, see
+	// KeyIDFromCertificate.
+	Key   *ecdsa.PrivateKey
+	KeyID []byte
+
+	// CertificateID is the unique vaccination certificate identifier
+	// (UVCI), e.g. "URN:UVCI:01:DE:...". If empty, a random one is
+	// generated.
+	CertificateID string
+
+	// Validity is how long the certificate is valid after issuance; it
+	// defaults to one year.
+	Validity time.Duration
+
+	// Now returns the issuance time; it defaults to time.Now.
+	Now func() time.Time
+}
+
+// KeyIDFromCertificate returns the key identifier of a Document Signer
+// Certificate, i.e. the first 8 bytes of the SHA-256 hash of its DER
+// encoding.
+func KeyIDFromCertificate(cert *x509.Certificate) []byte {
+	sum := sha256.Sum256(cert.Raw)
+	return sum[:8]
+}
+
+// Encode takes the core relevant data for an FHIR bundle representing a
+// patient's COVID-19 immunizations and returns the "HC1:" string of the
+// corresponding EU Digital COVID Certificate. The certificate records the
+// most recent immunization in the bundle, with the number of immunizations
+// in the bundle as its dose number.
+func Encode(fb fhirbundle.FHIRBundle, c Config) (string, error) {
+	if c.Key == nil || len(c.KeyID) == 0 {
+		return "", errors.New("signing key and key ID are required")
+	}
+	if len(fb.Immunizations) == 0 {
+		return "", errors.New("at least one immunization is required")
+	}
+
+	hcert, err := certificate(fb, c)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now
+	if c.Now != nil {
+		now = c.Now
+	}
+	validity := c.Validity
+	if validity == 0 {
+		validity = 365 * 24 * time.Hour
+	}
+	issuedAt := now()
+
+	claims, err := cborMarshal(cborMap{
+		{1, strings.ToUpper(c.Country)},
+		{4, issuedAt.Add(validity).Unix()},
+		{6, issuedAt.Unix()},
+		{-260, cborMap{{1, hcert}}},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	cose, err := sign(claims, c.Key, c.KeyID)
+	if err != nil {
+		return "", err
+	}
+
+	buf := new(bytes.Buffer)
+	zw, err := zlib.NewWriterLevel(buf, zlib.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := zw.Write(cose); err != nil {
+		return "", err
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+
+	return "HC1:" + base45(buf.Bytes()), nil
+}
+
+// QRCode encodes the "HC1:" string of an EU Digital COVID Certificate, as
+// returned by Encode, as a QR code in PNG format.
+func QRCode(hc1 string) ([]byte, error) {
+	q, err := qrcode.New(hc1, qrcode.High)
+	if err != nil {
+		return nil, err
+	}
+
+	return q.PNG(512)
+}
+
+// sign wraps the payload in a COSE_Sign1 structure signed with ES256. See
+// https://datatracker.ietf.org/doc/html/rfc8152#section-4.2.
+func sign(payload []byte, key *ecdsa.PrivateKey, kid []byte) ([]byte, error) {
+	protected, err := cborMarshal(cborMap{{1, -7}, {4, kid}})
+	if err != nil {
+		return nil, err
+	}
+
+	sigStructure, err := cborMarshal([]interface{}{"Signature1", protected, []byte{}, payload})
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256(sigStructure)
+	r, s, err := ecdsa.Sign(rand.Reader, key, hash[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return cborMarshal(cborTag{
+		number:  18,
+		content: []interface{}{protected, cborMap{}, payload, append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)},
+	})
+}
+
+func certificate(fb fhirbundle.FHIRBundle, c Config) (cborMap, error) {
+	latest := fb.Immunizations[len(fb.Immunizations)-1]
+
+	product, ok := products[latest.VaccineType]
+	if !ok {
+		return nil, fmt.Errorf("unsupported vaccine type %q", latest.VaccineType)
+	}
+
+	seriesDoses := product.seriesDoses
+	if len(fb.Immunizations) > seriesDoses {
+		seriesDoses = len(fb.Immunizations)
+	}
+
+	certificateID := c.CertificateID
+	if certificateID == "" {
+		id := make([]byte, 15)
+		if _, err := rand.Read(id); err != nil {
+			return nil, err
+		}
+		certificateID = fmt.Sprintf("URN:UVCI:01:%s:%s", strings.ToUpper(c.Country), base32.StdEncoding.EncodeToString(id))
+	}
+
+	givens := strings.Join(fb.Patient.Name.Givens, " ")
+
+	return cborMap{
+		{"ver", schemaVersion},
+		{"nam", cborMap{
+			{"fn", fb.Patient.Name.Family},
+			{"fnt", transliterate(fb.Patient.Name.Family)},
+			{"gn", givens},
+			{"gnt", transliterate(givens)},
+		}},
+		{"dob", fb.Patient.BirthDate.Format("2006-01-02")},
+		{"v", []interface{}{
+			cborMap{
+				{"tg", "840539006"},
+				{"vp", product.prophylaxis},
+				{"mp", product.medicinalProduct},
+				{"ma", product.marketingAuthorizationHolder},
+				{"dn", len(fb.Immunizations)},
+				{"sd", seriesDoses},
+				{"dt", latest.DatePerformed.Format("2006-01-02")},
+				{"co", strings.ToUpper(c.Country)},
+				{"is", c.Issuer},
+				{"ci", certificateID},
+			},
+		}},
+	}, nil
+}
+
+type product struct {
+	prophylaxis                  string
+	medicinalProduct             string
+	marketingAuthorizationHolder string
+	seriesDoses                  int
+}
+
+// products maps each supported vaccine type to the corresponding values of
+// the DCC value sets. See https://github.com/ehn-dcc-development/ehn-dcc-valuesets.
+var products = map[fhirbundle.VaccineType]product{
+	fhirbundle.Pfizer:            {"1119349007", "EU/1/20/1528", "ORG-100030215", 2},
+	fhirbundle.Moderna:           {"1119349007", "EU/1/20/1507", "ORG-100031184", 2},
+	fhirbundle.JohnsonAndJohnson: {"J07BX03", "EU/1/20/1525", "ORG-100001417", 1},
+	fhirbundle.AstraZeneca:       {"J07BX03", "EU/1/21/1529", "ORG-100001699", 2},
+	fhirbundle.Sinopharm:         {"J07BX03", "BBIBP-CorV", "ORG-100020693", 2},
+	fhirbundle.COVAXIN:           {"J07BX03", "Covaxin", "Bharat-Biotech", 2},
+}
+
+// transliterate returns the ICAO 9303 machine-readable form of a name, as
+// required for the "fnt" and "gnt" fields: uppercase A-Z, with separators
+// replaced by "<".
+func transliterate(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(strings.TrimSpace(name)) {
+		switch {
+		case r >= 'A' && r <= 'Z':
+			b.WriteRune(r)
+		case r == ' ' || r == '-' || r == '\'' || r == ',':
+			b.WriteByte('<')
+		default:
+			b.WriteString(icaoTransliterations[r])
+		}
+	}
+	return b.String()
+}
+
+var icaoTransliterations = map[rune]string{
+	'À': "A", 'Á': "A", 'Â': "A", 'Ã': "A", 'Ä': "AE", 'Å': "AA", 'Æ': "AE",
+	'Ç': "C", 'È': "E", 'É': "E", 'Ê': "E", 'Ë': "E", 'Ì': "I", 'Í': "I",
+	'Î': "I", 'Ï': "I", 'Ð': "D", 'Ñ': "N", 'Ò': "O", 'Ó': "O", 'Ô': "O",
+	'Õ': "O", 'Ö': "OE", 'Ø': "OE", 'Ù': "U", 'Ú': "U", 'Û': "U", 'Ü': "UE",
+	'Ý': "Y", 'Þ': "TH", 'ß': "SS", 'Ł': "L", 'Ś': "S", 'Ź': "Z", 'Ż': "Z",
+	'Č': "C", 'Ć': "C", 'Ř': "R", 'Š': "S", 'Ž': "Z", 'Ě': "E", 'Ů': "U",
+	'Ő': "OE", 'Ű': "UE", 'Œ': "OE",
+}
@@ -0,0 +1,153 @@
+// Package delivery emails patients their SMART Health Cards, attaching the
+// QR code PNG(s) and a .smart-health-card file. Messages can be sent with
+// any SMTP server, including the SMTP interface of Amazon SES, or with any
+// other Sender. See https://spec.smarthealth.cards/#via-file-download.
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/fhirbundle"
+	"github.com/amitkgupta/go-smarthealthcards/v2/issuer"
+	"github.com/amitkgupta/go-smarthealthcards/v2/qrcode"
+	"github.com/amitkgupta/go-smarthealthcards/v2/summary"
+)
+
+// Message is an email message.
+type Message struct {
+	To          string
+	Subject     string
+	Body        string
+	Attachments []Attachment
+}
+
+// Attachment is a file attached to an email message.
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Sender sends email messages, e.g. with SMTP or an email service's API.
+type Sender interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// SenderFunc adapts a function to a Sender.
+type SenderFunc func(ctx context.Context, m Message) error
+
+// Send calls f(ctx, m).
+func (f SenderFunc) Send(ctx context.Context, m Message) error {
+	return f(ctx, m)
+}
+
+// TemplateData is the data with which the subject and body templates of a
+// Mailer are executed.
+type TemplateData struct {
+	// Patient is the patient to whom the card was issued.
+	Patient fhirbundle.Patient
+
+	// Name is the patient's given and family names, joined by spaces.
+	Name string
+
+	// Doses is the number of immunizations on the card.
+	Doses int
+
+	// Summary is the contents of the card as plain text, as by
+	// summary.Summary.String.
+	Summary string
+
+	// Chunks is the number of QR codes attached.
+	Chunks int
+}
+
+// DefaultSubject and DefaultBody are the templates used by a Mailer without
+// its own templates.
+var (
+	DefaultSubject = template.Must(template.New("subject").Parse(`Your SMART Health Card`))
+	DefaultBody    = template.Must(template.New("body").Parse(`Hello {{.Name}},
+
+Your SMART Health Card is attached.
+{{- if eq .Chunks 1}} Scan the attached QR code{{else}} Scan all {{.Chunks}} attached QR codes{{end}} with your phone's camera, or open the attached .smart-health-card file on your phone, to add it to a health or wallet app.
+
+{{.Summary}}`))
+)
+
+// Mailer emails SMART Health Cards to patients.
+type Mailer struct {
+	// Sender sends the messages.
+	Sender Sender
+
+	// Subject and Body are the templates for the subject and body of each
+	// message, executed with a TemplateData; they default to
+	// DefaultSubject and DefaultBody.
+	Subject *template.Template
+	Body    *template.Template
+}
+
+// DeliverCard emails the card with the given JWS, issued for the given FHIR
+// bundle, to the given address. The QR code PNG(s) of the card, as returned
+// by qrcode.Encode, are attached along with a .smart-health-card file; if
+// qrPNGs is nil, they are rendered from the JWS.
+func (m Mailer) DeliverCard(ctx context.Context, to string, fb fhirbundle.FHIRBundle, healthCardJWS string, qrPNGs [][]byte) error {
+	if qrPNGs == nil {
+		var err error
+		if qrPNGs, err = qrcode.EncodeContext(ctx, healthCardJWS); err != nil {
+			return err
+		}
+	}
+
+	data := TemplateData{
+		Patient: fb.Patient,
+		Name:    summary.Name(fb.Patient.Name),
+		Doses:   len(fb.Immunizations),
+		Summary: summary.Of(fb).String(),
+		Chunks:  len(qrPNGs),
+	}
+
+	subject, err := execute(m.Subject, DefaultSubject, data)
+	if err != nil {
+		return err
+	}
+	body, err := execute(m.Body, DefaultBody, data)
+	if err != nil {
+		return err
+	}
+
+	file, err := issuer.File(healthCardJWS)
+	if err != nil {
+		return err
+	}
+
+	msg := Message{To: to, Subject: strings.TrimSpace(subject), Body: body}
+	for i, qrPNG := range qrPNGs {
+		filename := "card.png"
+		if len(qrPNGs) > 1 {
+			filename = fmt.Sprintf("card-part-%d-of-%d.png", i+1, len(qrPNGs))
+		}
+		msg.Attachments = append(msg.Attachments, Attachment{Filename: filename, ContentType: "image/png", Data: qrPNG})
+	}
+	msg.Attachments = append(msg.Attachments, Attachment{
+		Filename:    "card.smart-health-card",
+		ContentType: "application/smart-health-card",
+		Data:        file,
+	})
+
+	return m.Sender.Send(ctx, msg)
+}
+
+func execute(t, defaultTemplate *template.Template, data TemplateData) (string, error) {
+	if t == nil {
+		t = defaultTemplate
+	}
+
+	buf := new(bytes.Buffer)
+	if err := t.Execute(buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
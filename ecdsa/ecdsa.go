@@ -1,5 +1,7 @@
 // Package ecdsa loads an ECDSA P-256 private key (*crypto/ecdsa.PrivateKey)
-// from string representations of its key parameters. See
+// from string representations of its key parameters, or from a file in any
+// of the formats in which keys are commonly stored, optionally reloading it
+// when the file changes. See
 // https://spec.smarthealth.cards/#generating-and-resolving-cryptographic-keys.
 package ecdsa
 
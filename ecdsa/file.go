@@ -0,0 +1,254 @@
+package ecdsa
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Names of the environment variables holding the parameters of a key, as
+// written by "shc keygen -format env" and read by ParseKey.
+const (
+	EnvD = "SMART_HEALTH_CARDS_KEY_D"
+	EnvX = "SMART_HEALTH_CARDS_KEY_X"
+	EnvY = "SMART_HEALTH_CARDS_KEY_Y"
+)
+
+// LoadKeyFromFile loads an ECDSA P-256 private key from the file at the
+// given path, in any of the formats accepted by ParseKey.
+func LoadKeyFromFile(path string) (*ecdsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ParseKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return key, nil
+}
+
+// ParseKey parses an ECDSA P-256 private key, detecting its format: a PEM
+// block, of PKCS #8 or SEC 1; a private JSON Web Key; or lines assigning
+// the key's parameters to EnvD, EnvX, and EnvY, as decimal integers, in the
+// form of shell exports or of an env file, e.g.:
+//
+//	export SMART_HEALTH_CARDS_KEY_D=...
+//	export SMART_HEALTH_CARDS_KEY_X=...
+//	export SMART_HEALTH_CARDS_KEY_Y=...
+func ParseKey(data []byte) (*ecdsa.PrivateKey, error) {
+	trimmed := bytes.TrimSpace(data)
+	var key *ecdsa.PrivateKey
+	var err error
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("-----BEGIN")):
+		key, err = parsePEM(trimmed)
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		key, err = parseJWK(trimmed)
+	default:
+		key, err = parseEnv(trimmed)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := key.ECDH(); err != nil {
+		return nil, fmt.Errorf("invalid key: %w", err)
+	}
+	return key, nil
+}
+
+func parsePEM(data []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("invalid PEM block")
+	}
+
+	var key any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok || ecKey.Curve != elliptic.P256() {
+		return nil, errors.New("not an ECDSA P-256 key")
+	}
+	return ecKey, nil
+}
+
+func parseJWK(data []byte) (*ecdsa.PrivateKey, error) {
+	var jwk struct {
+		KeyType string `json:"kty"`
+		Curve   string `json:"crv"`
+		D       string `json:"d"`
+		X       string `json:"x"`
+		Y       string `json:"y"`
+	}
+	if err := json.Unmarshal(data, &jwk); err != nil {
+		return nil, fmt.Errorf("invalid JWK: %w", err)
+	}
+	if jwk.KeyType != "EC" || jwk.Curve != "P-256" || jwk.D == "" {
+		return nil, errors.New("not an ECDSA P-256 private JWK")
+	}
+
+	var params [3]*big.Int
+	for i, s := range []string{jwk.D, jwk.X, jwk.Y} {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWK: %w", err)
+		}
+		params[i] = new(big.Int).SetBytes(b)
+	}
+
+	return &ecdsa.PrivateKey{
+		D: params[0],
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     params[1],
+			Y:     params[2],
+		},
+	}, nil
+}
+
+func parseEnv(data []byte) (*ecdsa.PrivateKey, error) {
+	values := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		if !ok {
+			return nil, errors.New("not a PEM key, JWK, or environment variables")
+		}
+		values[strings.TrimSpace(name)] = strings.Trim(strings.TrimSpace(value), `"'`)
+	}
+
+	d, x, y := values[EnvD], values[EnvX], values[EnvY]
+	if d == "" || x == "" || y == "" {
+		return nil, fmt.Errorf("%s, %s, and %s must all be set", EnvD, EnvX, EnvY)
+	}
+	return LoadKey(d, x, y)
+}
+
+// KeyFile is a signing key loaded from a file, as by LoadKeyFromFile,
+// which can be reloaded while the application is running, e.g. when a key
+// mounted as a Kubernetes secret is rotated. It is safe for concurrent use.
+type KeyFile struct {
+	path string
+
+	mu  sync.Mutex
+	key *ecdsa.PrivateKey
+	sum [sha256.Size]byte
+}
+
+// OpenKeyFile loads the key from the file at the given path.
+func OpenKeyFile(path string) (*KeyFile, error) {
+	f := &KeyFile{path: path}
+	if _, err := f.Reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Key returns the key most recently loaded.
+func (f *KeyFile) Key() *ecdsa.PrivateKey {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.key
+}
+
+// Reload loads the key from the file again, reporting whether its contents
+// changed. If the file cannot be read or parsed, the previous key is kept.
+func (f *KeyFile) Reload() (bool, error) {
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return false, err
+	}
+
+	sum := sha256.Sum256(data)
+	f.mu.Lock()
+	unchanged := f.key != nil && sum == f.sum
+	f.mu.Unlock()
+	if unchanged {
+		return false, nil
+	}
+
+	key, err := ParseKey(data)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", f.path, err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.key, f.sum = key, sum
+	return true, nil
+}
+
+// Watch reloads the key whenever the process receives SIGHUP and, if the
+// interval is positive, whenever the file's contents are found to have
+// changed when checked at that interval, until the context is done. The
+// file is polled, rather than watched for events, because Kubernetes
+// updates secrets by swapping a symbolic link to a directory, which file
+// events on the key's path do not report.
+//
+// After each reload which changes the key, or fails, onReload, if not nil,
+// is called with the new key or with the error, e.g. to activate the key
+// in a keyring, so that cards signed with the previous key can still be
+// verified, or to log the error.
+func (f *KeyFile) Watch(ctx context.Context, interval time.Duration, onReload func(*ecdsa.PrivateKey, error)) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		case <-tick:
+		}
+
+		changed, err := f.Reload()
+		switch {
+		case onReload == nil:
+		case err != nil:
+			onReload(nil, err)
+		case changed:
+			onReload(f.Key(), nil)
+		}
+	}
+}
@@ -26,10 +26,33 @@ func main() {
 		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			switch r.Method {
 			case http.MethodPost:
-				if responseCode, errorMessage, ok := shcWebHandlers.ProcessForm(w, r); !ok {
+				var handler func(http.ResponseWriter, *http.Request) (int, string, bool)
+				switch r.URL.Path {
+				case webhandlers.DefaultRoutes.Preview:
+					handler = shcWebHandlers.PreviewForm
+				case webhandlers.DefaultRoutes.CSV:
+					handler = shcWebHandlers.ProcessCSV
+				case webhandlers.DefaultRoutes.Bundle:
+					handler = shcWebHandlers.ProcessBundle
+				default:
+					handler = shcWebHandlers.ProcessForm
+				}
+
+				if responseCode, errorMessage, ok := handler(w, r); !ok {
+					http.Error(w, errorMessage, responseCode)
+				}
+			case http.MethodOptions:
+				if responseCode, errorMessage, ok := shcWebHandlers.Preflight(w, r); !ok {
 					http.Error(w, errorMessage, responseCode)
 				}
 			case http.MethodGet:
+				if r.URL.Path == webhandlers.DefaultRoutes.OpenAPI {
+					if responseCode, errorMessage, ok := shcWebHandlers.OpenAPIJSON(w); !ok {
+						http.Error(w, errorMessage, responseCode)
+					}
+					return
+				}
+
 				if responseCode, errorMessage, ok := shcWebHandlers.JWKSJSON(w); !ok {
 					http.Error(w, errorMessage, responseCode)
 				}
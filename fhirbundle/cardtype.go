@@ -0,0 +1,104 @@
+package fhirbundle
+
+import (
+	"encoding/json"
+)
+
+// CardType is a type of SMART Health Card, e.g. a COVID-19 immunization
+// record, defined by the verifiable credential types of its cards, the FHIR
+// bundles it holds, and how those bundles are validated. COVID19Immunization
+// and COVID19LabResult are built in; other credential types are added by
+// implementing CardType, along with a Bundle building their FHIR bundles,
+// and registering it with the issuer.CardTypes option. See
+// https://spec.smarthealth.cards/vocabulary/.
+type CardType interface {
+	// Name identifies the card type, e.g. "covid19-immunization".
+	Name() string
+
+	// Types returns the verifiable credential types of the card type's
+	// cards, their "vc.type" value, e.g.
+	// "https://smarthealth.cards#health-card" followed by more specific
+	// types.
+	Types() []string
+
+	// Validate checks that the given JSON is an FHIR bundle of the card
+	// type, e.g. exported from an EHR, which is to be signed directly.
+	Validate(bundle []byte) error
+}
+
+// Bundle is the core relevant data for an FHIR bundle of a CardType, which
+// marshals as the bundle itself, e.g. FHIRBundle or LabResultBundle.
+type Bundle interface {
+	json.Marshaler
+
+	// CardType returns the card type of which the bundle is.
+	CardType() CardType
+}
+
+var (
+	// COVID19Immunization is the type of cards holding an FHIRBundle.
+	COVID19Immunization CardType = cardType{
+		name:     "covid19-immunization",
+		types:    []string{"https://smarthealth.cards#health-card", "https://smarthealth.cards#immunization", "https://smarthealth.cards#covid19"},
+		validate: ValidateJSON,
+	}
+
+	// COVID19LabResult is the type of cards holding a LabResultBundle.
+	COVID19LabResult CardType = cardType{
+		name:     "covid19-lab-result",
+		types:    []string{"https://smarthealth.cards#health-card", "https://smarthealth.cards#laboratory", "https://smarthealth.cards#covid19"},
+		validate: ValidateLabResultJSON,
+	}
+)
+
+// CardTypes returns the built-in card types.
+func CardTypes() []CardType {
+	return []CardType{COVID19Immunization, COVID19LabResult}
+}
+
+type cardType struct {
+	name     string
+	types    []string
+	validate func([]byte) error
+}
+
+func (c cardType) Name() string {
+	return c.name
+}
+
+func (c cardType) Types() []string {
+	return append([]string(nil), c.types...)
+}
+
+func (c cardType) Validate(bundle []byte) error {
+	return c.validate(bundle)
+}
+
+// CardType returns COVID19Immunization.
+func (f FHIRBundle) CardType() CardType {
+	return COVID19Immunization
+}
+
+// NewBundlePayload is like NewJWSPayload, but takes a Bundle of any card
+// type, whose verifiable credential types the payload carries. The names of
+// the patients of the built-in bundle types are normalized as configured by
+// the NormalizeNames and TransliterateNames options.
+func NewBundlePayload(b Bundle, issuer string, opts ...PayloadOption) jwsPayload {
+	o := newPayloadOptions(opts)
+	switch fb := b.(type) {
+	case FHIRBundle:
+		fb.Patient.Name = o.name(fb.Patient.Name)
+		b = fb
+	case LabResultBundle:
+		fb.Patient.Name = o.name(fb.Patient.Name)
+		b = fb
+	}
+	return newJWSPayload(b, issuer, b.CardType().Types(), opts)
+}
+
+// NewBundlePayloadFromJSON is like NewJWSPayloadFromJSON, but takes an FHIR
+// bundle of the given card type, which should first be checked with its
+// Validate method.
+func NewBundlePayloadFromJSON(cardType CardType, bundle json.RawMessage, issuer string, opts ...PayloadOption) jwsPayload {
+	return newJWSPayload(bundle, issuer, cardType.Types(), opts)
+}
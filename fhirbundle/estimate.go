@@ -0,0 +1,30 @@
+package fhirbundle
+
+import (
+	"encoding/json"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/jws"
+)
+
+// EstimateJWSSize returns the length of the JWS of a card issued by the
+// given issuer for the given FHIR bundle, without signing it, so that
+// callers can warn users before issuance that their data will not fit in a
+// single QR code; compare it with qrcode.MaxSingleChunkSize, or pass it to
+// qrcode.ChunkCount.
+func EstimateJWSSize(fb FHIRBundle, issuer string, opts ...PayloadOption) (int, error) {
+	return estimateJWSSize(NewJWSPayload(fb, issuer, opts...))
+}
+
+// EstimateJWSSizeJSON is like EstimateJWSSize, but takes an already
+// constructed FHIR bundle in JSON form.
+func EstimateJWSSizeJSON(bundle json.RawMessage, issuer string, opts ...PayloadOption) (int, error) {
+	return estimateJWSSize(NewJWSPayloadFromJSON(bundle, issuer, opts...))
+}
+
+func estimateJWSSize(jwsPayload jwsPayload) (int, error) {
+	payload, err := json.Marshal(jwsPayload)
+	if err != nil {
+		return 0, err
+	}
+	return jws.EstimateSize(payload)
+}
@@ -1,6 +1,7 @@
 // Package fhirbundle constructs and marshals a (pre-compressed) JWS
 // payload containing an FHIR bundle of information representing
-// COVID-19 immunizations. See
+// COVID-19 immunizations or, with LabResultBundle, COVID-19 laboratory test
+// results; other types of cards can be added as CardTypes. See
 // https://spec.smarthealth.cards/#health-cards-are-encoded-as-compact-serialization-json-web-signatures-jws
 // and
 // https://build.fhir.org/ig/HL7/fhir-shc-vaccination-ig/StructureDefinition-shc-vaccination-bundle-dm.html#tab-snapshot.
@@ -8,6 +9,7 @@ package fhirbundle
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 )
@@ -24,8 +26,35 @@ type verifiableCredentials struct {
 }
 
 type credentialSubject struct {
-	Version string     `json:"fhirVersion"`
-	Bundle  FHIRBundle `json:"fhirBundle"`
+	Version string         `json:"fhirVersion"`
+	Bundle  json.Marshaler `json:"fhirBundle"`
+}
+
+// PayloadOption customizes the JWS payload returned by NewJWSPayload.
+type PayloadOption func(*payloadOptions)
+
+type payloadOptions struct {
+	now                func() time.Time
+	normalizeNames     bool
+	transliterateNames bool
+}
+
+func newPayloadOptions(opts []PayloadOption) payloadOptions {
+	o := payloadOptions{now: time.Now}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithClock sets the function returning the issuance time, recorded as the
+// payload's "nbf" (not before) value, in place of time.Now, so that tests
+// get reproducible payloads and replayed or backdated issuances carry their
+// original time.
+func WithClock(now func() time.Time) PayloadOption {
+	return func(o *payloadOptions) {
+		o.now = now
+	}
 }
 
 // NewJWSPayload returns a struct that can be serialized as JSON
@@ -37,19 +66,27 @@ type credentialSubject struct {
 // bundle representing a patient's COVID-19 immunizations,
 // encapsulated in an FHIRBundle object, and an issuer which
 // is the entity that will JWS, as inputs.
-func NewJWSPayload(fb FHIRBundle, issuer string) jwsPayload {
+func NewJWSPayload(fb FHIRBundle, issuer string, opts ...PayloadOption) jwsPayload {
+	return NewBundlePayload(fb, issuer, opts...)
+}
+
+// NewJWSPayloadFromJSON is like NewJWSPayload, but takes an already
+// constructed FHIR bundle in JSON form, e.g. exported from an EHR, rather
+// than the core relevant data for one. The bundle should first be checked
+// with ValidateJSON.
+func NewJWSPayloadFromJSON(bundle json.RawMessage, issuer string, opts ...PayloadOption) jwsPayload {
+	return NewBundlePayloadFromJSON(COVID19Immunization, bundle, issuer, opts...)
+}
+
+func newJWSPayload(bundle json.Marshaler, issuer string, types []string, opts []PayloadOption) jwsPayload {
 	return jwsPayload{
 		Issuer:    issuer,
-		NotBefore: time.Now().Unix(),
+		NotBefore: newPayloadOptions(opts).now().Unix(),
 		VerifiableCredentials: verifiableCredentials{
-			Type: []string{
-				"https://smarthealth.cards#health-card",
-				"https://smarthealth.cards#immunization",
-				"https://smarthealth.cards#covid19",
-			},
+			Type: types,
 			CredentialSubject: credentialSubject{
 				Version: "4.0.1",
-				Bundle:  fb,
+				Bundle:  bundle,
 			},
 		},
 	}
@@ -57,30 +94,33 @@ func NewJWSPayload(fb FHIRBundle, issuer string) jwsPayload {
 
 // FHIRBundle encapsulates the core relevant data for an FHIR
 // bundle representing a patient's COVID-19 immunizations.
+//
+// It marshals with json.Marshal as the FHIR bundle itself; the struct tags
+// of its fields are those of MarshalModel.
 type FHIRBundle struct {
 	// Patient represents an individual who has received immunizations.
-	Patient
+	Patient `json:"patient" yaml:"patient"`
 
 	// Immunizations represents the immunizations the patient has received.
-	Immunizations []Immunization
+	Immunizations []Immunization `json:"immunizations" yaml:"immunizations"`
 }
 
 // Patient represents an individual who has received immunizations.
 type Patient struct {
 	// Name is the patient's name.
-	Name
+	Name `json:"name" yaml:"name"`
 
 	// BirthDate is the patient's date of birth.
-	BirthDate time.Time
+	BirthDate time.Time `json:"birthDate" yaml:"birthDate"`
 }
 
 // Name represents a patient's name.
 type Name struct {
 	// Family represents the patient's family name.
-	Family string `json:"family"`
+	Family string `json:"family,omitempty" yaml:"family,omitempty"`
 
 	// Givens represents the patient's given names.
-	Givens []string `json:"given"`
+	Givens []string `json:"given,omitempty" yaml:"given,omitempty"`
 }
 
 // Immunization represents one instance of a COVID-19 immunization
@@ -88,19 +128,20 @@ type Name struct {
 type Immunization struct {
 	// DatePerformed represents the date when the immunization was
 	// performed.
-	DatePerformed time.Time
+	DatePerformed time.Time `json:"datePerformed" yaml:"datePerformed"`
 
 	// Performer represents the entity which performed the immunization
-	// such as a particular hospital or health clinic.
-	Performer string
+	// such as a particular hospital or health clinic. It is omitted from
+	// the bundle if empty.
+	Performer string `json:"performer,omitempty" yaml:"performer,omitempty"`
 
 	// LotNumber represents the lot number of the specific batch of the
 	// vaccine that was administered.
-	LotNumber string
+	LotNumber string `json:"lotNumber" yaml:"lotNumber"`
 
 	// VaccineType represents the type of vaccine that was administered,
 	// e.g. Pfizer-BioNTech.
-	VaccineType
+	VaccineType `json:"vaccineType" yaml:"vaccineType"`
 }
 
 type VaccineType string
@@ -115,6 +156,49 @@ const (
 	COVAXIN           VaccineType = "COVAXIN"
 )
 
+// VaccineTypes returns the supported vaccine types, e.g. for listing them
+// in a form.
+func VaccineTypes() []VaccineType {
+	return []VaccineType{Pfizer, Moderna, JohnsonAndJohnson, AstraZeneca, Sinopharm, COVAXIN}
+}
+
+// VaccineTypeFromCVX returns the supported VaccineType with the given CVX
+// code, and false if no supported VaccineType has that code. See
+// https://www2a.cdc.gov/vaccines/iis/iisstandards/vaccines.asp?rpt=cvx.
+func VaccineTypeFromCVX(code string) (VaccineType, bool) {
+	for _, vt := range VaccineTypes() {
+		if vt.cvxcode() == code {
+			return vt, true
+		}
+	}
+	return "", false
+}
+
+// DisplayName returns the human-readable name of the VaccineType, e.g.
+// "Pfizer-BioNTech" for Pfizer, or the VaccineType itself if it is not
+// supported.
+func (vt VaccineType) DisplayName() string {
+	switch vt {
+	case Pfizer:
+		return "Pfizer-BioNTech"
+	case JohnsonAndJohnson:
+		return "Johnson & Johnson (Janssen)"
+	case AstraZeneca:
+		return "Oxford-AstraZeneca"
+	case Sinopharm:
+		return "Sinopharm (BIBP)"
+	case COVAXIN:
+		return "Bharat Biotech COVAXIN"
+	}
+	return string(vt)
+}
+
+// ErrInvalidVaccineType is the error with which marshaling an FHIRBundle
+// fails when one of its immunizations has an unsupported VaccineType.
+var ErrInvalidVaccineType = errors.New("invalid vaccine type")
+
+// cvxcode returns the CVX code of the VaccineType, or the empty string if
+// it is not supported. See
 // https://www2a.cdc.gov/vaccines/iis/iisstandards/vaccines.asp?rpt=cvx
 func (vt VaccineType) cvxcode() string {
 	switch vt {
@@ -132,7 +216,7 @@ func (vt VaccineType) cvxcode() string {
 		return "502"
 	}
 
-	panic("cvxcode called on invalid VaccineType")
+	return ""
 }
 
 type fhirBundleJSON struct {
@@ -156,6 +240,10 @@ type resourceJSON struct {
 	OccurrenceDate string           `json:"occurrenceDateTime,omitempty"`
 	Performers     []performerJSON  `json:"performer,omitempty"`
 	LotNumber      string           `json:"lotNumber,omitempty"`
+	Code           *vaccineCodeJSON `json:"code,omitempty"`
+	Subject        *patientJSON     `json:"subject,omitempty"`
+	EffectiveDate  string           `json:"effectiveDateTime,omitempty"`
+	Value          *vaccineCodeJSON `json:"valueCodeableConcept,omitempty"`
 }
 
 type vaccineCodeJSON struct {
@@ -201,6 +289,16 @@ func (f FHIRBundle) MarshalJSON() ([]byte, error) {
 	}
 
 	for i, immunization := range f.Immunizations {
+		code := immunization.VaccineType.cvxcode()
+		if code == "" {
+			return nil, fmt.Errorf("%w %q", ErrInvalidVaccineType, immunization.VaccineType)
+		}
+
+		var performers []performerJSON
+		if immunization.Performer != "" {
+			performers = []performerJSON{{Actor: actorJSON{Display: immunization.Performer}}}
+		}
+
 		fbj.Entries[i+1] = entryJSON{
 			FullURL: fmt.Sprintf("resource:%d", i+1),
 			Resource: resourceJSON{
@@ -210,13 +308,13 @@ func (f FHIRBundle) MarshalJSON() ([]byte, error) {
 					Coding: []codingJSON{
 						{
 							System: "https://hl7.org/fhir/sid/cvx", // https://www.hl7.org/fhir/cvx.html
-							Code:   immunization.VaccineType.cvxcode(),
+							Code:   code,
 						},
 					},
 				}),
 				Patient:        &(patientJSON{Reference: "resource:0"}),
 				OccurrenceDate: immunization.DatePerformed.Format("2006-01-02"),
-				Performers:     []performerJSON{{Actor: actorJSON{Display: immunization.Performer}}},
+				Performers:     performers,
 				LotNumber:      immunization.LotNumber,
 			},
 		}
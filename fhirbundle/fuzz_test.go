@@ -0,0 +1,29 @@
+package fhirbundle_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/conformance"
+	"github.com/amitkgupta/go-smarthealthcards/v2/fuzz"
+	"github.com/amitkgupta/go-smarthealthcards/v2/verifier"
+)
+
+// FuzzBundle runs fuzz.Bundle on FHIR bundles, seeded with those of the
+// golden examples.
+func FuzzBundle(f *testing.F) {
+	examples, err := conformance.Golden()
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, ex := range examples {
+		card, _ := verifier.Verify(context.Background(), ex.JWS, verifier.JWKS{})
+		f.Add([]byte(card.Bundle))
+	}
+	f.Add([]byte(`{"resourceType":"Bundle","type":"collection","entry":[]}`))
+	f.Add([]byte(`null`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fuzz.Bundle(data)
+	})
+}
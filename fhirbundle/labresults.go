@@ -0,0 +1,152 @@
+package fhirbundle
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// LabResultBundle encapsulates the core relevant data for an FHIR bundle
+// representing a patient's COVID-19 laboratory test results, as defined
+// here:
+// https://build.fhir.org/ig/HL7/fhir-shc-vaccination-ig/branches/master/StructureDefinition-shc-covid19-laboratory-bundle-dm.html.
+type LabResultBundle struct {
+	// Patient represents an individual who has been tested.
+	Patient
+
+	// LabResults represents the results of the patient's tests.
+	LabResults []LabResult
+}
+
+// LabResult represents the result of one COVID-19 laboratory test of a
+// patient.
+type LabResult struct {
+	// DateCollected represents the date when the specimen was collected.
+	DateCollected time.Time
+
+	// Performer represents the entity which performed the test, such as a
+	// particular laboratory. It is omitted from the bundle if empty.
+	Performer string
+
+	// TestType represents the type of test which was performed.
+	TestType
+
+	// Result represents the outcome of the test.
+	Result TestResult
+}
+
+type TestType string
+
+// Supported COVID-19 test types.
+const (
+	// NAAT is a nucleic acid amplification test, e.g. PCR.
+	NAAT TestType = "NAAT"
+
+	// Antigen is a rapid antigen test.
+	Antigen TestType = "Antigen"
+)
+
+// TestTypes returns the supported test types.
+func TestTypes() []TestType {
+	return []TestType{NAAT, Antigen}
+}
+
+// loinc returns the LOINC code of the TestType, or the empty string if it
+// is not supported. See https://loinc.org/sars-cov-2-and-covid-19/.
+func (tt TestType) loinc() string {
+	switch tt {
+	case NAAT:
+		return "94500-6"
+	case Antigen:
+		return "94558-4"
+	}
+	return ""
+}
+
+type TestResult string
+
+// Supported COVID-19 test results.
+const (
+	Detected    TestResult = "Detected"
+	NotDetected TestResult = "NotDetected"
+)
+
+// snomed returns the SNOMED CT code of the TestResult, or the empty string
+// if it is not supported.
+func (tr TestResult) snomed() string {
+	switch tr {
+	case Detected:
+		return "260373001"
+	case NotDetected:
+		return "260415000"
+	}
+	return ""
+}
+
+var (
+	// ErrInvalidTestType is the error with which marshaling a
+	// LabResultBundle fails when one of its results has an unsupported
+	// TestType.
+	ErrInvalidTestType = errors.New("invalid test type")
+
+	// ErrInvalidTestResult is the error with which marshaling a
+	// LabResultBundle fails when one of its results has an unsupported
+	// TestResult.
+	ErrInvalidTestResult = errors.New("invalid test result")
+)
+
+// CardType returns COVID19LabResult.
+func (l LabResultBundle) CardType() CardType {
+	return COVID19LabResult
+}
+
+// MarshalJSON serializes the bundle as a JSON byte slice, with each result
+// as an Observation resource.
+func (l LabResultBundle) MarshalJSON() ([]byte, error) {
+	fbj := fhirBundleJSON{
+		ResourceType: "Bundle",
+		Type:         "collection",
+		Entries:      make([]entryJSON, len(l.LabResults)+1),
+	}
+
+	fbj.Entries[0] = entryJSON{
+		FullURL: "resource:0",
+		Resource: resourceJSON{
+			ResourceType: "Patient",
+			Name:         []Name{l.Patient.Name},
+			BirthDate:    l.Patient.BirthDate.Format("2006-01-02"),
+		},
+	}
+
+	for i, result := range l.LabResults {
+		code := result.TestType.loinc()
+		if code == "" {
+			return nil, fmt.Errorf("%w %q", ErrInvalidTestType, result.TestType)
+		}
+		value := result.Result.snomed()
+		if value == "" {
+			return nil, fmt.Errorf("%w %q", ErrInvalidTestResult, result.Result)
+		}
+
+		var performers []performerJSON
+		if result.Performer != "" {
+			performers = []performerJSON{{Actor: actorJSON{Display: result.Performer}}}
+		}
+
+		fbj.Entries[i+1] = entryJSON{
+			FullURL: fmt.Sprintf("resource:%d", i+1),
+			Resource: resourceJSON{
+				ResourceType:  "Observation",
+				Status:        "final",
+				Code:          &(vaccineCodeJSON{Coding: []codingJSON{{System: "http://loinc.org", Code: code}}}),
+				Subject:       &(patientJSON{Reference: "resource:0"}),
+				EffectiveDate: result.DateCollected.Format("2006-01-02"),
+				Performers:    performers,
+				Value:         &(vaccineCodeJSON{Coding: []codingJSON{{System: "http://snomed.info/sct", Code: value}}}),
+			},
+		}
+	}
+
+	return json.Marshal(&fbj)
+}
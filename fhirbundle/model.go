@@ -0,0 +1,34 @@
+package fhirbundle
+
+import (
+	"encoding/json"
+)
+
+// fhirBundleModel is FHIRBundle without its MarshalJSON method, so that it
+// marshals by its struct tags.
+type fhirBundleModel FHIRBundle
+
+// MarshalModel serializes the bundle's own fields as JSON, by their struct
+// tags, rather than as the FHIR bundle they represent, e.g. to hold bundles
+// in a queue or store before they are issued, e.g.
+//
+//	{"patient":{"name":{"family":"Doe","given":["Jane"]},"birthDate":"1980-01-01T00:00:00Z"},
+//	 "immunizations":[{"datePerformed":"2021-04-01T00:00:00Z","performer":"Walgreens #123",
+//	 "lotNumber":"012A","vaccineType":"Moderna"}]}
+//
+// UnmarshalModel reverses it. The field names are stable across versions of
+// this module.
+func (f FHIRBundle) MarshalModel() ([]byte, error) {
+	return json.Marshal(fhirBundleModel(f))
+}
+
+// UnmarshalModel parses JSON serialized by MarshalModel. It does not check
+// the bundle's contents, e.g. that its vaccine types are supported; they are
+// checked when it is marshaled as an FHIR bundle.
+func UnmarshalModel(data []byte) (FHIRBundle, error) {
+	var m fhirBundleModel
+	if err := json.Unmarshal(data, &m); err != nil {
+		return FHIRBundle{}, err
+	}
+	return FHIRBundle(m), nil
+}
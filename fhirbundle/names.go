@@ -0,0 +1,137 @@
+package fhirbundle
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// NormalizeNames normalizes the patient's family and given names to
+// Unicode Normalization Form C before they are marshaled, composing letters
+// followed by combining marks, e.g. "e" followed by U+0301 COMBINING ACUTE
+// ACCENT, into precomposed letters, e.g. "é", since some verifier apps fail
+// to match a card to an ID whose name is spelled the same but encoded
+// differently. Only Latin letters are composed; other text is unchanged.
+// Bundles given to NewJWSPayloadFromJSON are not changed.
+func NormalizeNames() PayloadOption {
+	return func(o *payloadOptions) {
+		o.normalizeNames = true
+	}
+}
+
+// TransliterateNames is like NormalizeNames, but further transliterates the
+// names to ASCII, removing accents, e.g. "Zoë Ångström" becomes "Zoe
+// Angstrom", and spelling out letters such as "ß" and "Æ", for verifier apps
+// matching cards to IDs which only carry ASCII names. Characters with no
+// ASCII transliteration, such as those of non-Latin scripts, are unchanged.
+func TransliterateNames() PayloadOption {
+	return func(o *payloadOptions) {
+		o.normalizeNames = true
+		o.transliterateNames = true
+	}
+}
+
+// name returns the given name normalized as configured by the NormalizeNames
+// and TransliterateNames options.
+func (o payloadOptions) name(n Name) Name {
+	if !o.normalizeNames {
+		return n
+	}
+
+	normalize := nfc
+	if o.transliterateNames {
+		normalize = func(s string) string { return transliterate(nfc(s)) }
+	}
+
+	normalized := Name{Family: normalize(n.Family)}
+	if n.Givens != nil {
+		normalized.Givens = make([]string, len(n.Givens))
+		for i, given := range n.Givens {
+			normalized.Givens[i] = normalize(given)
+		}
+	}
+	return normalized
+}
+
+// nfc composes the Latin letters of s which are followed by combining marks
+// into precomposed letters, as Unicode Normalization Form C does.
+func nfc(s string) string {
+	if isASCII(s) {
+		return s
+	}
+
+	runes := make([]rune, 0, len(s))
+	for _, r := range s {
+		if n := len(runes); n > 0 {
+			if composed, ok := compositions[[2]rune{runes[n-1], r}]; ok {
+				runes[n-1] = composed
+				continue
+			}
+		}
+		runes = append(runes, r)
+	}
+	return string(runes)
+}
+
+// transliterations spells out letters which do not decompose into an ASCII
+// letter and combining marks, and replaces typographic punctuation common
+// in names.
+var transliterations = map[rune]string{
+	'Æ': "AE", 'æ': "ae",
+	'Œ': "OE", 'œ': "oe",
+	'Ĳ': "IJ", 'ĳ': "ij",
+	'Ø': "O", 'ø': "o",
+	'Ł': "L", 'ł': "l",
+	'Ŀ': "L", 'ŀ': "l",
+	'Đ': "D", 'đ': "d",
+	'Ð': "D", 'ð': "d",
+	'Ħ': "H", 'ħ': "h",
+	'Ŧ': "T", 'ŧ': "t",
+	'Ŋ': "N", 'ŋ': "n",
+	'Þ': "TH", 'þ': "th",
+	'ß': "ss", 'ẞ': "SS",
+	'ı': "i", 'ſ': "s",
+	'‘': "'", '’': "'", 'ʼ': "'",
+	'‐': "-", '‑': "-", '–': "-",
+}
+
+// transliterate replaces the Latin letters of s with ASCII letters, removing
+// their accents or spelling them out, and removes combining marks. Other
+// characters are unchanged.
+func transliterate(s string) string {
+	if isASCII(s) {
+		return s
+	}
+
+	var b strings.Builder
+	for _, r := range s {
+		if t, ok := transliterations[r]; ok {
+			b.WriteString(t)
+			continue
+		}
+
+		base := r
+		for {
+			pair, ok := decompositions[base]
+			if !ok {
+				break
+			}
+			base = pair[0]
+		}
+		if transliterated, ok := transliterations[base]; ok {
+			b.WriteString(transliterated)
+		} else if !unicode.Is(unicode.Mn, base) {
+			b.WriteRune(base)
+		}
+	}
+	return b.String()
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
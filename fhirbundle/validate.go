@@ -0,0 +1,224 @@
+package fhirbundle
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrInvalidBundle is wrapped by the errors returned by ValidateJSON.
+var ErrInvalidBundle = errors.New("invalid FHIR bundle")
+
+// ValidateJSON checks that the given JSON is an FHIR bundle conforming to the
+// SMART Health Cards vaccination profile, as defined here:
+// https://build.fhir.org/ig/HL7/fhir-shc-vaccination-ig/StructureDefinition-shc-vaccination-bundle-dm.html,
+// and to the minification rules of the SMART Health Card spec, as defined here:
+// https://spec.smarthealth.cards/#health-cards-are-small.
+//
+// It is intended for bundles constructed elsewhere, e.g. exported from an EHR,
+// which are to be signed directly with NewJWSPayloadFromJSON.
+//
+// The returned error wraps ErrInvalidBundle.
+func ValidateJSON(bundle []byte) error {
+	return validateBundle(bundle, "Immunization", validateImmunization)
+}
+
+// ValidateLabResultJSON is like ValidateJSON, but checks that the given JSON
+// is an FHIR bundle conforming to the SMART Health Cards COVID-19
+// laboratory result profile, as defined here:
+// https://build.fhir.org/ig/HL7/fhir-shc-vaccination-ig/branches/master/StructureDefinition-shc-covid19-laboratory-bundle-dm.html.
+func ValidateLabResultJSON(bundle []byte) error {
+	return validateBundle(bundle, "Observation", validateObservation)
+}
+
+// validateBundle checks that the given JSON is an FHIR bundle of one Patient
+// followed by at least one resource of the given type, each checked with
+// the given function.
+func validateBundle(bundle []byte, resourceType string, validateResource func(map[string]json.RawMessage, map[string]bool) error) error {
+	if err := validateJSON(bundle, resourceType, validateResource); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidBundle, err)
+	}
+	return nil
+}
+
+func validateJSON(bundle []byte, wantResourceType string, validateResource func(map[string]json.RawMessage, map[string]bool) error) error {
+	var b struct {
+		ResourceType string `json:"resourceType"`
+		Type         string `json:"type"`
+		Entries      []struct {
+			FullURL  string                     `json:"fullUrl"`
+			Resource map[string]json.RawMessage `json:"resource"`
+		} `json:"entry"`
+	}
+
+	d := json.NewDecoder(bytes.NewReader(bundle))
+	if err := d.Decode(&b); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	if b.ResourceType != "Bundle" {
+		return fmt.Errorf(`resourceType: must be "Bundle"`)
+	}
+	if b.Type != "collection" {
+		return fmt.Errorf(`type: must be "collection"`)
+	}
+
+	patients := map[string]bool{}
+	resources := 0
+	for i, entry := range b.Entries {
+		if entry.FullURL != fmt.Sprintf("resource:%d", i) {
+			return fmt.Errorf(`entry[%d].fullUrl: must be "resource:%d"`, i, i)
+		}
+
+		var resourceType string
+		if err := json.Unmarshal(entry.Resource["resourceType"], &resourceType); err != nil {
+			return fmt.Errorf("entry[%d].resource.resourceType: missing or invalid", i)
+		}
+
+		for _, element := range []string{"id", "text"} {
+			if _, ok := entry.Resource[element]; ok {
+				return fmt.Errorf("entry[%d].resource.%s: must be omitted", i, element)
+			}
+		}
+		if err := validateMeta(entry.Resource["meta"]); err != nil {
+			return fmt.Errorf("entry[%d].resource.meta: %w", i, err)
+		}
+
+		var err error
+		switch resourceType {
+		case "Patient":
+			patients[entry.FullURL] = true
+			err = validatePatient(entry.Resource)
+		case wantResourceType:
+			resources++
+			err = validateResource(entry.Resource, patients)
+		default:
+			err = fmt.Errorf("resourceType: %q is not allowed", resourceType)
+		}
+		if err != nil {
+			return fmt.Errorf("entry[%d].resource.%w", i, err)
+		}
+	}
+
+	if len(patients) != 1 {
+		return fmt.Errorf("entry: must contain exactly one Patient")
+	}
+	if resources == 0 {
+		return fmt.Errorf("entry: must contain at least one %s", wantResourceType)
+	}
+
+	return nil
+}
+
+func validateMeta(meta json.RawMessage) error {
+	if meta == nil {
+		return nil
+	}
+
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(meta, &m); err != nil {
+		return err
+	}
+	for element := range m {
+		if element != "security" {
+			return fmt.Errorf("only security is allowed")
+		}
+	}
+	return nil
+}
+
+func validatePatient(resource map[string]json.RawMessage) error {
+	var names []Name
+	if err := json.Unmarshal(resource["name"], &names); err != nil || len(names) == 0 {
+		return fmt.Errorf("name: missing or invalid")
+	}
+	for i, name := range names {
+		if name.Family == "" && len(name.Givens) == 0 {
+			return fmt.Errorf("name[%d]: must have a family or given name", i)
+		}
+	}
+
+	var birthDate string
+	if err := json.Unmarshal(resource["birthDate"], &birthDate); err != nil || !validDate(birthDate) {
+		return fmt.Errorf("birthDate: missing or invalid")
+	}
+
+	return nil
+}
+
+func validateImmunization(resource map[string]json.RawMessage, patients map[string]bool) error {
+	var status string
+	if err := json.Unmarshal(resource["status"], &status); err != nil || status != "completed" {
+		return fmt.Errorf(`status: must be "completed"`)
+	}
+
+	var vaccineCode vaccineCodeJSON
+	if err := json.Unmarshal(resource["vaccineCode"], &vaccineCode); err != nil || len(vaccineCode.Coding) == 0 {
+		return fmt.Errorf("vaccineCode: missing or invalid")
+	}
+	for i, coding := range vaccineCode.Coding {
+		if coding.System == "" || coding.Code == "" {
+			return fmt.Errorf("vaccineCode.coding[%d]: must have a system and code", i)
+		}
+	}
+
+	var patient patientJSON
+	if err := json.Unmarshal(resource["patient"], &patient); err != nil || !patients[patient.Reference] {
+		return fmt.Errorf("patient: must reference a preceding Patient entry")
+	}
+
+	var occurrenceDateTime string
+	if err := json.Unmarshal(resource["occurrenceDateTime"], &occurrenceDateTime); err != nil || !validDate(occurrenceDateTime) {
+		return fmt.Errorf("occurrenceDateTime: missing or invalid")
+	}
+
+	return nil
+}
+
+func validateObservation(resource map[string]json.RawMessage, patients map[string]bool) error {
+	var status string
+	if err := json.Unmarshal(resource["status"], &status); err != nil || (status != "final" && status != "amended" && status != "corrected") {
+		return fmt.Errorf(`status: must be "final", "amended", or "corrected"`)
+	}
+
+	var code vaccineCodeJSON
+	if err := json.Unmarshal(resource["code"], &code); err != nil || len(code.Coding) == 0 {
+		return fmt.Errorf("code: missing or invalid")
+	}
+	for i, coding := range code.Coding {
+		if coding.System == "" || coding.Code == "" {
+			return fmt.Errorf("code.coding[%d]: must have a system and code", i)
+		}
+	}
+
+	var subject patientJSON
+	if err := json.Unmarshal(resource["subject"], &subject); err != nil || !patients[subject.Reference] {
+		return fmt.Errorf("subject: must reference a preceding Patient entry")
+	}
+
+	var effectiveDateTime string
+	if err := json.Unmarshal(resource["effectiveDateTime"], &effectiveDateTime); err != nil || !validDate(effectiveDateTime) {
+		return fmt.Errorf("effectiveDateTime: missing or invalid")
+	}
+
+	for element := range resource {
+		if strings.HasPrefix(element, "value") {
+			return nil
+		}
+	}
+	return fmt.Errorf("value[x]: missing")
+}
+
+// validDate reports whether s is an FHIR date or dateTime with at least a
+// year, e.g. "2021", "2021-06", "2021-06-01", or "2021-06-01T12:00:00Z".
+func validDate(s string) bool {
+	for _, layout := range []string{"2006", "2006-01", "2006-01-02", time.RFC3339} {
+		if _, err := time.Parse(layout, s); err == nil {
+			return true
+		}
+	}
+	return false
+}
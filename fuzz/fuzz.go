@@ -0,0 +1,139 @@
+// Package fuzz provides entry points for fuzzing the parsers and encoders
+// of this module which are fed untrusted input: form data, FHIR bundles,
+// "shc:/" strings, QR code images, .smart-health-card files, and JWSs.
+//
+// Each function takes arbitrary bytes, follows the go-fuzz convention of
+// returning 1 if the input was interesting, i.e. parsed successfully, -1 if
+// it should not be added to the corpus, and 0 otherwise, and panics if it
+// finds a violated invariant, such as a value which does not survive a
+// round trip. They can be driven by go-fuzz or OSS-Fuzz directly. Native
+// Go fuzz targets running them, seeded with the golden examples of the
+// conformance package, are in the tests of the packages they exercise,
+// e.g.
+//
+//	go test ./verifier -run '^$' -fuzz FuzzJWS
+package fuzz
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/fhirbundle"
+	"github.com/amitkgupta/go-smarthealthcards/v2/qrcode"
+	"github.com/amitkgupta/go-smarthealthcards/v2/verifier"
+	"github.com/amitkgupta/go-smarthealthcards/v2/webhandlers"
+)
+
+const issuer = "https://example.com"
+
+var handlers = webhandlers.New(nil, issuer)
+
+// Form parses the given URL-encoded form data as by
+// webhandlers.Handlers.ParseFormValues, and checks that any bundle it
+// yields can be marshaled into a JWS payload.
+func Form(data []byte) int {
+	values, err := url.ParseQuery(string(data))
+	if err != nil {
+		return -1
+	}
+
+	fb, err := handlers.ParseFormValues(values)
+	if err != nil {
+		var errs webhandlers.ValidationErrors
+		if !errors.As(err, &errs) {
+			panic(fmt.Sprintf("ParseFormValues returned %T, not ValidationErrors: %v", err, err))
+		}
+		return 0
+	}
+
+	if _, err := json.Marshal(fhirbundle.NewJWSPayload(fb, issuer)); err != nil {
+		panic(fmt.Sprintf("marshaling parsed form: %v", err))
+	}
+	return 1
+}
+
+// Bundle validates the given FHIR bundle as by fhirbundle.ValidateJSON, and
+// checks that a valid bundle can be marshaled into a JWS payload which
+// holds it unchanged.
+func Bundle(data []byte) int {
+	if err := fhirbundle.ValidateJSON(data); err != nil {
+		return 0
+	}
+
+	payload, err := json.Marshal(fhirbundle.NewJWSPayloadFromJSON(data, issuer))
+	if err != nil {
+		panic(fmt.Sprintf("marshaling valid bundle: %v", err))
+	}
+	var p struct {
+		VC struct {
+			CredentialSubject struct {
+				Bundle any `json:"fhirBundle"`
+			} `json:"credentialSubject"`
+		} `json:"vc"`
+	}
+	if err := json.Unmarshal(payload, &p); err != nil {
+		panic(fmt.Sprintf("unmarshaling payload: %v", err))
+	}
+	var bundle any
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		panic(fmt.Sprintf("unmarshaling valid bundle: %v", err))
+	}
+	if !reflect.DeepEqual(p.VC.CredentialSubject.Bundle, bundle) {
+		panic("payload does not hold the bundle unchanged")
+	}
+	return 1
+}
+
+// SHCStrings decodes the given newline-separated "shc:/" strings as by
+// qrcode.DecodeStrings, and checks that the decoded content encodes and
+// decodes back to itself.
+func SHCStrings(data []byte) int {
+	content, err := qrcode.DecodeStrings(strings.Split(string(data), "\n"))
+	if err != nil {
+		return 0
+	}
+
+	shcStrings, err := qrcode.EncodeToStrings(content)
+	if err != nil {
+		return 0
+	}
+	if roundTripped, err := qrcode.DecodeStrings(shcStrings); err != nil || roundTripped != content {
+		panic(fmt.Sprintf("content does not round-trip through shc:/ strings: %v", err))
+	}
+	return 1
+}
+
+// QRImage decodes the given image as by qrcode.Decode.
+func QRImage(data []byte) int {
+	if _, err := qrcode.Decode(data); err != nil {
+		return 0
+	}
+	return 1
+}
+
+// File parses the given .smart-health-card file as by verifier.ParseFile.
+func File(data []byte) int {
+	if _, err := verifier.ParseFile(data); err != nil {
+		return 0
+	}
+	return 1
+}
+
+// JWS parses the given JWS as by verifier.Verify, with no keys, and checks
+// that it fails only with verifier.ErrMalformed or verifier.ErrUnknownKey.
+func JWS(data []byte) int {
+	_, err := verifier.Verify(context.Background(), string(data), verifier.JWKS{})
+	switch {
+	case errors.Is(err, verifier.ErrMalformed):
+		return 0
+	case errors.Is(err, verifier.ErrUnknownKey):
+		return 1
+	default:
+		panic(fmt.Sprintf("verifying with no keys returned %v", err))
+	}
+}
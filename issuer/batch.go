@@ -0,0 +1,56 @@
+package issuer
+
+import (
+	"context"
+	"runtime"
+	"sync"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/fhirbundle"
+)
+
+// Result is the outcome of issuing one card of a batch.
+type Result struct {
+	// Card is the issued card, if Err is nil.
+	Card Card
+
+	// Err is the error with which issuing the card failed, if any.
+	Err error
+}
+
+// IssueBatch issues a card for each of the given FHIR bundles, using up to
+// the given number of goroutines, or GOMAXPROCS if concurrency is not
+// positive. It returns a result for each bundle, in the same order, so
+// that one failed card does not prevent the rest of the batch from being
+// issued. Once the context is done, the cards not yet issued fail with the
+// context's error.
+//
+// Callers back-filling very large numbers of records should pass them in
+// batches of a bounded size, since every card of a batch, including its QR
+// code PNGs unless the WithoutPNGs option is given, is held in memory until
+// IssueBatch returns.
+func (i *Issuer) IssueBatch(ctx context.Context, bundles []fhirbundle.FHIRBundle, concurrency int) []Result {
+	if concurrency <= 0 {
+		concurrency = runtime.GOMAXPROCS(0)
+	}
+
+	results := make([]Result, len(bundles))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency && w < len(bundles); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range indexes {
+				results[n].Card, results[n].Err = i.Issue(ctx, bundles[n])
+			}
+		}()
+	}
+
+	for n := range bundles {
+		indexes <- n
+	}
+	close(indexes)
+	wg.Wait()
+
+	return results
+}
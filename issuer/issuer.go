@@ -0,0 +1,289 @@
+// Package issuer composes the other packages in this module into a single
+// pipeline for issuing SMART Health Cards: it constructs the JWS payload for
+// an FHIR bundle, signs it, and encodes the resulting JWS as "shc:/" strings,
+// QR code PNGs, and a .smart-health-card file. See
+// https://spec.smarthealth.cards.
+package issuer
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/fhirbundle"
+	"github.com/amitkgupta/go-smarthealthcards/v2/jws"
+	"github.com/amitkgupta/go-smarthealthcards/v2/qrcode"
+)
+
+// Card is a SMART Health Card in each of the forms in which it can be
+// delivered.
+type Card struct {
+	// JWS is the compact serialization of the card's JSON Web Signature.
+	JWS string
+
+	// SHCStrings are the "shc:/" strings encoding the JWS, one per QR
+	// code. See https://spec.smarthealth.cards/#encoding-chunks-as-qr-codes.
+	SHCStrings []string
+
+	// QRPNGs are the PNGs of the QR codes encoding SHCStrings, or nil if
+	// the issuer was created with the WithoutPNGs option.
+	QRPNGs [][]byte
+
+	// File is the contents of a .smart-health-card file holding the JWS.
+	// See https://spec.smarthealth.cards/#via-file-download.
+	File []byte
+}
+
+// Option customizes the behavior of an Issuer; see New.
+type Option func(*Issuer)
+
+// WithoutPNGs skips rendering QR code PNGs, for callers which render the
+// QR codes themselves from Card.SHCStrings.
+func WithoutPNGs() Option {
+	return func(i *Issuer) {
+		i.pngs = false
+	}
+}
+
+// Deterministic signs cards as with jws.Deterministic, so that issuing the
+// same FHIR bundle at the same "nbf" time, e.g. as fixed by Clock, always
+// yields the same JWS.
+func Deterministic() Option {
+	return func(i *Issuer) {
+		i.signOpts = append(i.signOpts, jws.Deterministic())
+	}
+}
+
+// Clock sets the function returning the issuance time of cards, as with
+// fhirbundle.WithClock, in place of time.Now.
+func Clock(now func() time.Time) Option {
+	return func(i *Issuer) {
+		i.payloadOpts = append(i.payloadOpts, fhirbundle.WithClock(now))
+	}
+}
+
+// KeyID sets the "kid" header of cards, as with jws.WithKeyID, e.g. to a
+// kid computed once for the key rather than for every card.
+func KeyID(kid string) Option {
+	return func(i *Issuer) {
+		i.signOpts = append(i.signOpts, jws.WithKeyID(kid))
+	}
+}
+
+// PayloadOptions constructs the JWS payloads of cards with the given
+// options, e.g. fhirbundle.WithClock, in addition to those of other
+// options.
+func PayloadOptions(opts ...fhirbundle.PayloadOption) Option {
+	return func(i *Issuer) {
+		i.payloadOpts = append(i.payloadOpts, opts...)
+	}
+}
+
+// MaxSize rejects cards whose JWS would be longer than the given size, e.g.
+// qrcode.MaxSingleChunkSize for cards which must fit in a single QR code,
+// with a *TooLargeError. The size is estimated before the card is signed,
+// so oversized cards are never signed.
+func MaxSize(size int) Option {
+	return func(i *Issuer) {
+		i.maxSize = size
+	}
+}
+
+// ErrTooLarge is the error wrapped by a TooLargeError.
+var ErrTooLarge = errors.New("card is too large")
+
+// TooLargeError is the error with which cards are rejected when they are
+// larger than allowed by the MaxSize option.
+type TooLargeError struct {
+	// Size is the estimated length of the card's JWS.
+	Size int
+
+	// Max is the longest JWS allowed.
+	Max int
+}
+
+func (e *TooLargeError) Error() string {
+	return fmt.Sprintf("%v: its JWS would be %d characters long, over the limit of %d", ErrTooLarge, e.Size, e.Max)
+}
+
+func (e *TooLargeError) Unwrap() error {
+	return ErrTooLarge
+}
+
+// NormalizeNames normalizes patients' names, as with
+// fhirbundle.NormalizeNames or, if transliterate is true,
+// fhirbundle.TransliterateNames.
+func NormalizeNames(transliterate bool) Option {
+	return func(i *Issuer) {
+		if transliterate {
+			i.payloadOpts = append(i.payloadOpts, fhirbundle.TransliterateNames())
+		} else {
+			i.payloadOpts = append(i.payloadOpts, fhirbundle.NormalizeNames())
+		}
+	}
+}
+
+// CompressionLevel compresses the payloads of cards at the given DEFLATE
+// level, as with jws.WithCompressionLevel, e.g. flate.BestSpeed to issue
+// large batches faster at the cost of larger cards.
+func CompressionLevel(level int) Option {
+	return func(i *Issuer) {
+		i.signOpts = append(i.signOpts, jws.WithCompressionLevel(level))
+	}
+}
+
+// WithoutCompression leaves the payloads of cards uncompressed, as with
+// jws.WithoutCompression, for verifiers which mishandle DEFLATE
+// compression, as long as the uncompressed card fits in a single QR code;
+// larger cards are still compressed.
+func WithoutCompression() Option {
+	return func(i *Issuer) {
+		i.uncompressed = true
+	}
+}
+
+// CardTypes registers the given card types, in addition to the built-in
+// fhirbundle.CardTypes, so that the issuer issues cards of them with
+// IssueBundle and IssueJSONAs. A card type replaces any registered card
+// type of the same name.
+func CardTypes(cardTypes ...fhirbundle.CardType) Option {
+	return func(i *Issuer) {
+		for _, ct := range cardTypes {
+			i.cardTypes[ct.Name()] = ct
+		}
+	}
+}
+
+// ErrUnknownCardType is the error with which IssueBundle and IssueJSONAs
+// fail when given a card type which is not registered with the issuer.
+var ErrUnknownCardType = errors.New("unknown card type")
+
+// Issuer issues SMART Health Cards on behalf of a single issuer. Create it
+// with New.
+type Issuer struct {
+	key         *ecdsa.PrivateKey
+	url         string
+	pngs        bool
+	signOpts    []jws.Option
+	payloadOpts []fhirbundle.PayloadOption
+	cardTypes   map[string]fhirbundle.CardType
+
+	uncompressed bool
+	maxSize      int
+}
+
+// New returns an Issuer signing cards with the given key on behalf of the
+// issuer with the given URL, the "iss" value of its cards. Its behavior can
+// be customized with the given options.
+func New(key *ecdsa.PrivateKey, iss string, opts ...Option) *Issuer {
+	i := &Issuer{key: key, url: iss, pngs: true, cardTypes: map[string]fhirbundle.CardType{}}
+	for _, ct := range fhirbundle.CardTypes() {
+		i.cardTypes[ct.Name()] = ct
+	}
+	for _, opt := range opts {
+		opt(i)
+	}
+	return i
+}
+
+// CardType returns the registered card type with the given name, and
+// whether there is one.
+func (i *Issuer) CardType(name string) (fhirbundle.CardType, bool) {
+	ct, ok := i.cardTypes[name]
+	return ct, ok
+}
+
+// Issue issues a card representing the given FHIR bundle. It stops early
+// and returns the context's error if the context is done before the card
+// has been signed and encoded.
+func (i *Issuer) Issue(ctx context.Context, fb fhirbundle.FHIRBundle) (Card, error) {
+	return i.issue(ctx, fhirbundle.NewJWSPayload(fb, i.url, i.payloadOpts...))
+}
+
+// IssueJSON is like Issue, but takes an already constructed FHIR bundle in
+// JSON form, which should first be checked with fhirbundle.ValidateJSON.
+func (i *Issuer) IssueJSON(ctx context.Context, bundle json.RawMessage) (Card, error) {
+	return i.issue(ctx, fhirbundle.NewJWSPayloadFromJSON(bundle, i.url, i.payloadOpts...))
+}
+
+// IssueBundle is like Issue, but takes a bundle of any registered card
+// type, e.g. a fhirbundle.LabResultBundle.
+func (i *Issuer) IssueBundle(ctx context.Context, b fhirbundle.Bundle) (Card, error) {
+	if _, ok := i.cardTypes[b.CardType().Name()]; !ok {
+		return Card{}, fmt.Errorf("%w %q", ErrUnknownCardType, b.CardType().Name())
+	}
+	return i.issue(ctx, fhirbundle.NewBundlePayload(b, i.url, i.payloadOpts...))
+}
+
+// IssueJSONAs is like IssueJSON, but takes an FHIR bundle of the registered
+// card type with the given name, which it first checks with the card
+// type's Validate method.
+func (i *Issuer) IssueJSONAs(ctx context.Context, cardType string, bundle json.RawMessage) (Card, error) {
+	ct, ok := i.cardTypes[cardType]
+	if !ok {
+		return Card{}, fmt.Errorf("%w %q", ErrUnknownCardType, cardType)
+	}
+	if err := ct.Validate(bundle); err != nil {
+		return Card{}, err
+	}
+	return i.issue(ctx, fhirbundle.NewBundlePayloadFromJSON(ct, bundle, i.url, i.payloadOpts...))
+}
+
+func (i *Issuer) issue(ctx context.Context, jwsPayload interface{}) (Card, error) {
+	payload, err := json.Marshal(jwsPayload)
+	if err != nil {
+		return Card{}, err
+	}
+
+	signOpts := i.signOpts
+	if i.uncompressed {
+		uncompressed := append(signOpts[:len(signOpts):len(signOpts)], jws.WithoutCompression())
+		size, err := jws.EstimateSize(payload, uncompressed...)
+		if err != nil {
+			return Card{}, err
+		}
+		if size <= qrcode.MaxSingleChunkSize {
+			signOpts = uncompressed
+		}
+	}
+
+	if i.maxSize > 0 {
+		size, err := jws.EstimateSize(payload, signOpts...)
+		if err != nil {
+			return Card{}, err
+		}
+		if size > i.maxSize {
+			return Card{}, &TooLargeError{Size: size, Max: i.maxSize}
+		}
+	}
+
+	var card Card
+	if card.JWS, err = jws.SignAndSerializeContext(ctx, payload, i.key, signOpts...); err != nil {
+		return Card{}, err
+	}
+
+	if card.SHCStrings, err = qrcode.EncodeToStrings(card.JWS); err != nil {
+		return Card{}, err
+	}
+
+	if i.pngs {
+		if card.QRPNGs, err = qrcode.EncodeContext(ctx, card.JWS); err != nil {
+			return Card{}, err
+		}
+	}
+
+	if card.File, err = File(card.JWS); err != nil {
+		return Card{}, err
+	}
+
+	return card, nil
+}
+
+// File returns the contents of a .smart-health-card file holding the given
+// JWSs. See https://spec.smarthealth.cards/#via-file-download.
+func File(healthCardJWSs ...string) ([]byte, error) {
+	return json.Marshal(map[string][]string{"verifiableCredential": healthCardJWSs})
+}
@@ -0,0 +1,78 @@
+package jws
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInvalidChain is the error with which VerifyChain fails.
+var ErrInvalidChain = errors.New("jws: invalid x5c certificate chain")
+
+// VerifyChain verifies the certificate chain published with an issuer's
+// key as the "x5c" parameter of its JWK, for issuers participating in
+// trust frameworks which certify their keys. See
+// https://spec.smarthealth.cards/#determining-keys-associated-with-an-issuer.
+//
+// Each certificate of the chain is base64-encoded DER, starting with that
+// of the key, which must be the given key and, unless issuer is empty,
+// must name the issuer URL among its subject alternative names. Each
+// certificate must be certified by the next, the last by one of the given
+// roots, and all must be valid at the given time. VerifyChain returns the
+// verified chain, from the key's certificate to the root's.
+func VerifyChain(x5c []string, key *ecdsa.PublicKey, issuer string, roots *x509.CertPool, at time.Time) ([]*x509.Certificate, error) {
+	switch {
+	case len(x5c) == 0:
+		return nil, fmt.Errorf("%w: no certificates", ErrInvalidChain)
+	case roots == nil:
+		return nil, fmt.Errorf("%w: no trusted roots", ErrInvalidChain)
+	}
+
+	certs := make([]*x509.Certificate, len(x5c))
+	for i, encoded := range x5c {
+		der, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("%w: certificate %d: %v", ErrInvalidChain, i, err)
+		}
+		if certs[i], err = x509.ParseCertificate(der); err != nil {
+			return nil, fmt.Errorf("%w: certificate %d: %v", ErrInvalidChain, i, err)
+		}
+	}
+
+	leaf := certs[0]
+	if pub, ok := leaf.PublicKey.(*ecdsa.PublicKey); !ok || key == nil || !pub.Equal(key) {
+		return nil, fmt.Errorf("%w: the first certificate is not of the key", ErrInvalidChain)
+	}
+	if issuer != "" && !namesURI(leaf, issuer) {
+		return nil, fmt.Errorf("%w: the first certificate does not name the issuer %q", ErrInvalidChain, issuer)
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	chains, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   at,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidChain, err)
+	}
+	return chains[0], nil
+}
+
+// namesURI reports whether the certificate has the given URI among its
+// subject alternative names.
+func namesURI(cert *x509.Certificate, uri string) bool {
+	for _, u := range cert.URIs {
+		if u.String() == uri {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+package jws
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+
+	"filippo.io/bigmod"
+	"filippo.io/nistec"
+)
+
+// Deterministic makes SignAndSerialize derive each ECDSA nonce from the key
+// and the signed content as described in RFC 6979, rather than drawing it
+// from crypto/rand, so that signing the same payload with the same key
+// always returns the same JWS. This makes golden-file tests possible, and
+// lets issuers deduplicate re-issued cards by a hash of their JWS. See
+// https://datatracker.ietf.org/doc/html/rfc6979.
+func Deterministic() Option {
+	return func(o *options) {
+		o.deterministic = true
+	}
+}
+
+// p256Order is the order of the P-256 group, and p256OrderMinus2 the
+// exponent with which nonces are inverted modulo it.
+var p256Order, p256OrderMinus2 = func() (*bigmod.Modulus, []byte) {
+	n := elliptic.P256().Params().N
+	m, err := bigmod.NewModulusFromBig(n)
+	if err != nil {
+		panic(err)
+	}
+	return m, new(big.Int).Sub(n, big.NewInt(2)).Bytes()
+}()
+
+// signDeterministic signs the given SHA-256 hash with a P-256 key, with a
+// nonce generated by the HMAC-SHA256 DRBG of RFC 6979, section 3.2. Like
+// crypto/ecdsa, it computes with the key and nonce only in constant time,
+// using filippo.io/nistec and filippo.io/bigmod, exported copies of the
+// packages underlying crypto/ecdsa.
+func signDeterministic(key *ecdsa.PrivateKey, hash []byte) (*big.Int, *big.Int, error) {
+	n := p256Order
+	size := n.Size()
+
+	if key.Curve != elliptic.P256() || key.D.BitLen() > n.BitLen() {
+		return nil, nil, errors.New("jws: deterministic signing requires a P-256 key")
+	}
+	x := key.D.FillBytes(make([]byte, size))
+	d, err := bigmod.NewNat().SetBytes(x, n)
+	if err != nil || d.IsZero() == 1 {
+		return nil, nil, errors.New("jws: invalid P-256 private key")
+	}
+
+	// For SHA-256 and P-256, bits2int is the identity, and a hash at
+	// least n is reduced once, as bits2octets requires.
+	e, err := bigmod.NewNat().SetOverflowingBytes(hash, n)
+	if err != nil {
+		return nil, nil, err
+	}
+	h := e.Bytes(n)
+
+	v := bytesOf(0x01, sha256.Size)
+	k := bytesOf(0x00, sha256.Size)
+	k = hmacSHA256(k, v, []byte{0x00}, x, h)
+	v = hmacSHA256(k, v)
+	k = hmacSHA256(k, v, []byte{0x01}, x, h)
+	v = hmacSHA256(k, v)
+
+	for i := 0; i < 64; i++ {
+		v = hmacSHA256(k, v)
+		if r, s, ok := signWithNonce(d, e, v); ok {
+			return new(big.Int).SetBytes(r), new(big.Int).SetBytes(s), nil
+		}
+		k = hmacSHA256(k, v, []byte{0x00})
+		v = hmacSHA256(k, v)
+	}
+
+	// Unreachable in practice: each candidate nonce is valid with
+	// overwhelming probability.
+	return nil, nil, errors.New("jws: failed to generate a deterministic nonce")
+}
+
+// signWithNonce returns the signature (r, s) of the hash e, reduced modulo
+// the order n, with the private key d and the candidate nonce, or false if
+// the nonce is not in [1, n-1] or yields a zero r or s, so that the next
+// candidate must be tried.
+func signWithNonce(d, e *bigmod.Nat, nonce []byte) (r, s []byte, ok bool) {
+	n := p256Order
+
+	k, err := bigmod.NewNat().SetBytes(nonce, n)
+	if err != nil || k.IsZero() == 1 {
+		return nil, nil, false
+	}
+
+	R, err := nistec.NewP256Point().ScalarBaseMult(k.Bytes(n))
+	if err != nil {
+		return nil, nil, false
+	}
+	Rx, err := R.BytesX()
+	if err != nil {
+		return nil, nil, false
+	}
+	rNat, err := bigmod.NewNat().SetOverflowingBytes(Rx, n)
+	if err != nil || rNat.IsZero() == 1 {
+		return nil, nil, false
+	}
+
+	// s = k⁻¹(e + r·d) mod n, inverting k as k^(n-2) by Fermat's little
+	// theorem.
+	r = rNat.Bytes(n)
+	kInv := bigmod.NewNat().Exp(k, p256OrderMinus2, n)
+	sNat := rNat.Mul(d, n)
+	sNat.Add(e, n)
+	sNat.Mul(kInv, n)
+	if sNat.IsZero() == 1 {
+		return nil, nil, false
+	}
+	return r, sNat.Bytes(n), true
+}
+
+func hmacSHA256(key []byte, data ...[]byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	for _, d := range data {
+		mac.Write(d)
+	}
+	return mac.Sum(nil)
+}
+
+func bytesOf(b byte, n int) []byte {
+	s := make([]byte, n)
+	for i := range s {
+		s[i] = b
+	}
+	return s
+}
@@ -0,0 +1,76 @@
+package jws
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+// TestSignDeterministicRFC6979 checks signatures against the P-256 and
+// SHA-256 test vectors of RFC 6979, appendix A.2.5.
+func TestSignDeterministicRFC6979(t *testing.T) {
+	x, err := hex.DecodeString("C9AFA9D845BA75166B5C215767B1D6934E50C3DB36E89B127B8A622B120F6721")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdhKey, err := ecdh.P256().NewPrivateKey(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	point := ecdhKey.PublicKey().Bytes()
+	key := &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(point[1:33]),
+			Y:     new(big.Int).SetBytes(point[33:]),
+		},
+		D: new(big.Int).SetBytes(x),
+	}
+
+	tests := []struct {
+		message string
+		r, s    string
+	}{
+		{
+			"sample",
+			"EFD48B2AACB6A8FD1140DD9CD45E81D69D2C877B56AAF991C34D0EA84EAF3716",
+			"F7CB1C942D657C41D436C7A1B6E29F65F3E900DBB9AFF4064DC4AB2F843ACDA8",
+		},
+		{
+			"test",
+			"F1ABB023518351CD71D881567B1EA663ED3EFCF6C5132B354F28D3B0B7D38367",
+			"019F4113742A2B14BD25926B49C649155F267E60D3814B4C0CC84250E46F0083",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.message, func(t *testing.T) {
+			hash := sha256.Sum256([]byte(tt.message))
+			r, s, err := signDeterministic(key, hash[:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := hexInt(t, tt.r); r.Cmp(want) != 0 {
+				t.Errorf("r = %X, want %X", r, want)
+			}
+			if want := hexInt(t, tt.s); s.Cmp(want) != 0 {
+				t.Errorf("s = %X, want %X", s, want)
+			}
+			if !ecdsa.Verify(&key.PublicKey, hash[:], r, s) {
+				t.Error("signature does not verify")
+			}
+		})
+	}
+}
+
+func hexInt(t *testing.T, s string) *big.Int {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return new(big.Int).SetBytes(b)
+}
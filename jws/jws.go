@@ -1,7 +1,9 @@
 // Package jws creates a compact serialization of a JSON Web Signature (JWS)
 // with the ECDSA P-256 SHA-256 signing algorithm and DEFLATE compression of
 // the payload and creates a serialization of a JSON Web Key Set representing
-// the public key of an ECDSA P-256 key. See
+// the public key of an ECDSA P-256 key. It also parses such a JWS, without
+// verifying it, and verifies the certificate chains published with keys.
+// See
 // https://spec.smarthealth.cards/#health-cards-are-encoded-as-compact-serialization-json-web-signatures-jws,
 // https://spec.smarthealth.cards/#health-cards-are-small,
 // and
@@ -11,13 +13,19 @@ package jws
 import (
 	"bytes"
 	"compress/flate"
+	"context"
 	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/big"
+	"sort"
+	"strings"
+	"sync"
 )
 
 const (
@@ -26,74 +34,331 @@ const (
 	keyType   = "EC"
 )
 
+// ErrUnsupportedKey is the error, wrapped in a SigningError, with which
+// SignAndSerialize fails when given a key other than an ECDSA P-256 key.
+var ErrUnsupportedKey = errors.New("jws: key is not an ECDSA P-256 private key")
+
+// ErrInvalidCompressionLevel is the error with which SignAndSerialize fails
+// when given a compression level outside the range accepted by
+// WithCompressionLevel.
+var ErrInvalidCompressionLevel = errors.New("jws: invalid compression level")
+
+// ErrReservedHeader is the error with which SignAndSerialize fails when
+// WithHeader is given a header parameter which the jws package sets itself.
+var ErrReservedHeader = errors.New("jws: reserved header parameter")
+
+// SigningError is the error with which SignAndSerialize fails when the
+// payload cannot be signed with the given key.
+type SigningError struct {
+	Err error
+}
+
+func (e *SigningError) Error() string {
+	return "jws: signing payload: " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *SigningError) Unwrap() error {
+	return e.Err
+}
+
 type header struct {
 	Algorithm string `json:"alg"`
-	Zip       string `json:"zip"`
+	Zip       string `json:"zip,omitempty"`
 	KeyID     string `json:"kid"`
 }
 
 // SignAndSerialize compresses the given payload, signs it with the given key,
 // and returns the resulting enoded JSON Web Signature (JWS). See:
 // https://datatracker.ietf.org/doc/html/rfc7515#appendix-A.3.
-func SignAndSerialize(payload []byte, key *ecdsa.PrivateKey) (string, error) {
-	h := header{
-		Algorithm: algorithm,
-		Zip:       "DEF",
-		KeyID:     kid(key),
+func SignAndSerialize(payload []byte, key *ecdsa.PrivateKey, opts ...Option) (string, error) {
+	return SignAndSerializeContext(context.Background(), payload, key, opts...)
+}
+
+// Option customizes the behavior of SignAndSerialize.
+type Option func(*options)
+
+type options struct {
+	keyID         string
+	deterministic bool
+	uncompressed  bool
+	level         int
+	headers       map[string]interface{}
+}
+
+func newOptions(opts []Option) options {
+	o := options{level: flate.BestCompression}
+	for _, opt := range opts {
+		opt(&o)
 	}
+	return o
+}
 
-	hBytes, err := json.Marshal(&h)
-	if err != nil {
+// WithKeyID sets the "kid" of the JWS header, which must be the kid of the
+// signing key as published in its JWKS, rather than computing it from the
+// key on every call. Callers signing many payloads with the same key can
+// compute it once, e.g. from the key's JWKSJSON, and reuse it.
+func WithKeyID(kid string) Option {
+	return func(o *options) {
+		o.keyID = kid
+	}
+}
+
+// WithHeader adds the given parameter to the protected header of the JWS,
+// e.g. "x5c" or "cty", for issuers participating in trust networks which
+// require additional header metadata. The value is serialized as JSON, and
+// additional parameters follow the "alg", "zip", and "kid" parameters in
+// the order of their names. The "alg", "zip", and "kid" parameters cannot
+// be set this way, and fail with ErrReservedHeader; use WithKeyID to
+// override the kid. Verifiers ignore parameters they do not understand,
+// but every parameter lengthens the card.
+func WithHeader(name string, value interface{}) Option {
+	return func(o *options) {
+		if o.headers == nil {
+			o.headers = make(map[string]interface{})
+		}
+		o.headers[name] = value
+	}
+}
+
+// WithoutCompression leaves the payload uncompressed and omits the "zip"
+// header, for verifiers which mishandle DEFLATE compression. Uncompressed
+// cards are considerably larger, so callers should check with EstimateSize
+// that the card still fits where it must, e.g. in a single QR code.
+func WithoutCompression() Option {
+	return func(o *options) {
+		o.uncompressed = true
+	}
+}
+
+// WithCompressionLevel sets the DEFLATE compression level of the payload,
+// from flate.HuffmanOnly to flate.BestCompression, trading the size of
+// cards for the speed of issuing them, e.g. in bulk. The default is
+// flate.BestCompression, which yields the fewest QR code chunks.
+func WithCompressionLevel(level int) Option {
+	return func(o *options) {
+		o.level = level
+	}
+}
+
+// SignAndSerializeContext is like SignAndSerialize, but stops early and
+// returns the context's error if the context is done before signing
+// completes.
+func SignAndSerializeContext(ctx context.Context, payload []byte, key *ecdsa.PrivateKey, opts ...Option) (string, error) {
+	if err := ctx.Err(); err != nil {
 		return "", err
 	}
 
-	hB64String := base64.RawURLEncoding.EncodeToString(hBytes)
+	if key == nil || key.Curve != elliptic.P256() {
+		return "", &SigningError{Err: ErrUnsupportedKey}
+	}
+
+	o := newOptions(opts)
+	if o.keyID == "" {
+		o.keyID = KeyID(&key.PublicKey)
+	}
 
-	pBuf := new(bytes.Buffer)
-	if zw, err := flate.NewWriter(pBuf, flate.BestCompression); err != nil {
+	hBytes, err := o.header()
+	if err != nil {
 		return "", err
-	} else {
-		if _, err = zw.Write(payload); err != nil {
-			return "", err
-		}
-		if err = zw.Close(); err != nil {
+	}
+
+	if !o.uncompressed {
+		pBuf := buffers.Get().(*bytes.Buffer)
+		pBuf.Reset()
+		defer buffers.Put(pBuf)
+
+		if err := compress(pBuf, payload, o.level); err != nil {
 			return "", err
 		}
+		payload = pBuf.Bytes()
 	}
 
-	pB64String := base64.RawURLEncoding.EncodeToString(pBuf.Bytes())
+	// Encode the header, payload, and signature directly into a slice of
+	// the final length.
+	enc := base64.RawURLEncoding
+	hLen, pLen := enc.EncodedLen(len(hBytes)), enc.EncodedLen(len(payload))
+	out := make([]byte, hLen+1+pLen+1+enc.EncodedLen(64))
+	enc.Encode(out, hBytes)
+	out[hLen] = '.'
+	enc.Encode(out[hLen+1:], payload)
+	out[hLen+1+pLen] = '.'
 
-	signingInput := []byte(hB64String + "." + pB64String)
+	signingInput := out[:hLen+1+pLen]
 
-	r, s, err := sign(key, signingInput)
-	if err != nil {
+	if err := ctx.Err(); err != nil {
 		return "", err
 	}
 
-	sigB64String := base64.RawURLEncoding.EncodeToString(
-		append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...),
-	)
+	r, s, err := sign(key, signingInput, o.deterministic)
+	if err != nil {
+		return "", &SigningError{Err: err}
+	}
+
+	var sig [64]byte
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	enc.Encode(out[hLen+1+pLen+1:], sig[:])
 
-	return hB64String + "." + pB64String + "." + sigB64String, nil
+	return string(out), nil
 }
 
-func sign(key *ecdsa.PrivateKey, payload []byte) (*big.Int, *big.Int, error) {
+// EstimateSize returns the length of the JWS which SignAndSerialize would
+// return for the given payload and options, without signing it, e.g. to
+// check whether a card will fit in a single QR code before issuing it.
+func EstimateSize(payload []byte, opts ...Option) (int, error) {
+	const signatureSize = 64
+
+	// The kid, unless given, is a base64url-encoded SHA-256 hash.
+	o := newOptions(opts)
+	if o.keyID == "" {
+		o.keyID = strings.Repeat("A", 43)
+	}
+	hBytes, err := o.header()
+	if err != nil {
+		return 0, err
+	}
+	headerSize := len(hBytes)
+
+	payloadSize := len(payload)
+	if !o.uncompressed {
+		buf := buffers.Get().(*bytes.Buffer)
+		buf.Reset()
+		defer buffers.Put(buf)
+
+		if err := compress(buf, payload, o.level); err != nil {
+			return 0, err
+		}
+		payloadSize = buf.Len()
+	}
+
+	enc := base64.RawURLEncoding
+	return enc.EncodedLen(headerSize) + 1 + enc.EncodedLen(payloadSize) + 1 + enc.EncodedLen(signatureSize), nil
+}
+
+// header returns the JSON serialization of the protected header of the
+// JWS: its "alg", "zip", and "kid" parameters followed by any additional
+// parameters given with WithHeader, in the order of their names.
+func (o options) header() ([]byte, error) {
+	h := header{
+		Algorithm: algorithm,
+		Zip:       "DEF",
+		KeyID:     o.keyID,
+	}
+	if o.uncompressed {
+		h.Zip = ""
+	}
+
+	hBytes, err := json.Marshal(&h)
+	if err != nil || len(o.headers) == 0 {
+		return hBytes, err
+	}
+
+	names := make([]string, 0, len(o.headers))
+	for name := range o.headers {
+		switch name {
+		case "alg", "zip", "kid":
+			return nil, fmt.Errorf("%w %q", ErrReservedHeader, name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	hBytes = hBytes[:len(hBytes)-1]
+	for _, name := range names {
+		n, err := json.Marshal(name)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(o.headers[name])
+		if err != nil {
+			return nil, err
+		}
+		hBytes = append(append(append(append(hBytes, ','), n...), ':'), v...)
+	}
+	return append(hBytes, '}'), nil
+}
+
+// compress writes the payload to buf compressed with raw DEFLATE at the
+// given level, as required by
+// https://spec.smarthealth.cards/#health-cards-are-small.
+func compress(buf *bytes.Buffer, payload []byte, level int) error {
+	if level < flate.HuffmanOnly || level > flate.BestCompression {
+		return fmt.Errorf("%w %d", ErrInvalidCompressionLevel, level)
+	}
+	pool := &flateWriters[level-flate.HuffmanOnly]
+
+	zw, _ := pool.Get().(*flate.Writer)
+	if zw == nil {
+		var err error
+		if zw, err = flate.NewWriter(buf, level); err != nil {
+			return err
+		}
+	} else {
+		zw.Reset(buf)
+	}
+	if _, err := zw.Write(payload); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	pool.Put(zw)
+	return nil
+}
+
+// flateWriters and buffers hold DEFLATE writers, one pool per compression
+// level, and compressed payload buffers for reuse across calls to
+// SignAndSerialize, since setting up a writer at the best compression level
+// allocates far more than signing.
+var (
+	flateWriters [flate.BestCompression - flate.HuffmanOnly + 1]sync.Pool
+	buffers      = sync.Pool{
+		New: func() any { return new(bytes.Buffer) },
+	}
+)
+
+func sign(key *ecdsa.PrivateKey, payload []byte, deterministic bool) (*big.Int, *big.Int, error) {
 	hash := make([]byte, 32)
 	for i, b := range sha256.Sum256(payload) {
 		hash[i] = b
 	}
+	if deterministic {
+		return signDeterministic(key, hash)
+	}
 	return ecdsa.Sign(rand.Reader, key, hash)
 }
 
-func xtos(key *ecdsa.PrivateKey) string {
-	return base64.RawURLEncoding.EncodeToString(key.PublicKey.X.FillBytes(make([]byte, 32)))
+func xtos(key *ecdsa.PublicKey) string {
+	return base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32)))
 }
 
-func ytos(key *ecdsa.PrivateKey) string {
-	return base64.RawURLEncoding.EncodeToString(key.PublicKey.Y.FillBytes(make([]byte, 32)))
+func ytos(key *ecdsa.PublicKey) string {
+	return base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32)))
 }
 
-func kid(key *ecdsa.PrivateKey) string {
+// KeyID returns the "kid" of the given public key, as published in its
+// JWKS and set in the header of each JWS it signs: the base64url-encoded
+// SHA-256 JWK thumbprint of the key, as defined by RFC 7638. See
+// https://spec.smarthealth.cards/#generating-and-resolving-cryptographic-keys.
+// It can be used to precompute kids, e.g. for key inventories, file names,
+// or correlating logs.
+func KeyID(key *ecdsa.PublicKey) string {
+	return thumbprint(map[string]string{
+		"crv": curve,
+		"kty": keyType,
+		"x":   xtos(key),
+		"y":   ytos(key),
+	})
+}
+
+// LegacyKeyID returns the kid of the given public key as computed by
+// earlier versions of this package, by hashing a hand-formatted JWK rather
+// than one canonicalized as by RFC 7638. The two are identical for ECDSA
+// P-256 keys, whose members need no escaping; deployments which depend on
+// the earlier layout can sign with WithKeyID(LegacyKeyID(key)) to be
+// certain of keeping it.
+func LegacyKeyID(key *ecdsa.PublicKey) string {
 	jwkString := fmt.Sprintf(
 		`{"crv":"%s","kty":"%s","x":"%s","y":"%s"}`,
 		curve,
@@ -102,12 +367,8 @@ func kid(key *ecdsa.PrivateKey) string {
 		ytos(key),
 	)
 
-	hash := make([]byte, 32)
-	for i, b := range sha256.Sum256([]byte(jwkString)) {
-		hash[i] = b
-	}
-
-	return base64.RawURLEncoding.EncodeToString(hash)
+	hash := sha256.Sum256([]byte(jwkString))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
 }
 
 // JWKSJSON takes an *crypto/ecdsa.PrivateKey and returns
@@ -115,19 +376,34 @@ func kid(key *ecdsa.PrivateKey) string {
 // representing the unique publid identifying information
 // of the private key.
 func JWKSJSON(key *ecdsa.PrivateKey) ([]byte, error) {
-	return json.Marshal(jwks{
-		Keys: []jwk{
-			{
-				KeyType:   keyType,
-				KeyID:     kid(key),
-				Use:       "sig",
-				Algorithm: algorithm,
-				Curve:     curve,
-				X:         xtos(key),
-				Y:         ytos(key),
-			},
-		},
-	})
+	return JWKSJSONFromPublic(&key.PublicKey)
+}
+
+// JWKSJSONFromPublic is like JWKSJSON, but takes only the public key, so
+// that applications which publish or verify with a key, but do not sign
+// with it, need not hold its private key.
+func JWKSJSONFromPublic(key *ecdsa.PublicKey) ([]byte, error) {
+	return PublicJWKSJSON(key)
+}
+
+// PublicJWKSJSON is like JWKSJSON, but takes the public keys of one or more
+// keys, e.g. the key currently used for signing along with keys which were
+// previously used for signing and with which verifiers must still be able to
+// verify cards.
+func PublicJWKSJSON(keys ...*ecdsa.PublicKey) ([]byte, error) {
+	set := jwks{Keys: make([]jwk, len(keys))}
+	for i, key := range keys {
+		set.Keys[i] = jwk{
+			KeyType:   keyType,
+			KeyID:     KeyID(key),
+			Use:       "sig",
+			Algorithm: algorithm,
+			Curve:     curve,
+			X:         xtos(key),
+			Y:         ytos(key),
+		}
+	}
+	return json.Marshal(set)
 }
 
 type jwks struct {
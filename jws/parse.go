@@ -0,0 +1,87 @@
+package jws
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrMalformed is the error with which Parse fails when given something
+// other than a compact JWS.
+var ErrMalformed = errors.New("jws: malformed JWS")
+
+// Header is the protected header of a JWS, as returned by Parse.
+type Header struct {
+	// Algorithm is the "alg" parameter, which is "ES256" for SMART Health
+	// Cards.
+	Algorithm string `json:"alg"`
+
+	// Zip is the "zip" parameter, which is "DEF" if the payload is
+	// compressed and empty if it is not.
+	Zip string `json:"zip,omitempty"`
+
+	// KeyID is the "kid" parameter, the kid of the signing key as published
+	// in its issuer's JWKS.
+	KeyID string `json:"kid"`
+
+	// Extra holds the header's other parameters, such as those added with
+	// WithHeader, as JSON.
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// Parse splits the given compact JWS into its header, payload, and
+// signature, decoding each and inflating the payload if it is compressed,
+// without verifying the signature, e.g. to find the kid of the signing key
+// before looking it up, or to display a card before it is verified. Nothing
+// returned by Parse may be trusted until the signature has been verified,
+// e.g. with the verifier package.
+func Parse(compact string) (Header, []byte, []byte, error) {
+	parts := strings.Split(strings.TrimSpace(compact), ".")
+	if len(parts) != 3 {
+		return Header{}, nil, nil, fmt.Errorf("%w: not a compact JWS", ErrMalformed)
+	}
+
+	hBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return Header{}, nil, nil, fmt.Errorf("%w: invalid header: %v", ErrMalformed, err)
+	}
+	var h Header
+	if err := json.Unmarshal(hBytes, &h); err != nil {
+		return Header{}, nil, nil, fmt.Errorf("%w: invalid header: %v", ErrMalformed, err)
+	}
+	if err := json.Unmarshal(hBytes, &h.Extra); err != nil {
+		return Header{}, nil, nil, fmt.Errorf("%w: invalid header: %v", ErrMalformed, err)
+	}
+	delete(h.Extra, "alg")
+	delete(h.Extra, "zip")
+	delete(h.Extra, "kid")
+	if len(h.Extra) == 0 {
+		h.Extra = nil
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return Header{}, nil, nil, fmt.Errorf("%w: invalid payload: %v", ErrMalformed, err)
+	}
+	switch h.Zip {
+	case "DEF":
+		if payload, err = io.ReadAll(flate.NewReader(bytes.NewReader(payload))); err != nil {
+			return Header{}, nil, nil, fmt.Errorf("%w: invalid compressed payload: %v", ErrMalformed, err)
+		}
+	case "":
+	default:
+		return Header{}, nil, nil, fmt.Errorf("%w: unsupported compression %q", ErrMalformed, h.Zip)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Header{}, nil, nil, fmt.Errorf("%w: invalid signature: %v", ErrMalformed, err)
+	}
+
+	return h, payload, signature, nil
+}
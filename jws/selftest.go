@@ -0,0 +1,68 @@
+package jws
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// ErrSelfTest is wrapped by the errors with which SelfTest fails.
+var ErrSelfTest = errors.New("jws: key failed self-test")
+
+// selfTestPayload is the canary payload signed by SelfTest.
+const selfTestPayload = `{"iss":"https://example.com","selfTest":true}`
+
+// SelfTest checks that cards signed with the given key will verify with its
+// public key as published in its JWKS: that it is an ECDSA P-256 key whose
+// public point lies on the curve and is the one derived from its private
+// scalar, and that a canary payload signed with it, as by
+// SignAndSerialize, verifies. Call it at startup, so that a misconfigured
+// key, e.g. one whose private and public parts were loaded from mismatched
+// sources, fails fast rather than when the first card is issued.
+func SelfTest(key *ecdsa.PrivateKey) error {
+	if key == nil || key.Curve != elliptic.P256() {
+		return fmt.Errorf("%w: %v", ErrSelfTest, ErrUnsupportedKey)
+	}
+
+	public, err := key.PublicKey.ECDH()
+	if err != nil {
+		return fmt.Errorf("%w: invalid public key: %v", ErrSelfTest, err)
+	}
+	private, err := key.ECDH()
+	if err != nil {
+		return fmt.Errorf("%w: invalid private key: %v", ErrSelfTest, err)
+	}
+	if !bytes.Equal(private.PublicKey().Bytes(), public.Bytes()) {
+		return fmt.Errorf("%w: the public key does not match the private key", ErrSelfTest)
+	}
+
+	compact, err := SignAndSerialize([]byte(selfTestPayload), key)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSelfTest, err)
+	}
+	h, payload, signature, err := Parse(compact)
+	switch {
+	case err != nil:
+		return fmt.Errorf("%w: %v", ErrSelfTest, err)
+	case string(payload) != selfTestPayload:
+		return fmt.Errorf("%w: the payload does not round-trip", ErrSelfTest)
+	case h.KeyID != KeyID(&key.PublicKey):
+		return fmt.Errorf("%w: the kid does not match the public key", ErrSelfTest)
+	case len(signature) != 64:
+		return fmt.Errorf("%w: the signature is %d bytes long", ErrSelfTest, len(signature))
+	}
+
+	signingInput := compact[:strings.LastIndexByte(compact, '.')]
+	hash := sha256.Sum256([]byte(signingInput))
+	r := new(big.Int).SetBytes(signature[:32])
+	s := new(big.Int).SetBytes(signature[32:])
+	if !ecdsa.Verify(&key.PublicKey, hash[:], r, s) {
+		return fmt.Errorf("%w: the signature does not verify", ErrSelfTest)
+	}
+	return nil
+}
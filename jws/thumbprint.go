@@ -0,0 +1,45 @@
+package jws
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+)
+
+// thumbprint returns the base64url-encoded SHA-256 JWK thumbprint, as
+// defined by RFC 7638, of the JWK with the given required members.
+func thumbprint(members map[string]string) string {
+	hash := sha256.Sum256(canonicalJWK(members))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+// canonicalJWK returns the JSON object with the given members as RFC 7638
+// requires it to be hashed: with the members ordered lexicographically by
+// the code points of their names, and no whitespace. Strings are escaped
+// only where JSON requires it, not, e.g., as HTML.
+func canonicalJWK(members map[string]string) []byte {
+	names := make([]string, 0, len(members))
+	for name := range members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	buf.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		enc.Encode(name)
+		buf.Truncate(buf.Len() - 1)
+		buf.WriteByte(':')
+		enc.Encode(members[name])
+		buf.Truncate(buf.Len() - 1)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes()
+}
@@ -0,0 +1,73 @@
+package jws
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/base64"
+	"math/big"
+	"testing"
+)
+
+// rfc7638Key is the RSA key of the example in RFC 7638, section 3.1.
+var rfc7638Key = map[string]string{
+	"kty": "RSA",
+	"n": "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECP" +
+		"ebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2Qv" +
+		"zqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6W" +
+		"eZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+	"e":   "AQAB",
+	"alg": "RS256",
+	"kid": "2011-04-29",
+}
+
+func TestThumbprintRFC7638(t *testing.T) {
+	// Only the required members of an RSA key are hashed.
+	members := map[string]string{
+		"e":   rfc7638Key["e"],
+		"kty": rfc7638Key["kty"],
+		"n":   rfc7638Key["n"],
+	}
+
+	want := `{"e":"AQAB","kty":"RSA","n":"` + rfc7638Key["n"] + `"}`
+	if got := string(canonicalJWK(members)); got != want {
+		t.Errorf("canonicalJWK = %s, want %s", got, want)
+	}
+
+	if got, want := thumbprint(members), "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"; got != want {
+		t.Errorf("thumbprint = %q, want %q", got, want)
+	}
+}
+
+func TestCanonicalJWKEscaping(t *testing.T) {
+	got := string(canonicalJWK(map[string]string{"b": `<"\>`, "a": "é"}))
+	if want := `{"a":"é","b":"<\"\\>"}`; got != want {
+		t.Errorf("canonicalJWK = %s, want %s", got, want)
+	}
+}
+
+func TestKeyIDSpecExample(t *testing.T) {
+	// The issuer key of the examples at
+	// https://spec.smarthealth.cards/examples/jwks.json.
+	const (
+		x   = "11XvRWy1I2S0EyJlyf_bWfw_TQ5CJJNLw78bHXNxcgw"
+		y   = "eZXwxvO1hvCY0KucrPfKo7yAyMT6Ajc3N7OkAB6VYy8"
+		kid = "3Kfdg-XwP-7gXyywtUfUADwBumDOPKMQx-iELL11W9s"
+	)
+	key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: b64Int(t, x), Y: b64Int(t, y)}
+
+	if got := KeyID(key); got != kid {
+		t.Errorf("KeyID = %q, want %q", got, kid)
+	}
+	if got := LegacyKeyID(key); got != kid {
+		t.Errorf("LegacyKeyID = %q, want %q", got, kid)
+	}
+}
+
+func b64Int(t *testing.T, s string) *big.Int {
+	t.Helper()
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return new(big.Int).SetBytes(b)
+}
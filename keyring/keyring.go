@@ -0,0 +1,248 @@
+// Package keyring manages the signing keys of a SMART Health Card issuer
+// over their lifetime: one key is active and used to sign new cards, keys
+// which were previously active remain published in the issuer's JSON Web
+// Key Set so that the cards they signed can still be verified, and keys
+// which are retired, e.g. because they were compromised, are no longer
+// published. See
+// https://spec.smarthealth.cards/#generating-and-resolving-cryptographic-keys.
+package keyring
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/jws"
+)
+
+// ErrKeyNotFound is returned when no key in the keyring has the given kid.
+var ErrKeyNotFound = errors.New("key not found")
+
+// ErrKeyActive is returned when attempting to retire the active key; rotate
+// to a new key first.
+var ErrKeyActive = errors.New("key is active")
+
+// State is the stage of a key's lifetime.
+type State string
+
+// Stages of a key's lifetime.
+const (
+	// Active keys sign new cards and are published.
+	Active State = "active"
+
+	// Inactive keys no longer sign new cards but are still published.
+	Inactive State = "inactive"
+
+	// Retired keys are neither used to sign cards nor published.
+	Retired State = "retired"
+)
+
+// Key describes a key in a keyring, without its private parameters.
+type Key struct {
+	// ID is the key's "kid".
+	ID string `json:"kid"`
+
+	// State is the stage of the key's lifetime.
+	State State `json:"state"`
+
+	// ActivatedAt is when the key became active.
+	ActivatedAt time.Time `json:"activatedAt"`
+
+	// DeactivatedAt is when the key stopped being active, or nil if it is
+	// active.
+	DeactivatedAt *time.Time `json:"deactivatedAt,omitempty"`
+
+	// RetiredAt is when the key was retired, or nil if it has not been
+	// retired.
+	RetiredAt *time.Time `json:"retiredAt,omitempty"`
+}
+
+type entry struct {
+	Key
+	private *ecdsa.PrivateKey
+}
+
+// Keyring holds an issuer's keys. It is safe for concurrent use.
+type Keyring struct {
+	mu      sync.RWMutex
+	entries []*entry
+
+	// OnChange, if not nil, is called after each rotation or retirement,
+	// e.g. to persist the keyring with MarshalJSON so that the change
+	// survives a restart. It is called without the keyring locked.
+	OnChange func(*Keyring)
+}
+
+// New returns a keyring whose only key is the given active key.
+func New(key *ecdsa.PrivateKey) *Keyring {
+	return &Keyring{
+		entries: []*entry{{
+			Key:     Key{ID: jws.KeyID(&key.PublicKey), State: Active, ActivatedAt: time.Now()},
+			private: key,
+		}},
+	}
+}
+
+// SigningKey returns the active key.
+func (k *Keyring) SigningKey() *ecdsa.PrivateKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return k.entries[len(k.entries)-1].private
+}
+
+// PublicKeys returns the public keys of the active and inactive keys, i.e.
+// those which should be published, with the active key first.
+func (k *Keyring) PublicKeys() []*ecdsa.PublicKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	var keys []*ecdsa.PublicKey
+	for i := len(k.entries) - 1; i >= 0; i-- {
+		if k.entries[i].State != Retired {
+			keys = append(keys, &k.entries[i].private.PublicKey)
+		}
+	}
+	return keys
+}
+
+// Keys describes every key in the keyring, in the order they became
+// active.
+func (k *Keyring) Keys() []Key {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	keys := make([]Key, len(k.entries))
+	for i, e := range k.entries {
+		keys[i] = e.Key
+	}
+	return keys
+}
+
+// Rotate generates a new ECDSA P-256 key and makes it the active key; the
+// previously active key becomes inactive.
+func (k *Keyring) Rotate() (Key, error) {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return Key{}, err
+	}
+	return k.Activate(private), nil
+}
+
+// Activate adds the given key to the keyring and makes it the active key,
+// e.g. a key generated offline; the previously active key becomes
+// inactive.
+func (k *Keyring) Activate(private *ecdsa.PrivateKey) Key {
+	k.mu.Lock()
+	now := time.Now()
+	previous := k.entries[len(k.entries)-1]
+	previous.State = Inactive
+	previous.DeactivatedAt = &now
+
+	e := &entry{
+		Key:     Key{ID: jws.KeyID(&private.PublicKey), State: Active, ActivatedAt: now},
+		private: private,
+	}
+	k.entries = append(k.entries, e)
+	k.mu.Unlock()
+
+	k.changed()
+	return e.Key
+}
+
+// Retire stops publishing the inactive key with the given kid. Cards it
+// signed can no longer be verified, so keys should only be retired if they
+// are compromised or all of their cards have been reissued.
+func (k *Keyring) Retire(kid string) (Key, error) {
+	k.mu.Lock()
+	var retired *entry
+	for _, e := range k.entries {
+		if e.ID == kid {
+			retired = e
+		}
+	}
+
+	switch {
+	case retired == nil:
+		k.mu.Unlock()
+		return Key{}, ErrKeyNotFound
+	case retired.State == Active:
+		k.mu.Unlock()
+		return Key{}, ErrKeyActive
+	case retired.State == Inactive:
+		now := time.Now()
+		retired.State = Retired
+		retired.RetiredAt = &now
+	}
+	key := retired.Key
+	k.mu.Unlock()
+
+	k.changed()
+	return key, nil
+}
+
+func (k *Keyring) changed() {
+	if k.OnChange != nil {
+		k.OnChange(k)
+	}
+}
+
+type keyJSON struct {
+	Key
+	D string `json:"d"`
+	X string `json:"x"`
+	Y string `json:"y"`
+}
+
+// MarshalJSON serializes the keyring, including the private parameters of
+// its keys, so that it can be persisted and restored with Load. The result
+// is as sensitive as the keys themselves.
+func (k *Keyring) MarshalJSON() ([]byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	keys := make([]keyJSON, len(k.entries))
+	for i, e := range k.entries {
+		keys[i] = keyJSON{
+			Key: e.Key,
+			D:   e.private.D.String(),
+			X:   e.private.X.String(),
+			Y:   e.private.Y.String(),
+		}
+	}
+	return json.Marshal(keys)
+}
+
+// Load restores a keyring serialized by MarshalJSON.
+func Load(data []byte) (*Keyring, error) {
+	var keys []keyJSON
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 || keys[len(keys)-1].State != Active {
+		return nil, errors.New("keyring has no active key")
+	}
+
+	k := new(Keyring)
+	for _, key := range keys {
+		private := &ecdsa.PrivateKey{
+			D:         new(big.Int),
+			PublicKey: ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int), Y: new(big.Int)},
+		}
+		for _, p := range []struct {
+			n *big.Int
+			s string
+		}{{private.D, key.D}, {private.X, key.X}, {private.Y, key.Y}} {
+			if _, ok := p.n.SetString(p.s, 10); !ok {
+				return nil, errors.New("invalid key parameter for key " + key.ID)
+			}
+		}
+		k.entries = append(k.entries, &entry{Key: key.Key, private: private})
+	}
+	return k, nil
+}
@@ -0,0 +1,169 @@
+// Package metrics records counters and histograms describing the issuance of
+// SMART Health Cards and exposes them in the Prometheus text exposition
+// format, so that they can be scraped by Prometheus or any compatible
+// collector. See
+// https://prometheus.io/docs/instrumenting/exposition_formats/.
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/expfmt"
+)
+
+// Metrics records issuance metrics. It is safe for concurrent use. Create it
+// with New, pass it to webhandlers.New with the webhandlers.Metrics option,
+// and either serve it on a scrape endpoint such as /metrics or, since it is
+// a prometheus.Collector, register it with an existing registry, e.g.
+// prometheus.MustRegister(m), to be served along with other metrics.
+type Metrics struct {
+	cardsIssued        *prometheus.CounterVec
+	issuanceFailures   *prometheus.CounterVec
+	validationFailures *prometheus.CounterVec
+	signingDuration    prometheus.Histogram
+	qrChunks           prometheus.Histogram
+	responseSize       prometheus.Histogram
+
+	registry *prometheus.Registry
+	handler  http.Handler
+}
+
+// New returns an empty set of issuance metrics.
+func New() *Metrics {
+	m := &Metrics{
+		cardsIssued: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "shc_cards_issued_total",
+			Help: "Number of SMART Health Cards issued.",
+		}, []string{"issuer"}),
+		issuanceFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "shc_issuance_failures_total",
+			Help: "Number of issuance attempts which failed, by HTTP response code.",
+		}, []string{"code"}),
+		validationFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "shc_validation_failures_total",
+			Help: "Number of input fields which failed validation, by field and reason.",
+		}, []string{"field", "reason"}),
+		signingDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "shc_signing_duration_seconds",
+			Help:    "Time taken to sign a SMART Health Card.",
+			Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+		}),
+		qrChunks: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "shc_qr_chunks",
+			Help:    "Number of QR code chunks per issued SMART Health Card.",
+			Buckets: []float64{1, 2, 3, 4, 5, 10},
+		}),
+		responseSize: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "shc_response_size_bytes",
+			Help:    "Size of issuance responses.",
+			Buckets: []float64{1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20},
+		}),
+	}
+
+	m.registry = prometheus.NewPedanticRegistry()
+	m.registry.MustRegister(m)
+	m.handler = promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+	return m
+}
+
+// collectors returns the metrics' collectors, in the order in which they
+// are described.
+func (m *Metrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.cardsIssued,
+		m.issuanceFailures,
+		m.validationFailures,
+		m.signingDuration,
+		m.qrChunks,
+		m.responseSize,
+	}
+}
+
+// Describe sends the descriptions of the metrics to the given channel, as
+// prometheus.Collector requires.
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range m.collectors() {
+		c.Describe(ch)
+	}
+}
+
+// Collect sends the current values of the metrics to the given channel, as
+// prometheus.Collector requires.
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range m.collectors() {
+		c.Collect(ch)
+	}
+}
+
+// CardIssued records that a card was issued on behalf of the given issuer,
+// consisting of the given number of QR code chunks. If the card was not
+// encoded as QR codes, chunks should be 0 and is not recorded.
+func (m *Metrics) CardIssued(issuer string, chunks int) {
+	m.cardsIssued.WithLabelValues(issuer).Inc()
+	if chunks > 0 {
+		m.qrChunks.Observe(float64(chunks))
+	}
+}
+
+// ResponseWritten records the size in bytes of a successful issuance
+// response.
+func (m *Metrics) ResponseWritten(size int) {
+	m.responseSize.Observe(float64(size))
+}
+
+// IssuanceFailed records that an issuance attempt failed with the given
+// HTTP response code.
+func (m *Metrics) IssuanceFailed(code int) {
+	m.issuanceFailures.WithLabelValues(strconv.Itoa(code)).Inc()
+}
+
+// ValidationFailed records that the given input field failed validation for
+// the given reason.
+func (m *Metrics) ValidationFailed(field, reason string) {
+	m.validationFailures.WithLabelValues(field, reason).Inc()
+}
+
+// Signed records the time taken to sign a card.
+func (m *Metrics) Signed(d time.Duration) {
+	m.signingDuration.Observe(d.Seconds())
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	families, err := m.registry.Gather()
+	if err != nil {
+		return 0, err
+	}
+
+	cw := &countingWriter{w: w}
+	enc := expfmt.NewEncoder(cw, expfmt.NewFormat(expfmt.TypeTextPlain))
+	for _, family := range families {
+		if err := enc.Encode(family); err != nil {
+			return cw.n, err
+		}
+	}
+	return cw.n, nil
+}
+
+// ServeHTTP serves the metrics in the Prometheus text exposition format, or
+// another format negotiated by the request's Accept header.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.handler.ServeHTTP(w, r)
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
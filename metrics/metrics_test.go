@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRegisterWithRegistry(t *testing.T) {
+	m := New()
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(m); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.CardIssued("https://example.com", 2)
+			m.Signed(time.Millisecond)
+		}()
+	}
+	wg.Wait()
+	m.ValidationFailed("date_of_birth", "invalid_date")
+
+	want := `
+# HELP shc_cards_issued_total Number of SMART Health Cards issued.
+# TYPE shc_cards_issued_total counter
+shc_cards_issued_total{issuer="https://example.com"} 10
+# HELP shc_validation_failures_total Number of input fields which failed validation, by field and reason.
+# TYPE shc_validation_failures_total counter
+shc_validation_failures_total{field="date_of_birth",reason="invalid_date"} 1
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(want), "shc_cards_issued_total", "shc_validation_failures_total"); err != nil {
+		t.Error(err)
+	}
+	if got := testutil.CollectAndCount(m, "shc_signing_duration_seconds"); got != 1 {
+		t.Errorf("collected %d signing duration histograms, want 1", got)
+	}
+}
+
+func TestWriteTo(t *testing.T) {
+	m := New()
+	m.IssuanceFailed(500)
+
+	var b strings.Builder
+	n, err := m.WriteTo(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int(n) != b.Len() {
+		t.Errorf("WriteTo returned %d, wrote %d bytes", n, b.Len())
+	}
+	if want := `shc_issuance_failures_total{code="500"} 1`; !strings.Contains(b.String(), want) {
+		t.Errorf("WriteTo wrote %q, want it to contain %q", b.String(), want)
+	}
+}
@@ -0,0 +1,156 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/fhirbundle"
+	"github.com/amitkgupta/go-smarthealthcards/v2/summary"
+)
+
+// ContactSheet writes a PDF document for printing the cards of a batch,
+// e.g. by a print shop for mailing to patients: each card is laid out on a
+// letter-size page of its own, within dashed cut lines, with its QR
+// code(s) and a summary of the patient's immunizations, and labeled
+// outside the cut lines, e.g. with the patient's identifier in the batch,
+// so that printed cards can be matched to envelopes. Pages are written as
+// cards are added, so memory use does not grow with the number of cards.
+type ContactSheet struct {
+	w *countingWriter
+
+	// offsets are the offsets of the objects written, by their numbers
+	// less one; those of objects 1, 2, and 3 are set by Close.
+	offsets []int
+
+	// pages are the numbers of the page objects written.
+	pages []int
+}
+
+// NewContactSheet returns a ContactSheet writing to w. Close must be called
+// to complete the document once all cards have been added.
+func NewContactSheet(w io.Writer) *ContactSheet {
+	s := &ContactSheet{w: &countingWriter{w: w}, offsets: make([]int, 3)}
+	io.WriteString(s.w, header)
+	return s
+}
+
+// Add adds a page for the card encoded by the given QR code PNG(s), as
+// returned by the qrcode package, with the given label, which may be empty,
+// below its cut lines.
+func (s *ContactSheet) Add(fb fhirbundle.FHIRBundle, qrPNGs [][]byte, label string) error {
+	if s.w.err != nil {
+		return s.w.err
+	}
+
+	images := make([]image.Image, len(qrPNGs))
+	for i, qrPNG := range qrPNGs {
+		var err error
+		if images[i], err = png.Decode(bytes.NewReader(qrPNG)); err != nil {
+			return err
+		}
+	}
+
+	const margin = 36
+	const padding = 18
+	const gap = 36
+	const cardWidth = letterWidth - 2*margin
+	top := letterHeight - margin
+
+	p := &page{width: letterWidth, height: letterHeight}
+	c := new(content)
+
+	y := top - padding - 20
+	c.text(margin+padding, y, 20, "SMART Health Card")
+	y -= 30
+	c.text(margin+padding, y, 14, summary.Name(fb.Patient.Name))
+	y -= 18
+	c.text(margin+padding, y, 12, "Date of birth: "+fb.Patient.BirthDate.Format("2006-01-02"))
+	y -= 26
+	for i, immunization := range fb.Immunizations {
+		c.text(margin+padding, y, 11, summary.Dose(i, immunization))
+		y -= 16
+	}
+	y -= 14
+
+	// Lay the QR codes out two to a row, shrinking them if need be so that
+	// all the rows fit on the page above the label.
+	columns := min(len(images), 2)
+	rows := (len(images) + 1) / 2
+	caption := 0
+	if len(images) > 1 {
+		caption = 16
+	}
+	qrSize := 216
+	if rows > 0 {
+		qrSize = min(qrSize, (y-margin-padding-24)/rows-caption-12)
+	}
+	left := margin + (cardWidth-columns*qrSize-(columns-1)*gap)/2
+
+	for i, img := range images {
+		object, err := imageObject(img)
+		if err != nil {
+			return err
+		}
+		ref := s.write(object)
+
+		x := left + i%2*(qrSize+gap)
+		c.image(p.addImage(ref), x, y-qrSize, qrSize, qrSize)
+		if len(images) > 1 {
+			c.text(x+qrSize/2-24, y-qrSize-12, 10, fmt.Sprintf("Part %d of %d", i+1, len(images)))
+		}
+
+		if i%2 == 1 || i == len(images)-1 {
+			y -= qrSize + caption + 12
+		}
+	}
+
+	bottom := y - padding + 12
+	c.dashedRect(margin, bottom, cardWidth, top-bottom)
+	if label != "" {
+		c.text(margin, bottom-16, 9, label)
+	}
+
+	contentRef := s.write(stream("", c.Bytes()))
+	s.pages = append(s.pages, s.write(p.object(contentRef)))
+	return s.w.err
+}
+
+// Close writes the page tree and the cross-reference table, completing the
+// document. It does not close the underlying writer.
+func (s *ContactSheet) Close() error {
+	catalog, pages, font := rootObjects(s.pages)
+	for i, object := range [][]byte{catalog, pages, font} {
+		s.offsets[i] = s.w.n
+		writeObject(s.w, i+1, object)
+	}
+	writeTrailer(s.w, s.offsets, s.w.n)
+	return s.w.err
+}
+
+// write writes an object, returning its number.
+func (s *ContactSheet) write(object []byte) int {
+	s.offsets = append(s.offsets, s.w.n)
+	writeObject(s.w, len(s.offsets), object)
+	return len(s.offsets)
+}
+
+// countingWriter counts the bytes written to w, and records the first
+// error with which writing fails, after which it writes nothing.
+type countingWriter struct {
+	w   io.Writer
+	n   int
+	err error
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	n, err := cw.w.Write(p)
+	cw.n += n
+	cw.err = err
+	return n, err
+}
@@ -0,0 +1,354 @@
+// Package pdf lays out the QR code(s) of a SMART Health Card together with a
+// summary of the patient's COVID-19 immunizations on a printable PDF
+// document, either letter-size or wallet-card-size, or, with ContactSheet,
+// the cards of a whole batch on a single document for printing in bulk, or,
+// with Poster, on a poster for display.
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"strings"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/fhirbundle"
+	"github.com/amitkgupta/go-smarthealthcards/v2/summary"
+)
+
+// PageSize represents the dimensions of the pages of the generated PDF.
+type PageSize string
+
+// Supported page sizes.
+const (
+	// Letter is US letter size, 8.5in x 11in.
+	Letter PageSize = "letter"
+
+	// WalletCard is ID-1 card size, 3.375in x 2.125in, with one QR code
+	// per page.
+	WalletCard PageSize = "wallet"
+
+	// A4 is ISO A4 size, 210mm x 297mm, for posters.
+	A4 PageSize = "a4"
+)
+
+const (
+	letterWidth  = 612
+	letterHeight = 792
+
+	walletWidth  = 243
+	walletHeight = 153
+)
+
+// Card takes the core relevant data for an FHIR bundle and the PNG images of
+// the QR code(s) encoding the corresponding SMART Health Card, as returned by
+// the qrcode package, and returns a PDF document laying out the QR code(s)
+// along with the patient's name, birth date, and immunizations.
+func Card(fb fhirbundle.FHIRBundle, qrPNGs [][]byte, size PageSize) ([]byte, error) {
+	images := make([]image.Image, len(qrPNGs))
+	for i, qrPNG := range qrPNGs {
+		var err error
+		if images[i], err = png.Decode(bytes.NewReader(qrPNG)); err != nil {
+			return nil, err
+		}
+	}
+
+	d := newDocument()
+
+	switch size {
+	case Letter, "":
+		if err := letterPages(d, fb, images); err != nil {
+			return nil, err
+		}
+	case WalletCard:
+		if err := walletPages(d, fb, images); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported page size %q", size)
+	}
+
+	return d.bytes(), nil
+}
+
+func letterPages(d *document, fb fhirbundle.FHIRBundle, images []image.Image) error {
+	const margin = 54
+	const qrSize = 216
+
+	c := new(content)
+	y := letterHeight - margin - 24
+	c.text(margin, y, 24, "SMART Health Card")
+	y -= 36
+	c.text(margin, y, 14, summary.Name(fb.Patient.Name))
+	y -= 18
+	c.text(margin, y, 12, "Date of birth: "+fb.Patient.BirthDate.Format("2006-01-02"))
+	y -= 30
+	for i, immunization := range fb.Immunizations {
+		c.text(margin, y, 11, summary.Dose(i, immunization))
+		y -= 16
+	}
+	y -= 20
+
+	page := d.newPage(letterWidth, letterHeight)
+	for i, img := range images {
+		if y-qrSize < margin {
+			page.content = c
+			page = d.newPage(letterWidth, letterHeight)
+			c = new(content)
+			y = letterHeight - margin
+		}
+
+		x := margin
+		if i%2 == 1 {
+			x = letterWidth - margin - qrSize
+		}
+
+		ref, err := d.addImage(img)
+		if err != nil {
+			return err
+		}
+		c.image(page.addImage(ref), x, y-qrSize, qrSize, qrSize)
+		if len(images) > 1 {
+			c.text(x+qrSize/2-24, y-qrSize-12, 10, fmt.Sprintf("Part %d of %d", i+1, len(images)))
+		}
+
+		if i%2 == 1 || i == len(images)-1 {
+			y -= qrSize + 30
+		}
+	}
+	page.content = c
+
+	return nil
+}
+
+func walletPages(d *document, fb fhirbundle.FHIRBundle, images []image.Image) error {
+	const margin = 9
+	const qrSize = walletHeight - 2*margin
+
+	for i, img := range images {
+		page := d.newPage(walletWidth, walletHeight)
+		c := new(content)
+
+		ref, err := d.addImage(img)
+		if err != nil {
+			return err
+		}
+		c.image(page.addImage(ref), walletWidth-margin-qrSize, margin, qrSize, qrSize)
+
+		y := walletHeight - margin - 8
+		c.text(margin, y, 8, "SMART Health Card")
+		y -= 14
+		c.text(margin, y, 7, summary.Name(fb.Patient.Name))
+		y -= 9
+		c.text(margin, y, 6, "DOB "+fb.Patient.BirthDate.Format("2006-01-02"))
+		y -= 12
+		for j, immunization := range fb.Immunizations {
+			c.text(margin, y, 5, fmt.Sprintf("%d. %s %s", j+1, immunization.VaccineType, immunization.DatePerformed.Format("2006-01-02")))
+			y -= 7
+		}
+		if len(images) > 1 {
+			c.text(margin, margin, 6, fmt.Sprintf("Part %d of %d", i+1, len(images)))
+		}
+
+		page.content = c
+	}
+
+	return nil
+}
+
+// document accumulates the objects of a PDF file. Object 1 is the catalog,
+// object 2 is the page tree, and object 3 is the Helvetica font shared by
+// every page; all other objects are numbered in the order they are added.
+type document struct {
+	objects [][]byte
+	pages   []*page
+}
+
+type page struct {
+	width, height int
+	images        []int
+	content       *content
+}
+
+func newDocument() *document {
+	return &document{objects: make([][]byte, 3)}
+}
+
+func (d *document) add(object []byte) int {
+	d.objects = append(d.objects, object)
+	return len(d.objects)
+}
+
+func (d *document) newPage(width, height int) *page {
+	p := &page{width: width, height: height, content: new(content)}
+	d.pages = append(d.pages, p)
+	return p
+}
+
+func (p *page) addImage(ref int) string {
+	p.images = append(p.images, ref)
+	return fmt.Sprintf("Im%d", len(p.images))
+}
+
+func (d *document) addImage(img image.Image) (int, error) {
+	object, err := imageObject(img)
+	if err != nil {
+		return 0, err
+	}
+	return d.add(object), nil
+}
+
+// imageObject returns an image XObject drawing the given image in shades
+// of gray.
+func imageObject(img image.Image) ([]byte, error) {
+	b := img.Bounds()
+
+	var raw bytes.Buffer
+	zw := zlib.NewWriter(&raw)
+	row := make([]byte, b.Dx())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, _ := img.At(x, y).RGBA()
+			row[x-b.Min.X] = byte(((299*r + 587*g + 114*bl) / 1000) >> 8)
+		}
+		if _, err := zw.Write(row); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return stream(
+		fmt.Sprintf(
+			"/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceGray /BitsPerComponent 8 /Filter /FlateDecode",
+			b.Dx(),
+			b.Dy(),
+		),
+		raw.Bytes(),
+	), nil
+}
+
+func (d *document) bytes() []byte {
+	kids := make([]int, len(d.pages))
+	for i, p := range d.pages {
+		contentRef := d.add(stream("", p.content.Bytes()))
+		kids[i] = d.add(p.object(contentRef))
+	}
+
+	d.objects[0], d.objects[1], d.objects[2] = rootObjects(kids)
+
+	var buf bytes.Buffer
+	buf.WriteString(header)
+
+	offsets := make([]int, len(d.objects))
+	for i, object := range d.objects {
+		offsets[i] = buf.Len()
+		writeObject(&buf, i+1, object)
+	}
+	writeTrailer(&buf, offsets, buf.Len())
+
+	return buf.Bytes()
+}
+
+// header begins a PDF file, marking it as binary with a comment of
+// non-ASCII bytes.
+const header = "%PDF-1.4\n%\xe2\xe3\xcf\xd3\n"
+
+// object returns the page object of the page, drawn by the content stream
+// with the given object number.
+func (p *page) object(contentRef int) []byte {
+	var xobjects strings.Builder
+	for j, ref := range p.images {
+		fmt.Fprintf(&xobjects, " /Im%d %d 0 R", j+1, ref)
+	}
+
+	return []byte(fmt.Sprintf(
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> /XObject <<%s >> >> /Contents %d 0 R >>",
+		p.width,
+		p.height,
+		xobjects.String(),
+		contentRef,
+	))
+}
+
+// rootObjects returns objects 1, 2, and 3 of a document: the catalog, the
+// page tree of the page objects with the given numbers, and the font.
+func rootObjects(pageRefs []int) (catalog, pages, font []byte) {
+	kids := make([]string, len(pageRefs))
+	for i, ref := range pageRefs {
+		kids[i] = fmt.Sprintf("%d 0 R", ref)
+	}
+
+	catalog = []byte("<< /Type /Catalog /Pages 2 0 R >>")
+	pages = []byte(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(kids)))
+	font = []byte("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	return catalog, pages, font
+}
+
+func writeObject(w io.Writer, number int, object []byte) {
+	fmt.Fprintf(w, "%d 0 obj\n", number)
+	w.Write(object)
+	io.WriteString(w, "\nendobj\n")
+}
+
+// writeTrailer writes the cross-reference table of the objects at the
+// given offsets, numbered from 1, and the trailer, where xref is the offset
+// of the table.
+func writeTrailer(w io.Writer, offsets []int, xref int) {
+	fmt.Fprintf(w, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(w, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(w, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+}
+
+func stream(dict string, data []byte) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<< %s /Length %d >>\nstream\n", dict, len(data))
+	buf.Write(data)
+	buf.WriteString("\nendstream")
+	return buf.Bytes()
+}
+
+// content is a PDF content stream describing what is drawn on a page.
+type content struct {
+	bytes.Buffer
+}
+
+func (c *content) text(x, y, size int, s string) {
+	fmt.Fprintf(c, "BT /F1 %d Tf %d %d Td (%s) Tj ET\n", size, x, y, escape(s))
+}
+
+func (c *content) image(name string, x, y, width, height int) {
+	fmt.Fprintf(c, "q %d 0 0 %d %d %d cm /%s Do Q\n", width, height, x, y, name)
+}
+
+// dashedRect strokes a rectangle with dashed lines, e.g. to cut along.
+func (c *content) dashedRect(x, y, width, height int) {
+	fmt.Fprintf(c, "q [6 4] 0 d 0.75 w %d %d %d %d re S Q\n", x, y, width, height)
+}
+
+// escape encodes s as the body of a PDF literal string in WinAnsiEncoding,
+// replacing characters outside of Latin-1 with '?'.
+func escape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20:
+			b.WriteByte(' ')
+		case r < 0x80:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,194 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"strings"
+)
+
+const (
+	a4Width  = 595
+	a4Height = 842
+)
+
+// PosterOptions customizes the posters laid out by Poster.
+type PosterOptions struct {
+	// Size is the page size, Letter or A4; it defaults to Letter.
+	Size PageSize
+
+	// Title is drawn above the QR code(s); it defaults to "SMART Health
+	// Card".
+	Title string
+
+	// Instructions are drawn beneath the QR code(s), wrapped to fit; they
+	// default to "Scan to save your vaccination record".
+	Instructions string
+
+	// Issuer is the issuer's name, drawn beneath its logo, if not empty.
+	Issuer string
+
+	// Logo is the issuer's logo, drawn in shades of gray at the top of
+	// the poster. If it is nil, a dashed box is drawn in its place, e.g.
+	// for a sticker.
+	Logo image.Image
+}
+
+// Poster takes the PNG images of the QR code(s) encoding a SMART Health
+// Card, as returned by the qrcode package, or of other content, such as a
+// link to cards, and returns a one-page PDF document laying them out as a
+// poster, e.g. for clinics which post a patient's card for pickup, or for
+// signage. The QR code(s) are drawn as large as the page allows beneath
+// the issuer's logo and name and the title, and above the instructions;
+// several are laid out two to a row, each captioned with which part of the
+// whole it is.
+func Poster(qrPNGs [][]byte, opts PosterOptions) ([]byte, error) {
+	if len(qrPNGs) == 0 {
+		return nil, errors.New("no QR codes")
+	}
+
+	var width, height int
+	switch opts.Size {
+	case Letter, "":
+		width, height = letterWidth, letterHeight
+	case A4:
+		width, height = a4Width, a4Height
+	default:
+		return nil, fmt.Errorf("unsupported poster size %q", opts.Size)
+	}
+	title, instructions := opts.Title, opts.Instructions
+	if title == "" {
+		title = "SMART Health Card"
+	}
+	if instructions == "" {
+		instructions = "Scan to save your vaccination record"
+	}
+
+	const margin = 54
+	const gap = 24
+	const logoWidth, logoHeight = 180, 90
+	const issuerSize, titleSize, instructionsSize, captionSize = 14, 32, 20, 12
+	text := width - 2*margin
+
+	issuer := wrapText(opts.Issuer, issuerSize, text)
+	titleLines := wrapText(title, titleSize, text)
+	instructionLines := wrapText(instructions, instructionsSize, text)
+
+	d := newDocument()
+	page := d.newPage(width, height)
+	c := page.content
+
+	// Lay the text out from the top and bottom of the page, and the QR
+	// codes as large as fit in between, centered in any space left over.
+	y := height - margin - logoHeight
+	logoX := (width - logoWidth) / 2
+	if opts.Logo != nil && !opts.Logo.Bounds().Empty() {
+		// Draw the logo on white, so that transparent areas are not black.
+		lb := opts.Logo.Bounds()
+		logo := image.NewRGBA(lb)
+		draw.Draw(logo, lb, image.White, image.Point{}, draw.Src)
+		draw.Draw(logo, lb, opts.Logo, lb.Min, draw.Over)
+		ref, err := d.addImage(logo)
+		if err != nil {
+			return nil, err
+		}
+		scale := min(float64(logoWidth)/float64(lb.Dx()), float64(logoHeight)/float64(lb.Dy()))
+		w, h := int(float64(lb.Dx())*scale), int(float64(lb.Dy())*scale)
+		c.image(page.addImage(ref), logoX+(logoWidth-w)/2, y+(logoHeight-h)/2, w, h)
+	} else {
+		c.dashedRect(logoX, y, logoWidth, logoHeight)
+		c.centeredText(width/2, y+logoHeight/2-5, 14, "Logo")
+	}
+
+	y -= gap
+	for _, line := range issuer {
+		y -= issuerSize
+		c.centeredText(width/2, y, issuerSize, line)
+		y -= issuerSize / 3
+	}
+	y -= gap / 2
+	for _, line := range titleLines {
+		y -= titleSize
+		c.centeredText(width/2, y, titleSize, line)
+		y -= titleSize / 3
+	}
+	y -= gap
+
+	bottom := margin + len(instructionLines)*(instructionsSize*4/3) + gap
+	columns, rows := min(len(qrPNGs), 2), (len(qrPNGs)+1)/2
+	caption := 0
+	if len(qrPNGs) > 1 {
+		caption = captionSize * 2
+	}
+	qrSize := min((text-(columns-1)*gap)/columns, (y-bottom)/rows-caption)
+	if qrSize <= 0 {
+		return nil, errors.New("the text leaves no room for the QR codes")
+	}
+	y -= (y - bottom - rows*(qrSize+caption)) / 2
+
+	left := (width - columns*qrSize - (columns-1)*gap) / 2
+	for i, qrPNG := range qrPNGs {
+		img, err := png.Decode(bytes.NewReader(qrPNG))
+		if err != nil {
+			return nil, err
+		}
+		ref, err := d.addImage(img)
+		if err != nil {
+			return nil, err
+		}
+
+		x := left + i%2*(qrSize+gap)
+		c.image(page.addImage(ref), x, y-qrSize, qrSize, qrSize)
+		if len(qrPNGs) > 1 {
+			c.centeredText(x+qrSize/2, y-qrSize-captionSize-4, captionSize, fmt.Sprintf("Part %d of %d", i+1, len(qrPNGs)))
+		}
+
+		if i%2 == 1 || i == len(qrPNGs)-1 {
+			y -= qrSize + caption
+		}
+	}
+
+	y = bottom - gap
+	for _, line := range instructionLines {
+		y -= instructionsSize
+		c.centeredText(width/2, y, instructionsSize, line)
+		y -= instructionsSize / 3
+	}
+
+	return d.bytes(), nil
+}
+
+// textWidth approximates the width of s in Helvetica of the given size,
+// from the average width of its glyphs.
+func textWidth(size int, s string) int {
+	return size * len([]rune(s)) * 11 / 20
+}
+
+// wrapText breaks s into lines, between words, which fit in the given
+// width in Helvetica of the given size, as approximated by textWidth.
+func wrapText(s string, size, width int) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(s) {
+		switch {
+		case line == "":
+			line = word
+		case textWidth(size, line+" "+word) <= width:
+			line += " " + word
+		default:
+			lines, line = append(lines, line), word
+		}
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// centeredText draws s centered on x, as approximated by textWidth.
+func (c *content) centeredText(x, y, size int, s string) {
+	c.text(x-textWidth(size, s)/2, y, size, s)
+}
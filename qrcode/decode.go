@@ -0,0 +1,640 @@
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"  // Register GIF for Decode.
+	_ "image/jpeg" // Register JPEG for Decode.
+	_ "image/png"  // Register PNG for Decode.
+	"strconv"
+	"strings"
+)
+
+// ErrNoQRCode is returned when an image does not contain a QR code which can
+// be read.
+var ErrNoQRCode = errors.New("no readable QR code found in image")
+
+// Decode is the inverse of Encode: it reads the QR code in each of the given
+// images, which may be PNG, JPEG, or GIF files, and reassembles the JWS from
+// the "shc:/" strings they encode. The images may be given in any order.
+//
+// Only upright, unskewed images of QR codes on a plain background are
+// supported, such as the PNGs returned by Encode, screenshots of them, or
+// flatbed scans; photos taken at an angle generally cannot be read.
+func Decode(images ...[]byte) (string, error) {
+	shcStrings := make([]string, len(images))
+	for i, data := range images {
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return "", err
+		}
+
+		if shcStrings[i], err = DecodeImage(img); err != nil {
+			return "", err
+		}
+	}
+
+	return DecodeStrings(shcStrings)
+}
+
+// DecodeImage returns the text encoded by the QR code in the given image,
+// e.g. an "shc:/" string. It is subject to the same restrictions on images
+// as Decode.
+func DecodeImage(img image.Image) (string, error) {
+	modules, err := sample(img)
+	if err != nil {
+		return "", err
+	}
+
+	return readSymbol(modules)
+}
+
+// ErrInvalidSHCString wraps the errors with which DecodeStrings fails.
+var ErrInvalidSHCString = errors.New("invalid shc:/ strings")
+
+// DecodeStrings is the inverse of EncodeToStrings: it reassembles the JWS
+// from the "shc:/" strings encoding its chunks, which may be given in any
+// order. See https://spec.smarthealth.cards/#encoding-chunks-as-qr-codes.
+func DecodeStrings(shcStrings []string) (string, error) {
+	content, err := decodeStrings(shcStrings)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidSHCString, err)
+	}
+	return content, nil
+}
+
+func decodeStrings(shcStrings []string) (string, error) {
+	if len(shcStrings) == 0 {
+		return "", errors.New("no shc:/ strings given")
+	}
+
+	chunks := make([]string, len(shcStrings))
+	for _, s := range shcStrings {
+		if !strings.HasPrefix(s, "shc:/") {
+			return "", fmt.Errorf("%.20q is not an shc:/ string", s)
+		}
+		s = strings.TrimPrefix(s, "shc:/")
+
+		c, n := 1, 1
+		if parts := strings.Split(s, "/"); len(parts) == 3 {
+			var errC, errN error
+			c, errC = strconv.Atoi(parts[0])
+			n, errN = strconv.Atoi(parts[1])
+			if errC != nil || errN != nil || c < 1 || c > n {
+				return "", fmt.Errorf("invalid chunk index %s/%s", parts[0], parts[1])
+			}
+			s = parts[2]
+		} else if len(parts) != 1 {
+			return "", errors.New("too many / separators")
+		}
+
+		if n != len(shcStrings) {
+			return "", fmt.Errorf("expected %d chunks, got %d", n, len(shcStrings))
+		}
+		if chunks[c-1] != "" {
+			return "", fmt.Errorf("duplicate chunk %d", c)
+		}
+
+		chunk, err := numericDecode(s)
+		if err != nil {
+			return "", err
+		}
+		chunks[c-1] = chunk
+	}
+
+	return strings.Join(chunks, ""), nil
+}
+
+// sample locates the QR code in the image, which is assumed to be upright
+// and surrounded by a light quiet zone, with nothing dark beside or above
+// it, and returns the darkness of each of
+// its modules, indexed by row and then column.
+func sample(img image.Image) ([][]bool, error) {
+	b := img.Bounds()
+
+	lum := make([][]uint8, b.Dy())
+	var lo, hi uint8 = 255, 0
+	for y := range lum {
+		lum[y] = make([]uint8, b.Dx())
+		for x := range lum[y] {
+			l := color.GrayModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.Gray).Y
+			lum[y][x] = l
+			if l < lo {
+				lo = l
+			}
+			if l > hi {
+				hi = l
+			}
+		}
+	}
+	if hi-lo < 64 {
+		return nil, ErrNoQRCode
+	}
+	threshold := lo + (hi-lo)/2
+	dark := func(x, y int) bool { return lum[y][x] < threshold }
+
+	minX, minY, maxX, maxY := b.Dx(), b.Dy(), -1, -1
+	for y := range lum {
+		for x := range lum[y] {
+			if dark(x, y) {
+				minX, minY = min(minX, x), min(minY, y)
+				maxX, maxY = max(maxX, x), max(maxY, y)
+			}
+		}
+	}
+	width, height := maxX-minX+1, maxY-minY+1
+	if height > width {
+		// QR codes are square, so anything further down, such as the
+		// label drawn by Options.Label, is not part of the QR code.
+		height = width
+	}
+	if width < 21 || height < 21 {
+		return nil, ErrNoQRCode
+	}
+
+	// The top-left finder pattern is 7 modules wide. Measure it half a
+	// module below its top edge, to avoid any blurring along that edge.
+	run := func(y int) int {
+		n := 0
+		for x := minX; x <= maxX && dark(x, y); x++ {
+			n++
+		}
+		return n
+	}
+	finderWidth := run(minY + run(minY)/14)
+	if finderWidth == 0 {
+		return nil, ErrNoQRCode
+	}
+
+	// Count the modules along the horizontal timing pattern, which
+	// alternates between dark and light from the seventh column after the
+	// top-left finder pattern to the column before the top-right one.
+	module := float64(finderWidth) / 7
+	y := minY + int(6.5*module)
+	darkRuns := 0
+	for x, prev := minX+int(7.5*module), false; x <= maxX-int(7.5*module); x++ {
+		d := dark(x, y)
+		if d && !prev {
+			darkRuns++
+		}
+		prev = d
+	}
+	size := 2*darkRuns + 15
+	if size < 21 || size > 177 || (size-17)%4 != 0 {
+		return nil, ErrNoQRCode
+	}
+
+	moduleWidth := float64(width) / float64(size)
+	moduleHeight := float64(height) / float64(size)
+	modules := make([][]bool, size)
+	for row := range modules {
+		modules[row] = make([]bool, size)
+		for col := range modules[row] {
+			modules[row][col] = dark(
+				minX+int((float64(col)+0.5)*moduleWidth),
+				minY+int((float64(row)+0.5)*moduleHeight),
+			)
+		}
+	}
+
+	for _, corner := range [][2]int{{0, 0}, {0, size - 7}, {size - 7, 0}} {
+		row, col := corner[0], corner[1]
+		if !modules[row][col] || modules[row+1][col+1] || !modules[row+3][col+3] {
+			return nil, ErrNoQRCode
+		}
+	}
+
+	return modules, nil
+}
+
+// readSymbol decodes the text of the QR code with the given modules. See
+// ISO/IEC 18004.
+func readSymbol(modules [][]bool) (string, error) {
+	size := len(modules)
+	version := (size - 17) / 4
+
+	level, mask, err := readFormat(modules)
+	if err != nil {
+		return "", err
+	}
+
+	function := functionPatterns(version)
+
+	var codewords []byte
+	var current byte
+	bits := 0
+	up := true
+	for col := size - 1; col > 0; col -= 2 {
+		if col == 6 {
+			col--
+		}
+		for i := 0; i < size; i++ {
+			row := i
+			if up {
+				row = size - 1 - i
+			}
+			for c := col; c > col-2; c-- {
+				if function[row][c] {
+					continue
+				}
+				current <<= 1
+				if modules[row][c] != masked(mask, row, c) {
+					current |= 1
+				}
+				if bits++; bits == 8 {
+					codewords = append(codewords, current)
+					current, bits = 0, 0
+				}
+			}
+		}
+		up = !up
+	}
+
+	data, err := deinterleave(codewords, ecBlocks[version-1][level])
+	if err != nil {
+		return "", err
+	}
+
+	return readSegments(data, version)
+}
+
+// Error correction levels, in the order of ecBlocks.
+const (
+	levelL = iota
+	levelM
+	levelQ
+	levelH
+)
+
+// readFormat returns the error correction level and mask pattern of the
+// symbol from whichever copy of its format information is closest to a
+// valid code.
+func readFormat(modules [][]bool) (int, int, error) {
+	size := len(modules)
+	bit := func(row, col int) uint {
+		if modules[row][col] {
+			return 1
+		}
+		return 0
+	}
+
+	var first, second uint
+	for col := 0; col <= 5; col++ {
+		first = first<<1 | bit(8, col)
+	}
+	first = first<<1 | bit(8, 7)
+	first = first<<1 | bit(8, 8)
+	first = first<<1 | bit(7, 8)
+	for row := 5; row >= 0; row-- {
+		first = first<<1 | bit(row, 8)
+	}
+	for row := size - 1; row >= size-7; row-- {
+		second = second<<1 | bit(row, 8)
+	}
+	for col := size - 8; col < size; col++ {
+		second = second<<1 | bit(8, col)
+	}
+
+	best, bestDistance := 0, 16
+	for format := 0; format < 32; format++ {
+		code := uint(format<<10|bch(format<<10, 0x537, 10)) ^ 0x5412
+		for _, read := range []uint{first, second} {
+			if d := popcount(code ^ read); d < bestDistance {
+				best, bestDistance = format, d
+			}
+		}
+	}
+	if bestDistance > 3 {
+		return 0, 0, errors.New("unreadable QR code format information")
+	}
+
+	// The format's error correction level bits are 01 for L, 00 for M,
+	// 11 for Q, and 10 for H.
+	level := [4]int{levelM, levelL, levelH, levelQ}[best>>3]
+	return level, best & 7, nil
+}
+
+// bch returns the remainder of dividing value by the given generator
+// polynomial of the given degree over GF(2).
+func bch(value, generator, degree int) int {
+	for i := 30; i >= degree; i-- {
+		if value&(1<<i) != 0 {
+			value ^= generator << (i - degree)
+		}
+	}
+	return value
+}
+
+func popcount(v uint) int {
+	n := 0
+	for ; v != 0; v &= v - 1 {
+		n++
+	}
+	return n
+}
+
+// masked reports whether the given mask pattern inverts the module at the
+// given row and column.
+func masked(mask, row, col int) bool {
+	switch mask {
+	case 0:
+		return (row+col)%2 == 0
+	case 1:
+		return row%2 == 0
+	case 2:
+		return col%3 == 0
+	case 3:
+		return (row+col)%3 == 0
+	case 4:
+		return (row/2+col/3)%2 == 0
+	case 5:
+		return (row*col)%2+(row*col)%3 == 0
+	case 6:
+		return ((row*col)%2+(row*col)%3)%2 == 0
+	default:
+		return ((row+col)%2+(row*col)%3)%2 == 0
+	}
+}
+
+// functionPatterns returns which modules of a symbol of the given version
+// are finder, separator, timing, or alignment patterns, or hold format or
+// version information, rather than data.
+func functionPatterns(version int) [][]bool {
+	size := 17 + 4*version
+	function := make([][]bool, size)
+	for row := range function {
+		function[row] = make([]bool, size)
+	}
+	region := func(top, left, height, width int) {
+		for row := top; row < top+height; row++ {
+			for col := left; col < left+width; col++ {
+				function[row][col] = true
+			}
+		}
+	}
+
+	region(0, 0, 9, 9)
+	region(0, size-8, 9, 8)
+	region(size-8, 0, 8, 9)
+	region(6, 9, 1, size-17)
+	region(9, 6, size-17, 1)
+
+	centers := alignmentCenters[version-1]
+	for i, row := range centers {
+		for j, col := range centers {
+			last := len(centers) - 1
+			if (i == 0 && (j == 0 || j == last)) || (i == last && j == 0) {
+				continue
+			}
+			region(row-2, col-2, 5, 5)
+		}
+	}
+
+	if version >= 7 {
+		region(0, size-11, 6, 3)
+		region(size-11, 0, 3, 6)
+	}
+
+	return function
+}
+
+// deinterleave splits the symbol's codewords into its blocks, corrects any
+// errors in each block, and returns the data codewords of the blocks in
+// order.
+func deinterleave(codewords []byte, groups []ecBlock) ([]byte, error) {
+	var blocks [][]byte
+	var dataLengths []int
+	ecLength := groups[0].codewords - groups[0].data
+	for _, g := range groups {
+		for i := 0; i < g.blocks; i++ {
+			blocks = append(blocks, make([]byte, 0, g.codewords))
+			dataLengths = append(dataLengths, g.data)
+		}
+	}
+
+	next := 0
+	take := func() (byte, error) {
+		if next >= len(codewords) {
+			return 0, errors.New("QR code is too short")
+		}
+		next++
+		return codewords[next-1], nil
+	}
+
+	maxData := dataLengths[len(dataLengths)-1]
+	for i := 0; i < maxData+ecLength; i++ {
+		for b := range blocks {
+			if i >= dataLengths[b] && i < maxData {
+				continue
+			}
+			c, err := take()
+			if err != nil {
+				return nil, err
+			}
+			blocks[b] = append(blocks[b], c)
+		}
+	}
+
+	var data []byte
+	for b, block := range blocks {
+		if err := correct(block, ecLength); err != nil {
+			return nil, err
+		}
+		data = append(data, block[:dataLengths[b]]...)
+	}
+	return data, nil
+}
+
+// readSegments decodes the text held by the data codewords of a symbol of
+// the given version.
+func readSegments(data []byte, version int) (string, error) {
+	r := bitReader{data: data}
+	var text strings.Builder
+
+	countBits := func(numeric, alphanumeric, bytes int) [3]int {
+		return [3]int{numeric, alphanumeric, bytes}
+	}
+	var counts [3]int
+	switch {
+	case version <= 9:
+		counts = countBits(10, 9, 8)
+	case version <= 26:
+		counts = countBits(12, 11, 16)
+	default:
+		counts = countBits(14, 13, 16)
+	}
+
+	for r.remaining() >= 4 {
+		switch mode := r.read(4); mode {
+		case 0x0:
+			return text.String(), nil
+		case 0x1:
+			for n := r.read(counts[0]); n > 0; {
+				digits := min(n, 3)
+				value := r.read([4]int{0, 4, 7, 10}[digits])
+				fmt.Fprintf(&text, "%0*d", digits, value)
+				n -= digits
+			}
+		case 0x2:
+			const alphanumeric = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ $%*+-./:"
+			for n := r.read(counts[1]); n > 0; {
+				if n == 1 {
+					text.WriteByte(alphanumeric[r.read(6)%45])
+					break
+				}
+				value := r.read(11)
+				text.WriteByte(alphanumeric[(value/45)%45])
+				text.WriteByte(alphanumeric[value%45])
+				n -= 2
+			}
+		case 0x4:
+			for n := r.read(counts[2]); n > 0; n-- {
+				text.WriteByte(byte(r.read(8)))
+			}
+		case 0x7:
+			// Skip the ECI designator; SHC content is ASCII.
+			switch {
+			case r.read(1) == 0:
+				r.read(7)
+			case r.read(1) == 0:
+				r.read(14)
+			default:
+				r.read(22)
+			}
+		default:
+			return "", fmt.Errorf("unsupported QR code mode %d", mode)
+		}
+
+		if r.overrun {
+			return "", errors.New("QR code data is truncated")
+		}
+	}
+
+	return text.String(), nil
+}
+
+type bitReader struct {
+	data    []byte
+	offset  int
+	overrun bool
+}
+
+func (r *bitReader) remaining() int {
+	return len(r.data)*8 - r.offset
+}
+
+func (r *bitReader) read(n int) int {
+	v := 0
+	for i := 0; i < n; i++ {
+		if r.offset >= len(r.data)*8 {
+			r.overrun = true
+			return v
+		}
+		v <<= 1
+		if r.data[r.offset/8]&(0x80>>(r.offset%8)) != 0 {
+			v |= 1
+		}
+		r.offset++
+	}
+	return v
+}
+
+// ecBlock describes a group of blocks of a QR code with the same length:
+// the number of blocks, and the number of codewords and data codewords in
+// each.
+type ecBlock struct {
+	blocks, codewords, data int
+}
+
+// ecBlocks lists the groups of blocks of each version of QR code, for each
+// error correction level in the order L, M, Q, H.
+var ecBlocks = [40][4][]ecBlock{
+	{{{1, 26, 19}}, {{1, 26, 16}}, {{1, 26, 13}}, {{1, 26, 9}}},
+	{{{1, 44, 34}}, {{1, 44, 28}}, {{1, 44, 22}}, {{1, 44, 16}}},
+	{{{1, 70, 55}}, {{1, 70, 44}}, {{2, 35, 17}}, {{2, 35, 13}}},
+	{{{1, 100, 80}}, {{2, 50, 32}}, {{2, 50, 24}}, {{4, 25, 9}}},
+	{{{1, 134, 108}}, {{2, 67, 43}}, {{2, 33, 15}, {2, 34, 16}}, {{2, 33, 11}, {2, 34, 12}}},
+	{{{2, 86, 68}}, {{4, 43, 27}}, {{4, 43, 19}}, {{4, 43, 15}}},
+	{{{2, 98, 78}}, {{4, 49, 31}}, {{2, 32, 14}, {4, 33, 15}}, {{4, 39, 13}, {1, 40, 14}}},
+	{{{2, 121, 97}}, {{2, 60, 38}, {2, 61, 39}}, {{4, 40, 18}, {2, 41, 19}}, {{4, 40, 14}, {2, 41, 15}}},
+	{{{2, 146, 116}}, {{3, 58, 36}, {2, 59, 37}}, {{4, 36, 16}, {4, 37, 17}}, {{4, 36, 12}, {4, 37, 13}}},
+	{{{2, 86, 68}, {2, 87, 69}}, {{4, 69, 43}, {1, 70, 44}}, {{6, 43, 19}, {2, 44, 20}}, {{6, 43, 15}, {2, 44, 16}}},
+	{{{4, 101, 81}}, {{1, 80, 50}, {4, 81, 51}}, {{4, 50, 22}, {4, 51, 23}}, {{3, 36, 12}, {8, 37, 13}}},
+	{{{2, 116, 92}, {2, 117, 93}}, {{6, 58, 36}, {2, 59, 37}}, {{4, 46, 20}, {6, 47, 21}}, {{7, 42, 14}, {4, 43, 15}}},
+	{{{4, 133, 107}}, {{8, 59, 37}, {1, 60, 38}}, {{8, 44, 20}, {4, 45, 21}}, {{12, 33, 11}, {4, 34, 12}}},
+	{{{3, 145, 115}, {1, 146, 116}}, {{4, 64, 40}, {5, 65, 41}}, {{11, 36, 16}, {5, 37, 17}}, {{11, 36, 12}, {5, 37, 13}}},
+	{{{5, 109, 87}, {1, 110, 88}}, {{5, 65, 41}, {5, 66, 42}}, {{5, 54, 24}, {7, 55, 25}}, {{11, 36, 12}, {7, 37, 13}}},
+	{{{5, 122, 98}, {1, 123, 99}}, {{7, 73, 45}, {3, 74, 46}}, {{15, 43, 19}, {2, 44, 20}}, {{3, 45, 15}, {13, 46, 16}}},
+	{{{1, 135, 107}, {5, 136, 108}}, {{10, 74, 46}, {1, 75, 47}}, {{1, 50, 22}, {15, 51, 23}}, {{2, 42, 14}, {17, 43, 15}}},
+	{{{5, 150, 120}, {1, 151, 121}}, {{9, 69, 43}, {4, 70, 44}}, {{17, 50, 22}, {1, 51, 23}}, {{2, 42, 14}, {19, 43, 15}}},
+	{{{3, 141, 113}, {4, 142, 114}}, {{3, 70, 44}, {11, 71, 45}}, {{17, 47, 21}, {4, 48, 22}}, {{9, 39, 13}, {16, 40, 14}}},
+	{{{3, 135, 107}, {5, 136, 108}}, {{3, 67, 41}, {13, 68, 42}}, {{15, 54, 24}, {5, 55, 25}}, {{15, 43, 15}, {10, 44, 16}}},
+	{{{4, 144, 116}, {4, 145, 117}}, {{17, 68, 42}}, {{17, 50, 22}, {6, 51, 23}}, {{19, 46, 16}, {6, 47, 17}}},
+	{{{2, 139, 111}, {7, 140, 112}}, {{17, 74, 46}}, {{7, 54, 24}, {16, 55, 25}}, {{34, 37, 13}}},
+	{{{4, 151, 121}, {5, 152, 122}}, {{4, 75, 47}, {14, 76, 48}}, {{11, 54, 24}, {14, 55, 25}}, {{16, 45, 15}, {14, 46, 16}}},
+	{{{6, 147, 117}, {4, 148, 118}}, {{6, 73, 45}, {14, 74, 46}}, {{11, 54, 24}, {16, 55, 25}}, {{30, 46, 16}, {2, 47, 17}}},
+	{{{8, 132, 106}, {4, 133, 107}}, {{8, 75, 47}, {13, 76, 48}}, {{7, 54, 24}, {22, 55, 25}}, {{22, 45, 15}, {13, 46, 16}}},
+	{{{10, 142, 114}, {2, 143, 115}}, {{19, 74, 46}, {4, 75, 47}}, {{28, 50, 22}, {6, 51, 23}}, {{33, 46, 16}, {4, 47, 17}}},
+	{{{8, 152, 122}, {4, 153, 123}}, {{22, 73, 45}, {3, 74, 46}}, {{8, 53, 23}, {26, 54, 24}}, {{12, 45, 15}, {28, 46, 16}}},
+	{{{3, 147, 117}, {10, 148, 118}}, {{3, 73, 45}, {23, 74, 46}}, {{4, 54, 24}, {31, 55, 25}}, {{11, 45, 15}, {31, 46, 16}}},
+	{{{7, 146, 116}, {7, 147, 117}}, {{21, 73, 45}, {7, 74, 46}}, {{1, 53, 23}, {37, 54, 24}}, {{19, 45, 15}, {26, 46, 16}}},
+	{{{5, 145, 115}, {10, 146, 116}}, {{19, 75, 47}, {10, 76, 48}}, {{15, 54, 24}, {25, 55, 25}}, {{23, 45, 15}, {25, 46, 16}}},
+	{{{13, 145, 115}, {3, 146, 116}}, {{2, 74, 46}, {29, 75, 47}}, {{42, 54, 24}, {1, 55, 25}}, {{23, 45, 15}, {28, 46, 16}}},
+	{{{17, 145, 115}}, {{10, 74, 46}, {23, 75, 47}}, {{10, 54, 24}, {35, 55, 25}}, {{19, 45, 15}, {35, 46, 16}}},
+	{{{17, 145, 115}, {1, 146, 116}}, {{14, 74, 46}, {21, 75, 47}}, {{29, 54, 24}, {19, 55, 25}}, {{11, 45, 15}, {46, 46, 16}}},
+	{{{13, 145, 115}, {6, 146, 116}}, {{14, 74, 46}, {23, 75, 47}}, {{44, 54, 24}, {7, 55, 25}}, {{59, 46, 16}, {1, 47, 17}}},
+	{{{12, 151, 121}, {7, 152, 122}}, {{12, 75, 47}, {26, 76, 48}}, {{39, 54, 24}, {14, 55, 25}}, {{22, 45, 15}, {41, 46, 16}}},
+	{{{6, 151, 121}, {14, 152, 122}}, {{6, 75, 47}, {34, 76, 48}}, {{46, 54, 24}, {10, 55, 25}}, {{2, 45, 15}, {64, 46, 16}}},
+	{{{17, 152, 122}, {4, 153, 123}}, {{29, 74, 46}, {14, 75, 47}}, {{49, 54, 24}, {10, 55, 25}}, {{24, 45, 15}, {46, 46, 16}}},
+	{{{4, 152, 122}, {18, 153, 123}}, {{13, 74, 46}, {32, 75, 47}}, {{48, 54, 24}, {14, 55, 25}}, {{42, 45, 15}, {32, 46, 16}}},
+	{{{20, 147, 117}, {4, 148, 118}}, {{40, 75, 47}, {7, 76, 48}}, {{43, 54, 24}, {22, 55, 25}}, {{10, 45, 15}, {67, 46, 16}}},
+	{{{19, 148, 118}, {6, 149, 119}}, {{18, 75, 47}, {31, 76, 48}}, {{34, 54, 24}, {34, 55, 25}}, {{20, 45, 15}, {61, 46, 16}}},
+}
+
+// alignmentCenters lists the row and column coordinates of the centers of
+// the alignment patterns of each version of QR code.
+var alignmentCenters = [40][]int{
+	{},
+	{6, 18},
+	{6, 22},
+	{6, 26},
+	{6, 30},
+	{6, 34},
+	{6, 22, 38},
+	{6, 24, 42},
+	{6, 26, 46},
+	{6, 28, 50},
+	{6, 30, 54},
+	{6, 32, 58},
+	{6, 34, 62},
+	{6, 26, 46, 66},
+	{6, 26, 48, 70},
+	{6, 26, 50, 74},
+	{6, 30, 54, 78},
+	{6, 30, 56, 82},
+	{6, 30, 58, 86},
+	{6, 34, 62, 90},
+	{6, 28, 50, 72, 94},
+	{6, 26, 50, 74, 98},
+	{6, 30, 54, 78, 102},
+	{6, 28, 54, 80, 106},
+	{6, 32, 58, 84, 110},
+	{6, 30, 58, 86, 114},
+	{6, 34, 62, 90, 118},
+	{6, 26, 50, 74, 98, 122},
+	{6, 30, 54, 78, 102, 126},
+	{6, 26, 52, 78, 104, 130},
+	{6, 30, 56, 82, 108, 134},
+	{6, 34, 60, 86, 112, 138},
+	{6, 30, 58, 86, 114, 142},
+	{6, 34, 62, 90, 118, 146},
+	{6, 30, 54, 78, 102, 126, 150},
+	{6, 24, 50, 76, 102, 128, 154},
+	{6, 28, 54, 80, 106, 132, 158},
+	{6, 32, 58, 84, 110, 136, 162},
+	{6, 26, 54, 82, 110, 138, 166},
+	{6, 30, 58, 86, 114, 142, 170},
+}
@@ -0,0 +1,47 @@
+package qrcode
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodeRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"short", "eyJhbGciOiJFUzI1NiIsInppcCI6IkRFRiJ9.e30.c2ln"},
+		{"long", jwsOfLength(900)},
+		{"several chunks", jwsOfLength(2500)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pngs, err := Encode(tt.content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Decode(pngs...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.content {
+				t.Errorf("Decode(Encode(content)) = %q, want %q", got, tt.content)
+			}
+		})
+	}
+}
+
+// jwsOfLength returns a string of the given length in the alphabet of a
+// JWS: base64url segments separated by two dots.
+func jwsOfLength(n int) string {
+	const alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+	var b strings.Builder
+	for i := 0; b.Len() < n; i++ {
+		if i == n/3 || i == 2*n/3 {
+			b.WriteByte('.')
+			continue
+		}
+		b.WriteByte(alphabet[(i*7)%len(alphabet)])
+	}
+	return b.String()
+}
@@ -0,0 +1,41 @@
+package qrcode_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/conformance"
+	"github.com/amitkgupta/go-smarthealthcards/v2/fuzz"
+)
+
+// FuzzSHCStrings runs fuzz.SHCStrings on newline-separated "shc:/" strings,
+// seeded with those of the golden examples.
+func FuzzSHCStrings(f *testing.F) {
+	examples, err := conformance.Golden()
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, ex := range examples {
+		f.Add([]byte(strings.Join(ex.SHCStrings, "\n")))
+	}
+	f.Add([]byte("shc:/1/2/"))
+	f.Add([]byte("shc:/-1"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fuzz.SHCStrings(data)
+	})
+}
+
+// FuzzQRImage runs fuzz.QRImage on images, seeded with the example QR code.
+func FuzzQRImage(f *testing.F) {
+	png, err := os.ReadFile("../examples/qr.png")
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(png)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fuzz.QRImage(data)
+	})
+}
@@ -0,0 +1,164 @@
+package qrcode
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+)
+
+// glyphWidth and glyphHeight are the size, in font pixels, of each glyph
+// of the label font, which is spaced by one font pixel.
+const (
+	glyphWidth  = 5
+	glyphHeight = 7
+)
+
+// glyphs is the label font: a 5x7 bitmap font of capital letters, digits,
+// and the punctuation common in names and dates. Each row of a glyph is
+// a byte whose five low bits are its pixels, from left to right.
+var glyphs = map[rune][glyphHeight]uint8{
+	' ':  {},
+	'A':  {0b01110, 0b10001, 0b10001, 0b11111, 0b10001, 0b10001, 0b10001},
+	'B':  {0b11110, 0b10001, 0b10001, 0b11110, 0b10001, 0b10001, 0b11110},
+	'C':  {0b01110, 0b10001, 0b10000, 0b10000, 0b10000, 0b10001, 0b01110},
+	'D':  {0b11110, 0b10001, 0b10001, 0b10001, 0b10001, 0b10001, 0b11110},
+	'E':  {0b11111, 0b10000, 0b10000, 0b11110, 0b10000, 0b10000, 0b11111},
+	'F':  {0b11111, 0b10000, 0b10000, 0b11110, 0b10000, 0b10000, 0b10000},
+	'G':  {0b01110, 0b10001, 0b10000, 0b10111, 0b10001, 0b10001, 0b01111},
+	'H':  {0b10001, 0b10001, 0b10001, 0b11111, 0b10001, 0b10001, 0b10001},
+	'I':  {0b01110, 0b00100, 0b00100, 0b00100, 0b00100, 0b00100, 0b01110},
+	'J':  {0b00111, 0b00010, 0b00010, 0b00010, 0b00010, 0b10010, 0b01100},
+	'K':  {0b10001, 0b10010, 0b10100, 0b11000, 0b10100, 0b10010, 0b10001},
+	'L':  {0b10000, 0b10000, 0b10000, 0b10000, 0b10000, 0b10000, 0b11111},
+	'M':  {0b10001, 0b11011, 0b10101, 0b10101, 0b10001, 0b10001, 0b10001},
+	'N':  {0b10001, 0b10001, 0b11001, 0b10101, 0b10011, 0b10001, 0b10001},
+	'O':  {0b01110, 0b10001, 0b10001, 0b10001, 0b10001, 0b10001, 0b01110},
+	'P':  {0b11110, 0b10001, 0b10001, 0b11110, 0b10000, 0b10000, 0b10000},
+	'Q':  {0b01110, 0b10001, 0b10001, 0b10001, 0b10101, 0b10010, 0b01101},
+	'R':  {0b11110, 0b10001, 0b10001, 0b11110, 0b10100, 0b10010, 0b10001},
+	'S':  {0b01111, 0b10000, 0b10000, 0b01110, 0b00001, 0b00001, 0b11110},
+	'T':  {0b11111, 0b00100, 0b00100, 0b00100, 0b00100, 0b00100, 0b00100},
+	'U':  {0b10001, 0b10001, 0b10001, 0b10001, 0b10001, 0b10001, 0b01110},
+	'V':  {0b10001, 0b10001, 0b10001, 0b10001, 0b10001, 0b01010, 0b00100},
+	'W':  {0b10001, 0b10001, 0b10001, 0b10101, 0b10101, 0b10101, 0b01010},
+	'X':  {0b10001, 0b10001, 0b01010, 0b00100, 0b01010, 0b10001, 0b10001},
+	'Y':  {0b10001, 0b10001, 0b10001, 0b01010, 0b00100, 0b00100, 0b00100},
+	'Z':  {0b11111, 0b00001, 0b00010, 0b00100, 0b01000, 0b10000, 0b11111},
+	'0':  {0b01110, 0b10001, 0b10011, 0b10101, 0b11001, 0b10001, 0b01110},
+	'1':  {0b00100, 0b01100, 0b00100, 0b00100, 0b00100, 0b00100, 0b01110},
+	'2':  {0b01110, 0b10001, 0b00001, 0b00010, 0b00100, 0b01000, 0b11111},
+	'3':  {0b11111, 0b00010, 0b00100, 0b00010, 0b00001, 0b10001, 0b01110},
+	'4':  {0b00010, 0b00110, 0b01010, 0b10010, 0b11111, 0b00010, 0b00010},
+	'5':  {0b11111, 0b10000, 0b11110, 0b00001, 0b00001, 0b10001, 0b01110},
+	'6':  {0b00110, 0b01000, 0b10000, 0b11110, 0b10001, 0b10001, 0b01110},
+	'7':  {0b11111, 0b00001, 0b00010, 0b00100, 0b01000, 0b01000, 0b01000},
+	'8':  {0b01110, 0b10001, 0b10001, 0b01110, 0b10001, 0b10001, 0b01110},
+	'9':  {0b01110, 0b10001, 0b10001, 0b01111, 0b00001, 0b00010, 0b01100},
+	'-':  {0b00000, 0b00000, 0b00000, 0b11111, 0b00000, 0b00000, 0b00000},
+	'.':  {0b00000, 0b00000, 0b00000, 0b00000, 0b00000, 0b01100, 0b01100},
+	',':  {0b00000, 0b00000, 0b00000, 0b00000, 0b01100, 0b00100, 0b01000},
+	'\'': {0b01100, 0b00100, 0b01000, 0b00000, 0b00000, 0b00000, 0b00000},
+	'/':  {0b00000, 0b00001, 0b00010, 0b00100, 0b01000, 0b10000, 0b00000},
+	'(':  {0b00010, 0b00100, 0b01000, 0b01000, 0b01000, 0b00100, 0b00010},
+	')':  {0b01000, 0b00100, 0b00010, 0b00010, 0b00010, 0b00100, 0b01000},
+	':':  {0b00000, 0b01100, 0b01100, 0b00000, 0b01100, 0b01100, 0b00000},
+	'#':  {0b01010, 0b01010, 0b11111, 0b01010, 0b11111, 0b01010, 0b01010},
+	'&':  {0b01100, 0b10010, 0b10100, 0b01000, 0b10101, 0b10010, 0b01101},
+	'+':  {0b00000, 0b00100, 0b00100, 0b11111, 0b00100, 0b00100, 0b00000},
+	'!':  {0b00100, 0b00100, 0b00100, 0b00100, 0b00100, 0b00000, 0b00100},
+	'?':  {0b01110, 0b10001, 0b00001, 0b00010, 0b00100, 0b00000, 0b00100},
+}
+
+// unaccented maps accented Latin capitals to the glyphs drawn for them.
+var unaccented = strings.NewReplacer(
+	"À", "A", "Á", "A", "Â", "A", "Ã", "A", "Ä", "A", "Å", "A",
+	"Ç", "C",
+	"È", "E", "É", "E", "Ê", "E", "Ë", "E",
+	"Ì", "I", "Í", "I", "Î", "I", "Ï", "I",
+	"Ñ", "N",
+	"Ò", "O", "Ó", "O", "Ô", "O", "Õ", "O", "Ö", "O", "Ø", "O",
+	"Ù", "U", "Ú", "U", "Û", "U", "Ü", "U",
+	"Ý", "Y", "Ÿ", "Y",
+)
+
+// labelLines returns the lines of the label of the part-th of parts QR
+// codes, in capitals, with characters the font lacks replaced by '?'.
+func (o Options) labelLines(part, parts int) []string {
+	var lines []string
+	if o.Label != "" {
+		lines = append(lines, string(fontRunes(o.Label)))
+	}
+	if parts > 1 {
+		lines = append(lines, fmt.Sprintf("PART %d OF %d", part, parts))
+	}
+	return lines
+}
+
+// labeled returns the given QR code image with the given lines of text
+// drawn beneath it in the given colors, centered, at the largest scale at
+// which the longest line fits, up to one image pixel per font pixel for
+// every 128 pixels of the image's width. Lines which do not fit at any
+// scale are truncated.
+func labeled(qr image.Image, lines []string, fg, bg color.Color) image.Image {
+	width := qr.Bounds().Dx()
+	margin := width / 16
+
+	longest := 0
+	for _, line := range lines {
+		if n := len([]rune(line)); n > longest {
+			longest = n
+		}
+	}
+
+	scale := width / 128
+	for scale > 1 && longest*(glyphWidth+1)*scale > width-2*margin {
+		scale--
+	}
+	if scale < 1 {
+		scale = 1
+	}
+	maxRunes := (width - 2*margin) / ((glyphWidth + 1) * scale)
+
+	lineHeight := (glyphHeight + 3) * scale
+	bounds := image.Rect(0, 0, width, qr.Bounds().Dy()+len(lines)*lineHeight+margin/2)
+	var img draw.Image = image.NewPaletted(bounds, color.Palette{bg, fg})
+	if _, ok := qr.(*image.Paletted); !ok {
+		// Keep the colors of a logo.
+		img = image.NewRGBA(bounds)
+	}
+	draw.Draw(img, img.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+	draw.Draw(img, qr.Bounds().Sub(qr.Bounds().Min), qr, qr.Bounds().Min, draw.Src)
+
+	for i, line := range lines {
+		runes := []rune(line)
+		if len(runes) > maxRunes && maxRunes > 3 {
+			runes = append(runes[:maxRunes-3], '.', '.', '.')
+		} else if len(runes) > maxRunes {
+			runes = runes[:max(maxRunes, 0)]
+		}
+
+		x := (width - len(runes)*(glyphWidth+1)*scale + scale) / 2
+		y := qr.Bounds().Dy() + i*lineHeight
+		for _, r := range runes {
+			drawGlyph(img, glyphs[r], x, y, scale, fg)
+			x += (glyphWidth + 1) * scale
+		}
+	}
+	return img
+}
+
+// drawGlyph draws the glyph in the given color with its top left corner at
+// (x, y), with each font pixel a square of scale image pixels.
+func drawGlyph(img draw.Image, glyph [glyphHeight]uint8, x, y, scale int, fg color.Color) {
+	for row, bits := range glyph {
+		for col := 0; col < glyphWidth; col++ {
+			if bits&(1<<(glyphWidth-1-col)) == 0 {
+				continue
+			}
+			r := image.Rect(x+col*scale, y+row*scale, x+(col+1)*scale, y+(row+1)*scale)
+			draw.Draw(img, r, image.NewUniform(fg), image.Point{}, draw.Src)
+		}
+	}
+}
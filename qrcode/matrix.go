@@ -0,0 +1,46 @@
+package qrcode
+
+import "image"
+
+// QuietZone is the width, in modules, of the light margin around each QR
+// code, which scanners need to tell it apart from its surroundings.
+const QuietZone = 4
+
+// EncodeToMatrices is like EncodeWithOptions, but returns the modules of
+// each QR code rather than rendering it, so that callers can draw QR codes
+// themselves, e.g. on a canvas, an e-ink display, or in the command
+// language of a label printer. Each matrix is indexed by row and then by
+// column, with true for dark modules, and includes the quiet zone of
+// QuietZone light modules on every side. Only the error correction and
+// chunking options apply.
+func EncodeToMatrices(content string, opts Options) ([][][]bool, error) {
+	opts.Style = Style{}
+	codes, err := opts.qrCodes(content)
+	if err != nil {
+		return nil, err
+	}
+
+	matrices := make([][][]bool, len(codes))
+	for i, q := range codes {
+		matrices[i] = q.Bitmap()
+	}
+	return matrices, nil
+}
+
+// EncodeToImages is like EncodeWithOptions, but returns each QR code as an
+// image rather than encoding it as a PNG, e.g. for converting it to the
+// pixel format of a display or drawing it into a larger image.
+func EncodeToImages(content string, opts Options) ([]image.Image, error) {
+	codes, err := opts.qrCodes(content)
+	if err != nil {
+		return nil, err
+	}
+
+	images := make([]image.Image, len(codes))
+	for i, q := range codes {
+		if images[i], err = render(q, i+1, len(codes), opts); err != nil {
+			return nil, err
+		}
+	}
+	return images, nil
+}
@@ -0,0 +1,92 @@
+package qrcode
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// NumericEncode encodes a JWS in the numeric mode of "shc:/" strings, as
+// each of its characters' value minus 45, written as two digits, without
+// the "shc:/" prefix or chunk index. Only characters between '-' and 'z',
+// which include every character of a JWS in compact serialization, are
+// encoded faithfully; check other content with ValidateAlphabet first.
+// See https://spec.smarthealth.cards/#encoding-chunks-as-qr-codes.
+func NumericEncode(jws string) string {
+	return string(appendNumeric(make([]byte, 0, 2*len(jws)), jws))
+}
+
+// NumericDecode is the inverse of NumericEncode. It fails with an error
+// wrapping ErrInvalidSHCString if the digits are not pairs, and also
+// wrapping a *CharacterError if a pair encodes a character outside of the
+// alphabet of a JWS.
+func NumericDecode(digits string) (string, error) {
+	jws, err := numericDecode(digits)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidSHCString, err)
+	}
+	return jws, nil
+}
+
+// CharacterError is the error with which encoding fails, and which the
+// errors of decoding wrap, when the content has a character outside of the
+// alphabet of a JWS in compact serialization: the letters, digits, "-",
+// and "_" of base64url, and ".".
+// Other characters cannot all be written in the numeric mode of "shc:/"
+// strings, and are a sign of corrupted content.
+type CharacterError struct {
+	// Offset is the byte offset of the character in the content.
+	Offset int
+
+	// Char is the character.
+	Char rune
+}
+
+func (e *CharacterError) Error() string {
+	return fmt.Sprintf("character %q at offset %d is not in the alphabet of a JWS", e.Char, e.Offset)
+}
+
+// ValidateAlphabet returns a *CharacterError for the first character of
+// the content outside of the alphabet of a JWS, or nil if there is none.
+func ValidateAlphabet(content string) error {
+	for i, r := range content {
+		if r >= 0x80 || !inAlphabet(byte(r)) {
+			return &CharacterError{Offset: i, Char: r}
+		}
+	}
+	return nil
+}
+
+func inAlphabet(c byte) bool {
+	return 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.'
+}
+
+// appendNumeric appends the numeric encoding of s to b. The JWS is ASCII,
+// so it is encoded byte by byte.
+func appendNumeric(b []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		v := s[i] - 45
+		b = append(b, '0'+v/10, '0'+v%10)
+	}
+	return b
+}
+
+func numericDecode(digits string) (string, error) {
+	if len(digits)%2 != 0 {
+		return "", errors.New("shc:/ string has an odd number of digits")
+	}
+
+	var b strings.Builder
+	b.Grow(len(digits) / 2)
+	for i := 0; i < len(digits); i += 2 {
+		hi, lo := digits[i]-'0', digits[i+1]-'0'
+		if hi > 9 || lo > 9 {
+			return "", fmt.Errorf("invalid digits %q in shc:/ string", digits[i:i+2])
+		}
+		if c := int(hi)*10 + int(lo) + 45; c > 'z' || !inAlphabet(byte(c)) {
+			return "", &CharacterError{Offset: i / 2, Char: rune(c)}
+		}
+		b.WriteByte(hi*10 + lo + 45)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,168 @@
+package qrcode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image/color"
+	"strings"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// ErrorCorrection is the error correction level of a QR code, i.e. how much
+// of it can be damaged or obscured while remaining readable.
+type ErrorCorrection int
+
+// Error correction levels. Higher levels are more robust, but fit less
+// content in each QR code; since every chunk is encoded as a version 22 QR
+// code, the largest chunks may not fit at levels above Medium.
+const (
+	Medium   ErrorCorrection = iota // Recovers 15% of the QR code.
+	Low                             // Recovers 7% of the QR code.
+	Quartile                        // Recovers 25% of the QR code.
+	High                            // Recovers 30% of the QR code.
+)
+
+// DefaultSize is the width and height, in pixels, of the PNGs rendered by
+// Encode.
+const DefaultSize = 512
+
+// Options customizes the rendering of QR codes by EncodeWithOptions and
+// EncodeSVG. The zero value renders QR codes as Encode does.
+type Options struct {
+	// Size is the width and height of each PNG in pixels; it defaults to
+	// DefaultSize. It is ignored by EncodeSVG, since SVGs scale freely.
+	Size int
+
+	// ErrorCorrection is the error correction level of each QR code; it
+	// defaults to Medium.
+	ErrorCorrection ErrorCorrection
+
+	// Label is text, such as the patient's name and birth date, drawn in
+	// capitals beneath each QR code in PNGs, followed, when the content
+	// needs multiple QR codes, by which part of the whole each is, e.g.
+	// "PART 2 OF 3", so that printed QR codes are not mixed up. Characters
+	// other than letters, digits, and common punctuation are drawn as
+	// '?'. The PNGs are then taller than they are wide. It is ignored by
+	// EncodeSVG.
+	Label string
+
+	// ChunkSize is the length of the longest chunk of the content, each of
+	// which is encoded as a QR code; content no longer than ChunkSize is
+	// encoded as a single QR code. It defaults to MaxSingleChunkSize for
+	// content encoded as a single QR code, and slightly less for each of
+	// multiple QR codes, as recommended by the SMART Health Card spec.
+	// Smaller chunks make for sparser QR codes, which are easier to scan
+	// and leave room for higher error correction levels; chunks larger
+	// than MaxSingleChunkSize do not fit in a QR code.
+	ChunkSize int
+
+	// MaxChunks, if positive, is the largest number of chunks, and so QR
+	// codes, into which the content may be broken. Content needing more
+	// fails to encode with a *ChunkCountError, as the spec discourages
+	// cards split across more than a few QR codes, which are hard to scan.
+	MaxChunks int
+
+	// Style customizes the colors and shapes of the QR codes, and draws
+	// a logo over them.
+	Style
+}
+
+// EncodeWithOptions is like Encode, but renders the QR codes as specified
+// by the given options.
+func EncodeWithOptions(content string, opts Options) ([][]byte, error) {
+	return encode(context.Background(), content, opts)
+}
+
+// EncodeWithOptionsContext is like EncodeWithOptions, but stops early as
+// described by EncodeContext.
+func EncodeWithOptionsContext(ctx context.Context, content string, opts Options) ([][]byte, error) {
+	return encode(ctx, content, opts)
+}
+
+// EncodeSVG is like EncodeWithOptions, but renders each QR code as an SVG
+// image rather than a PNG.
+func EncodeSVG(content string, opts Options) ([][]byte, error) {
+	codes, err := opts.qrCodes(content)
+	if err != nil {
+		return nil, err
+	}
+
+	fg, bg := opts.colors()
+	svgs := make([][]byte, len(codes))
+	for i, q := range codes {
+		svgs[i] = svg(q.Bitmap(), fg, bg)
+	}
+	return svgs, nil
+}
+
+// ErrPayloadTooLarge is the error with which encoding fails when a chunk of
+// the content does not fit in a version 22 QR code at the requested error
+// correction level.
+var ErrPayloadTooLarge = errors.New("content does not fit in a QR code")
+
+func (o Options) qrCode(shcContent string) (*qrcode.QRCode, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+
+	level := map[ErrorCorrection]qrcode.RecoveryLevel{
+		Low:      qrcode.Low,
+		Medium:   qrcode.Medium,
+		Quartile: qrcode.High,
+		High:     qrcode.Highest,
+	}[o.ErrorCorrection]
+
+	var err error
+	for _, level := range o.levels(level) {
+		var q *qrcode.QRCode
+		if q, err = qrcode.NewWithForcedVersion(shcContent, 22, level); err == nil {
+			return q, nil
+		}
+	}
+	if o.Logo != nil {
+		return nil, fmt.Errorf("%w at the error correction level needed for a logo: %v", ErrPayloadTooLarge, err)
+	}
+	return nil, fmt.Errorf("%w: %v", ErrPayloadTooLarge, err)
+}
+
+func (o Options) size() int {
+	if o.Size <= 0 {
+		return DefaultSize
+	}
+	return o.Size
+}
+
+// svg renders a QR code bitmap, including its quiet zone, with one unit
+// per module and each horizontal run of dark modules as a single path
+// segment, in the given colors.
+func svg(bitmap [][]bool, fg, bg color.Color) []byte {
+	var path strings.Builder
+	for y, row := range bitmap {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+			start := x
+			for x < len(row) && row[x] {
+				x++
+			}
+			fmt.Fprintf(&path, "M%d %dh%dv1h-%dz", start, y, x-start, x-start)
+		}
+	}
+
+	fill, background := "#000", "#fff"
+	if fg != color.Black {
+		fill = hexColor(fg)
+	}
+	if bg != color.White {
+		background = hexColor(bg)
+	}
+
+	return []byte(fmt.Sprintf(
+		`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+
+			`<rect width="100%%" height="100%%" fill="%s"/><path fill="%s" d="%s"/></svg>`+"\n",
+		len(bitmap), len(bitmap), background, fill, path.String(),
+	))
+}
@@ -0,0 +1,287 @@
+package qrcode
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	imagepng "image/png"
+	"io"
+	"strings"
+)
+
+// LetterPoster and A4Poster are the sizes, in pixels, of US letter and A4
+// pages at 150 dots per inch, for Poster.Size.
+var (
+	LetterPoster = image.Pt(1275, 1650)
+	A4Poster     = image.Pt(1240, 1754)
+)
+
+// Poster lays out QR codes on a printable poster along with a title, the
+// issuer's logo and name, and instructions, e.g. for clinics which post a
+// patient's card for pickup, or for signage with a QR code linking to
+// cards. Its text is drawn in capitals in the font of Options.Label.
+type Poster struct {
+	// Size is the width and height of the poster in pixels; it defaults
+	// to LetterPoster.
+	Size image.Point
+
+	// Title is drawn above the QR codes; it defaults to "SMART Health
+	// Card".
+	Title string
+
+	// Instructions are drawn beneath the QR codes, wrapped to fit; they
+	// default to "Scan to save your vaccination record".
+	Instructions string
+
+	// Issuer is the issuer's name, drawn beneath its logo, if not empty.
+	Issuer string
+
+	// Logo is the issuer's logo, drawn at the top of the poster. If it is
+	// nil, a dashed box is drawn in its place, e.g. for a sticker.
+	Logo image.Image
+}
+
+// Encode encodes the content as one or more QR codes, as by
+// EncodeToImages with the given options, but sized to fit the poster and
+// without labels, and writes a PNG of the poster laying them out.
+func (p Poster) Encode(w io.Writer, content string, opts Options) error {
+	codes, err := opts.qrCodes(content)
+	if err != nil {
+		return err
+	}
+
+	// The poster captions each QR code with its part itself.
+	opts.Label = ""
+	opts.Size = p.layout(len(codes)).qrSize
+	images := make([]image.Image, len(codes))
+	for i, q := range codes {
+		if images[i], err = render(q, 1, 1, opts); err != nil {
+			return err
+		}
+	}
+	encoder := imagepng.Encoder{CompressionLevel: imagepng.BestCompression}
+	return encoder.Encode(w, p.Image(images))
+}
+
+// Image returns the poster laying out the given square QR code images,
+// e.g. of content other than a card, which are scaled to fit. When there
+// are several, they are laid out two to a row and each is captioned with
+// which part of the whole it is.
+func (p Poster) Image(qrs []image.Image) image.Image {
+	l := p.layout(len(qrs))
+	img := image.NewRGBA(image.Rectangle{Max: l.size})
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	logo := image.Rect((l.size.X-l.logo.X)/2, l.margin, (l.size.X+l.logo.X)/2, l.margin+l.logo.Y)
+	if p.Logo != nil && !p.Logo.Bounds().Empty() {
+		lb := p.Logo.Bounds()
+		scale := min(float64(logo.Dx())/float64(lb.Dx()), float64(logo.Dy())/float64(lb.Dy()))
+		w, h := max(int(float64(lb.Dx())*scale), 1), max(int(float64(lb.Dy())*scale), 1)
+		r := image.Rect(logo.Min.X+(logo.Dx()-w)/2, logo.Min.Y+(logo.Dy()-h)/2, 0, 0)
+		r.Max = r.Min.Add(image.Pt(w, h))
+		draw.Draw(img, r, scaled(p.Logo, w, h), image.Point{}, draw.Over)
+	} else {
+		dashedRect(img, logo, max(l.size.X/400, 1), color.Gray{Y: 0x80})
+		drawLines(img, []string{"LOGO"}, logo.Min.Y+(logo.Dy()-glyphHeight*l.issuerScale)/2, l.issuerScale, color.Gray{Y: 0x80})
+	}
+
+	y := logo.Max.Y + l.gap
+	if len(l.issuer) > 0 {
+		y = drawLines(img, l.issuer, y, l.issuerScale, color.Black)
+	}
+	y = drawLines(img, l.title, y+l.gap/2, l.titleScale, color.Black) + l.gap/2 + l.slack/2
+
+	columns := min(len(qrs), 2)
+	width := columns*l.qrSize + (columns-1)*l.gap
+	for i, qr := range qrs {
+		x := (l.size.X-width)/2 + i%2*(l.qrSize+l.gap)
+		r := image.Rect(x, y, x+l.qrSize, y+l.qrSize)
+		if qr.Bounds().Dx() == l.qrSize && qr.Bounds().Dy() == l.qrSize {
+			draw.Draw(img, r, qr, qr.Bounds().Min, draw.Src)
+		} else {
+			draw.Draw(img, r, scaledNearest(qr, l.qrSize), image.Point{}, draw.Src)
+		}
+		if len(qrs) > 1 {
+			caption := fmt.Sprintf("PART %d OF %d", i+1, len(qrs))
+			drawText(img, []rune(caption), x+l.qrSize/2, r.Max.Y+l.captionScale, l.captionScale, color.Black)
+		}
+		if i%2 == 1 || i == len(qrs)-1 {
+			y += l.qrSize + l.caption
+		}
+	}
+
+	drawLines(img, l.instructions, y+l.gap/2, l.instructionsScale, color.Black)
+	return img
+}
+
+// posterLayout is the arrangement of the parts of a poster, in pixels.
+type posterLayout struct {
+	size              image.Point
+	margin, gap       int
+	logo              image.Point
+	qrSize            int
+	slack             int
+	caption           int
+	issuer, title     []string
+	instructions      []string
+	issuerScale       int
+	titleScale        int
+	captionScale      int
+	instructionsScale int
+}
+
+// layout arranges the poster for the given number of QR codes, giving
+// them the space left over by the text, up to the width of the page, and
+// centering them in any space still left over.
+func (p Poster) layout(n int) posterLayout {
+	l := posterLayout{size: p.Size}
+	if l.size.X <= 0 || l.size.Y <= 0 {
+		l.size = LetterPoster
+	}
+	title, instructions := p.Title, p.Instructions
+	if title == "" {
+		title = "SMART Health Card"
+	}
+	if instructions == "" {
+		instructions = "Scan to save your vaccination record"
+	}
+
+	w := l.size.X
+	l.margin, l.gap = w/16, w/32
+	l.logo = image.Pt(w/4, w/8)
+	text := w - 2*l.margin
+
+	l.titleScale = fitScale(title, w/128, text)
+	l.title = wrap(title, text/((glyphWidth+1)*l.titleScale))
+	l.issuerScale = max(w/320, 1)
+	if p.Issuer != "" {
+		l.issuer = wrap(p.Issuer, text/((glyphWidth+1)*l.issuerScale))
+	}
+	l.instructionsScale = fitScale(instructions, w/200, text)
+	l.instructions = wrap(instructions, text/((glyphWidth+1)*l.instructionsScale))
+	l.captionScale = max(w/400, 1)
+
+	used := l.margin + l.logo.Y + l.gap +
+		textHeight(len(l.issuer), l.issuerScale) + l.gap/2 +
+		textHeight(len(l.title), l.titleScale) + l.gap/2 +
+		l.gap/2 + textHeight(len(l.instructions), l.instructionsScale) + l.margin
+
+	n = max(n, 1)
+	columns, rows := min(n, 2), (n+1)/2
+	if n > 1 {
+		l.caption = textHeight(1, l.captionScale) + l.captionScale
+	}
+	l.qrSize = min((text-(columns-1)*l.gap)/columns, (l.size.Y-used)/rows-l.caption)
+	l.qrSize = max(l.qrSize, 1)
+	l.slack = max(l.size.Y-used-rows*(l.qrSize+l.caption), 0)
+	return l
+}
+
+// fontRunes returns s in the capitals of the label font, with characters
+// it lacks replaced by '?'.
+func fontRunes(s string) []rune {
+	runes := []rune(unaccented.Replace(strings.ToUpper(s)))
+	for i, r := range runes {
+		if _, ok := glyphs[r]; !ok {
+			runes[i] = '?'
+		}
+	}
+	return runes
+}
+
+// fitScale returns the largest scale, up to the given one, at which each
+// word of s fits in the given width, so that s need only be wrapped
+// between words.
+func fitScale(s string, scale, width int) int {
+	scale = max(scale, 1)
+	for _, word := range strings.Fields(s) {
+		for scale > 1 && len([]rune(word))*(glyphWidth+1)*scale > width {
+			scale--
+		}
+	}
+	return scale
+}
+
+// wrap breaks s into lines of at most the given number of runes, in the
+// capitals of the label font, between words where it can.
+func wrap(s string, width int) []string {
+	width = max(width, 1)
+	var lines []string
+	var line []rune
+	for _, word := range strings.Fields(s) {
+		runes := fontRunes(word)
+		for len(runes) > width {
+			if len(line) > 0 {
+				lines, line = append(lines, string(line)), nil
+			}
+			lines, runes = append(lines, string(runes[:width])), runes[width:]
+		}
+		switch {
+		case len(line) == 0:
+			line = runes
+		case len(line)+1+len(runes) <= width:
+			line = append(append(line, ' '), runes...)
+		default:
+			lines, line = append(lines, string(line)), runes
+		}
+	}
+	if len(line) > 0 {
+		lines = append(lines, string(line))
+	}
+	return lines
+}
+
+// textHeight returns the height of the given number of lines of text at
+// the given scale.
+func textHeight(lines, scale int) int {
+	return lines * (glyphHeight + 3) * scale
+}
+
+// drawLines draws the lines of text centered across the image, starting
+// at y, and returns the y beneath them.
+func drawLines(img draw.Image, lines []string, y, scale int, fg color.Color) int {
+	for _, line := range lines {
+		drawText(img, []rune(line), img.Bounds().Dx()/2, y, scale, fg)
+		y += (glyphHeight + 3) * scale
+	}
+	return y
+}
+
+// drawText draws the text centered on x, with its top at y.
+func drawText(img draw.Image, text []rune, x, y, scale int, fg color.Color) {
+	x -= (len(text)*(glyphWidth+1)*scale - scale) / 2
+	for _, r := range text {
+		drawGlyph(img, glyphs[r], x, y, scale, fg)
+		x += (glyphWidth + 1) * scale
+	}
+}
+
+// dashedRect strokes the rectangle with dashed lines of the given width.
+func dashedRect(img draw.Image, r image.Rectangle, width int, c color.Color) {
+	dash := 6 * width
+	u := image.NewUniform(c)
+	for x := r.Min.X; x < r.Max.X; x += 2 * dash {
+		end := min(x+dash, r.Max.X)
+		draw.Draw(img, image.Rect(x, r.Min.Y, end, r.Min.Y+width), u, image.Point{}, draw.Src)
+		draw.Draw(img, image.Rect(x, r.Max.Y-width, end, r.Max.Y), u, image.Point{}, draw.Src)
+	}
+	for y := r.Min.Y; y < r.Max.Y; y += 2 * dash {
+		end := min(y+dash, r.Max.Y)
+		draw.Draw(img, image.Rect(r.Min.X, y, r.Min.X+width, end), u, image.Point{}, draw.Src)
+		draw.Draw(img, image.Rect(r.Max.X-width, y, r.Max.X, end), u, image.Point{}, draw.Src)
+	}
+}
+
+// scaledNearest returns the image scaled to a square of the given size by
+// sampling the nearest pixel, which keeps the edges of modules sharp.
+func scaledNearest(src image.Image, size int) image.Image {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			dst.Set(x, y, src.At(b.Min.X+x*b.Dx()/size, b.Min.Y+y*b.Dy()/size))
+		}
+	}
+	return dst
+}
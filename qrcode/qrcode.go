@@ -8,12 +8,20 @@
 package qrcode
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
 	"fmt"
-
-	qrcode "github.com/skip2/go-qrcode"
+	"runtime"
+	"strconv"
+	"sync"
 )
 
-const maxSingleChunkSize = 1195 // https://spec.smarthealth.cards/#chunking
+// MaxSingleChunkSize is the length of the longest content, such as a JWS,
+// which Encode encodes as a single QR code. See
+// https://spec.smarthealth.cards/#chunking.
+const MaxSingleChunkSize = 1195
+
 const maxMultipleChunkSize = 1191
 
 // Encode takes the content to be encoded, breaks it into chunks if necessary,
@@ -23,40 +31,198 @@ const maxMultipleChunkSize = 1191
 // Each encoded chunk is then encoded as a QR code in PNG format and
 // represented as a byte slice.
 func Encode(content string) ([][]byte, error) {
-	numChunks := 1
-	if len(content) > maxSingleChunkSize {
-		if len(content)%maxMultipleChunkSize == 0 {
-			numChunks = len(content) / maxMultipleChunkSize
-		} else {
-			numChunks = (len(content) / maxMultipleChunkSize) + 1
+	return EncodeContext(context.Background(), content)
+}
+
+// EncodeContext is like Encode, but stops early and returns the context's
+// error if the context is done before all QR codes have been rendered.
+//
+// When the content needs multiple QR codes, they are rendered concurrently,
+// using up to GOMAXPROCS goroutines.
+func EncodeContext(ctx context.Context, content string) ([][]byte, error) {
+	return encode(ctx, content, Options{})
+}
+
+func encode(ctx context.Context, content string, opts Options) ([][]byte, error) {
+	shcStrings, err := EncodeToStringsWithOptions(content, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	pngs := make([][]byte, len(shcStrings))
+	if len(shcStrings) == 1 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
 		}
+		if pngs[0], err = png(shcStrings[0], 1, 1, opts); err != nil {
+			return nil, err
+		}
+		return pngs, nil
 	}
 
-	pngs := make([][]byte, numChunks)
-	for i := 1; i <= numChunks; i++ {
-		var err error
-		if pngs[i-1], err = shcContent(i, numChunks, content[(i-1)*len(content)/numChunks:i*len(content)/numChunks]); err != nil {
+	// Rendering PNGs is the slowest step of issuing a card, and chunks
+	// are independent, so render them in parallel, at most one per CPU.
+	errs := make([]error, len(shcStrings))
+	sem := make(chan struct{}, runtime.GOMAXPROCS(0))
+	var wg sync.WaitGroup
+loop:
+	for i, shcString := range shcStrings {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			errs[i] = ctx.Err()
+			break loop
+		}
+		wg.Add(1)
+		go func(i int, shcString string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			if errs[i] = ctx.Err(); errs[i] == nil {
+				pngs[i], errs[i] = png(shcString, i+1, len(shcStrings), opts)
+			}
+		}(i, shcString)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
 			return nil, err
 		}
 	}
 	return pngs, nil
 }
 
-func shcContent(c int, n int, content string) ([]byte, error) {
-	shcContent := "shc:/"
+// EncodeToDataURIs is like Encode, but represents each QR code PNG as a
+// "data:image/png;base64,..." URI which can be used directly as the src of
+// an HTML img element.
+func EncodeToDataURIs(content string) ([]string, error) {
+	pngs, err := Encode(content)
+	if err != nil {
+		return nil, err
+	}
 
-	if n != 1 {
-		shcContent += fmt.Sprintf("%d/%d/", c, n)
+	dataURIs := make([]string, len(pngs))
+	for i, png := range pngs {
+		dataURIs[i] = DataURI(png)
 	}
+	return dataURIs, nil
+}
 
-	for _, r := range content {
-		shcContent += fmt.Sprintf("%02d", r-45)
+// DataURI represents a QR code PNG, such as one returned by Encode, as a
+// "data:image/png;base64,..." URI.
+func DataURI(png []byte) string {
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(png)
+}
+
+// EncodeToStrings takes the content to be encoded, breaks it into chunks if
+// necessary, and encodes each chunk as a "shc:/" string as per the SMART
+// Health Card spec, see:
+// https://spec.smarthealth.cards/#encoding-chunks-as-qr-codes.
+//
+// This is useful for callers who wish to render the QR codes themselves, or
+// store the encoded strings, rather than receive PNGs.
+func EncodeToStrings(content string) ([]string, error) {
+	return EncodeToStringsWithOptions(content, Options{})
+}
+
+// EncodeToStringsWithOptions is like EncodeToStrings, but breaks the
+// content into chunks as specified by the ChunkSize and MaxChunks options,
+// returning a *ChunkCountError if it needs more than MaxChunks chunks.
+//
+// Like every function encoding content, it returns a *CharacterError if
+// the content is not made of the characters of a JWS, as checked by
+// ValidateAlphabet.
+func EncodeToStringsWithOptions(content string, opts Options) ([]string, error) {
+	if err := ValidateAlphabet(content); err != nil {
+		return nil, err
+	}
+
+	numChunks := ChunkCountWithOptions(len(content), opts)
+	if opts.MaxChunks > 0 && numChunks > opts.MaxChunks {
+		return nil, &ChunkCountError{Chunks: numChunks, MaxChunks: opts.MaxChunks}
+	}
+
+	shcStrings := make([]string, numChunks)
+	for i := 1; i <= numChunks; i++ {
+		shcStrings[i-1] = shcContent(i, numChunks, content[(i-1)*len(content)/numChunks:i*len(content)/numChunks])
+	}
+	return shcStrings, nil
+}
+
+// ChunkCount returns the number of chunks, and so QR codes, into which
+// content of the given length, such as the length of a JWS, is broken by
+// Encode. See https://spec.smarthealth.cards/#chunking.
+func ChunkCount(length int) int {
+	return ChunkCountWithOptions(length, Options{})
+}
+
+// ChunkCountWithOptions is like ChunkCount, but counts the chunks into
+// which content is broken as specified by the ChunkSize option. It does not
+// check the MaxChunks option.
+func ChunkCountWithOptions(length int, opts Options) int {
+	if opts.ChunkSize > 0 {
+		if length <= opts.ChunkSize {
+			return 1
+		}
+		return (length + opts.ChunkSize - 1) / opts.ChunkSize
+	}
+
+	if length <= MaxSingleChunkSize {
+		return 1
+	}
+	if length%maxMultipleChunkSize == 0 {
+		return length / maxMultipleChunkSize
 	}
+	return (length / maxMultipleChunkSize) + 1
+}
+
+// ChunkCountError is the error with which encoding fails when the content
+// needs more chunks than the MaxChunks option allows.
+type ChunkCountError struct {
+	// Chunks is the number of chunks the content needs.
+	Chunks int
+
+	// MaxChunks is the largest number of chunks allowed.
+	MaxChunks int
+}
 
-	q, err := qrcode.NewWithForcedVersion(shcContent, 22, qrcode.Medium)
+func (e *ChunkCountError) Error() string {
+	return fmt.Sprintf("content needs %d QR codes, more than the maximum of %d", e.Chunks, e.MaxChunks)
+}
+
+// shcContent encodes the c-th of n chunks as an "shc:/" string, writing
+// the chunk as by NumericEncode.
+func shcContent(c int, n int, content string) string {
+	b := make([]byte, 0, len("shc:/")+len("999/999/")+2*len(content))
+	b = append(b, "shc:/"...)
+
+	if n != 1 {
+		b = strconv.AppendInt(b, int64(c), 10)
+		b = append(b, '/')
+		b = strconv.AppendInt(b, int64(n), 10)
+		b = append(b, '/')
+	}
+
+	return string(appendNumeric(b, content))
+}
+
+// png renders the part-th of parts chunks, encoded as the given "shc:/"
+// string, as a PNG.
+func png(shcContent string, part, parts int, opts Options) ([]byte, error) {
+	q, err := opts.qrCode(shcContent)
 	if err != nil {
 		return nil, err
 	}
 
-	return q.PNG(512)
+	if lines := opts.labelLines(part, parts); len(lines) > 0 || opts.styled() {
+		buf := new(bytes.Buffer)
+		if err := writePNG(buf, q, part, parts, opts); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return q.PNG(opts.size())
 }
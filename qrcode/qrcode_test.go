@@ -0,0 +1,18 @@
+package qrcode
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestEncodeContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, content := range []string{jwsOfLength(100), jwsOfLength(2500)} {
+		if _, err := EncodeContext(ctx, content); !errors.Is(err, context.Canceled) {
+			t.Errorf("EncodeContext of %d characters with a canceled context returned %v, want context.Canceled", len(content), err)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package qrcode
+
+import "errors"
+
+// Arithmetic in GF(256) with the primitive polynomial used by QR codes,
+// x^8 + x^4 + x^3 + x^2 + 1.
+var gfExp, gfLog = func() ([512]byte, [256]int) {
+	var exp [512]byte
+	var log [256]int
+	x := 1
+	for i := 0; i < 255; i++ {
+		exp[i] = byte(x)
+		log[x] = i
+		if x <<= 1; x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+	for i := 255; i < len(exp); i++ {
+		exp[i] = exp[i-255]
+	}
+	return exp, log
+}()
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[gfLog[a]+gfLog[b]]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[gfLog[a]+255-gfLog[b]]
+}
+
+// gfPow returns α^n.
+func gfPow(n int) byte {
+	return gfExp[((n%255)+255)%255]
+}
+
+// polyEval evaluates the polynomial with the given coefficients, lowest
+// degree first, at x.
+func polyEval(p []byte, x byte) byte {
+	var y byte
+	for i := len(p) - 1; i >= 0; i-- {
+		y = gfMul(y, x) ^ p[i]
+	}
+	return y
+}
+
+// correct corrects, in place, errors in a Reed-Solomon block whose last
+// ecLength codewords are error correction codewords, using the
+// Berlekamp-Massey algorithm and Forney's formula.
+func correct(block []byte, ecLength int) error {
+	n := len(block)
+
+	// The block is a polynomial with its first codeword as the highest
+	// degree coefficient; its syndromes are its values at α^0, α^1, ....
+	syndromes := make([]byte, ecLength)
+	clean := true
+	for j := range syndromes {
+		x := gfPow(j)
+		var s byte
+		for _, c := range block {
+			s = gfMul(s, x) ^ c
+		}
+		syndromes[j] = s
+		clean = clean && s == 0
+	}
+	if clean {
+		return nil
+	}
+
+	// Find the error locator polynomial, lowest degree first.
+	locator, prev := []byte{1}, []byte{1}
+	errorCount, shift, prevDiscrepancy := 0, 1, byte(1)
+	for i := 0; i < ecLength; i++ {
+		discrepancy := syndromes[i]
+		for j := 1; j <= errorCount && j < len(locator); j++ {
+			discrepancy ^= gfMul(locator[j], syndromes[i-j])
+		}
+		if discrepancy == 0 {
+			shift++
+			continue
+		}
+
+		scale := gfDiv(discrepancy, prevDiscrepancy)
+		next := make([]byte, max(len(locator), len(prev)+shift))
+		copy(next, locator)
+		for j, p := range prev {
+			next[j+shift] ^= gfMul(scale, p)
+		}
+
+		if 2*errorCount <= i {
+			prev, prevDiscrepancy = locator, discrepancy
+			errorCount = i + 1 - errorCount
+			shift = 1
+		} else {
+			shift++
+		}
+		locator = next
+	}
+	if 2*errorCount > ecLength {
+		return errTooManyErrors
+	}
+
+	// The error evaluator polynomial is syndromes × locator mod x^ecLength.
+	evaluator := make([]byte, ecLength)
+	for i, s := range syndromes {
+		for j, l := range locator {
+			if i+j < ecLength {
+				evaluator[i+j] ^= gfMul(s, l)
+			}
+		}
+	}
+
+	// The formal derivative of the locator keeps only its odd terms.
+	derivative := make([]byte, len(locator))
+	for i := 1; i < len(locator); i += 2 {
+		derivative[i-1] = locator[i]
+	}
+
+	// Search for the roots of the locator, which are the inverses of α
+	// raised to the degrees of the erroneous codewords.
+	found := 0
+	for degree := 0; degree < n; degree++ {
+		xInv := gfPow(-degree)
+		if polyEval(locator, xInv) != 0 {
+			continue
+		}
+		d := polyEval(derivative, xInv)
+		if d == 0 {
+			return errTooManyErrors
+		}
+		magnitude := gfMul(gfPow(degree), gfDiv(polyEval(evaluator, xInv), d))
+		block[n-1-degree] ^= magnitude
+		found++
+	}
+	if found != errorCount {
+		return errTooManyErrors
+	}
+
+	return nil
+}
+
+var errTooManyErrors = errors.New("QR code has too many errors to correct")
@@ -0,0 +1,199 @@
+package qrcode
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	imagepng "image/png"
+	"io"
+	"strings"
+	"time"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// ErrMultipleQRCodes is returned by EncodeTo when the content needs more
+// than one QR code.
+var ErrMultipleQRCodes = errors.New("content needs more than one QR code")
+
+// EncodeTo is like EncodeWithOptions, but writes the PNG of the QR code to
+// w as it is encoded, rather than returning it. If the content needs more
+// than one QR code, which can be checked beforehand with ChunkCount, it
+// returns ErrMultipleQRCodes without writing anything; use EncodeZIPTo
+// instead.
+func EncodeTo(w io.Writer, content string, opts Options) error {
+	codes, err := opts.qrCodes(content)
+	if err != nil {
+		return err
+	}
+	if len(codes) != 1 {
+		return ErrMultipleQRCodes
+	}
+
+	return writePNG(w, codes[0], 1, 1, opts)
+}
+
+// EncodeZIPTo is like EncodeTo, but writes a ZIP archive of the PNGs of
+// one or more QR codes, named "card-part-1-of-3.png", "card-part-2-of-3.png",
+// and so on, encoding each PNG directly into the archive so that only one is
+// held in memory at a time. The archive also holds a manifest.json file
+// describing it with a ZIPManifest. If the content is a SMART Health Card's
+// JWS, the files are dated with the card's issuance time, its "nbf" value;
+// otherwise they are dated with the current time. If the content cannot be
+// encoded, nothing is written; but since each PNG is written as soon as it
+// is rendered, if rendering one fails, e.g. with ErrUnscannable, or w
+// fails, the archive is left incomplete, so callers streaming it, e.g. to
+// an HTTP response, must be ready to abandon it.
+func EncodeZIPTo(w io.Writer, content string, opts Options) error {
+	codes, err := opts.qrCodes(content)
+	if err != nil {
+		return err
+	}
+
+	iss, issued := claims(content)
+	if issued.IsZero() {
+		issued = time.Now()
+	}
+	sum := sha256.Sum256([]byte(content))
+	manifest, err := json.MarshalIndent(ZIPManifest{
+		ChunkCount: len(codes),
+		JWSSHA256:  hex.EncodeToString(sum[:]),
+		Issuer:     iss,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(w)
+	for i, q := range codes {
+		f, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     fmt.Sprintf("card-part-%d-of-%d.png", i+1, len(codes)),
+			Method:   zip.Deflate,
+			Modified: issued,
+		})
+		if err != nil {
+			return err
+		}
+		if err := writePNG(f, q, i+1, len(codes), opts); err != nil {
+			return err
+		}
+	}
+
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: "manifest.json", Method: zip.Deflate, Modified: issued})
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(manifest, '\n')); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// ZIPManifest describes a ZIP archive written by EncodeZIPTo, as its
+// manifest.json file.
+type ZIPManifest struct {
+	// ChunkCount is the number of QR codes, and so PNGs, in the archive.
+	ChunkCount int `json:"chunkCount"`
+
+	// JWSSHA256 is the hex-encoded SHA-256 hash of the encoded content,
+	// i.e. of the card's JWS.
+	JWSSHA256 string `json:"jwsSha256"`
+
+	// Issuer is the card's "iss" value, or empty if the content is not a
+	// SMART Health Card's JWS.
+	Issuer string `json:"issuer,omitempty"`
+}
+
+// claims returns the "iss" and "nbf" values of the payload of the given
+// SMART Health Card JWS, compressed or not, or zero values if it is not
+// one.
+func claims(healthCardJWS string) (string, time.Time) {
+	parts := strings.Split(healthCardJWS, ".")
+	if len(parts) != 3 {
+		return "", time.Time{}
+	}
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", time.Time{}
+	}
+	var header struct {
+		Zip string `json:"zip"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return "", time.Time{}
+	}
+	payloadBytes, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", time.Time{}
+	}
+
+	var r io.Reader = bytes.NewReader(payloadBytes)
+	if header.Zip == "DEF" {
+		r = flate.NewReader(r)
+	}
+	var payload struct {
+		Issuer    string  `json:"iss"`
+		NotBefore float64 `json:"nbf"`
+	}
+	if err := json.NewDecoder(r).Decode(&payload); err != nil {
+		return "", time.Time{}
+	}
+
+	var nbf time.Time
+	if payload.NotBefore > 0 {
+		nbf = time.Unix(int64(payload.NotBefore), 0)
+	}
+	return payload.Issuer, nbf
+}
+
+// render renders the QR code of the part-th of parts chunks as an image,
+// styled as described by Options.Style and labeled as described by
+// Options.Label.
+func render(q *qrcode.QRCode, part, parts int, opts Options) (image.Image, error) {
+	img := opts.image(q, opts.size())
+	if lines := opts.labelLines(part, parts); len(lines) > 0 {
+		fg, bg := opts.colors()
+		img = labeled(img, lines, fg, bg)
+	}
+	if opts.styled() {
+		if content, err := DecodeImage(img); err != nil || content != q.Content {
+			return nil, ErrUnscannable
+		}
+	}
+	return img, nil
+}
+
+// qrCodes returns the QR codes encoding each chunk of the content.
+func (o Options) qrCodes(content string) ([]*qrcode.QRCode, error) {
+	shcStrings, err := EncodeToStringsWithOptions(content, o)
+	if err != nil {
+		return nil, err
+	}
+
+	codes := make([]*qrcode.QRCode, len(shcStrings))
+	for i, shcString := range shcStrings {
+		if codes[i], err = o.qrCode(shcString); err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+// writePNG writes the QR code of the part-th of parts chunks as a PNG,
+// encoded as by (*qrcode.QRCode).PNG, rendered as by render.
+func writePNG(w io.Writer, q *qrcode.QRCode, part, parts int, opts Options) error {
+	img, err := render(q, part, parts, opts)
+	if err != nil {
+		return err
+	}
+
+	encoder := imagepng.Encoder{CompressionLevel: imagepng.BestCompression}
+	return encoder.Encode(w, img)
+}
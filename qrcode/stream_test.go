@@ -0,0 +1,44 @@
+package qrcode
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/jws"
+)
+
+func TestClaims(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := []byte(`{"iss":"https://example.com","nbf":1622505600.5,"vc":{}}`)
+	nbf := time.Unix(1622505600, 0)
+
+	tests := []struct {
+		name string
+		opts []jws.Option
+	}{
+		{"compressed", nil},
+		{"uncompressed", []jws.Option{jws.WithoutCompression()}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			healthCardJWS, err := jws.SignAndSerialize(payload, key, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			iss, issued := claims(healthCardJWS)
+			if iss != "https://example.com" || !issued.Equal(nbf) {
+				t.Errorf("claims = %q, %v; want %q, %v", iss, issued, "https://example.com", nbf)
+			}
+		})
+	}
+
+	if iss, issued := claims("not.a.jws"); iss != "" || !issued.IsZero() {
+		t.Errorf("claims of a non-JWS = %q, %v; want zero values", iss, issued)
+	}
+}
@@ -0,0 +1,321 @@
+package qrcode
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strconv"
+	"strings"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// ModuleShape is the shape in which the dark modules of QR codes are
+// drawn.
+type ModuleShape int
+
+// Module shapes. The modules of the finder patterns in three corners of a
+// QR code are always drawn as squares, so that scanners can locate it.
+const (
+	Square  ModuleShape = iota // Squares, which merge into solid areas.
+	Rounded                    // Squares whose outer corners are rounded.
+	Dots                       // Circles.
+)
+
+// ParseModuleShape returns the ModuleShape named "square", "rounded", or
+// "dots".
+func ParseModuleShape(name string) (ModuleShape, error) {
+	switch strings.ToLower(name) {
+	case "square", "":
+		return Square, nil
+	case "rounded":
+		return Rounded, nil
+	case "dots":
+		return Dots, nil
+	}
+	return 0, fmt.Errorf("unknown module shape %q", name)
+}
+
+// MinContrast is the lowest contrast ratio, as defined by WCAG 2, accepted
+// between the foreground and background colors of a Style. It is that
+// required of text by WCAG level AA, which is comfortably above what
+// scanners need.
+const MinContrast = 4.5
+
+// ErrLowContrast is the error with which encoding fails when the colors of
+// a Style are not opaque, or the foreground is not darker than the
+// background by at least MinContrast; many scanners cannot read QR codes
+// with light modules on a dark background.
+var ErrLowContrast = errors.New("QR code colors do not contrast enough to be scanned")
+
+// ErrUnscannable is the error with which encoding fails when a styled QR
+// code cannot be read back, e.g. because its logo covers too much of it.
+var ErrUnscannable = errors.New("styled QR code cannot be read back")
+
+// Style customizes the appearance of QR codes, e.g. to match an issuer's
+// branding, within limits that keep them scannable. The zero value draws
+// black square modules on white, as Encode does.
+//
+// Each PNG rendered with a Style other than the zero value is decoded
+// before it is returned, and encoding fails with ErrUnscannable if it
+// cannot be.
+type Style struct {
+	// Foreground and Background are the colors of the dark and light
+	// modules; they default to black and white. They must satisfy
+	// MinContrast.
+	Foreground color.Color
+	Background color.Color
+
+	// Shape is the shape of the dark modules of PNGs. Modules narrower
+	// than 4 pixels are always drawn as squares. It is ignored by
+	// EncodeSVG.
+	Shape ModuleShape
+
+	// Logo, if not nil, is drawn over the center of each PNG, scaled to
+	// fit the area that the error correction level can spare: the level
+	// is raised to the highest, but at least Medium, at which each chunk
+	// fits in a QR code, so that short content, or content broken into
+	// small chunks with Options.ChunkSize, leaves room for a larger logo.
+	// It is ignored by EncodeSVG.
+	Logo image.Image
+}
+
+// Validate checks that the colors of the style satisfy MinContrast,
+// returning an error wrapping ErrLowContrast if they do not.
+func (s Style) Validate() error {
+	fg, bg := s.colors()
+	for _, c := range []color.Color{fg, bg} {
+		if _, _, _, a := c.RGBA(); a != 0xffff {
+			return fmt.Errorf("%w: colors must be opaque", ErrLowContrast)
+		}
+	}
+
+	fgLum, bgLum := luminance(fg), luminance(bg)
+	if fgLum >= bgLum {
+		return fmt.Errorf("%w: the foreground must be darker than the background", ErrLowContrast)
+	}
+	if ratio := (bgLum + 0.05) / (fgLum + 0.05); ratio < MinContrast {
+		return fmt.Errorf("%w: contrast ratio %.1f is below %.1f", ErrLowContrast, ratio, MinContrast)
+	}
+	return nil
+}
+
+// ParseColor parses a color written as "#rgb" or "#rrggbb".
+func ParseColor(s string) (color.Color, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if len(hex) != 6 || err != nil {
+		return nil, fmt.Errorf("invalid color %q; use #rgb or #rrggbb", s)
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}, nil
+}
+
+// styled reports whether the style differs from the zero value.
+func (s Style) styled() bool {
+	return s.Foreground != nil || s.Background != nil || s.Shape != Square || s.Logo != nil
+}
+
+// colors returns the foreground and background colors, or their defaults.
+func (s Style) colors() (fg, bg color.Color) {
+	fg, bg = s.Foreground, s.Background
+	if fg == nil {
+		fg = color.Black
+	}
+	if bg == nil {
+		bg = color.White
+	}
+	return fg, bg
+}
+
+// luminance returns the relative luminance of an opaque color, as defined
+// by WCAG 2.
+func luminance(c color.Color) float64 {
+	r, g, b, _ := c.RGBA()
+	linear := func(v uint32) float64 {
+		f := float64(v) / 0xffff
+		if f <= 0.04045 {
+			return f / 12.92
+		}
+		return math.Pow((f+0.055)/1.055, 2.4)
+	}
+	return 0.2126*linear(r) + 0.7152*linear(g) + 0.0722*linear(b)
+}
+
+// levels returns the error correction levels at which to try encoding a
+// QR code in this style, in order of preference.
+func (s Style) levels(requested qrcode.RecoveryLevel) []qrcode.RecoveryLevel {
+	if s.Logo == nil {
+		return []qrcode.RecoveryLevel{requested}
+	}
+
+	var levels []qrcode.RecoveryLevel
+	for _, level := range []qrcode.RecoveryLevel{qrcode.Highest, qrcode.High, qrcode.Medium} {
+		if level >= requested {
+			levels = append(levels, level)
+		}
+	}
+	return levels
+}
+
+// logoFraction is the largest fraction of the width of a QR code, without
+// its quiet zone, which a logo may span at each error correction level,
+// covering no more than about a third of the codewords the level can
+// recover.
+var logoFraction = map[qrcode.RecoveryLevel]float64{
+	qrcode.Highest: 0.30,
+	qrcode.High:    0.24,
+	qrcode.Medium:  0.18,
+}
+
+// image renders the QR code as an image of the given width and height,
+// like (*qrcode.QRCode).Image, in this style.
+func (s Style) image(q *qrcode.QRCode, size int) image.Image {
+	fg, bg := s.colors()
+	if s.Shape == Square && s.Logo == nil {
+		q.ForegroundColor, q.BackgroundColor = fg, bg
+		return q.Image(size)
+	}
+
+	bitmap := q.Bitmap()
+	n := len(bitmap)
+	if size < n {
+		size = n
+	}
+	m := float64(size) / float64(n)
+
+	var img draw.Image
+	if s.Logo == nil {
+		img = image.NewPaletted(image.Rect(0, 0, size, size), color.Palette{bg, fg})
+	} else {
+		img = image.NewRGBA(image.Rect(0, 0, size, size))
+	}
+	draw.Draw(img, img.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+
+	// The finder patterns are 7 modules wide, in the corners of the symbol
+	// within the quiet zone.
+	symbol := n - 2*QuietZone
+	finder := func(row, col int) bool {
+		row, col = row-QuietZone, col-QuietZone
+		return (row < 7 || row >= symbol-7) && (col < 7 || col >= symbol-7) && !(row >= symbol-7 && col >= symbol-7)
+	}
+	dark := func(row, col int) bool {
+		return row >= 0 && col >= 0 && row < n && col < n && bitmap[row][col]
+	}
+
+	for row := range bitmap {
+		for col := range bitmap[row] {
+			if !bitmap[row][col] {
+				continue
+			}
+			x0, y0 := float64(col)*m, float64(row)*m
+			shape := s.Shape
+			if finder(row, col) || m < 4 {
+				shape = Square
+			}
+
+			// Each corner is rounded unless a dark module adjoins it.
+			var rounded [4]bool
+			if shape == Rounded {
+				up, down, left, right := dark(row-1, col), dark(row+1, col), dark(row, col-1), dark(row, col+1)
+				rounded = [4]bool{!up && !left, !up && !right, !down && !left, !down && !right}
+			}
+
+			for y := int(y0); y < int(y0+m); y++ {
+				for x := int(x0); x < int(x0+m); x++ {
+					if inModule(shape, rounded, float64(x)+0.5-x0, float64(y)+0.5-y0, m) {
+						img.Set(x, y, fg)
+					}
+				}
+			}
+		}
+	}
+
+	if s.Logo != nil {
+		drawLogo(img, s.Logo, float64(QuietZone)*m, float64(symbol)*m, logoFraction[q.Level], m, bg)
+	}
+	return img
+}
+
+// inModule reports whether the point (x, y), relative to the top left
+// corner of a module of width m, is within the module's shape, given which
+// of its top left, top right, bottom left, and bottom right corners are
+// rounded.
+func inModule(shape ModuleShape, rounded [4]bool, x, y, m float64) bool {
+	switch shape {
+	case Dots:
+		r := m * 0.45
+		return math.Hypot(x-m/2, y-m/2) <= r
+	case Rounded:
+		r := m / 2
+		corner := 0
+		if x >= r {
+			corner++
+		}
+		if y >= r {
+			corner += 2
+		}
+		if !rounded[corner] {
+			return true
+		}
+		return math.Hypot(x-m/2, y-m/2) <= r
+	}
+	return true
+}
+
+// drawLogo draws the logo centered over the symbol, which starts at the
+// given offset and has the given width, scaled to span at most the given
+// fraction of its width, on a margin of the background color a module wide.
+func drawLogo(img draw.Image, logo image.Image, offset, width, fraction, module float64, bg color.Color) {
+	lb := logo.Bounds()
+	if lb.Empty() {
+		return
+	}
+	box := width * fraction
+	scale := box / float64(max(lb.Dx(), lb.Dy()))
+	w, h := int(float64(lb.Dx())*scale), int(float64(lb.Dy())*scale)
+	if w < 1 || h < 1 {
+		return
+	}
+
+	center := offset + width/2
+	r := image.Rect(int(center)-w/2, int(center)-h/2, int(center)-w/2+w, int(center)-h/2+h)
+	draw.Draw(img, r.Inset(-int(math.Ceil(module))), image.NewUniform(bg), image.Point{}, draw.Src)
+	draw.Draw(img, r, scaled(logo, w, h), image.Point{}, draw.Over)
+}
+
+// scaled returns the image scaled to the given width and height, averaging
+// the pixels of the image covered by each pixel of the result.
+func scaled(src image.Image, width, height int) image.Image {
+	b := src.Bounds()
+	dst := image.NewRGBA64(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		sy0 := b.Min.Y + y*b.Dy()/height
+		sy1 := max(b.Min.Y+(y+1)*b.Dy()/height, sy0+1)
+		for x := 0; x < width; x++ {
+			sx0 := b.Min.X + x*b.Dx()/width
+			sx1 := max(b.Min.X+(x+1)*b.Dx()/width, sx0+1)
+
+			var r, g, bl, a, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, bl, a, n = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca), n+1
+				}
+			}
+			dst.SetRGBA64(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(bl / n), A: uint16(a / n)})
+		}
+	}
+	return dst
+}
+
+// hexColor returns the color as "#rrggbb", for SVGs.
+func hexColor(c color.Color) string {
+	r, g, b, _ := c.RGBA()
+	return fmt.Sprintf("#%02x%02x%02x", r>>8, g>>8, b>>8)
+}
@@ -0,0 +1,46 @@
+package qrcode
+
+import "strings"
+
+// EncodeToTerminal is like EncodeWithOptions, but renders each QR code as
+// text made of Unicode half-block characters, two rows of modules per line,
+// which can be printed to a terminal and scanned from the screen, e.g. when
+// testing over SSH. The size option is ignored.
+//
+// Light modules, including the quiet zone, are drawn with block characters
+// and dark modules with spaces, so that the QR code reads correctly on a
+// terminal with light text on a dark background, as most are.
+func EncodeToTerminal(content string, opts Options) ([]string, error) {
+	codes, err := opts.qrCodes(content)
+	if err != nil {
+		return nil, err
+	}
+
+	texts := make([]string, len(codes))
+	for i, q := range codes {
+		texts[i] = terminal(q.Bitmap())
+	}
+	return texts, nil
+}
+
+func terminal(bitmap [][]bool) string {
+	var b strings.Builder
+	for y := 0; y < len(bitmap); y += 2 {
+		for x := range bitmap[y] {
+			top := !bitmap[y][x]
+			bottom := y+1 < len(bitmap) && !bitmap[y+1][x]
+			switch {
+			case top && bottom:
+				b.WriteRune('█')
+			case top:
+				b.WriteRune('▀')
+			case bottom:
+				b.WriteRune('▄')
+			default:
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
@@ -0,0 +1,260 @@
+// Package redis shares the state of the issuance handlers between the
+// replicas of a deployment in a Redis server, where the in-memory
+// implementations of the webhandlers and store packages would give each
+// replica its own: RateLimiter limits the rate of requests across replicas,
+// and Store records issuances, so that idempotency keys are honored
+// whichever replica a retried request reaches.
+//
+// It speaks the Redis protocol itself with Client, so that it has no
+// dependencies beyond the standard library.
+package redis
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Error is an error reply from the Redis server, e.g. "WRONGTYPE Operation
+// against a key holding the wrong kind of value".
+type Error string
+
+func (e Error) Error() string {
+	return "redis: " + string(e)
+}
+
+// errProtocol is wrapped by the errors returned for malformed replies.
+var errProtocol = errors.New("redis: protocol error")
+
+// Client sends commands to a Redis server over a pool of connections. It
+// supports only what this package needs: commands whose arguments are
+// strings, and replies of the types of RESP2, see
+// https://redis.io/docs/reference/protocol-spec/. It is safe for concurrent
+// use.
+type Client struct {
+	// Addr is the host and port of the server, e.g. "localhost:6379".
+	Addr string
+
+	// Username and Password, if Password is given, authenticate each
+	// connection with the AUTH command; Username may be empty.
+	Username string
+	Password string
+
+	// DB is the number of the database selected on each connection.
+	DB int
+
+	// TLSConfig, if not nil, makes connections use TLS.
+	TLSConfig *tls.Config
+
+	// MaxIdle is the number of idle connections kept for reuse; it
+	// defaults to 8.
+	MaxIdle int
+
+	mu   sync.Mutex
+	idle []*conn
+}
+
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+// Do sends a command, e.g. Do(ctx, "GET", key), and returns its reply: a
+// string for simple strings and bulk strings, an int64 for integers, a
+// []any for arrays, nil for null bulk strings and arrays, or an Error for
+// error replies. The context's deadline, if any, applies to the whole
+// round trip.
+func (c *Client) Do(ctx context.Context, args ...string) (any, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	cn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := cn.do(ctx, args)
+	var redisErr Error
+	if err != nil && !errors.As(err, &redisErr) {
+		cn.Close()
+		return nil, err
+	}
+	c.put(cn)
+	return reply, err
+}
+
+// Ping checks that the server can be reached, e.g. when a deployment
+// starts.
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.Do(ctx, "PING")
+	return err
+}
+
+// get returns an idle connection, or a new one.
+func (c *Client) get(ctx context.Context) (*conn, error) {
+	c.mu.Lock()
+	if n := len(c.idle); n > 0 {
+		cn := c.idle[n-1]
+		c.idle = c.idle[:n-1]
+		c.mu.Unlock()
+		return cn, nil
+	}
+	c.mu.Unlock()
+
+	var nc net.Conn
+	var err error
+	if c.TLSConfig != nil {
+		d := &tls.Dialer{Config: c.TLSConfig}
+		nc, err = d.DialContext(ctx, "tcp", c.Addr)
+	} else {
+		var d net.Dialer
+		nc, err = d.DialContext(ctx, "tcp", c.Addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	cn := &conn{Conn: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+
+	if c.Password != "" {
+		args := []string{"AUTH", c.Password}
+		if c.Username != "" {
+			args = []string{"AUTH", c.Username, c.Password}
+		}
+		if _, err := cn.do(ctx, args); err != nil {
+			cn.Close()
+			return nil, err
+		}
+	}
+	if c.DB != 0 {
+		if _, err := cn.do(ctx, []string{"SELECT", strconv.Itoa(c.DB)}); err != nil {
+			cn.Close()
+			return nil, err
+		}
+	}
+	return cn, nil
+}
+
+// put returns a connection to the pool, or closes it if the pool is full.
+func (c *Client) put(cn *conn) {
+	maxIdle := c.MaxIdle
+	if maxIdle <= 0 {
+		maxIdle = 8
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.idle) >= maxIdle {
+		cn.Close()
+		return
+	}
+	c.idle = append(c.idle, cn)
+}
+
+// Close closes the idle connections.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var errs []error
+	for _, cn := range c.idle {
+		errs = append(errs, cn.Close())
+	}
+	c.idle = nil
+	return errors.Join(errs...)
+}
+
+func (cn *conn) do(ctx context.Context, args []string) (any, error) {
+	deadline, _ := ctx.Deadline()
+	if err := cn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(cn.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(cn.w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if err := cn.w.Flush(); err != nil {
+		return nil, err
+	}
+	return cn.reply()
+}
+
+// reply reads a single reply.
+func (cn *conn) reply() (any, error) {
+	line, err := cn.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("%w: malformed line %q", errProtocol, line)
+	}
+	kind, text := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return text, nil
+	case '-':
+		return nil, Error(text)
+	case ':':
+		n, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: malformed integer %q", errProtocol, text)
+		}
+		return n, nil
+	case '$':
+		n, err := strconv.Atoi(text)
+		if err != nil || n < -1 {
+			return nil, fmt.Errorf("%w: malformed bulk string length %q", errProtocol, text)
+		}
+		if n == -1 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(cn.r, buf); err != nil {
+			return nil, err
+		}
+		if buf[n] != '\r' || buf[n+1] != '\n' {
+			return nil, fmt.Errorf("%w: bulk string longer than its length %d", errProtocol, n)
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(text)
+		if err != nil || n < -1 {
+			return nil, fmt.Errorf("%w: malformed array length %q", errProtocol, text)
+		}
+		if n == -1 {
+			return nil, nil
+		}
+		items := make([]any, n)
+		var itemErr error
+		for i := range items {
+			items[i], err = cn.reply()
+			var redisErr Error
+			if errors.As(err, &redisErr) {
+				items[i], itemErr = redisErr, err
+			} else if err != nil {
+				return nil, err
+			}
+		}
+		return items, itemErr
+	}
+	return nil, fmt.Errorf("%w: unknown reply type %q", errProtocol, kind)
+}
+
+// deadline returns a context with the given timeout, if the given context
+// has no deadline, so that a stalled server does not hang requests.
+func deadline(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
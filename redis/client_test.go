@@ -0,0 +1,94 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReply(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    any
+		wantErr error
+	}{
+		{"simple string", "+OK\r\n", "OK", nil},
+		{"empty simple string", "+\r\n", "", nil},
+		{"error", "-ERR unknown command\r\n", nil, Error("ERR unknown command")},
+		{"integer", ":42\r\n", int64(42), nil},
+		{"negative integer", ":-1\r\n", int64(-1), nil},
+		{"bulk string", "$5\r\nhello\r\n", "hello", nil},
+		{"bulk string with CRLF", "$4\r\na\r\nb\r\n", "a\r\nb", nil},
+		{"empty bulk string", "$0\r\n\r\n", "", nil},
+		{"null bulk string", "$-1\r\n", nil, nil},
+		{"array", "*3\r\n$3\r\nfoo\r\n:1\r\n*1\r\n+x\r\n", []any{"foo", int64(1), []any{"x"}}, nil},
+		{"empty array", "*0\r\n", []any{}, nil},
+		{"null array", "*-1\r\n", nil, nil},
+		{"array with error", "*2\r\n-ERR a\r\n+b\r\n", []any{Error("ERR a"), "b"}, Error("ERR a")},
+		{"missing CR", "+OK\n", nil, errProtocol},
+		{"malformed integer", ":x\r\n", nil, errProtocol},
+		{"malformed bulk string length", "$-2\r\n", nil, errProtocol},
+		{"bulk string longer than its length", "$1\r\nab\r\n", nil, errProtocol},
+		{"malformed array length", "*x\r\n", nil, errProtocol},
+		{"unknown type", "!3\r\nabc\r\n", nil, errProtocol},
+		{"truncated bulk string", "$5\r\nhel", nil, io.ErrUnexpectedEOF},
+		{"truncated line", "+OK", nil, io.EOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cn := &conn{r: bufio.NewReader(strings.NewReader(tt.input))}
+			got, err := cn.reply()
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("reply = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDo(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// The server reads a single command and replies with a bulk string.
+	const want = "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$7\r\nva\r\nlue\r\n"
+	received := make(chan string, 1)
+	go func() {
+		nc, err := l.Accept()
+		if err != nil {
+			received <- err.Error()
+			return
+		}
+		defer nc.Close()
+		buf := make([]byte, len(want))
+		_, err = io.ReadFull(nc, buf)
+		received <- string(buf)
+		if err == nil {
+			io.WriteString(nc, "$2\r\nOK\r\n")
+		}
+	}()
+
+	c := &Client{Addr: l.Addr().String()}
+	defer c.Close()
+	reply, err := c.Do(context.Background(), "SET", "key", "va\r\nlue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply != "OK" {
+		t.Errorf("reply = %#v, want %q", reply, "OK")
+	}
+	if got := <-received; got != want {
+		t.Errorf("server received %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,90 @@
+package redis
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/webhandlers"
+)
+
+// tokenBucket is the Lua script which atomically takes a token from the
+// bucket of a key, refilling it by the time elapsed, as measured by the
+// server's clock so that replicas' clocks need not agree. It returns the
+// number of milliseconds to wait for a token, or 0 if one was taken.
+const tokenBucket = `
+local rate, burst = tonumber(ARGV[1]), tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local b = redis.call('HMGET', KEYS[1], 'tokens', 'last')
+local tokens, last = tonumber(b[1]) or burst, tonumber(b[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - last) / 1000 * rate)
+local wait = 0
+if tokens < 1 then
+	wait = math.ceil((1 - tokens) / rate * 1000)
+else
+	tokens = tokens - 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'last', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate * 1000) + 1000)
+return wait
+`
+
+// RateLimiter is a webhandlers.Limiter which limits the rate of requests per
+// key with a token bucket, as webhandlers.RateLimiter does, but keeps the
+// buckets in Redis, so that the limit applies across all the replicas of a
+// deployment. Each bucket expires once it has refilled.
+type RateLimiter struct {
+	client *Client
+	prefix string
+	rate   float64
+	burst  int
+	key    webhandlers.RateLimitKey
+
+	// OnError, if not nil, is called with the errors with which requests
+	// to Redis fail. Requests are allowed when Redis cannot be reached, so
+	// that an outage of the limiter is not an outage of issuance.
+	OnError func(r *http.Request, err error)
+}
+
+// NewRateLimiter returns a RateLimiter allowing each key, as determined by
+// the given RateLimitKey, perSecond requests per second with bursts of up
+// to burst requests, keeping its buckets in Redis under keys starting with
+// the given prefix, e.g. "shc:ratelimit:".
+func NewRateLimiter(client *Client, prefix string, perSecond float64, burst int, key webhandlers.RateLimitKey) *RateLimiter {
+	return &RateLimiter{client: client, prefix: prefix, rate: perSecond, burst: burst, key: key}
+}
+
+// Allow reports whether the request may proceed and, if not, how long its
+// key must wait before its next request would be allowed.
+func (l *RateLimiter) Allow(r *http.Request) (time.Duration, bool) {
+	key := l.key(r)
+	if key == "" {
+		return 0, true
+	}
+	if l.rate <= 0 {
+		return time.Duration(1<<63 - 1), false
+	}
+
+	ctx, cancel := deadline(r.Context(), time.Second)
+	defer cancel()
+
+	reply, err := l.client.Do(ctx, "EVAL", tokenBucket, "1", l.prefix+key,
+		strconv.FormatFloat(l.rate, 'g', -1, 64), strconv.Itoa(l.burst))
+	wait, ok := reply.(int64)
+	if err == nil && !ok {
+		err = fmt.Errorf("%w: unexpected reply %v", errProtocol, reply)
+	}
+	if err != nil {
+		if l.OnError != nil {
+			l.OnError(r, err)
+		}
+		return 0, true
+	}
+
+	if wait > 0 {
+		return time.Duration(wait) * time.Millisecond, false
+	}
+	return 0, true
+}
@@ -0,0 +1,185 @@
+package redis
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/store"
+)
+
+// Store is a store.IdempotentIssuanceStore which keeps issuances in Redis,
+// so that all the replicas of a deployment see the same issuances and
+// idempotency keys. Issuances are kept in a sorted set by the time they
+// were issued, and the first issuance requested with each idempotency key
+// under its own key, which expires after KeyTTL. It also records the draft
+// tokens redeemed by webhandlers.TwoStepIssuance; see RedeemDraft.
+type Store struct {
+	// Client is the client of the Redis server.
+	Client *Client
+
+	// Prefix is the prefix of the keys in which issuances are kept; it
+	// defaults to "shc:".
+	Prefix string
+
+	// KeyTTL is how long issuances are found by their idempotency keys;
+	// it defaults to a day. Issuances themselves do not expire.
+	KeyTTL time.Duration
+}
+
+func (s Store) prefix() string {
+	if s.Prefix == "" {
+		return "shc:"
+	}
+	return s.Prefix
+}
+
+func (s Store) issuancesKey() string {
+	return s.prefix() + "issuances"
+}
+
+// idempotencyKey returns the key holding the issuance requested by the
+// given identity with the given idempotency key, hashing them so that the
+// key's length is bounded and its parts cannot be confused.
+func (s Store) idempotencyKey(identity, key string) string {
+	hash := sha256.Sum256([]byte(identity + "\x00" + key))
+	return s.prefix() + "idempotency:" + hex.EncodeToString(hash[:])
+}
+
+// RecordIssuance records the issuance of a card.
+func (s Store) RecordIssuance(ctx context.Context, i store.Issuance) error {
+	data, err := json.Marshal(i)
+	if err != nil {
+		return err
+	}
+
+	score := strconv.FormatInt(i.IssuedAt.UnixMicro(), 10)
+	if _, err := s.Client.Do(ctx, "ZADD", s.issuancesKey(), score, string(data)); err != nil {
+		return err
+	}
+
+	if i.IdempotencyKey != "" {
+		if _, err := s.setIdempotencyKey(ctx, i, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RecordIdempotentIssuance atomically records the issuance of a card
+// requested with an idempotency key unless an issuance requested by the
+// same identity with the same key has been recorded within KeyTTL, in which
+// case it records nothing and returns that issuance and true.
+func (s Store) RecordIdempotentIssuance(ctx context.Context, i store.Issuance) (store.Issuance, bool, error) {
+	if i.IdempotencyKey == "" {
+		return i, false, s.RecordIssuance(ctx, i)
+	}
+
+	data, err := json.Marshal(i)
+	if err != nil {
+		return store.Issuance{}, false, err
+	}
+
+	set, err := s.setIdempotencyKey(ctx, i, data)
+	if err != nil {
+		return store.Issuance{}, false, err
+	}
+	if !set {
+		previous, found, err := s.IssuanceByIdempotencyKey(ctx, i.Identity, i.IdempotencyKey)
+		if err != nil || found {
+			return previous, found, err
+		}
+	}
+
+	score := strconv.FormatInt(i.IssuedAt.UnixMicro(), 10)
+	if _, err := s.Client.Do(ctx, "ZADD", s.issuancesKey(), score, string(data)); err != nil {
+		return store.Issuance{}, false, err
+	}
+	return i, false, nil
+}
+
+// setIdempotencyKey keeps the given issuance, encoded as data, under its
+// idempotency key unless one is already kept there, reporting whether it
+// was.
+func (s Store) setIdempotencyKey(ctx context.Context, i store.Issuance, data []byte) (bool, error) {
+	ttl := s.KeyTTL
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	reply, err := s.Client.Do(ctx, "SET", s.idempotencyKey(i.Identity, i.IdempotencyKey), string(data),
+		"NX", "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	return reply != nil, err
+}
+
+// Issuances returns the issuances recorded at or after from and before to,
+// in the order they were issued.
+func (s Store) Issuances(ctx context.Context, from, to time.Time) ([]store.Issuance, error) {
+	reply, err := s.Client.Do(ctx, "ZRANGEBYSCORE", s.issuancesKey(),
+		strconv.FormatInt(from.UnixMicro(), 10), "("+strconv.FormatInt(to.UnixMicro(), 10))
+	if err != nil {
+		return nil, err
+	}
+	members, ok := reply.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: unexpected reply %v", errProtocol, reply)
+	}
+
+	var issuances []store.Issuance
+	for _, member := range members {
+		i, err := parseIssuance(member)
+		if err != nil {
+			return nil, err
+		}
+		issuances = append(issuances, i)
+	}
+	return issuances, nil
+}
+
+// IssuanceByIdempotencyKey returns the earliest issuance requested by the
+// given identity with the given idempotency key, and whether there is one.
+func (s Store) IssuanceByIdempotencyKey(ctx context.Context, identity, key string) (store.Issuance, bool, error) {
+	if key == "" {
+		return store.Issuance{}, false, nil
+	}
+
+	reply, err := s.Client.Do(ctx, "GET", s.idempotencyKey(identity, key))
+	if err != nil || reply == nil {
+		return store.Issuance{}, false, err
+	}
+	i, err := parseIssuance(reply)
+	if err != nil {
+		return store.Issuance{}, false, err
+	}
+	return i, true, nil
+}
+
+func parseIssuance(reply any) (store.Issuance, error) {
+	data, ok := reply.(string)
+	if !ok {
+		return store.Issuance{}, fmt.Errorf("%w: unexpected reply %v", errProtocol, reply)
+	}
+	var i store.Issuance
+	if err := json.Unmarshal([]byte(data), &i); err != nil {
+		return store.Issuance{}, fmt.Errorf("redis: invalid issuance: %w", err)
+	}
+	return i, nil
+}
+
+// RedeemDraft records the redemption of the draft token with the given ID,
+// which expires at the given time, and reports whether it had not already
+// been redeemed, so that Store can be given to the
+// webhandlers.DraftRedemptions option. Redemptions are kept until the
+// token expires.
+func (s Store) RedeemDraft(ctx context.Context, id string, expiresAt time.Time) (bool, error) {
+	ttl := time.Until(expiresAt)
+	if ttl < time.Millisecond {
+		ttl = time.Millisecond
+	}
+	reply, err := s.Client.Do(ctx, "SET", s.prefix()+"draft:"+id, "1",
+		"NX", "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	return reply != nil, err
+}
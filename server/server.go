@@ -0,0 +1,249 @@
+// Package server serves an issuer's handlers over HTTPS with certificates
+// obtained automatically from an ACME certificate authority such as Let's
+// Encrypt. The specification requires the issuer URL, and therefore its
+// JWKS at /.well-known/jwks.json, to be served over HTTPS; see
+// https://spec.smarthealth.cards/#issuer-generated-keys.
+//
+// Certificates are obtained by a CertManager, which is satisfied by the
+// *autocert.Manager from golang.org/x/crypto/acme/autocert returned by
+// NewCertManager:
+//
+//	m := server.NewCertManager("/var/lib/shc/certs", "example.com")
+//	log.Fatal(server.ListenAndServeTLS(webhandlers.New(key, "https://example.com").Handler(), m))
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// CertManager obtains and renews TLS certificates on demand, answering the
+// certificate authority's challenges, as *autocert.Manager does.
+type CertManager interface {
+	// GetCertificate returns the certificate for the TLS handshake
+	// described by hello, as used by tls.Config.
+	GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error)
+
+	// HTTPHandler returns a handler answering HTTP-01 challenges, and
+	// passing any other request to fallback or, if fallback is nil,
+	// redirecting it to HTTPS.
+	HTTPHandler(fallback http.Handler) http.Handler
+}
+
+// NewCertManager returns an *autocert.Manager obtaining certificates from
+// Let's Encrypt, accepting its terms of service, for the given hosts only,
+// e.g. the host of the issuer URL, so that clients cannot cause
+// certificates to be requested for arbitrary names. It caches them in the
+// given directory, so that they survive restarts without being obtained
+// again. To allow the hosts of issuer URLs, replace its HostPolicy with one
+// returned by HostPolicy.
+func NewCertManager(cacheDir string, hosts ...string) *autocert.Manager {
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(cacheDir),
+		HostPolicy: autocert.HostWhitelist(hosts...),
+	}
+}
+
+// acmeALPNProto is the ALPN protocol negotiated for the TLS-ALPN-01
+// challenge; see RFC 8737.
+const acmeALPNProto = "acme-tls/1"
+
+// DefaultRequestTimeout is how long the servers returned by New allow for
+// reading each request and writing its response, unless its handler
+// extends the deadline.
+const DefaultRequestTimeout = time.Minute
+
+// New returns an HTTPS server listening on the standard HTTPS port, serving
+// the given handler with certificates obtained by the given CertManager. If
+// m is nil, the server has no TLS configuration, e.g. to serve plain HTTP,
+// or HTTPS with the certificate files given to ListenAndServeTLS.
+//
+// Its timeouts protect against clients which are slow to send requests or
+// read responses. Rather than a WriteTimeout for the whole server, which
+// would cut off responses streamed for longer, such as the ZIP archives of
+// large CSV batches, the handler is wrapped with Deadline, allowing
+// DefaultRequestTimeout for each request, which its handler can extend.
+func New(handler http.Handler, m CertManager) *http.Server {
+	s := &http.Server{
+		Addr:              ":https",
+		Handler:           Deadline(handler, DefaultRequestTimeout),
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+	}
+	if m != nil {
+		s.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: m.GetCertificate,
+			NextProtos:     []string{"h2", "http/1.1", acmeALPNProto},
+		}
+	}
+	return s
+}
+
+// Deadline wraps the given handler so that each request must be read, and
+// its response written, within the given timeout, by setting the
+// connection's deadlines with an http.ResponseController. Handlers which
+// stream long responses, such as webhandlers.ProcessCSV, extend the
+// deadlines with their own http.ResponseController as they go.
+func Deadline(handler http.Handler, timeout time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		deadline := time.Now().Add(timeout)
+		rc.SetReadDeadline(deadline)
+		rc.SetWriteDeadline(deadline)
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// ListenAndServeTLS serves the given handler over HTTPS on the standard
+// HTTPS port with certificates obtained by the given CertManager, as
+// returned by New, and serves the CertManager's HTTP handler on the
+// standard HTTP port, which answers HTTP-01 challenges and redirects other
+// requests to HTTPS. It returns when either server fails, after closing the
+// other, and always returns a non-nil error.
+func ListenAndServeTLS(handler http.Handler, m CertManager) error {
+	return ListenAndServeTLSContext(context.Background(), handler, m, 0)
+}
+
+// ListenAndServeTLSContext is like ListenAndServeTLS, but once the context
+// is done, e.g. on SIGTERM, it shuts both servers down gracefully, as
+// Graceful does, and returns nil if they drained within the given timeout.
+func ListenAndServeTLSContext(ctx context.Context, handler http.Handler, m CertManager, drainTimeout time.Duration) error {
+	httpsServer := New(handler, m)
+	httpServer := &http.Server{
+		Addr:              ":http",
+		Handler:           m.HTTPHandler(nil),
+		ReadHeaderTimeout: httpsServer.ReadHeaderTimeout,
+		ReadTimeout:       DefaultRequestTimeout,
+		WriteTimeout:      DefaultRequestTimeout,
+		IdleTimeout:       httpsServer.IdleTimeout,
+	}
+
+	errs := make(chan error, 2)
+	go func() {
+		errs <- fmt.Errorf("serving HTTP: %w", httpServer.ListenAndServe())
+	}()
+	go func() {
+		errs <- fmt.Errorf("serving HTTPS: %w", httpsServer.ListenAndServeTLS("", ""))
+	}()
+
+	select {
+	case err := <-errs:
+		httpServer.Close()
+		httpsServer.Close()
+		return err
+	case <-ctx.Done():
+		return shutdown(drainTimeout, httpsServer, httpServer)
+	}
+}
+
+// DefaultDrainTimeout is how long Graceful waits for in-flight requests to
+// complete unless another timeout is given.
+const DefaultDrainTimeout = 30 * time.Second
+
+// Graceful runs serve, e.g. s.ListenAndServe, until it fails or the context
+// is done, e.g. as returned by signal.NotifyContext for SIGTERM during a
+// rolling deploy. Then it shuts s down gracefully: it stops accepting
+// connections and waits, for up to the given timeout, or
+// DefaultDrainTimeout if it is not positive, for in-flight requests to
+// complete, so that cards being issued are recorded and ZIP archives being
+// streamed are not truncated. It returns nil if the requests completed in
+// time, and otherwise closes their connections and returns an error.
+//
+//	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+//	defer stop()
+//	s := &http.Server{Addr: ":8080", Handler: h.Handler()}
+//	log.Fatal(server.Graceful(ctx, s, s.ListenAndServe, time.Minute))
+func Graceful(ctx context.Context, s *http.Server, serve func() error, drainTimeout time.Duration) error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- serve()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	if err := shutdown(drainTimeout, s); err != nil {
+		return err
+	}
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// shutdown shuts the given servers down gracefully, closing them if their
+// in-flight requests do not complete within the given timeout.
+func shutdown(drainTimeout time.Duration, servers ...*http.Server) error {
+	if drainTimeout <= 0 {
+		drainTimeout = DefaultDrainTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+
+	var errs []error
+	for _, s := range servers {
+		if err := s.Shutdown(ctx); err != nil {
+			s.Close()
+			errs = append(errs, fmt.Errorf("server: draining in-flight requests: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// DebugHandler returns a handler serving the runtime profiles of
+// net/http/pprof under /debug/pprof/, e.g. /debug/pprof/profile for a CPU
+// profile of signing and QR code generation, and the variables of expvar at
+// /debug/vars. It exposes the process's internals, so it should be served
+// by its own server on an address reachable only by operators, e.g.
+// "localhost:6060", never alongside the issuance handlers.
+func DebugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	return mux
+}
+
+// HostPolicy returns a function, suitable as the HostPolicy of an
+// *autocert.Manager, which allows certificates to be obtained only for the
+// hosts of the given issuer URLs, so that clients cannot cause certificates
+// to be requested for arbitrary names. It returns an error if any of the
+// URLs is not an absolute HTTPS URL, as the specification requires.
+func HostPolicy(issuers ...string) (func(ctx context.Context, host string) error, error) {
+	hosts := map[string]bool{}
+	for _, issuer := range issuers {
+		u, err := url.Parse(issuer)
+		if err != nil {
+			return nil, fmt.Errorf("invalid issuer URL %q: %w", issuer, err)
+		}
+		if u.Scheme != "https" || u.Hostname() == "" {
+			return nil, fmt.Errorf("issuer URL %q is not an absolute HTTPS URL", issuer)
+		}
+		hosts[strings.ToLower(u.Hostname())] = true
+	}
+
+	return func(_ context.Context, host string) error {
+		if !hosts[strings.ToLower(host)] {
+			return errors.New("server: host is not that of an issuer")
+		}
+		return nil
+	}, nil
+}
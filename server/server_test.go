@@ -0,0 +1,56 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDeadline(t *testing.T) {
+	const timeout = 100 * time.Millisecond
+
+	tests := []struct {
+		name    string
+		extend  bool
+		wantErr bool
+	}{
+		{"slow response", false, true},
+		{"slow response extending the deadline", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := httptest.NewServer(Deadline(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.extend {
+					http.NewResponseController(w).SetWriteDeadline(time.Now().Add(10 * timeout))
+				}
+				time.Sleep(2 * timeout)
+				w.Write([]byte("ok"))
+			}), timeout))
+			defer s.Close()
+
+			resp, err := http.Get(s.URL)
+			if err == nil {
+				_, err = io.ReadAll(resp.Body)
+				resp.Body.Close()
+			}
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Errorf("error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewWithoutCertManager(t *testing.T) {
+	s := New(http.NotFoundHandler(), nil)
+	if s.TLSConfig != nil {
+		t.Error("TLSConfig is set without a CertManager")
+	}
+	if s.ReadHeaderTimeout == 0 {
+		t.Error("ReadHeaderTimeout is not set")
+	}
+	if s.WriteTimeout != 0 {
+		t.Errorf("WriteTimeout = %v, want none", s.WriteTimeout)
+	}
+}
@@ -0,0 +1,240 @@
+// Package shctest provides utilities for testing applications which issue
+// or verify SMART Health Cards with this module, in the manner of
+// net/http/httptest: a fixed test key, deterministic signing and issuance,
+// and a test server running the issuance handlers, along with helpers to
+// decode and verify its responses, so that integration tests need neither
+// real keys nor a real issuer.
+package shctest
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"fmt"
+	"io"
+	"math/big"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/fhirbundle"
+	"github.com/amitkgupta/go-smarthealthcards/v2/issuer"
+	"github.com/amitkgupta/go-smarthealthcards/v2/jws"
+	"github.com/amitkgupta/go-smarthealthcards/v2/qrcode"
+	"github.com/amitkgupta/go-smarthealthcards/v2/verifier"
+	"github.com/amitkgupta/go-smarthealthcards/v2/webhandlers"
+)
+
+// Now is the issuance time of the cards issued by NewIssuer and NewServer.
+var Now = time.Date(2021, time.June, 1, 0, 0, 0, 0, time.UTC)
+
+// key is the test key. It is public; never use it to issue real cards.
+var key = func() *ecdsa.PrivateKey {
+	d, _ := new(big.Int).SetString("f5054cb567899d3ad8525e2a1a189f0fdff6a537101e7db9e563378db538e822", 16)
+	k := &ecdsa.PrivateKey{D: d}
+	k.Curve = elliptic.P256()
+	k.X, k.Y = k.Curve.ScalarBaseMult(d.FillBytes(make([]byte, 32)))
+	return k
+}()
+
+// Key returns the pre-generated test key, which signs the cards issued by
+// Sign, NewIssuer, and NewServer.
+func Key() *ecdsa.PrivateKey {
+	return key
+}
+
+// Keys returns a JWKS holding the public key of Key, with which the
+// cards issued by this package verify.
+func Keys() verifier.JWKS {
+	jwksJSON, err := jws.JWKSJSON(key)
+	if err != nil {
+		panic(err)
+	}
+	keys, err := verifier.ParseJWKS(jwksJSON)
+	if err != nil {
+		panic(err)
+	}
+	return keys
+}
+
+// Sign signs the given payload with Key, deterministically, so that the
+// same payload always yields the same JWS.
+func Sign(payload []byte) (string, error) {
+	return jws.SignAndSerialize(payload, key, jws.Deterministic())
+}
+
+// NewIssuer returns an Issuer which issues cards on behalf of the issuer
+// with the given URL, signed deterministically with Key at Now, so that
+// the same FHIR bundle always yields the same card. The given options are
+// applied afterwards.
+func NewIssuer(iss string, opts ...issuer.Option) *issuer.Issuer {
+	return issuer.New(key, iss, append([]issuer.Option{
+		issuer.Deterministic(),
+		issuer.Clock(func() time.Time { return Now }),
+	}, opts...)...)
+}
+
+// Server is an HTTPS test server serving the issuance handlers at
+// webhandlers.DefaultRoutes on behalf of an issuer whose URL is the
+// server's own, so that its JWKS can be fetched from it.
+type Server struct {
+	*httptest.Server
+
+	// Handlers are the handlers being served.
+	Handlers webhandlers.Handlers
+}
+
+// NewServer starts a Server whose handlers sign cards deterministically
+// with Key at Now, customized by the given options, and closes it when the
+// test finishes.
+func NewServer(t testing.TB, opts ...webhandlers.Option) *Server {
+	t.Helper()
+
+	s := &Server{Server: httptest.NewUnstartedServer(nil)}
+	iss := "https://" + s.Listener.Addr().String()
+	s.Handlers = webhandlers.New(key, iss, append([]webhandlers.Option{
+		webhandlers.DeterministicSignatures(),
+		webhandlers.Clock(func() time.Time { return Now }),
+	}, opts...)...)
+	s.Config.Handler = s.Handlers.Handler()
+	s.StartTLS()
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// Keys returns a KeySource which fetches the server's JWKS with the
+// server's client, which trusts its certificate.
+func (s *Server) Keys() verifier.KeySource {
+	return verifier.IssuerJWKS{HTTPClient: s.Client()}
+}
+
+// IssueForm posts the given form values to the server's form endpoint,
+// asking for the card as a JWS, and returns the JWS. The test fails if the
+// card is not issued.
+func (s *Server) IssueForm(t testing.TB, form url.Values) string {
+	t.Helper()
+
+	form = cloneValues(form)
+	form.Set("output", "jws")
+	resp, err := s.Client().PostForm(s.URL+webhandlers.DefaultRoutes.Form, form)
+	if err != nil {
+		t.Fatalf("POST %s: %v", webhandlers.DefaultRoutes.Form, err)
+	}
+	return DecodeResponse(t, resp)
+}
+
+// Verify verifies the given JWS against the server's JWKS and returns the
+// card. The test fails if the card does not verify.
+func (s *Server) Verify(t testing.TB, healthCardJWS string) verifier.Card {
+	t.Helper()
+
+	card, err := verifier.Verify(context.Background(), healthCardJWS, s.Keys())
+	if err != nil {
+		t.Fatalf("verifying card: %v", err)
+	}
+	return card
+}
+
+// DecodeResponse reads a card written by the issuance handlers, as a JWS,
+// a .smart-health-card file, a QR code PNG, or a ZIP archive of QR code
+// PNGs, according to its Content-Type, and returns its JWS. It closes the
+// response's body. The test fails if the response is not a successful one
+// holding a card.
+func DecodeResponse(t testing.TB, resp *http.Response) string {
+	t.Helper()
+
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+
+	healthCardJWS, err := decode(resp.Header.Get("Content-Type"), body)
+	if err != nil {
+		t.Fatalf("decoding %s response: %v", resp.Header.Get("Content-Type"), err)
+	}
+	return healthCardJWS
+}
+
+func decode(contentType string, body []byte) (string, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/smart-health-card":
+		jwss, err := verifier.ParseFile(body)
+		if err != nil {
+			return "", err
+		}
+		if len(jwss) != 1 {
+			return "", fmt.Errorf("file holds %d cards, want 1", len(jwss))
+		}
+		return jwss[0], nil
+	case "image/png":
+		return qrcode.Decode(body)
+	case "application/zip":
+		zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+		if err != nil {
+			return "", err
+		}
+		var images [][]byte
+		for _, f := range zr.File {
+			if path.Ext(f.Name) != ".png" {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return "", err
+			}
+			image, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return "", err
+			}
+			images = append(images, image)
+		}
+		return qrcode.Decode(images...)
+	default:
+		return strings.TrimSpace(string(body)), nil
+	}
+}
+
+// Form returns the form values expected by the form endpoint for the given
+// FHIR bundle, which may hold up to three immunizations. The given names are
+// repeated "given_name" values, so that multi-word given names are kept
+// whole.
+func Form(fb fhirbundle.FHIRBundle) url.Values {
+	form := url.Values{
+		"family_name":   {fb.Patient.Name.Family},
+		"given_name":    append([]string(nil), fb.Patient.Name.Givens...),
+		"date_of_birth": {fb.Patient.BirthDate.Format("2006-01-02")},
+	}
+	for i, ordinal := range []string{"first", "second", "third"} {
+		if i >= len(fb.Immunizations) {
+			break
+		}
+		immunization := fb.Immunizations[i]
+		form.Set(ordinal+"_immunization_performer", immunization.Performer)
+		form.Set(ordinal+"_immunization_lot_number", immunization.LotNumber)
+		form.Set(ordinal+"_immunization_vaccine_type", string(immunization.VaccineType))
+		form.Set(ordinal+"_immunization_date", immunization.DatePerformed.Format("2006-01-02"))
+	}
+	return form
+}
+
+func cloneValues(values url.Values) url.Values {
+	clone := make(url.Values, len(values)+1)
+	for k, v := range values {
+		clone[k] = append([]string(nil), v...)
+	}
+	return clone
+}
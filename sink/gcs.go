@@ -0,0 +1,121 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GCS is a Sink which puts files in a Google Cloud Storage bucket with the
+// JSON API's media uploads. See
+// https://cloud.google.com/storage/docs/uploading-objects#uploading-an-object.
+type GCS struct {
+	// Bucket is the name of the bucket.
+	Bucket string
+
+	// Prefix is prepended to the names of files to form their object
+	// names, e.g. "cards/".
+	Prefix string
+
+	// Endpoint is the URL of the API, e.g. that of an emulator; it defaults
+	// to "https://storage.googleapis.com".
+	Endpoint string
+
+	// Token returns the OAuth 2.0 access token with which requests are
+	// authorized. By default, the token of the default service account of
+	// the instance running the process is fetched from the metadata
+	// server, as on Compute Engine, GKE, and Cloud Run, and reused until
+	// it expires.
+	Token func(ctx context.Context) (string, error)
+
+	// HTTPClient is used to make requests; it defaults to
+	// http.DefaultClient.
+	HTTPClient *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// metadataTokenURL is the metadata server's endpoint for the access token
+// of the default service account.
+const metadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+// Put puts the file in the bucket under the Prefix followed by its name.
+func (g *GCS) Put(ctx context.Context, name, contentType string, data []byte) error {
+	token, err := g.accessToken(ctx)
+	if err != nil {
+		return fmt.Errorf("sink: gcs: %w", err)
+	}
+
+	endpoint := g.Endpoint
+	if endpoint == "" {
+		endpoint = "https://storage.googleapis.com"
+	}
+	u := fmt.Sprintf("%s/upload/storage/v1/b/%s/o?uploadType=media&name=%s",
+		strings.TrimSuffix(endpoint, "/"), url.PathEscape(g.Bucket), url.QueryEscape(g.Prefix+name))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("sink: gcs: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	if err := do(g.HTTPClient, req); err != nil {
+		return fmt.Errorf("sink: gcs: %w", err)
+	}
+	return nil
+}
+
+// accessToken returns the token given by Token or, if it is nil, by the
+// metadata server.
+func (g *GCS) accessToken(ctx context.Context) (string, error) {
+	if g.Token != nil {
+		return g.Token(ctx)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.token != "" && time.Now().Before(g.expires) {
+		return g.token, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadataTokenURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	client := g.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("fetching access token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetching access token: unexpected status %s", resp.Status)
+	}
+
+	var t struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&t); err != nil {
+		return "", fmt.Errorf("fetching access token: %w", err)
+	}
+
+	// Refresh the token a minute before it expires, so that it does not
+	// expire in flight.
+	g.token, g.expires = t.AccessToken, time.Now().Add(time.Duration(t.ExpiresIn)*time.Second-time.Minute)
+	return g.token, nil
+}
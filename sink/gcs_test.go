@@ -0,0 +1,137 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestGCSPut(t *testing.T) {
+	var (
+		gotMethod, gotPath, gotName, gotContentType, gotAuthorization string
+		gotBody                                                       []byte
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod, gotPath = r.Method, r.URL.EscapedPath()
+		gotName = r.URL.Query().Get("name")
+		gotContentType = r.Header.Get("Content-Type")
+		gotAuthorization = r.Header.Get("Authorization")
+		gotBody, _ = io.ReadAll(r.Body)
+		w.Write([]byte(`{"kind":"storage#object"}`))
+	}))
+	defer srv.Close()
+
+	g := &GCS{
+		Bucket:     "cards",
+		Prefix:     "issued/",
+		Endpoint:   srv.URL + "/",
+		Token:      func(ctx context.Context) (string, error) { return "ya29.token", nil },
+		HTTPClient: srv.Client(),
+	}
+	if err := g.Put(context.Background(), "jane doe&co.png", "image/png", []byte("png")); err != nil {
+		t.Fatal(err)
+	}
+
+	if gotMethod != http.MethodPost {
+		t.Errorf("method = %s, want POST", gotMethod)
+	}
+	if want := "/upload/storage/v1/b/cards/o"; gotPath != want {
+		t.Errorf("path = %s, want %s", gotPath, want)
+	}
+	if want := "issued/jane doe&co.png"; gotName != want {
+		t.Errorf("name = %q, want %q", gotName, want)
+	}
+	if gotContentType != "image/png" {
+		t.Errorf("Content-Type = %q, want %q", gotContentType, "image/png")
+	}
+	if gotAuthorization != "Bearer ya29.token" {
+		t.Errorf("Authorization = %q, want %q", gotAuthorization, "Bearer ya29.token")
+	}
+	if string(gotBody) != "png" {
+		t.Errorf("body = %q, want %q", gotBody, "png")
+	}
+}
+
+func TestGCSPutTokenError(t *testing.T) {
+	errToken := errors.New("no credentials")
+	g := &GCS{
+		Bucket:   "cards",
+		Endpoint: "http://127.0.0.1:0",
+		Token:    func(ctx context.Context) (string, error) { return "", errToken },
+	}
+	if err := g.Put(context.Background(), "card.png", "image/png", []byte("png")); !errors.Is(err, errToken) {
+		t.Errorf("error = %v, want %v", err, errToken)
+	}
+}
+
+// redirectTransport sends every request to the given server, as if it were
+// both the metadata server and the JSON API.
+type redirectTransport struct {
+	srv *httptest.Server
+}
+
+func (t redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	u, _ := url.Parse(t.srv.URL)
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = u.Scheme, u.Host
+	return t.srv.Client().Transport.RoundTrip(req)
+}
+
+func TestGCSMetadataToken(t *testing.T) {
+	var tokenRequests int
+	var gotAuthorization []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/computeMetadata/") {
+			if r.Header.Get("Metadata-Flavor") != "Google" {
+				http.Error(w, "missing Metadata-Flavor header", http.StatusForbidden)
+				return
+			}
+			tokenRequests++
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"access_token":"ya29.metadata","expires_in":3599,"token_type":"Bearer"}`))
+			return
+		}
+		gotAuthorization = append(gotAuthorization, r.Header.Get("Authorization"))
+	}))
+	defer srv.Close()
+
+	g := &GCS{
+		Bucket:     "cards",
+		HTTPClient: &http.Client{Transport: redirectTransport{srv}},
+	}
+	for i := 0; i < 2; i++ {
+		if err := g.Put(context.Background(), "card.png", "image/png", []byte("png")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if tokenRequests != 1 {
+		t.Errorf("fetched the token %d times, want once", tokenRequests)
+	}
+	for _, got := range gotAuthorization {
+		if got != "Bearer ya29.metadata" {
+			t.Errorf("Authorization = %q, want %q", got, "Bearer ya29.metadata")
+		}
+	}
+	if len(gotAuthorization) != 2 {
+		t.Errorf("made %d uploads, want 2", len(gotAuthorization))
+	}
+}
+
+func TestGCSMetadataTokenError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	g := &GCS{Bucket: "cards", HTTPClient: &http.Client{Transport: redirectTransport{srv}}}
+	err := g.Put(context.Background(), "card.png", "image/png", []byte("png"))
+	if err == nil || !strings.Contains(err.Error(), "fetching access token") {
+		t.Errorf("error = %v, want one fetching the access token", err)
+	}
+}
@@ -0,0 +1,171 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3 is a Sink which puts files in an Amazon S3 bucket, or a bucket of any
+// service compatible with its API, e.g. MinIO, signing requests with AWS
+// Signature Version 4. See
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_PutObject.html.
+type S3 struct {
+	// Bucket is the name of the bucket.
+	Bucket string
+
+	// Region is the region of the bucket, e.g. "us-east-1".
+	Region string
+
+	// Prefix is prepended to the names of files to form their keys, e.g.
+	// "cards/".
+	Prefix string
+
+	// Endpoint, if given, is the URL of an S3-compatible service, e.g.
+	// "http://localhost:9000", whose buckets are addressed by path; by
+	// default buckets are addressed as virtual hosts of Amazon S3.
+	Endpoint string
+
+	// AccessKeyID, SecretAccessKey, and SessionToken are the credentials
+	// with which requests are signed; SessionToken is needed only for
+	// temporary credentials.
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+
+	// HTTPClient is used to make requests; it defaults to
+	// http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// S3FromEnv returns an S3 sink for the given bucket with the region and
+// credentials given by the standard AWS_REGION (or AWS_DEFAULT_REGION),
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, and AWS_SESSION_TOKEN
+// environment variables, and the endpoint given by AWS_ENDPOINT_URL_S3, if
+// any.
+func S3FromEnv(bucket string) (*S3, error) {
+	s := &S3{
+		Bucket:          bucket,
+		Region:          os.Getenv("AWS_REGION"),
+		Endpoint:        os.Getenv("AWS_ENDPOINT_URL_S3"),
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if s.Region == "" {
+		s.Region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if s.Region == "" {
+		return nil, errors.New("sink: AWS_REGION is not set")
+	}
+	if s.AccessKeyID == "" || s.SecretAccessKey == "" {
+		return nil, errors.New("sink: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are not set")
+	}
+	return s, nil
+}
+
+// Put puts the file in the bucket under the Prefix followed by its name.
+func (s *S3) Put(ctx context.Context, name, contentType string, data []byte) error {
+	key := s.Prefix + name
+	url := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", s.Bucket, s.Region, uriEncode(key, true))
+	if s.Endpoint != "" {
+		url = fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(s.Endpoint, "/"), uriEncode(s.Bucket, false), uriEncode(key, true))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("sink: s3: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	s.sign(req, data, time.Now())
+
+	if err := do(s.HTTPClient, req); err != nil {
+		return fmt.Errorf("sink: s3: %w", err)
+	}
+	return nil
+}
+
+// sign adds the headers authenticating the request with AWS Signature
+// Version 4, see
+// https://docs.aws.amazon.com/IAM/latest/UserGuide/create-signed-request.html.
+func (s *S3) sign(req *http.Request, payload []byte, t time.Time) {
+	t = t.UTC()
+	date, amzDate := t.Format("20060102"), t.Format("20060102T150405Z")
+
+	payloadHash := sha256.Sum256(payload)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(req.Header.Get(name))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	scope := date + "/" + s.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + s.SecretAccessKey)
+	for _, part := range []string{date, s.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// uriEncode percent-encodes every byte of s but the unreserved characters
+// of RFC 3986, and "/" if keepSlash is true, as Signature Version 4
+// requires of paths.
+func uriEncode(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '.', c == '_', c == '~', c == '/' && keepSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,80 @@
+// Package sink writes the files of issued SMART Health Cards, i.e. the
+// PNGs of their QR codes or their .smart-health-card files, to object
+// storage, e.g. Amazon S3 or Google Cloud Storage, so that large batches
+// can be issued without streaming every card in the HTTP response.
+//
+// It signs its requests itself, so that it has no dependencies beyond the
+// standard library.
+package sink
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Sink stores files by name, replacing any file with the same name.
+type Sink interface {
+	Put(ctx context.Context, name, contentType string, data []byte) error
+}
+
+// Func adapts a function to a Sink.
+type Func func(ctx context.Context, name, contentType string, data []byte) error
+
+// Put calls f(ctx, name, contentType, data).
+func (f Func) Put(ctx context.Context, name, contentType string, data []byte) error {
+	return f(ctx, name, contentType, data)
+}
+
+// FromURL returns the sink given by a URL naming a bucket and, optionally,
+// a prefix of the names of the files put in it: "s3://bucket/prefix/" for
+// an S3 sink configured by S3FromEnv, or "gs://bucket/prefix/" for a GCS
+// sink authorized by the metadata server.
+func FromURL(rawURL string) (Sink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("sink: %w", err)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("sink: %s: missing bucket", rawURL)
+	}
+	prefix := strings.TrimPrefix(u.Path, "/")
+
+	switch u.Scheme {
+	case "s3":
+		s, err := S3FromEnv(u.Host)
+		if err != nil {
+			return nil, err
+		}
+		s.Prefix = prefix
+		return s, nil
+	case "gs":
+		return &GCS{Bucket: u.Host, Prefix: prefix}, nil
+	}
+	return nil, fmt.Errorf("sink: %s: unknown scheme; use s3:// or gs://", rawURL)
+}
+
+// do sends a request with the given client, or http.DefaultClient if it is
+// nil, and returns an error describing the response if its status is not
+// 2xx.
+func do(client *http.Client, req *http.Request) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s: unexpected status %s: %s", req.Method, req.URL.Redacted(), resp.Status, body)
+	}
+	_, err = io.Copy(io.Discard, resp.Body)
+	return err
+}
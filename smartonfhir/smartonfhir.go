@@ -0,0 +1,234 @@
+// Package smartonfhir fetches a patient's COVID-19 immunization history from
+// a FHIR server, authorized with an OAuth 2.0 access token obtained through
+// SMART on FHIR, and maps it into an fhirbundle.FHIRBundle which can then be
+// issued as a SMART Health Card. See
+// https://hl7.org/fhir/smart-app-launch/
+// and
+// https://spec.smarthealth.cards/#health-cards-are-encoded-as-compact-serialization-json-web-signatures-jws.
+package smartonfhir
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/fhirbundle"
+)
+
+const cvxSystem = "http://hl7.org/fhir/sid/cvx"
+
+// ErrNoImmunizations is returned when the patient has no completed COVID-19
+// immunizations of a supported vaccine type.
+var ErrNoImmunizations = errors.New("patient has no supported COVID-19 immunizations")
+
+// Client fetches resources from a FHIR server.
+type Client struct {
+	// BaseURL is the FHIR server's base URL, e.g. the "iss" parameter of a
+	// SMART on FHIR launch.
+	BaseURL string
+
+	// AccessToken is the OAuth 2.0 bearer token authorizing access to the
+	// patient's Patient and Immunization resources.
+	AccessToken string
+
+	// HTTPClient is used to make requests; it defaults to
+	// http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// FetchBundle fetches the Patient resource with the given ID and the
+// patient's Immunization resources, and returns the core relevant data for
+// an FHIR bundle representing the patient's completed COVID-19 immunizations
+// of supported vaccine types, in chronological order. Immunizations of other
+// vaccine types are ignored.
+func (c Client) FetchBundle(ctx context.Context, patientID string) (fhirbundle.FHIRBundle, error) {
+	var p patient
+	if err := c.get(ctx, c.BaseURL+"/Patient/"+url.PathEscape(patientID), &p); err != nil {
+		return fhirbundle.FHIRBundle{}, err
+	}
+
+	birthDate, err := parseDate(p.BirthDate)
+	if err != nil {
+		return fhirbundle.FHIRBundle{}, fmt.Errorf("invalid patient birth date: %w", err)
+	}
+
+	fb := fhirbundle.FHIRBundle{
+		Patient: fhirbundle.Patient{
+			Name:      p.name(),
+			BirthDate: birthDate,
+		},
+	}
+
+	next := c.BaseURL + "/Immunization?patient=" + url.QueryEscape(patientID)
+	for next != "" {
+		var b bundle
+		if err := c.get(ctx, next, &b); err != nil {
+			return fhirbundle.FHIRBundle{}, err
+		}
+
+		for _, entry := range b.Entries {
+			if immunization, ok := entry.Resource.immunization(); ok {
+				fb.Immunizations = append(fb.Immunizations, immunization)
+			}
+		}
+
+		next = b.next()
+	}
+
+	if len(fb.Immunizations) == 0 {
+		return fhirbundle.FHIRBundle{}, ErrNoImmunizations
+	}
+
+	sort.SliceStable(fb.Immunizations, func(i, j int) bool {
+		return fb.Immunizations[i].DatePerformed.Before(fb.Immunizations[j].DatePerformed)
+	})
+
+	return fb, nil
+}
+
+func (c Client) get(ctx context.Context, u string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/fhir+json")
+	req.Header.Set("Authorization", "Bearer "+c.AccessToken)
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: unexpected status %s", u, resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+type patient struct {
+	Names []struct {
+		Use    string   `json:"use"`
+		Family string   `json:"family"`
+		Givens []string `json:"given"`
+	} `json:"name"`
+	BirthDate string `json:"birthDate"`
+}
+
+// name returns the patient's official name, or the first name if none is
+// marked official.
+func (p patient) name() fhirbundle.Name {
+	if len(p.Names) == 0 {
+		return fhirbundle.Name{}
+	}
+
+	n := p.Names[0]
+	for _, candidate := range p.Names {
+		if candidate.Use == "official" {
+			n = candidate
+			break
+		}
+	}
+
+	return fhirbundle.Name{Family: n.Family, Givens: n.Givens}
+}
+
+type bundle struct {
+	Links []struct {
+		Relation string `json:"relation"`
+		URL      string `json:"url"`
+	} `json:"link"`
+	Entries []struct {
+		Resource resource `json:"resource"`
+	} `json:"entry"`
+}
+
+func (b bundle) next() string {
+	for _, link := range b.Links {
+		if link.Relation == "next" {
+			return link.URL
+		}
+	}
+	return ""
+}
+
+type resource struct {
+	ResourceType string `json:"resourceType"`
+	Status       string `json:"status"`
+	VaccineCode  struct {
+		Coding []struct {
+			System string `json:"system"`
+			Code   string `json:"code"`
+		} `json:"coding"`
+	} `json:"vaccineCode"`
+	OccurrenceDateTime string `json:"occurrenceDateTime"`
+	Performers         []struct {
+		Actor struct {
+			Display string `json:"display"`
+		} `json:"actor"`
+	} `json:"performer"`
+	LotNumber string `json:"lotNumber"`
+}
+
+// immunization maps a resource to an fhirbundle.Immunization, returning
+// false if the resource is not a completed immunization with a supported
+// vaccine type.
+func (r resource) immunization() (fhirbundle.Immunization, bool) {
+	if r.ResourceType != "Immunization" || r.Status != "completed" {
+		return fhirbundle.Immunization{}, false
+	}
+
+	var vaccineType fhirbundle.VaccineType
+	for _, coding := range r.VaccineCode.Coding {
+		if strings.TrimSuffix(coding.System, "/") == cvxSystem {
+			if vt, ok := fhirbundle.VaccineTypeFromCVX(coding.Code); ok {
+				vaccineType = vt
+				break
+			}
+		}
+	}
+	if vaccineType == "" {
+		return fhirbundle.Immunization{}, false
+	}
+
+	datePerformed, err := parseDate(r.OccurrenceDateTime)
+	if err != nil {
+		return fhirbundle.Immunization{}, false
+	}
+
+	var performer string
+	if len(r.Performers) > 0 {
+		performer = r.Performers[0].Actor.Display
+	}
+
+	return fhirbundle.Immunization{
+		DatePerformed: datePerformed,
+		Performer:     performer,
+		LotNumber:     r.LotNumber,
+		VaccineType:   vaccineType,
+	}, true
+}
+
+// parseDate parses an FHIR date or dateTime.
+func parseDate(s string) (time.Time, error) {
+	var err error
+	for _, layout := range []string{"2006-01-02", time.RFC3339, "2006-01", "2006"} {
+		var t time.Time
+		if t, err = time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
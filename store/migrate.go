@@ -0,0 +1,146 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// migrations are the schema changes applied by Migrate, in order, each
+// numbered by its index plus one.
+var migrations = []func(s SQL) []string{
+	// 1: the issuances table, as created by CreateTable.
+	func(s SQL) []string {
+		return []string{fmt.Sprintf(
+			`CREATE TABLE IF NOT EXISTS %s (
+				card_hash CHAR(64) NOT NULL PRIMARY KEY,
+				kid VARCHAR(64) NOT NULL,
+				issuer VARCHAR(2048) NOT NULL,
+				issued_at TIMESTAMP NOT NULL,
+				identity VARCHAR(255) NOT NULL,
+				idempotency_key VARCHAR(255)
+			)`,
+			s.table(),
+		)}
+	},
+
+	// 2: indexes for Issuances and IssuanceByIdempotencyKey.
+	func(s SQL) []string {
+		return []string{
+			fmt.Sprintf("CREATE INDEX %s_issued_at ON %s (issued_at)", s.table(), s.table()),
+			fmt.Sprintf("CREATE INDEX %s_idempotency_key ON %s (identity, idempotency_key)", s.table(), s.table()),
+		}
+	},
+
+	// 3: the revocations table.
+	func(s SQL) []string {
+		return []string{fmt.Sprintf(
+			`CREATE TABLE %s (
+				card_hash CHAR(64) NOT NULL PRIMARY KEY,
+				revoked_at TIMESTAMP NOT NULL,
+				reason VARCHAR(1024) NOT NULL
+			)`,
+			s.revocationsTable(),
+		)}
+	},
+
+	// 4: a unique index for RecordIdempotentIssuance, replacing that of
+	// migration 2. It fails if an identity has already been recorded
+	// using the same idempotency key twice; delete all but the earliest of
+	// those issuances before migrating.
+	func(s SQL) []string {
+		return []string{
+			fmt.Sprintf("DROP INDEX %s_idempotency_key", s.table()),
+			fmt.Sprintf("CREATE UNIQUE INDEX %s_idempotency_key ON %s (identity, idempotency_key)", s.table(), s.table()),
+		}
+	},
+}
+
+func (s SQL) revocationsTable() string {
+	if s.RevocationsTable == "" {
+		return "shc_revocations"
+	}
+	return s.RevocationsTable
+}
+
+func (s SQL) migrationsTable() string {
+	return s.table() + "_migrations"
+}
+
+// Migrate creates or updates the tables in which issuances and
+// revocations are recorded to the schema expected by this version of the
+// package, recording the migrations it has applied in a table named after
+// the issuances table with a "_migrations" suffix, so that it is safe to
+// call every time a deployment starts. Each migration is applied in a
+// transaction. If several instances of a deployment start at once, all but
+// one may fail to apply a migration, and should be restarted.
+func (s SQL) Migrate(ctx context.Context) error {
+	if _, err := s.DB.ExecContext(ctx, fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s (version INTEGER NOT NULL PRIMARY KEY, applied_at TIMESTAMP NOT NULL)",
+		s.migrationsTable(),
+	)); err != nil {
+		return err
+	}
+
+	var version sql.NullInt64
+	if err := s.DB.QueryRowContext(ctx, fmt.Sprintf("SELECT MAX(version) FROM %s", s.migrationsTable())).Scan(&version); err != nil {
+		return err
+	}
+
+	for v := int(version.Int64) + 1; v <= len(migrations); v++ {
+		if err := s.migrate(ctx, v); err != nil {
+			return fmt.Errorf("store: migration %d: %w", v, err)
+		}
+	}
+	return nil
+}
+
+func (s SQL) migrate(ctx context.Context, version int) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, statement := range migrations[version-1](s) {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(
+		"INSERT INTO %s (version, applied_at) VALUES (%s, %s)",
+		s.migrationsTable(), s.placeholder(1), s.placeholder(2),
+	), version, time.Now().UTC()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Revoke records the revocation of a card.
+func (s SQL) Revoke(ctx context.Context, r Revocation) error {
+	revoked, err := s.Revoked(ctx, r.CardHash)
+	if err != nil || revoked {
+		return err
+	}
+
+	_, err = s.DB.ExecContext(ctx, fmt.Sprintf(
+		"INSERT INTO %s (card_hash, revoked_at, reason) VALUES (%s, %s, %s)",
+		s.revocationsTable(), s.placeholder(1), s.placeholder(2), s.placeholder(3),
+	), r.CardHash, r.RevokedAt.UTC(), r.Reason)
+	return err
+}
+
+// Revoked reports whether the card with the given hash has been revoked.
+func (s SQL) Revoked(ctx context.Context, cardHash string) (bool, error) {
+	var hash string
+	err := s.DB.QueryRowContext(ctx, fmt.Sprintf(
+		"SELECT card_hash FROM %s WHERE card_hash = %s",
+		s.revocationsTable(), s.placeholder(1),
+	), cardHash).Scan(&hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
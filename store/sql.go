@@ -0,0 +1,173 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// SQL is an IdempotentIssuanceStore and Revoker which keeps issuances and
+// revocations in tables of a SQL database. It uses only SQL understood by
+// both SQLite, version 3.24 or later, and PostgreSQL, so it can be used
+// with any database/sql driver for either; NewSQLite and NewPostgres
+// configure it for each. Create the tables with Migrate.
+//
+// Tables created by CreateTable before idempotency keys were recorded need
+// a nullable idempotency_key VARCHAR(255) column added before issuances
+// with idempotency keys can be recorded.
+type SQL struct {
+	// DB is the database in which issuances are recorded.
+	DB *sql.DB
+
+	// Table is the name of the table in which issuances are recorded; it
+	// defaults to "shc_issuances".
+	Table string
+
+	// RevocationsTable is the name of the table in which revocations are
+	// recorded; it defaults to "shc_revocations".
+	RevocationsTable string
+
+	// NumberedPlaceholders makes queries use $1, $2, etc. as placeholders,
+	// as PostgreSQL requires, rather than ?.
+	NumberedPlaceholders bool
+}
+
+// NewSQLite returns a SQL store keeping issuances in the given SQLite
+// database, e.g. opened with the modernc.org/sqlite or
+// github.com/mattn/go-sqlite3 driver.
+func NewSQLite(db *sql.DB) SQL {
+	return SQL{DB: db}
+}
+
+// NewPostgres returns a SQL store keeping issuances in the given PostgreSQL
+// database, e.g. opened with the github.com/jackc/pgx/v5/stdlib or
+// github.com/lib/pq driver.
+func NewPostgres(db *sql.DB) SQL {
+	return SQL{DB: db, NumberedPlaceholders: true}
+}
+
+func (s SQL) table() string {
+	if s.Table == "" {
+		return "shc_issuances"
+	}
+	return s.Table
+}
+
+func (s SQL) placeholder(n int) string {
+	if s.NumberedPlaceholders {
+		return fmt.Sprintf("$%d", n)
+	}
+	return "?"
+}
+
+// CreateTable creates the table in which issuances are recorded, if it does
+// not already exist. Migrate creates it too, along with the indexes and
+// other tables of later versions of this package; use it instead.
+func (s SQL) CreateTable(ctx context.Context) error {
+	_, err := s.DB.ExecContext(ctx, fmt.Sprintf(
+		`CREATE TABLE IF NOT EXISTS %s (
+			card_hash CHAR(64) NOT NULL PRIMARY KEY,
+			kid VARCHAR(64) NOT NULL,
+			issuer VARCHAR(2048) NOT NULL,
+			issued_at TIMESTAMP NOT NULL,
+			identity VARCHAR(255) NOT NULL,
+			idempotency_key VARCHAR(255)
+		)`,
+		s.table(),
+	))
+	return err
+}
+
+// RecordIssuance records the issuance of a card. Recording the issuance of
+// a card which has already been recorded, e.g. one issued again
+// deterministically, has no effect.
+func (s SQL) RecordIssuance(ctx context.Context, i Issuance) error {
+	if i.IdempotencyKey != "" {
+		_, err := s.DB.ExecContext(ctx, fmt.Sprintf(
+			"INSERT INTO %s (card_hash, kid, issuer, issued_at, identity, idempotency_key) VALUES (%s, %s, %s, %s, %s, %s) ON CONFLICT (card_hash) DO NOTHING",
+			s.table(), s.placeholder(1), s.placeholder(2), s.placeholder(3), s.placeholder(4), s.placeholder(5), s.placeholder(6),
+		), i.CardHash, i.KeyID, i.Issuer, i.IssuedAt.UTC(), i.Identity, i.IdempotencyKey)
+		return err
+	}
+
+	_, err := s.DB.ExecContext(ctx, fmt.Sprintf(
+		"INSERT INTO %s (card_hash, kid, issuer, issued_at, identity) VALUES (%s, %s, %s, %s, %s) ON CONFLICT (card_hash) DO NOTHING",
+		s.table(), s.placeholder(1), s.placeholder(2), s.placeholder(3), s.placeholder(4), s.placeholder(5),
+	), i.CardHash, i.KeyID, i.Issuer, i.IssuedAt.UTC(), i.Identity)
+	return err
+}
+
+// Issuances returns the issuances recorded at or after from and before to,
+// in the order they were issued.
+func (s SQL) Issuances(ctx context.Context, from, to time.Time) ([]Issuance, error) {
+	rows, err := s.DB.QueryContext(ctx, fmt.Sprintf(
+		"SELECT card_hash, kid, issuer, issued_at, identity FROM %s WHERE issued_at >= %s AND issued_at < %s ORDER BY issued_at",
+		s.table(), s.placeholder(1), s.placeholder(2),
+	), from.UTC(), to.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var issuances []Issuance
+	for rows.Next() {
+		var i Issuance
+		if err := rows.Scan(&i.CardHash, &i.KeyID, &i.Issuer, &i.IssuedAt, &i.Identity); err != nil {
+			return nil, err
+		}
+		issuances = append(issuances, i)
+	}
+	return issuances, rows.Err()
+}
+
+// IssuanceByIdempotencyKey returns the earliest issuance requested by the
+// given identity with the given idempotency key, and whether there is one.
+func (s SQL) IssuanceByIdempotencyKey(ctx context.Context, identity, key string) (Issuance, bool, error) {
+	if key == "" {
+		return Issuance{}, false, nil
+	}
+
+	rows, err := s.DB.QueryContext(ctx, fmt.Sprintf(
+		"SELECT card_hash, kid, issuer, issued_at, identity, idempotency_key FROM %s WHERE identity = %s AND idempotency_key = %s ORDER BY issued_at",
+		s.table(), s.placeholder(1), s.placeholder(2),
+	), identity, key)
+	if err != nil {
+		return Issuance{}, false, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return Issuance{}, false, rows.Err()
+	}
+	var i Issuance
+	if err := rows.Scan(&i.CardHash, &i.KeyID, &i.Issuer, &i.IssuedAt, &i.Identity, &i.IdempotencyKey); err != nil {
+		return Issuance{}, false, err
+	}
+	return i, true, nil
+}
+
+// RecordIdempotentIssuance atomically records the issuance of a card
+// requested with an idempotency key unless an issuance requested by the
+// same identity with the same key has already been recorded, in which case
+// it records nothing and returns that issuance and true. It relies on the
+// unique index created by Migrate.
+func (s SQL) RecordIdempotentIssuance(ctx context.Context, i Issuance) (Issuance, bool, error) {
+	result, err := s.DB.ExecContext(ctx, fmt.Sprintf(
+		"INSERT INTO %s (card_hash, kid, issuer, issued_at, identity, idempotency_key) VALUES (%s, %s, %s, %s, %s, %s) ON CONFLICT DO NOTHING",
+		s.table(), s.placeholder(1), s.placeholder(2), s.placeholder(3), s.placeholder(4), s.placeholder(5), s.placeholder(6),
+	), i.CardHash, i.KeyID, i.Issuer, i.IssuedAt.UTC(), i.Identity, i.IdempotencyKey)
+	if err != nil {
+		return Issuance{}, false, err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 1 {
+		return i, false, err
+	}
+
+	// Either the key or the card itself had already been recorded.
+	previous, found, err := s.IssuanceByIdempotencyKey(ctx, i.Identity, i.IdempotencyKey)
+	if err != nil || !found {
+		return i, false, err
+	}
+	return previous, true, nil
+}
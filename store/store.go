@@ -0,0 +1,204 @@
+// Package store records the SMART Health Cards which have been issued, so
+// that deployments can answer auditors' questions such as how many cards
+// were issued and when, without storing the cards' health data. It provides
+// an in-memory implementation, suitable for tests and single-process
+// deployments, and an implementation backed by a SQL database, such as
+// SQLite or PostgreSQL. Both also record revoked cards.
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Issuance records the issuance of a single card.
+type Issuance struct {
+	// CardHash is the hex-encoded SHA-256 hash of the card's JWS, as
+	// returned by CardHash.
+	CardHash string
+
+	// KeyID is the "kid" of the key which signed the card.
+	KeyID string
+
+	// Issuer is the issuer URL, the "iss" value of the card.
+	Issuer string
+
+	// IssuedAt is when the card was signed.
+	IssuedAt time.Time
+
+	// Identity identifies who requested the card, e.g. the subject of the
+	// webhandlers.Identity authorized to issue it, or is empty if not
+	// known.
+	Identity string
+
+	// IdempotencyKey is the idempotency key with which the card was
+	// requested, or is empty if none was given.
+	IdempotencyKey string
+}
+
+// IssuanceStore records issued cards.
+type IssuanceStore interface {
+	// RecordIssuance records the issuance of a card. Recording the
+	// issuance of a card which has already been recorded has no effect.
+	RecordIssuance(ctx context.Context, i Issuance) error
+
+	// Issuances returns the issuances recorded at or after from and
+	// before to, in the order they were issued.
+	Issuances(ctx context.Context, from, to time.Time) ([]Issuance, error)
+}
+
+// IdempotentIssuanceStore is an IssuanceStore which can also find
+// issuances by the idempotency key with which they were requested, so that
+// a retried request returns the card issued for the first rather than
+// issuing another.
+type IdempotentIssuanceStore interface {
+	IssuanceStore
+
+	// IssuanceByIdempotencyKey returns the earliest issuance requested by
+	// the given identity with the given idempotency key, and whether there
+	// is one.
+	IssuanceByIdempotencyKey(ctx context.Context, identity, key string) (Issuance, bool, error)
+
+	// RecordIdempotentIssuance atomically records the issuance of a card
+	// requested with an idempotency key unless an issuance requested by
+	// the same identity with the same key has already been recorded, in
+	// which case it records nothing and returns that issuance and true.
+	// Of concurrent requests with the same key, only one is recorded.
+	RecordIdempotentIssuance(ctx context.Context, i Issuance) (Issuance, bool, error)
+}
+
+// Revocation records the revocation of a card, e.g. one issued in error.
+type Revocation struct {
+	// CardHash is the hex-encoded SHA-256 hash of the card's JWS, as
+	// returned by CardHash.
+	CardHash string
+
+	// RevokedAt is when the card was revoked.
+	RevokedAt time.Time
+
+	// Reason is why the card was revoked, for auditors, or is empty.
+	Reason string
+}
+
+// Revoker records revoked cards, so that verifiers can reject them, e.g.
+// with verifier.VerifyOptions.Revoked.
+type Revoker interface {
+	// Revoke records the revocation of a card. Revoking a card which is
+	// already revoked has no effect.
+	Revoke(ctx context.Context, r Revocation) error
+
+	// Revoked reports whether the card with the given hash, as returned
+	// by CardHash, has been revoked.
+	Revoked(ctx context.Context, cardHash string) (bool, error)
+}
+
+// CardHash returns the hex-encoded SHA-256 hash of the given JWS.
+func CardHash(healthCardJWS string) string {
+	hash := sha256.Sum256([]byte(healthCardJWS))
+	return hex.EncodeToString(hash[:])
+}
+
+// Memory is an IdempotentIssuanceStore and Revoker which keeps issuances
+// and revocations in memory. It is safe for concurrent use. The zero value is an empty store.
+type Memory struct {
+	mu          sync.Mutex
+	issuances   []Issuance
+	revocations map[string]Revocation
+}
+
+// RecordIssuance records the issuance of a card. Recording the issuance of
+// a card which has already been recorded has no effect.
+func (m *Memory) RecordIssuance(ctx context.Context, i Issuance) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, recorded := range m.issuances {
+		if recorded.CardHash == i.CardHash {
+			return nil
+		}
+	}
+	m.issuances = append(m.issuances, i)
+	return nil
+}
+
+// Issuances returns the issuances recorded at or after from and before to,
+// in the order they were issued.
+func (m *Memory) Issuances(ctx context.Context, from, to time.Time) ([]Issuance, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var issuances []Issuance
+	for _, i := range m.issuances {
+		if !i.IssuedAt.Before(from) && i.IssuedAt.Before(to) {
+			issuances = append(issuances, i)
+		}
+	}
+	return issuances, nil
+}
+
+// IssuanceByIdempotencyKey returns the earliest issuance requested by the
+// given identity with the given idempotency key, and whether there is one.
+func (m *Memory) IssuanceByIdempotencyKey(ctx context.Context, identity, key string) (Issuance, bool, error) {
+	if key == "" {
+		return Issuance{}, false, nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, i := range m.issuances {
+		if i.IdempotencyKey == key && i.Identity == identity {
+			return i, true, nil
+		}
+	}
+	return Issuance{}, false, nil
+}
+
+// RecordIdempotentIssuance atomically records the issuance of a card
+// requested with an idempotency key unless an issuance requested by the
+// same identity with the same key has already been recorded, in which case
+// it records nothing and returns that issuance and true.
+func (m *Memory) RecordIdempotentIssuance(ctx context.Context, i Issuance) (Issuance, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, recorded := range m.issuances {
+		if i.IdempotencyKey != "" && recorded.IdempotencyKey == i.IdempotencyKey && recorded.Identity == i.Identity {
+			return recorded, true, nil
+		}
+	}
+	for _, recorded := range m.issuances {
+		if recorded.CardHash == i.CardHash {
+			return i, false, nil
+		}
+	}
+	m.issuances = append(m.issuances, i)
+	return i, false, nil
+}
+
+// Revoke records the revocation of a card.
+func (m *Memory) Revoke(ctx context.Context, r Revocation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.revocations[r.CardHash]; ok {
+		return nil
+	}
+	if m.revocations == nil {
+		m.revocations = map[string]Revocation{}
+	}
+	m.revocations[r.CardHash] = r
+	return nil
+}
+
+// Revoked reports whether the card with the given hash has been revoked.
+func (m *Memory) Revoked(ctx context.Context, cardHash string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.revocations[cardHash]
+	return ok, nil
+}
@@ -0,0 +1,63 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryRecordIssuanceTwice(t *testing.T) {
+	ctx := context.Background()
+	issuedAt := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	i := Issuance{CardHash: CardHash("a.b.c"), Issuer: "https://example.com", IssuedAt: issuedAt}
+
+	var m Memory
+	for n := 0; n < 2; n++ {
+		if err := m.RecordIssuance(ctx, i); err != nil {
+			t.Fatalf("RecordIssuance #%d: %v", n+1, err)
+		}
+	}
+
+	issuances, err := m.Issuances(ctx, issuedAt, issuedAt.Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issuances) != 1 {
+		t.Errorf("recorded %d issuances, want 1", len(issuances))
+	}
+}
+
+func TestMemoryRecordIdempotentIssuance(t *testing.T) {
+	ctx := context.Background()
+	issuedAt := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	first := Issuance{CardHash: CardHash("a.b.c"), IssuedAt: issuedAt, Identity: "alice", IdempotencyKey: "key"}
+
+	tests := []struct {
+		name      string
+		issuance  Issuance
+		wantFound bool
+	}{
+		{"same key", Issuance{CardHash: CardHash("d.e.f"), IssuedAt: issuedAt.Add(time.Second), Identity: "alice", IdempotencyKey: "key"}, true},
+		{"other key", Issuance{CardHash: CardHash("g.h.i"), IssuedAt: issuedAt, Identity: "alice", IdempotencyKey: "other"}, false},
+		{"other identity", Issuance{CardHash: CardHash("j.k.l"), IssuedAt: issuedAt, Identity: "bob", IdempotencyKey: "key"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m Memory
+			if _, found, err := m.RecordIdempotentIssuance(ctx, first); err != nil || found {
+				t.Fatalf("RecordIdempotentIssuance(first) = %v, %v", found, err)
+			}
+
+			got, found, err := m.RecordIdempotentIssuance(ctx, tt.issuance)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if found != tt.wantFound {
+				t.Errorf("found = %v, want %v", found, tt.wantFound)
+			}
+			if found && got != first {
+				t.Errorf("RecordIdempotentIssuance = %+v, want %+v", got, first)
+			}
+		})
+	}
+}
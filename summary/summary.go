@@ -0,0 +1,102 @@
+// Package summary renders the contents of a SMART Health Card as
+// human-readable text or HTML, e.g. "Dose 1: Moderna, 2021-04-01,
+// Walgreens #123, Lot 012A", for display alongside its QR codes in web
+// pages, PDFs, emails, and the command line.
+package summary
+
+import (
+	"fmt"
+	"html/template"
+	"strings"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/fhirbundle"
+)
+
+// Summary is the human-readable contents of a card.
+type Summary struct {
+	// Name is the patient's given and family names, joined by spaces.
+	Name string
+
+	// BirthDate is the patient's date of birth, as YYYY-MM-DD, or empty if
+	// it is unknown.
+	BirthDate string
+
+	// Doses describe each immunization, as by Dose.
+	Doses []string
+}
+
+// Of summarizes the given FHIR bundle, e.g. one decoded by the verifier
+// package.
+func Of(fb fhirbundle.FHIRBundle) Summary {
+	s := Summary{Name: Name(fb.Patient.Name)}
+	if !fb.Patient.BirthDate.IsZero() {
+		s.BirthDate = fb.Patient.BirthDate.Format("2006-01-02")
+	}
+	for i, immunization := range fb.Immunizations {
+		s.Doses = append(s.Doses, Dose(i, immunization))
+	}
+	return s
+}
+
+// Name returns the given and family names, joined by spaces.
+func Name(n fhirbundle.Name) string {
+	return strings.TrimSpace(strings.Join(append(append([]string{}, n.Givens...), n.Family), " "))
+}
+
+// Dose describes the i-th immunization, counting from 0, by its dose
+// number, the display name of its vaccine, and its date, performer, and lot
+// number, omitting any which are empty, e.g. "Dose 1: Moderna, 2021-04-01,
+// Walgreens #123, Lot 012A".
+func Dose(i int, immunization fhirbundle.Immunization) string {
+	vaccine := immunization.VaccineType.DisplayName()
+	if vaccine == "" {
+		vaccine = "Unknown vaccine"
+	}
+
+	parts := []string{vaccine}
+	if !immunization.DatePerformed.IsZero() {
+		parts = append(parts, immunization.DatePerformed.Format("2006-01-02"))
+	}
+	if immunization.Performer != "" {
+		parts = append(parts, immunization.Performer)
+	}
+	if immunization.LotNumber != "" {
+		parts = append(parts, "Lot "+immunization.LotNumber)
+	}
+	return fmt.Sprintf("Dose %d: %s", i+1, strings.Join(parts, ", "))
+}
+
+// String returns the summary as lines of plain text: the patient's name,
+// date of birth, and each dose.
+func (s Summary) String() string {
+	var b strings.Builder
+	b.WriteString(s.Name + "\n")
+	if s.BirthDate != "" {
+		b.WriteString("Date of birth: " + s.BirthDate + "\n")
+	}
+	for _, dose := range s.Doses {
+		b.WriteString(dose + "\n")
+	}
+	return b.String()
+}
+
+var htmlTemplate = template.Must(template.New("summary").Parse(`<div class="shc-summary">
+<h2>{{.Name}}</h2>
+{{- with .BirthDate}}
+<p>Date of birth: {{.}}</p>
+{{- end}}
+<ul>
+{{- range .Doses}}
+<li>{{.}}</li>
+{{- end}}
+</ul>
+</div>`))
+
+// HTML returns the summary as an HTML fragment, with its text escaped.
+func (s Summary) HTML() template.HTML {
+	var b strings.Builder
+	if err := htmlTemplate.Execute(&b, s); err != nil {
+		return ""
+	}
+	return template.HTML(b.String())
+}
@@ -0,0 +1,44 @@
+package verifier_test
+
+import (
+	"testing"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/conformance"
+	"github.com/amitkgupta/go-smarthealthcards/v2/fuzz"
+)
+
+// FuzzJWS runs fuzz.JWS on JWSs, seeded with those of the golden examples.
+func FuzzJWS(f *testing.F) {
+	examples, err := conformance.Golden()
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, ex := range examples {
+		f.Add([]byte(ex.JWS))
+	}
+	f.Add([]byte("a.b.c"))
+	f.Add([]byte(""))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fuzz.JWS(data)
+	})
+}
+
+// FuzzFile runs fuzz.File on .smart-health-card files, seeded with those of
+// the golden examples.
+func FuzzFile(f *testing.F) {
+	examples, err := conformance.Golden()
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, ex := range examples {
+		if ex.File != nil {
+			f.Add(ex.File)
+		}
+	}
+	f.Add([]byte(`{"verifiableCredential":[]}`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fuzz.File(data)
+	})
+}
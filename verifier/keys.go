@@ -0,0 +1,192 @@
+package verifier
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/jws"
+)
+
+// KeySource finds the public key with which an issuer signed a card.
+type KeySource interface {
+	// Key returns the public key of the given issuer with the given
+	// "kid", or ErrUnknownKey if there is none.
+	Key(ctx context.Context, issuer, kid string) (*ecdsa.PublicKey, error)
+}
+
+// KeySourceFunc adapts a function to a KeySource.
+type KeySourceFunc func(ctx context.Context, issuer, kid string) (*ecdsa.PublicKey, error)
+
+// Key calls f(ctx, issuer, kid).
+func (f KeySourceFunc) Key(ctx context.Context, issuer, kid string) (*ecdsa.PublicKey, error) {
+	return f(ctx, issuer, kid)
+}
+
+// JWKS is a KeySource holding the keys of a JSON Web Key Set, by "kid". It
+// ignores the issuer, so should only hold keys of trusted issuers.
+type JWKS map[string]*ecdsa.PublicKey
+
+// ChainKeySource is a KeySource which also finds the "x5c" certificate
+// chain published with each key, if any, for VerifyOptions.TrustedRoots.
+type ChainKeySource interface {
+	KeySource
+
+	// KeyWithChain is like Key, but also returns the key's certificate
+	// chain, which is nil if none is published.
+	KeyWithChain(ctx context.Context, issuer, kid string) (*ecdsa.PublicKey, []string, error)
+}
+
+// ParseJWKS parses the ECDSA P-256 keys of a JSON Web Key Set, such as one
+// written by jws.JWKSJSON; other keys are ignored.
+func ParseJWKS(data []byte) (JWKS, error) {
+	keys, _, err := parseJWKS(data)
+	return keys, err
+}
+
+// PublicKeys returns a JWKS holding the given public keys by their "kid",
+// for verifiers configured with an issuer's public keys rather than
+// fetching its JWKS.
+func PublicKeys(keys ...*ecdsa.PublicKey) (JWKS, error) {
+	data, err := jws.PublicJWKSJSON(keys...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(data)
+}
+
+// parseJWKS is like ParseJWKS, but also returns the "x5c" certificate
+// chains of the keys which have them, by kid.
+func parseJWKS(data []byte) (JWKS, map[string][]string, error) {
+	var set struct {
+		Keys []struct {
+			KeyType string   `json:"kty"`
+			KeyID   string   `json:"kid"`
+			Curve   string   `json:"crv"`
+			X       string   `json:"x"`
+			Y       string   `json:"y"`
+			X5C     []string `json:"x5c"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, nil, err
+	}
+
+	keys := JWKS{}
+	chains := map[string][]string{}
+	for _, k := range set.Keys {
+		if k.KeyType != "EC" || k.Curve != "P-256" {
+			continue
+		}
+
+		x, errX := base64.RawURLEncoding.DecodeString(k.X)
+		y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+		if errX != nil || errY != nil || len(x) != 32 || len(y) != 32 {
+			return nil, nil, fmt.Errorf("key %q: invalid coordinates", k.KeyID)
+		}
+		if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return nil, nil, fmt.Errorf("key %q: %w", k.KeyID, err)
+		}
+
+		keys[k.KeyID] = &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if len(k.X5C) > 0 {
+			chains[k.KeyID] = k.X5C
+		}
+	}
+
+	return keys, chains, nil
+}
+
+// Key returns the key with the given kid.
+func (j JWKS) Key(_ context.Context, _, kid string) (*ecdsa.PublicKey, error) {
+	key, ok := j[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+// maxJWKSBytes limits the size of a JWKS fetched by IssuerJWKS.
+const maxJWKSBytes = 1 << 20
+
+// IssuerJWKS is a KeySource which fetches each issuer's JWKS from
+// /.well-known/jwks.json under its issuer URL. See
+// https://spec.smarthealth.cards/#determining-keys-associated-with-an-issuer.
+type IssuerJWKS struct {
+	// HTTPClient is used to make requests; it defaults to
+	// http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// Key fetches the issuer's JWKS and returns the key with the given kid.
+func (i IssuerJWKS) Key(ctx context.Context, issuer, kid string) (*ecdsa.PublicKey, error) {
+	key, _, err := i.KeyWithChain(ctx, issuer, kid)
+	return key, err
+}
+
+// KeyWithChain is like Key, but also returns the key's certificate chain,
+// making IssuerJWKS a ChainKeySource.
+func (i IssuerJWKS) KeyWithChain(ctx context.Context, issuer, kid string) (*ecdsa.PublicKey, []string, error) {
+	data, u, err := fetchJWKS(ctx, i.HTTPClient, issuer)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keys, chains, err := parseJWKS(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("GET %s: %w", u, err)
+	}
+	key, err := keys.Key(ctx, issuer, kid)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, chains[kid], nil
+}
+
+// fetchJWKS fetches the JWKS of the given issuer with the given client, or
+// http.DefaultClient if it is nil, returning it along with the URL it was
+// fetched from.
+func fetchJWKS(ctx context.Context, httpClient *http.Client, issuer string) ([]byte, string, error) {
+	if !strings.HasPrefix(issuer, "https://") {
+		return nil, "", fmt.Errorf("issuer %q is not an https URL", issuer)
+	}
+
+	u := strings.TrimSuffix(issuer, "/") + "/.well-known/jwks.json"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("GET %s: unexpected status %s", u, resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxJWKSBytes))
+	if err != nil {
+		return nil, "", err
+	}
+	return data, u, nil
+}
@@ -0,0 +1,141 @@
+package verifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IssuerMetadataPath is the path, under an issuer URL, at which the issuer
+// publishes its IssuerMetadata, alongside its JWKS at
+// /.well-known/jwks.json.
+const IssuerMetadataPath = "/.well-known/smart-health-card-issuer.json"
+
+// IssuerMetadata describes an issuer for display, e.g. by wallet apps
+// showing who issued a card rather than its bare issuer URL.
+type IssuerMetadata struct {
+	// Issuer is the issuer URL, the "iss" of its cards.
+	Issuer string `json:"iss"`
+
+	// Name is the issuer's human-readable name, e.g. "Example Clinic".
+	Name string `json:"name"`
+
+	// Website is the URL of the issuer's website, if any.
+	Website string `json:"website,omitempty"`
+
+	// LogoURL is the URL of the issuer's logo, if any.
+	LogoURL string `json:"logo_uri,omitempty"`
+
+	// Contact is how to contact the issuer, e.g. an email address or phone
+	// number, if given.
+	Contact string `json:"contact,omitempty"`
+}
+
+// maxIssuerMetadataBytes limits the size of the metadata fetched by
+// FetchIssuerMetadata.
+const maxIssuerMetadataBytes = 64 << 10
+
+// FetchIssuerMetadata fetches the metadata of the given issuer from
+// IssuerMetadataPath under its issuer URL, with the given client, or
+// http.DefaultClient if it is nil. The metadata must name the issuer it was
+// fetched from.
+func FetchIssuerMetadata(ctx context.Context, httpClient *http.Client, issuer string) (IssuerMetadata, error) {
+	if !strings.HasPrefix(issuer, "https://") {
+		return IssuerMetadata{}, fmt.Errorf("issuer %q is not an https URL", issuer)
+	}
+
+	u := strings.TrimSuffix(issuer, "/") + IssuerMetadataPath
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return IssuerMetadata{}, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return IssuerMetadata{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return IssuerMetadata{}, fmt.Errorf("GET %s: unexpected status %s", u, resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxIssuerMetadataBytes))
+	if err != nil {
+		return IssuerMetadata{}, err
+	}
+
+	var m IssuerMetadata
+	if err := json.Unmarshal(data, &m); err != nil {
+		return IssuerMetadata{}, fmt.Errorf("GET %s: %w", u, err)
+	}
+	if m.Issuer != issuer {
+		return IssuerMetadata{}, fmt.Errorf("GET %s: metadata is for issuer %q", u, m.Issuer)
+	}
+	return m, nil
+}
+
+// DefaultIssuerMetadataTTL is how long an IssuerMetadataCache keeps
+// metadata unless its TTL is set.
+const DefaultIssuerMetadataTTL = 24 * time.Hour
+
+// IssuerMetadataCache fetches issuers' metadata as FetchIssuerMetadata
+// does, keeping it for a while so that displaying many cards from the same
+// issuer fetches its metadata once. It is safe for concurrent use; the zero
+// value is ready to use.
+type IssuerMetadataCache struct {
+	// HTTPClient is used to make requests; it defaults to
+	// http.DefaultClient.
+	HTTPClient *http.Client
+
+	// TTL is how long metadata is kept; it defaults to
+	// DefaultIssuerMetadataTTL.
+	TTL time.Duration
+
+	mu      sync.Mutex
+	entries map[string]issuerMetadataEntry
+}
+
+type issuerMetadataEntry struct {
+	metadata IssuerMetadata
+	expires  time.Time
+}
+
+// Get returns the metadata of the given issuer, fetching it if it is not
+// cached or has expired. Failures to fetch it are not cached.
+func (c *IssuerMetadataCache) Get(ctx context.Context, issuer string) (IssuerMetadata, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[issuer]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.metadata, nil
+	}
+
+	m, err := FetchIssuerMetadata(ctx, c.HTTPClient, issuer)
+	if err != nil {
+		return IssuerMetadata{}, err
+	}
+
+	ttl := c.TTL
+	if ttl <= 0 {
+		ttl = DefaultIssuerMetadataTTL
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]issuerMetadataEntry)
+	}
+	c.entries[issuer] = issuerMetadataEntry{metadata: m, expires: time.Now().Add(ttl)}
+	return m, nil
+}
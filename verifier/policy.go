@@ -0,0 +1,150 @@
+package verifier
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/jws"
+)
+
+// ErrRejected is wrapped by the errors with which VerifyWithOptions rejects
+// cards which are validly signed, or not checked, but do not satisfy the
+// given VerifyOptions.
+var ErrRejected = errors.New("card rejected by verification policy")
+
+// Errors with which VerifyWithOptions rejects cards, each wrapping
+// ErrRejected.
+var (
+	ErrUntrustedIssuer = fmt.Errorf("%w: issuer is not trusted", ErrRejected)
+	ErrNotYetValid     = fmt.Errorf("%w: card is not yet valid", ErrRejected)
+	ErrExpired         = fmt.Errorf("%w: card has expired", ErrRejected)
+	ErrTooOld          = fmt.Errorf("%w: card was issued too long ago", ErrRejected)
+	ErrMissingType     = fmt.Errorf("%w: card lacks a required type", ErrRejected)
+	ErrRevoked         = fmt.Errorf("%w: card has been revoked", ErrRejected)
+	ErrUntrustedChain  = fmt.Errorf("%w: key's certificate chain is not trusted", ErrRejected)
+)
+
+// VerifyOptions is the policy with which VerifyWithOptions decides whether
+// to accept a card, so that verifier deployments can configure it in one
+// place. The zero value accepts any validly signed card which is neither
+// issued in the future nor expired.
+type VerifyOptions struct {
+	// Issuers, if not empty, are the issuer URLs, i.e. "iss" values, of the
+	// only cards accepted. Cards from other issuers are rejected with
+	// ErrUntrustedIssuer before their issuer's keys are looked up.
+	Issuers []string
+
+	// ClockSkew is how far in the future a card's "nbf" value and how far
+	// in the past its "exp" value may be before it is rejected with
+	// ErrNotYetValid or ErrExpired, to allow for issuers' and verifiers'
+	// clocks disagreeing.
+	ClockSkew time.Duration
+
+	// MaxAge, if positive, is how long ago a card may have been issued,
+	// according to its "nbf" value, before it is rejected with ErrTooOld.
+	MaxAge time.Duration
+
+	// RequiredTypes are the verifiable credential types, e.g.
+	// "https://smarthealth.cards#immunization", which a card must all have
+	// to be accepted; cards lacking any are rejected with ErrMissingType.
+	RequiredTypes []string
+
+	// Revoked, if given, reports whether a validly signed card has been
+	// revoked, e.g. by looking up its issuer's revocation list, in which
+	// case it is rejected with ErrRevoked.
+	Revoked func(ctx context.Context, card Card) (bool, error)
+
+	// TrustedRoots, if not nil, are the root certificates of the trust
+	// framework in which issuers' keys are certified. Cards signed with a
+	// key published with an "x5c" certificate chain, as found by a
+	// ChainKeySource such as IssuerJWKS, are rejected with
+	// ErrUntrustedChain unless the chain verifies to one of them, as by
+	// jws.VerifyChain; the verified chain is returned as the card's
+	// Certificates. Keys published without a chain are not checked.
+	TrustedRoots *x509.CertPool
+
+	// Now returns the current time; it defaults to time.Now.
+	Now func() time.Time
+}
+
+// VerifyWithOptions is like Verify, but also rejects cards which do not
+// satisfy the given options, returning their contents along with an error
+// wrapping ErrRejected.
+func VerifyWithOptions(ctx context.Context, healthCardJWS string, keys KeySource, opts VerifyOptions) (Card, error) {
+	return verify(ctx, healthCardJWS, keys, &opts)
+}
+
+// checkIssuer checks the card's issuer against the Issuers option.
+func (o VerifyOptions) checkIssuer(card Card) error {
+	if len(o.Issuers) == 0 {
+		return nil
+	}
+	for _, issuer := range o.Issuers {
+		if card.Issuer == issuer {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q", ErrUntrustedIssuer, card.Issuer)
+}
+
+// checkChain checks the certificate chain of the key which validly signed
+// the card against the TrustedRoots option, returning the verified chain.
+func (o VerifyOptions) checkChain(card Card, key *ecdsa.PublicKey, x5c []string) ([]*x509.Certificate, error) {
+	chain, err := jws.VerifyChain(x5c, key, card.Issuer, o.TrustedRoots, o.now())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUntrustedChain, err)
+	}
+	return chain, nil
+}
+
+// now returns the current time, as given by the Now option.
+func (o VerifyOptions) now() time.Time {
+	if o.Now != nil {
+		return o.Now()
+	}
+	return time.Now()
+}
+
+// check checks a validly signed card against the options other than
+// Issuers and TrustedRoots.
+func (o VerifyOptions) check(ctx context.Context, card Card) error {
+	now := o.now()
+
+	if card.NotBefore.After(now.Add(o.ClockSkew)) {
+		return fmt.Errorf("%w until %s", ErrNotYetValid, card.NotBefore.UTC().Format(time.RFC3339))
+	}
+	if !card.Expires.IsZero() && !now.Before(card.Expires.Add(o.ClockSkew)) {
+		return fmt.Errorf("%w at %s", ErrExpired, card.Expires.UTC().Format(time.RFC3339))
+	}
+	if o.MaxAge > 0 && now.Sub(card.NotBefore) > o.MaxAge {
+		return fmt.Errorf("%w (%s)", ErrTooOld, card.NotBefore.UTC().Format(time.RFC3339))
+	}
+
+	for _, required := range o.RequiredTypes {
+		found := false
+		for _, t := range card.Types {
+			if t == required {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%w: %q", ErrMissingType, required)
+		}
+	}
+
+	if o.Revoked != nil {
+		revoked, err := o.Revoked(ctx, card)
+		if err != nil {
+			return fmt.Errorf("checking revocation: %w", err)
+		}
+		if revoked {
+			return ErrRevoked
+		}
+	}
+	return nil
+}
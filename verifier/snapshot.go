@@ -0,0 +1,132 @@
+package verifier
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/jws"
+)
+
+// ErrInvalidSnapshot is returned by LoadSnapshot when the snapshot is not
+// well-formed or its signature does not verify.
+var ErrInvalidSnapshot = errors.New("invalid JWKS snapshot")
+
+// Snapshot holds the JWKS of one or more issuers as fetched at a given
+// time, so that cards can be verified without network access, e.g. by
+// door-check devices at venues with no connectivity. Snapshots are fetched
+// with FetchSnapshot, signed with Sign into a file which is copied to the
+// devices, and loaded there with LoadSnapshot.
+type Snapshot struct {
+	Issuers []SnapshotIssuer `json:"issuers"`
+}
+
+// SnapshotIssuer is the JWKS of a single issuer in a Snapshot.
+type SnapshotIssuer struct {
+	// Issuer is the issuer URL.
+	Issuer string `json:"iss"`
+
+	// FetchedAt is when the JWKS was fetched.
+	FetchedAt time.Time `json:"fetchedAt"`
+
+	// JWKS is the issuer's JSON Web Key Set as fetched.
+	JWKS json.RawMessage `json:"jwks"`
+}
+
+// FetchSnapshot fetches the JWKS of each of the given issuers, as
+// IssuerJWKS does, with the given client, or http.DefaultClient if it is
+// nil.
+func FetchSnapshot(ctx context.Context, httpClient *http.Client, issuers ...string) (Snapshot, error) {
+	var s Snapshot
+	for _, issuer := range issuers {
+		data, u, err := fetchJWKS(ctx, httpClient, issuer)
+		if err != nil {
+			return Snapshot{}, err
+		}
+		if _, err := ParseJWKS(data); err != nil {
+			return Snapshot{}, fmt.Errorf("GET %s: %w", u, err)
+		}
+		s.Issuers = append(s.Issuers, SnapshotIssuer{
+			Issuer:    issuer,
+			FetchedAt: time.Now().UTC().Truncate(time.Second),
+			JWKS:      data,
+		})
+	}
+	return s, nil
+}
+
+// Sign returns the snapshot signed with the given key, as a compact JWS
+// which LoadSnapshot verifies, so that devices only trust snapshots from
+// whoever manages them.
+func (s Snapshot) Sign(key *ecdsa.PrivateKey) ([]byte, error) {
+	payload, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	signed, err := jws.SignAndSerialize(payload, key)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(signed + "\n"), nil
+}
+
+// LoadSnapshot verifies the signature of a snapshot written by Sign with
+// the key, from the given KeySource, with the snapshot's kid, and returns
+// the snapshot. The KeySource is asked for the key with an empty issuer.
+func LoadSnapshot(ctx context.Context, data []byte, keys KeySource) (Snapshot, error) {
+	compact := strings.TrimSpace(string(data))
+	h, payload, signature, err := jws.Parse(compact)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	if h.Algorithm != "ES256" || len(signature) != 64 {
+		return Snapshot{}, fmt.Errorf("%w: unsupported signature", ErrInvalidSnapshot)
+	}
+
+	key, err := keys.Key(ctx, "", h.KeyID)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("%w: %w", ErrInvalidSnapshot, err)
+	}
+	if !validSignature(key, compact[:strings.LastIndexByte(compact, '.')], signature) {
+		return Snapshot{}, fmt.Errorf("%w: %v", ErrInvalidSnapshot, ErrInvalidSignature)
+	}
+
+	var s Snapshot
+	if err := json.Unmarshal(payload, &s); err != nil {
+		return Snapshot{}, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	return s, nil
+}
+
+// Keys returns a KeySource holding the keys of the snapshot's issuers,
+// which, unlike JWKS, only returns each key for cards from the issuer whose
+// JWKS holds it.
+func (s Snapshot) Keys() (SnapshotKeys, error) {
+	keys := SnapshotKeys{}
+	for _, i := range s.Issuers {
+		jwks, err := ParseJWKS(i.JWKS)
+		if err != nil {
+			return nil, fmt.Errorf("%w: issuer %q: %v", ErrInvalidSnapshot, i.Issuer, err)
+		}
+		keys[i.Issuer] = jwks
+	}
+	return keys, nil
+}
+
+// SnapshotKeys is a KeySource holding the keys of a Snapshot, by issuer.
+type SnapshotKeys map[string]JWKS
+
+// Key returns the key of the given issuer with the given kid, or
+// ErrUnknownKey if the snapshot holds no such key.
+func (s SnapshotKeys) Key(ctx context.Context, issuer, kid string) (*ecdsa.PublicKey, error) {
+	jwks, ok := s[issuer]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return jwks.Key(ctx, issuer, kid)
+}
@@ -0,0 +1,310 @@
+// Package verifier verifies SMART Health Cards: it checks the signature of a
+// card's JWS against its issuer's public keys, and decodes the FHIR bundle
+// it holds. See
+// https://spec.smarthealth.cards/#health-cards-are-encoded-as-compact-serialization-json-web-signatures-jws
+// and
+// https://spec.smarthealth.cards/#determining-keys-associated-with-an-issuer.
+package verifier
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/fhirbundle"
+)
+
+// ErrMalformed is returned when a JWS is not a well-formed SMART Health
+// Card.
+var ErrMalformed = errors.New("malformed health card")
+
+// ErrUnknownKey is returned by a KeySource which has no key with the "kid"
+// of a card.
+var ErrUnknownKey = errors.New("no key found for the card's kid")
+
+// ErrInvalidSignature is returned when the signature of a card does not
+// verify with its issuer's key.
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// Card is the verified contents of a SMART Health Card.
+type Card struct {
+	// Issuer is the issuer URL, the "iss" value of the card.
+	Issuer string
+
+	// KeyID is the "kid" of the key which signed the card.
+	KeyID string
+
+	// NotBefore is when the card was issued, its "nbf" value.
+	NotBefore time.Time
+
+	// Expires is when the card expires, its "exp" value, or the zero time
+	// if it does not expire.
+	Expires time.Time
+
+	// Types are the types of the card's verifiable credential, e.g.
+	// "https://smarthealth.cards#immunization".
+	Types []string
+
+	// FHIRBundle is the core relevant data of the card's FHIR bundle. The
+	// VaccineType of immunizations with a CVX code not supported by the
+	// fhirbundle package is empty.
+	FHIRBundle fhirbundle.FHIRBundle
+
+	// Bundle is the card's FHIR bundle in JSON form.
+	Bundle json.RawMessage
+
+	// Certificates is the verified certificate chain of the key which
+	// signed the card, from the key's certificate to the root's, if it
+	// was checked against VerifyOptions.TrustedRoots.
+	Certificates []*x509.Certificate
+}
+
+// Verify verifies the signature of the given JWS with the key of its issuer
+// from the given KeySource, and returns the contents of the card.
+//
+// If the JWS is well-formed but its signature cannot be verified, e.g. with
+// ErrUnknownKey or ErrInvalidSignature, the contents of the card are still
+// returned along with the error, for display to the user; they must not be
+// trusted.
+func Verify(ctx context.Context, healthCardJWS string, keys KeySource) (Card, error) {
+	return verify(ctx, healthCardJWS, keys, nil)
+}
+
+func verify(ctx context.Context, healthCardJWS string, keys KeySource, opts *VerifyOptions) (Card, error) {
+	parts := strings.Split(strings.TrimSpace(healthCardJWS), ".")
+	if len(parts) != 3 {
+		return Card{}, fmt.Errorf("%w: not a compact JWS", ErrMalformed)
+	}
+
+	var h struct {
+		Algorithm string `json:"alg"`
+		Zip       string `json:"zip"`
+		KeyID     string `json:"kid"`
+	}
+	if err := decodeJSON(parts[0], &h); err != nil {
+		return Card{}, fmt.Errorf("%w: invalid header: %v", ErrMalformed, err)
+	}
+	if h.Algorithm != "ES256" {
+		return Card{}, fmt.Errorf("%w: unsupported algorithm %q", ErrMalformed, h.Algorithm)
+	}
+
+	compressed, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return Card{}, fmt.Errorf("%w: invalid payload: %v", ErrMalformed, err)
+	}
+	payload := compressed
+	switch h.Zip {
+	case "DEF":
+		if payload, err = inflate(compressed); err != nil {
+			return Card{}, fmt.Errorf("%w: invalid compressed payload: %v", ErrMalformed, err)
+		}
+	case "":
+	default:
+		return Card{}, fmt.Errorf("%w: unsupported compression %q", ErrMalformed, h.Zip)
+	}
+
+	var p struct {
+		Issuer                string  `json:"iss"`
+		NotBefore             float64 `json:"nbf"`
+		Expires               float64 `json:"exp"`
+		VerifiableCredentials struct {
+			Type              []string `json:"type"`
+			CredentialSubject struct {
+				Bundle json.RawMessage `json:"fhirBundle"`
+			} `json:"credentialSubject"`
+		} `json:"vc"`
+	}
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return Card{}, fmt.Errorf("%w: invalid payload: %v", ErrMalformed, err)
+	}
+
+	card := Card{
+		Issuer:    p.Issuer,
+		KeyID:     h.KeyID,
+		NotBefore: time.Unix(int64(p.NotBefore), 0),
+		Types:     p.VerifiableCredentials.Type,
+		Bundle:    p.VerifiableCredentials.CredentialSubject.Bundle,
+	}
+	if p.Expires > 0 {
+		card.Expires = time.Unix(int64(p.Expires), 0)
+	}
+	if card.FHIRBundle, err = parseBundle(card.Bundle); err != nil {
+		return Card{}, fmt.Errorf("%w: invalid FHIR bundle: %v", ErrMalformed, err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || len(signature) != 64 {
+		return Card{}, fmt.Errorf("%w: invalid signature encoding", ErrMalformed)
+	}
+
+	if opts != nil {
+		if err := opts.checkIssuer(card); err != nil {
+			return card, err
+		}
+	}
+
+	var key *ecdsa.PublicKey
+	var x5c []string
+	if chainKeys, ok := keys.(ChainKeySource); ok && opts != nil && opts.TrustedRoots != nil {
+		key, x5c, err = chainKeys.KeyWithChain(ctx, card.Issuer, card.KeyID)
+	} else {
+		key, err = keys.Key(ctx, card.Issuer, card.KeyID)
+	}
+	if err != nil {
+		return card, err
+	}
+
+	if !validSignature(key, parts[0]+"."+parts[1], signature) {
+		return card, ErrInvalidSignature
+	}
+
+	if len(x5c) > 0 {
+		if card.Certificates, err = opts.checkChain(card, key, x5c); err != nil {
+			return card, err
+		}
+	}
+
+	if opts != nil {
+		return card, opts.check(ctx, card)
+	}
+	return card, nil
+}
+
+// validSignature reports whether the given 64-byte signature is a valid
+// ES256 signature of the given JWS signing input by the given key.
+func validSignature(key *ecdsa.PublicKey, signingInput string, signature []byte) bool {
+	hash := sha256.Sum256([]byte(signingInput))
+	r := new(big.Int).SetBytes(signature[:32])
+	s := new(big.Int).SetBytes(signature[32:])
+	return ecdsa.Verify(key, hash[:], r, s)
+}
+
+// inflate decompresses a payload which must be a raw DEFLATE stream, as
+// required by https://spec.smarthealth.cards/#health-cards-are-small,
+// without a zlib or gzip wrapper and without trailing data.
+func inflate(compressed []byte) ([]byte, error) {
+	r := bytes.NewReader(compressed)
+	payload, err := io.ReadAll(flate.NewReader(r))
+	switch {
+	case err != nil && wrapped(compressed):
+		return nil, errors.New("not raw DEFLATE; the payload has a zlib or gzip header")
+	case err != nil:
+		return nil, err
+	case r.Len() > 0:
+		return nil, fmt.Errorf("%d bytes of trailing data after the DEFLATE stream", r.Len())
+	}
+	return payload, nil
+}
+
+// wrapped reports whether the given data starts with a zlib or gzip header.
+// See https://datatracker.ietf.org/doc/html/rfc1950#section-2.2 and
+// https://datatracker.ietf.org/doc/html/rfc1952#section-2.3.1.
+func wrapped(data []byte) bool {
+	if len(data) < 2 {
+		return false
+	}
+	gzip := data[0] == 0x1f && data[1] == 0x8b
+	zlib := data[0]&0x0f == 8 && (uint16(data[0])<<8|uint16(data[1]))%31 == 0
+	return gzip || zlib
+}
+
+// ParseFile returns the JWSs held by the given contents of a
+// .smart-health-card file. See
+// https://spec.smarthealth.cards/#via-file-download.
+func ParseFile(data []byte) ([]string, error) {
+	var f struct {
+		VerifiableCredential []string `json:"verifiableCredential"`
+	}
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	if len(f.VerifiableCredential) == 0 {
+		return nil, fmt.Errorf("%w: no verifiable credentials in file", ErrMalformed)
+	}
+	return f.VerifiableCredential, nil
+}
+
+func decodeJSON(s string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// parseBundle extracts the core relevant data of an FHIR bundle in the form
+// written by fhirbundle.FHIRBundle.MarshalJSON.
+func parseBundle(bundle json.RawMessage) (fhirbundle.FHIRBundle, error) {
+	var b struct {
+		Entries []struct {
+			Resource struct {
+				ResourceType string            `json:"resourceType"`
+				Name         []fhirbundle.Name `json:"name"`
+				BirthDate    string            `json:"birthDate"`
+				VaccineCode  struct {
+					Coding []struct {
+						Code string `json:"code"`
+					} `json:"coding"`
+				} `json:"vaccineCode"`
+				OccurrenceDate string `json:"occurrenceDateTime"`
+				Performers     []struct {
+					Actor struct {
+						Display string `json:"display"`
+					} `json:"actor"`
+				} `json:"performer"`
+				LotNumber string `json:"lotNumber"`
+			} `json:"resource"`
+		} `json:"entry"`
+	}
+	if err := json.Unmarshal(bundle, &b); err != nil {
+		return fhirbundle.FHIRBundle{}, err
+	}
+
+	var fb fhirbundle.FHIRBundle
+	for _, entry := range b.Entries {
+		r := entry.Resource
+		switch r.ResourceType {
+		case "Patient":
+			if len(r.Name) > 0 {
+				fb.Patient.Name = r.Name[0]
+			}
+			fb.Patient.BirthDate = parseDate(r.BirthDate)
+		case "Immunization":
+			var immunization fhirbundle.Immunization
+			immunization.DatePerformed = parseDate(r.OccurrenceDate)
+			if len(r.Performers) > 0 {
+				immunization.Performer = r.Performers[0].Actor.Display
+			}
+			immunization.LotNumber = r.LotNumber
+			for _, coding := range r.VaccineCode.Coding {
+				if vt, ok := fhirbundle.VaccineTypeFromCVX(coding.Code); ok {
+					immunization.VaccineType = vt
+				}
+			}
+			fb.Immunizations = append(fb.Immunizations, immunization)
+		}
+	}
+
+	return fb, nil
+}
+
+// parseDate parses an FHIR date or dateTime, ignoring any time of day, and
+// returns the zero time if it is invalid.
+func parseDate(s string) time.Time {
+	if len(s) > len("2006-01-02") {
+		s = s[:len("2006-01-02")]
+	}
+	t, _ := time.Parse("2006-01-02", s)
+	return t
+}
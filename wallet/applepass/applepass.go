@@ -0,0 +1,295 @@
+// Package applepass wraps a SMART Health Card in a signed Apple Wallet pass
+// (.pkpass) containing the card's QR code along with the patient's name,
+// birth date, and immunizations. See
+// https://developer.apple.com/documentation/walletpasses.
+package applepass
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"strings"
+
+	"go.mozilla.org/pkcs7"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/fhirbundle"
+	"github.com/amitkgupta/go-smarthealthcards/v2/qrcode"
+)
+
+// ErrMultipleChunks is returned when the JWS of a SMART Health Card is too
+// large to be encoded as a single QR code. A pass can only display a single
+// barcode, so such cards cannot be wrapped in a pass.
+var ErrMultipleChunks = errors.New("health card requires multiple QR codes and cannot be represented as a single pass barcode")
+
+// Config holds the issuer's pass type identity and signing credentials.
+type Config struct {
+	// PassTypeIdentifier is the pass type identifier registered with Apple,
+	// e.g. pass.com.example.healthcard.
+	PassTypeIdentifier string
+
+	// TeamIdentifier is the Apple Developer team identifier that owns the
+	// pass type identifier.
+	TeamIdentifier string
+
+	// OrganizationName is displayed on the lock screen and in the Wallet
+	// app, e.g. the name of the clinic.
+	OrganizationName string
+
+	// Description is used by accessibility features; it defaults to
+	// "SMART Health Card".
+	Description string
+
+	// Certificate is the pass type certificate issued by Apple, and
+	// PrivateKey is its corresponding private key.
+	Certificate *x509.Certificate
+	PrivateKey  crypto.PrivateKey
+
+	// WWDRCertificate is the Apple Worldwide Developer Relations
+	// intermediate certificate which issued Certificate.
+	WWDRCertificate *x509.Certificate
+
+	// Icon is the PNG icon shown on the lock screen and in notifications.
+	// If nil, a plain placeholder icon is used.
+	Icon []byte
+
+	// ForegroundColor, BackgroundColor, and LabelColor are CSS-style colors,
+	// e.g. "rgb(255, 255, 255)". They are optional.
+	ForegroundColor string
+	BackgroundColor string
+	LabelColor      string
+}
+
+// New returns the bytes of a signed .pkpass archive for the SMART Health Card
+// with the given JWS, whose contents are described by the given FHIR bundle.
+// The serialNumber must uniquely identify the pass among all passes of the
+// same pass type.
+func New(fb fhirbundle.FHIRBundle, healthCardJWS string, serialNumber string, c Config) ([]byte, error) {
+	shcStrings, err := qrcode.EncodeToStrings(healthCardJWS)
+	if err != nil {
+		return nil, err
+	}
+	if len(shcStrings) != 1 {
+		return nil, ErrMultipleChunks
+	}
+
+	passJSON, err := json.Marshal(newPass(fb, shcStrings[0], serialNumber, c))
+	if err != nil {
+		return nil, err
+	}
+
+	icon := c.Icon
+	if icon == nil {
+		if icon, err = placeholderIcon(); err != nil {
+			return nil, err
+		}
+	}
+
+	files := map[string][]byte{
+		"pass.json":   passJSON,
+		"icon.png":    icon,
+		"icon@2x.png": icon,
+	}
+
+	manifest := make(map[string]string, len(files))
+	for name, data := range files {
+		sum := sha1.Sum(data)
+		manifest[name] = hex.EncodeToString(sum[:])
+	}
+
+	manifestJSON, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := sign(manifestJSON, c)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+
+	for _, name := range []string{"pass.json", "icon.png", "icon@2x.png"} {
+		if f, err := zw.Create(name); err != nil {
+			return nil, err
+		} else if _, err = f.Write(files[name]); err != nil {
+			return nil, err
+		}
+	}
+
+	if f, err := zw.Create("manifest.json"); err != nil {
+		return nil, err
+	} else if _, err = f.Write(manifestJSON); err != nil {
+		return nil, err
+	}
+
+	if f, err := zw.Create("signature"); err != nil {
+		return nil, err
+	} else if _, err = f.Write(signature); err != nil {
+		return nil, err
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func sign(manifestJSON []byte, c Config) ([]byte, error) {
+	if c.Certificate == nil || c.PrivateKey == nil || c.WWDRCertificate == nil {
+		return nil, errors.New("pass type certificate, private key, and WWDR certificate are required")
+	}
+
+	sd, err := pkcs7.NewSignedData(manifestJSON)
+	if err != nil {
+		return nil, err
+	}
+	sd.SetDigestAlgorithm(pkcs7.OIDDigestAlgorithmSHA256)
+
+	if err := sd.AddSignerChain(
+		c.Certificate,
+		c.PrivateKey,
+		[]*x509.Certificate{c.WWDRCertificate},
+		pkcs7.SignerInfoConfig{},
+	); err != nil {
+		return nil, err
+	}
+	sd.Detach()
+
+	return sd.Finish()
+}
+
+type pass struct {
+	FormatVersion      int       `json:"formatVersion"`
+	PassTypeIdentifier string    `json:"passTypeIdentifier"`
+	SerialNumber       string    `json:"serialNumber"`
+	TeamIdentifier     string    `json:"teamIdentifier"`
+	OrganizationName   string    `json:"organizationName"`
+	Description        string    `json:"description"`
+	ForegroundColor    string    `json:"foregroundColor,omitempty"`
+	BackgroundColor    string    `json:"backgroundColor,omitempty"`
+	LabelColor         string    `json:"labelColor,omitempty"`
+	Barcodes           []barcode `json:"barcodes"`
+	Generic            structure `json:"generic"`
+}
+
+type barcode struct {
+	Format          string `json:"format"`
+	Message         string `json:"message"`
+	MessageEncoding string `json:"messageEncoding"`
+	AltText         string `json:"altText,omitempty"`
+}
+
+type structure struct {
+	PrimaryFields   []field `json:"primaryFields"`
+	SecondaryFields []field `json:"secondaryFields"`
+	AuxiliaryFields []field `json:"auxiliaryFields,omitempty"`
+	BackFields      []field `json:"backFields,omitempty"`
+}
+
+type field struct {
+	Key   string `json:"key"`
+	Label string `json:"label"`
+	Value string `json:"value"`
+}
+
+func newPass(fb fhirbundle.FHIRBundle, shcString string, serialNumber string, c Config) pass {
+	description := c.Description
+	if description == "" {
+		description = "SMART Health Card"
+	}
+
+	p := pass{
+		FormatVersion:      1,
+		PassTypeIdentifier: c.PassTypeIdentifier,
+		SerialNumber:       serialNumber,
+		TeamIdentifier:     c.TeamIdentifier,
+		OrganizationName:   c.OrganizationName,
+		Description:        description,
+		ForegroundColor:    c.ForegroundColor,
+		BackgroundColor:    c.BackgroundColor,
+		LabelColor:         c.LabelColor,
+		Barcodes: []barcode{
+			{
+				Format:          "PKBarcodeFormatQR",
+				Message:         shcString,
+				MessageEncoding: "iso-8859-1",
+			},
+		},
+		Generic: structure{
+			PrimaryFields: []field{
+				{
+					Key:   "name",
+					Label: "NAME",
+					Value: strings.Join(append(append([]string{}, fb.Patient.Name.Givens...), fb.Patient.Name.Family), " "),
+				},
+			},
+			SecondaryFields: []field{
+				{
+					Key:   "birthDate",
+					Label: "DATE OF BIRTH",
+					Value: fb.Patient.BirthDate.Format("2006-01-02"),
+				},
+			},
+		},
+	}
+
+	if n := len(fb.Immunizations); n > 0 {
+		latest := fb.Immunizations[n-1]
+		p.Generic.SecondaryFields = append(p.Generic.SecondaryFields, field{
+			Key:   "doses",
+			Label: "DOSES",
+			Value: fmt.Sprintf("%d", n),
+		})
+		p.Generic.AuxiliaryFields = []field{
+			{
+				Key:   "latestVaccine",
+				Label: "LATEST VACCINE",
+				Value: string(latest.VaccineType),
+			},
+			{
+				Key:   "latestDate",
+				Label: "LATEST DOSE",
+				Value: latest.DatePerformed.Format("2006-01-02"),
+			},
+		}
+	}
+
+	for i, immunization := range fb.Immunizations {
+		p.Generic.BackFields = append(p.Generic.BackFields, field{
+			Key:   fmt.Sprintf("dose%d", i+1),
+			Label: fmt.Sprintf("DOSE %d", i+1),
+			Value: fmt.Sprintf(
+				"%s, %s, %s, Lot %s",
+				immunization.VaccineType,
+				immunization.DatePerformed.Format("2006-01-02"),
+				immunization.Performer,
+				immunization.LotNumber,
+			),
+		})
+	}
+
+	return p
+}
+
+func placeholderIcon() ([]byte, error) {
+	img := image.NewGray(image.Rect(0, 0, 58, 58))
+	for i := range img.Pix {
+		img.Pix[i] = 0x40
+	}
+
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,104 @@
+package webhandlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/keyring"
+)
+
+// AdminAuthorize sets the Authorizer consulted by the key management
+// handlers, KeysJSON, RotateKey, and RetireKey, which reject every request
+// unless it is given. It should only allow operators, not the staff allowed
+// to issue cards by the Authorize option.
+func AdminAuthorize(a Authorizer) Option {
+	return func(h *Handlers) {
+		h.adminAuthorizer = a
+	}
+}
+
+// KeysJSON writes a JSON document listing the keys of the keyring of
+// Handlers created by NewWithKeyring, with their kids, states, and
+// activation, deactivation, and retirement times.
+//
+// If there is an error, this methods returns the HTTP response code,
+// an additional error message if available, and false. If there is no
+// error, it returns 0, the empty string, and true.
+func (h Handlers) KeysJSON(w http.ResponseWriter, r *http.Request) (int, string, bool) {
+	return h.admin(w, r, func(w http.ResponseWriter, r *http.Request) (int, string, bool) {
+		return writeKeysJSON(w, h.keyring.Keys())
+	})
+}
+
+// RotateKey generates a new key and makes it the active key of the keyring
+// of Handlers created by NewWithKeyring, so that subsequent cards are
+// signed with it. The previously active key remains published. This method
+// writes a JSON document describing the new key.
+//
+// If there is an error, this methods returns the HTTP response code,
+// an additional error message if available, and false. If there is no
+// error, it returns 0, the empty string, and true.
+func (h Handlers) RotateKey(w http.ResponseWriter, r *http.Request) (int, string, bool) {
+	return h.admin(w, r, func(w http.ResponseWriter, r *http.Request) (int, string, bool) {
+		key, err := h.keyring.Rotate()
+		if err != nil {
+			return h.internalError(r, err)
+		}
+		return writeKeysJSON(w, []keyring.Key{key})
+	})
+}
+
+// RetireKey expects the request to provide a "kid" form value identifying
+// an inactive key of the keyring of Handlers created by NewWithKeyring, and
+// stops publishing that key. This method writes a JSON document describing
+// the retired key. Unknown keys result in a 404 response code and the
+// active key in a 409 response code.
+//
+// If there is an error, this methods returns the HTTP response code,
+// an additional error message if available, and false. If there is no
+// error, it returns 0, the empty string, and true.
+func (h Handlers) RetireKey(w http.ResponseWriter, r *http.Request) (int, string, bool) {
+	return h.admin(w, r, func(w http.ResponseWriter, r *http.Request) (int, string, bool) {
+		kid := strings.TrimSpace(r.PostFormValue("kid"))
+		if kid == "" {
+			return http.StatusBadRequest, h.localize(r, ValidationErrors{{Field: "kid", Reason: ReasonMissing}}), false
+		}
+
+		key, err := h.keyring.Retire(kid)
+		switch {
+		case errors.Is(err, keyring.ErrKeyNotFound):
+			return http.StatusNotFound, err.Error(), false
+		case errors.Is(err, keyring.ErrKeyActive):
+			return http.StatusConflict, err.Error(), false
+		case err != nil:
+			return h.internalError(r, err)
+		}
+		return writeKeysJSON(w, []keyring.Key{key})
+	})
+}
+
+// admin calls the given key management handler if the request is allowed
+// by the Authorizer given by the AdminAuthorize option.
+func (h Handlers) admin(w http.ResponseWriter, r *http.Request, handler handlerFunc) (int, string, bool) {
+	r = identify(w, r)
+	if h.adminAuthorizer == nil {
+		return http.StatusForbidden, "key management is not enabled", false
+	}
+	if h.keyring == nil {
+		return http.StatusNotImplemented, "key management requires a keyring", false
+	}
+
+	return h.authorizeWith(h.adminAuthorizer, h.harden(handler))(w, r)
+}
+
+func writeKeysJSON(w http.ResponseWriter, keys []keyring.Key) (int, string, bool) {
+	if keysJSON, err := json.Marshal(map[string][]keyring.Key{"keys": keys}); err != nil {
+		return http.StatusInternalServerError, "", false
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(keysJSON)
+		return 0, "", true
+	}
+}
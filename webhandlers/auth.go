@@ -0,0 +1,234 @@
+package webhandlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ErrUnauthenticated should be returned by an Authorizer when the request
+// does not carry valid credentials.
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+// ErrForbidden should be returned by an Authorizer when the request carries
+// valid credentials which are not allowed to issue cards.
+var ErrForbidden = errors.New("forbidden")
+
+// Identity describes the authorized party on whose behalf a request issues
+// cards, e.g. a member of a clinic's staff.
+type Identity struct {
+	// Subject identifies the authorized party, e.g. a user name or the
+	// name of an API key.
+	Subject string
+
+	// Scopes are the scopes granted to the authorized party, if any.
+	Scopes []string
+}
+
+// Authorizer decides whether a request may issue cards.
+type Authorizer interface {
+	// Authorize returns the identity of the party making the request, or
+	// ErrUnauthenticated or ErrForbidden if the request must be denied.
+	Authorize(r *http.Request) (Identity, error)
+}
+
+// AuthorizerFunc adapts a function to an Authorizer.
+type AuthorizerFunc func(r *http.Request) (Identity, error)
+
+// Authorize calls f(r).
+func (f AuthorizerFunc) Authorize(r *http.Request) (Identity, error) {
+	return f(r)
+}
+
+// Authorize sets an Authorizer consulted before ProcessForm, ProcessCSV,
+// ProcessBundle, and ProcessLookup issue any cards. Requests it denies are
+// rejected with a 401 or 403 response code; the identity of allowed
+// requests is available to the rest of the application from the request's
+// context with IdentityFromContext.
+func Authorize(a Authorizer) Option {
+	return func(h *Handlers) {
+		h.authorizer = a
+	}
+}
+
+type identityKey struct{}
+
+// IdentityFromContext returns the identity of the party authorized to make
+// a request, if the handlers were configured with the Authorize option.
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(Identity)
+	return identity, ok
+}
+
+// authorize wraps the given issuance handler with the Authorizer given by
+// the Authorize option.
+func (h Handlers) authorize(handler handlerFunc) handlerFunc {
+	return h.authorizeWith(h.authorizer, handler)
+}
+
+// authorizeWith wraps the given handler so that it is only called for
+// requests allowed by the given Authorizer, if any.
+func (h Handlers) authorizeWith(a Authorizer, handler handlerFunc) handlerFunc {
+	if a == nil {
+		return handler
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) (int, string, bool) {
+		identity, err := a.Authorize(r)
+		switch {
+		case errors.Is(err, ErrUnauthenticated):
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			return http.StatusUnauthorized, ErrUnauthenticated.Error(), false
+		case errors.Is(err, ErrForbidden):
+			return http.StatusForbidden, ErrForbidden.Error(), false
+		case err != nil:
+			return h.internalError(r, err)
+		}
+
+		return handler(w, r.WithContext(context.WithValue(r.Context(), identityKey{}, identity)))
+	}
+}
+
+// bearerToken returns the token of the request's "Authorization: Bearer"
+// header, if any.
+func bearerToken(r *http.Request) string {
+	const prefix = "bearer "
+	authorization := r.Header.Get("Authorization")
+	if len(authorization) <= len(prefix) || !strings.EqualFold(authorization[:len(prefix)], prefix) {
+		return ""
+	}
+	return strings.TrimSpace(authorization[len(prefix):])
+}
+
+// APIKeys returns an Authorizer which allows requests carrying one of the
+// given API keys, either as a bearer token in the Authorization header or
+// in the X-Api-Key header. The keys map each API key to the subject of the
+// resulting Identity, e.g. the name of the clinic or staff member to whom
+// it was issued.
+func APIKeys(keys map[string]string) Authorizer {
+	return AuthorizerFunc(func(r *http.Request) (Identity, error) {
+		key := r.Header.Get("X-Api-Key")
+		if key == "" {
+			key = bearerToken(r)
+		}
+		if key == "" {
+			return Identity{}, ErrUnauthenticated
+		}
+
+		// Compare against every key so that the time taken does not
+		// reveal which keys share a prefix with the given one.
+		var subject string
+		found := 0
+		for k, s := range keys {
+			if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+				subject = s
+				found = 1
+			}
+		}
+		if found == 0 {
+			return Identity{}, ErrUnauthenticated
+		}
+
+		return Identity{Subject: subject}, nil
+	})
+}
+
+// TokenIntrospection is an Authorizer which allows requests carrying an
+// OAuth 2.0 bearer token which an authorization server reports as active.
+// See https://datatracker.ietf.org/doc/html/rfc7662.
+type TokenIntrospection struct {
+	// URL is the authorization server's introspection endpoint.
+	URL string
+
+	// ClientID and ClientSecret authenticate this resource server to the
+	// introspection endpoint with HTTP Basic authentication.
+	ClientID     string
+	ClientSecret string
+
+	// RequiredScope, if not empty, is a scope which the token must have
+	// been granted, e.g. "shc.issue"; tokens without it are forbidden.
+	RequiredScope string
+
+	// HTTPClient is used to make requests; it defaults to
+	// http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// Authorize introspects the request's bearer token.
+func (t TokenIntrospection) Authorize(r *http.Request) (Identity, error) {
+	token := bearerToken(r)
+	if token == "" {
+		return Identity{}, ErrUnauthenticated
+	}
+
+	req, err := http.NewRequestWithContext(
+		r.Context(),
+		http.MethodPost,
+		t.URL,
+		strings.NewReader(url.Values{"token": {token}, "token_type_hint": {"access_token"}}.Encode()),
+	)
+	if err != nil {
+		return Identity{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if t.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(t.ClientID), url.QueryEscape(t.ClientSecret))
+	}
+
+	httpClient := t.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return Identity{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Identity{}, fmt.Errorf("POST %s: unexpected status %s", t.URL, resp.Status)
+	}
+
+	var introspection struct {
+		Active   bool   `json:"active"`
+		Scope    string `json:"scope"`
+		Subject  string `json:"sub"`
+		Username string `json:"username"`
+		ClientID string `json:"client_id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&introspection); err != nil {
+		return Identity{}, err
+	}
+
+	if !introspection.Active {
+		return Identity{}, ErrUnauthenticated
+	}
+
+	identity := Identity{Subject: introspection.Subject, Scopes: strings.Fields(introspection.Scope)}
+	for _, subject := range []string{introspection.Username, introspection.ClientID} {
+		if identity.Subject == "" {
+			identity.Subject = subject
+		}
+	}
+
+	if t.RequiredScope != "" {
+		granted := false
+		for _, scope := range identity.Scopes {
+			if scope == t.RequiredScope {
+				granted = true
+			}
+		}
+		if !granted {
+			return Identity{}, ErrForbidden
+		}
+	}
+
+	return identity, nil
+}
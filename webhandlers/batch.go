@@ -0,0 +1,445 @@
+package webhandlers
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/fhirbundle"
+	shcissuer "github.com/amitkgupta/go-smarthealthcards/v2/issuer"
+	"github.com/amitkgupta/go-smarthealthcards/v2/qrcode"
+)
+
+// BatchConcurrency sets the number of rows of a CSV batch which ProcessCSV
+// issues at once, signing them and encoding their QR codes in parallel; the
+// default is GOMAXPROCS.
+func BatchConcurrency(n int) Option {
+	return func(h *Handlers) {
+		h.batchConcurrency = n
+	}
+}
+
+// batchRowTimeout is how long ProcessCSV allows for reading each row of a
+// CSV batch and writing its files to the archive.
+const batchRowTimeout = time.Minute
+
+// ProcessCSV expects the request to provide a CSV document, either as the
+// request body or as a "file" in multipart form data, with a header row
+// naming the same fields as those expected by ProcessForm and one row per
+// patient. This method issues a SMART Health Card for each row and writes a
+// ZIP archive containing, for the row numbered N (counting from 1 and
+// excluding the header row), either the PNG(s) of its QR code(s) as
+// row-N/1.png, row-N/2.png, etc. or, if the "output" query or form value is
+// "smart-health-card", a row-N.smart-health-card file. If the OutputSink
+// option is given, those files are instead written to the sink, named by
+// each row's ExternalIDField, and listed in a manifest.csv in the archive.
+// If the "contact_sheet" query or form value is true, the archive also
+// contains a cards.pdf contact sheet laying out every card on a page of its
+// own, as with pdf.ContactSheet, labeled with its row number and external
+// ID, for printing in bulk.
+//
+// The archive also contains an errors.csv report listing the row number,
+// field, reason, and message of every validation error; rows with errors
+// are skipped. Rows are issued concurrently, as set by the BatchConcurrency
+// option, and their cards are streamed into the archive, in row order, as
+// soon as they are issued, so memory use does not grow with the size of the
+// batch, and once the archive has been started, errors with individual rows
+// do not prevent the remaining rows from being processed. Since the archive
+// is streamed for as long as the batch takes, each row is allowed a minute
+// to be read and written, extending any deadline of the whole request, e.g.
+// as set by server.Deadline.
+//
+// If there is an error, this methods returns the HTTP response code,
+// an additional error message if available, and false. If there is no
+// error, it returns 0, the empty string, and true.
+func (h Handlers) ProcessCSV(w http.ResponseWriter, r *http.Request) (int, string, bool) {
+	return h.instrument(w, r, h.processCSV)
+}
+
+func (h Handlers) processCSV(w http.ResponseWriter, r *http.Request) (int, string, bool) {
+	issuer, ok := h.resolve(r)
+	if !ok {
+		return http.StatusNotFound, "unknown issuer", false
+	}
+
+	output := strings.TrimSpace(r.FormValue("output"))
+	if output != "" && output != "png" && output != "smart-health-card" {
+		return http.StatusBadRequest, h.localize(r, ValidationErrors{{Field: "output", Reason: ReasonInvalid}}), false
+	}
+
+	var sheet *contactSheet
+	if value := strings.TrimSpace(r.FormValue("contact_sheet")); value != "" {
+		if ok, err := strconv.ParseBool(value); err != nil {
+			return http.StatusBadRequest, h.localize(r, ValidationErrors{{Field: "contact_sheet", Reason: ReasonInvalid}}), false
+		} else if ok {
+			var err error
+			if sheet, err = newContactSheet(); err != nil {
+				return h.internalError(r, err)
+			}
+			defer sheet.remove()
+		}
+	}
+
+	var body io.Reader = r.Body
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			return http.StatusBadRequest, h.localize(r, ValidationErrors{{Field: "file", Reason: ReasonMissing}}), false
+		}
+		defer f.Close()
+		body = f
+	}
+
+	cr := csv.NewReader(body)
+	cr.FieldsPerRecord = -1
+	columns, err := cr.Read()
+	if tooLarge(err) {
+		return http.StatusRequestEntityTooLarge, "request body too large", false
+	} else if err != nil {
+		return http.StatusBadRequest, "missing or invalid CSV header row", false
+	}
+	for i, column := range columns {
+		columns[i] = strings.TrimSpace(column)
+	}
+
+	catalog := h.catalog(r)
+	report := [][]string{{"row", "field", "reason", "message"}}
+	manifest := [][]string{{"row", ExternalIDField, "file"}}
+
+	w.Header().Set("Content-Type", "application/zip")
+	if h.filename != nil {
+		setAttachment(w, "cards.zip")
+	}
+	zw := zip.NewWriter(w)
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	rows := make(chan chan batchRow, h.concurrency())
+	go h.readBatch(ctx, cr, columns, rows, func(row int, externalID string, fhirBundle fhirbundle.FHIRBundle) batchRow {
+		return h.issueRow(ctx, issuer, output, sheet != nil, row, externalID, fhirBundle)
+	})
+
+	rc := http.NewResponseController(w)
+	for future := range rows {
+		b := <-future
+		deadline := time.Now().Add(batchRowTimeout)
+		rc.SetReadDeadline(deadline)
+		rc.SetWriteDeadline(deadline)
+		if b.status != 0 {
+			return b.status, b.message, false
+		}
+
+		if b.malformed != nil {
+			report = append(report, []string{strconv.Itoa(b.row), "", string(ReasonInvalid), b.malformed.Err.Error()})
+			continue
+		}
+
+		if b.err != nil {
+			if !errors.Is(b.err, ErrCardTooLarge) {
+				return h.internalError(r, b.err)
+			}
+			report = append(report, []string{strconv.Itoa(b.row), "", "too_large", b.err.Error()})
+			continue
+		}
+
+		if b.invalid != nil {
+			h.validationFailed(r, b.invalid)
+
+			var errs ValidationErrors
+			errors.As(b.invalid, &errs)
+			for _, e := range errs {
+				report = append(report, []string{strconv.Itoa(b.row), e.Field, string(e.Reason), catalog.message(e)})
+			}
+			continue
+		}
+
+		if b.uploadErr != nil {
+			if h.onError != nil {
+				h.onError(r, b.uploadErr)
+			}
+			report = append(report, []string{strconv.Itoa(b.row), "", "upload_failed", b.uploadErr.Error()})
+		}
+
+		if h.outputSink != nil {
+			for _, file := range b.files {
+				if b.uploadErr == nil {
+					manifest = append(manifest, []string{strconv.Itoa(b.row), b.externalID, file.name})
+				}
+			}
+		} else {
+			for _, file := range b.files {
+				if f, err := zw.Create(file.name); err != nil {
+					return h.internalError(r, err)
+				} else if _, err = f.Write(file.data); err != nil {
+					return h.internalError(r, err)
+				}
+			}
+		}
+		if sheet != nil {
+			label := fmt.Sprintf("Row %d", b.row)
+			if b.externalID != "" {
+				label += " (" + b.externalID + ")"
+			}
+			if err := sheet.Add(b.fhirBundle, b.qrPNGs, label); err != nil {
+				return h.internalError(r, err)
+			}
+		}
+		h.cardIssued(r, issuer, b.healthCardJWS, b.chunks)
+	}
+	if err := r.Context().Err(); err != nil {
+		return h.internalError(r, err)
+	}
+
+	if h.outputSink != nil {
+		if f, err := zw.Create("manifest.csv"); err != nil {
+			return h.internalError(r, err)
+		} else if err = csv.NewWriter(f).WriteAll(manifest); err != nil {
+			return h.internalError(r, err)
+		}
+	}
+
+	if sheet != nil {
+		if f, err := zw.Create("cards.pdf"); err != nil {
+			return h.internalError(r, err)
+		} else if err = sheet.copyTo(f); err != nil {
+			return h.internalError(r, err)
+		}
+	}
+
+	if f, err := zw.Create("errors.csv"); err != nil {
+		return h.internalError(r, err)
+	} else if err = csv.NewWriter(f).WriteAll(report); err != nil {
+		return h.internalError(r, err)
+	}
+
+	if err := zw.Close(); err != nil {
+		return h.internalError(r, err)
+	}
+
+	return 0, "", true
+}
+
+// concurrency returns the number of rows of a batch issued at once.
+func (h Handlers) concurrency() int {
+	if h.batchConcurrency > 0 {
+		return h.batchConcurrency
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// batchRow is the outcome of processing one row of a CSV batch.
+type batchRow struct {
+	row int
+
+	// status and message, if status is not 0, are the response with which
+	// the whole batch fails, e.g. because the CSV document is too large.
+	status  int
+	message string
+
+	// malformed is the error with which the row failed to parse as CSV.
+	malformed *csv.ParseError
+
+	// invalid is the error, wrapping ValidationErrors, with which the row
+	// failed validation.
+	invalid error
+
+	// err is the error with which issuing the row's card failed.
+	err error
+
+	// uploadErr is the error with which writing the row's files to the
+	// sink set by the OutputSink option failed, after its card was issued.
+	uploadErr error
+
+	externalID    string
+	healthCardJWS string
+	chunks        int
+	files         []batchFile
+
+	// fhirBundle and qrPNGs are the contents and QR code(s) of the row's
+	// card, kept for the contact sheet, if one is requested.
+	fhirBundle fhirbundle.FHIRBundle
+	qrPNGs     [][]byte
+}
+
+// batchFile is a file written to the ZIP archive of a CSV batch, or to the
+// sink set by the OutputSink option.
+type batchFile struct {
+	name        string
+	contentType string
+	data        []byte
+}
+
+// readBatch reads and validates the rows of a CSV batch, and sends a
+// channel for the outcome of each, in row order, to rows, which it closes
+// once all rows have been read or the context is done. If the OutputSink
+// option is given, each row must have a unique external ID. It issues the
+// card for each valid row with the given function, in a new goroutine,
+// limiting the rows being issued at once to the capacity of rows, so that
+// the outcomes of at most twice that many rows are held in memory.
+func (h Handlers) readBatch(ctx context.Context, cr *csv.Reader, columns []string, rows chan<- chan batchRow, issue func(row int, externalID string, fhirBundle fhirbundle.FHIRBundle) batchRow) {
+	defer close(rows)
+	issuing := make(chan struct{}, cap(rows))
+	externalIDs := map[string]bool{}
+
+	for row := 1; ctx.Err() == nil; row++ {
+		b := batchRow{row: row}
+		record, err := cr.Read()
+		if err == io.EOF {
+			return
+		}
+
+		future := make(chan batchRow, 1)
+		select {
+		case rows <- future:
+		case <-ctx.Done():
+			return
+		}
+
+		if err != nil {
+			var parseErr *csv.ParseError
+			if tooLarge(err) {
+				b.status, b.message = http.StatusRequestEntityTooLarge, "request body too large"
+			} else if !errors.As(err, &parseErr) {
+				b.status = http.StatusBadRequest
+			} else {
+				b.malformed = parseErr
+			}
+			future <- b
+			if b.status != 0 {
+				return
+			}
+			continue
+		}
+
+		var cellErrs ValidationErrors
+		values := make(map[string]string, len(columns))
+		for i, column := range columns {
+			if i >= len(record) {
+				continue
+			}
+			if e, ok := h.checkValue(column, record[i]); !ok {
+				cellErrs = append(cellErrs, e)
+				continue
+			}
+			values[column] = record[i]
+		}
+
+		var externalID string
+		if h.outputSink != nil && len(cellErrs) == 0 {
+			id, e, ok := checkExternalID(values[ExternalIDField], externalIDs)
+			if !ok {
+				cellErrs = append(cellErrs, e)
+			}
+			externalID = id
+		}
+
+		var fhirBundle fhirbundle.FHIRBundle
+		if len(cellErrs) > 0 {
+			cellErrs.sort()
+			err = cellErrs
+		} else {
+			fhirBundle, err = h.parseValues(func(field string) []string {
+				if value, ok := values[field]; ok {
+					return []string{value}
+				}
+				return nil
+			})
+		}
+		if err != nil {
+			b.invalid = err
+			future <- b
+			continue
+		}
+		if externalID != "" {
+			externalIDs[externalID] = true
+		}
+
+		select {
+		case issuing <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		go func(row int, externalID string, fhirBundle fhirbundle.FHIRBundle) {
+			defer func() { <-issuing }()
+			future <- issue(row, externalID, fhirBundle)
+		}(row, externalID, fhirBundle)
+	}
+}
+
+// issueRow signs the card for a valid row of a CSV batch and encodes it as
+// the files written to the archive, or to the sink set by the OutputSink
+// option, in which case they are named by the row's external ID. If
+// contactSheet is true, it also keeps the card's QR code(s) for the contact
+// sheet.
+func (h Handlers) issueRow(ctx context.Context, issuer Issuer, output string, contactSheet bool, row int, externalID string, fhirBundle fhirbundle.FHIRBundle) batchRow {
+	b := batchRow{row: row, externalID: externalID}
+	name := fmt.Sprintf("row-%d", row)
+	if externalID != "" {
+		name = externalID
+	}
+
+	idem := idempotency{issuedAt: h.now()}
+	card, _, err := h.sign(ctx, issuer, fhirBundle.Patient, idem, func(i *shcissuer.Issuer) (shcissuer.Card, error) {
+		return i.Issue(ctx, fhirBundle)
+	})
+	if errors.Is(err, ErrCardTooLarge) {
+		b.err = explainTooLarge(err, fhirBundle, issuer.URL, h.payloadOptions(idem.clock())...)
+		return b
+	} else if err != nil {
+		b.err = err
+		return b
+	}
+	healthCardJWS := card.JWS
+	b.healthCardJWS = healthCardJWS
+
+	if output == "smart-health-card" {
+		b.files = []batchFile{{name: name + ".smart-health-card", contentType: "application/smart-health-card", data: card.File}}
+		if !contactSheet {
+			b.uploadErr = h.upload(ctx, b.files)
+			return b
+		}
+	}
+
+	qrPNGs, err := qrcode.EncodeWithOptionsContext(ctx, healthCardJWS, h.qrOptions(fhirBundle.Patient))
+	if err != nil {
+		b.err = err
+		return b
+	}
+	if contactSheet {
+		b.fhirBundle, b.qrPNGs = fhirBundle, qrPNGs
+	}
+	b.chunks = len(qrPNGs)
+	if output == "smart-health-card" {
+		b.uploadErr = h.upload(ctx, b.files)
+		return b
+	}
+
+	for i, qrPNG := range qrPNGs {
+		b.files = append(b.files, batchFile{name: fmt.Sprintf("%s/%d.png", name, i+1), contentType: "image/png", data: qrPNG})
+	}
+	b.uploadErr = h.upload(ctx, b.files)
+	return b
+}
+
+// upload writes the files of a row of a CSV batch to the sink set by the
+// OutputSink option, if any.
+func (h Handlers) upload(ctx context.Context, files []batchFile) error {
+	if h.outputSink == nil {
+		return nil
+	}
+	for _, file := range files {
+		if err := h.outputSink.Put(ctx, file.name, file.contentType, file.data); err != nil {
+			return fmt.Errorf("writing %s: %w", file.name, err)
+		}
+	}
+	return nil
+}
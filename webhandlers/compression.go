@@ -0,0 +1,172 @@
+package webhandlers
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// CompressResponses compresses the JWKS, JSON, HTML, JWS, and
+// .smart-health-card responses of the handlers with gzip or deflate,
+// whichever the request's Accept-Encoding header prefers, for deployments
+// with no reverse proxy or other middleware to do so. PNG, ZIP, and PDF
+// responses, which are already compressed, are written as is.
+func CompressResponses() Option {
+	return func(h *Handlers) {
+		h.compress = true
+	}
+}
+
+// compressed wraps the given handler so that, if the CompressResponses
+// option is given, its responses are compressed as negotiated by the
+// request's Accept-Encoding header.
+func (h Handlers) compressed(handler handlerFunc) handlerFunc {
+	if !h.compress {
+		return handler
+	}
+	return func(w http.ResponseWriter, r *http.Request) (int, string, bool) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := acceptedEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" {
+			return handler(w, r)
+		}
+
+		cw := &compressingResponseWriter{ResponseWriter: w, encoding: encoding}
+		defer cw.Close()
+		return handler(cw, r)
+	}
+}
+
+// acceptedEncoding returns "gzip" or "deflate", whichever of the two an
+// Accept-Encoding header prefers, favoring gzip, or the empty string if it
+// accepts neither.
+func acceptedEncoding(header string) string {
+	qs := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+		if coding == "x-gzip" {
+			coding = "gzip"
+		}
+
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		qs[coding] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, coding := range []string{"gzip", "deflate"} {
+		q, ok := qs[coding]
+		if !ok {
+			q = qs["*"]
+		}
+		if q > bestQ {
+			best, bestQ = coding, q
+		}
+	}
+	return best
+}
+
+// compressible reports whether responses of the given Content-Type are
+// worth compressing, i.e. are text rather than an already compressed
+// format.
+func compressible(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		mediaType == "application/json",
+		strings.HasSuffix(mediaType, "+json"),
+		mediaType == "application/smart-health-card":
+		return true
+	}
+	return false
+}
+
+// compressingResponseWriter compresses the response written to it if,
+// when its header is written, its Content-Type is compressible and it has
+// a body which is not already encoded.
+type compressingResponseWriter struct {
+	http.ResponseWriter
+	encoding string
+
+	wroteHeader bool
+	w           io.WriteCloser
+}
+
+func (w *compressingResponseWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.wroteHeader = true
+
+	header := w.Header()
+	if code == http.StatusNotModified {
+		weakenETag(header)
+	}
+	if code >= http.StatusOK && code != http.StatusNoContent && code != http.StatusPartialContent && code != http.StatusNotModified &&
+		header.Get("Content-Encoding") == "" && compressible(header.Get("Content-Type")) {
+		header.Set("Content-Encoding", w.encoding)
+		header.Del("Content-Length")
+		header.Del("Accept-Ranges")
+		weakenETag(header)
+
+		if w.encoding == "gzip" {
+			w.w = gzip.NewWriter(w.ResponseWriter)
+		} else {
+			// The "deflate" content coding is DEFLATE in the zlib format;
+			// see RFC 9110, section 8.4.1.2.
+			w.w = zlib.NewWriter(w.ResponseWriter)
+		}
+	}
+
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// weakenETag marks the ETag in the given header, if any, as weak, since
+// the compressed response is a different representation of the resource
+// than the one it was computed from. Conditional requests compare ETags
+// weakly, so they are still answered.
+func weakenETag(header http.Header) {
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		header.Set("ETag", "W/"+etag)
+	}
+}
+
+// Unwrap returns the underlying ResponseWriter, for http.ResponseController.
+func (w *compressingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *compressingResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.w == nil {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.w.Write(b)
+}
+
+// Close flushes the compressed response, if any.
+func (w *compressingResponseWriter) Close() error {
+	if w.w == nil {
+		return nil
+	}
+	return w.w.Close()
+}
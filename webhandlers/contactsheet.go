@@ -0,0 +1,49 @@
+package webhandlers
+
+import (
+	"bufio"
+	"io"
+	"os"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/pdf"
+)
+
+// contactSheet is the contact sheet of a CSV batch. It is written to a
+// temporary file as rows are issued, since the ZIP archive of the batch
+// can only be written one file at a time, and copied into the archive once
+// every row has been issued.
+type contactSheet struct {
+	*pdf.ContactSheet
+	f *os.File
+	w *bufio.Writer
+}
+
+func newContactSheet() (*contactSheet, error) {
+	f, err := os.CreateTemp("", "shc-contact-sheet-*.pdf")
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(f)
+	return &contactSheet{ContactSheet: pdf.NewContactSheet(w), f: f, w: w}, nil
+}
+
+// copyTo completes the contact sheet and copies it to w.
+func (s *contactSheet) copyTo(w io.Writer) error {
+	if err := s.Close(); err != nil {
+		return err
+	}
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	if _, err := s.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := io.Copy(w, s.f)
+	return err
+}
+
+// remove closes and removes the temporary file.
+func (s *contactSheet) remove() {
+	s.f.Close()
+	os.Remove(s.f.Name())
+}
@@ -0,0 +1,139 @@
+package webhandlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSPolicy describes which cross-origin requests browsers may make to the
+// handlers. See https://fetch.spec.whatwg.org/#http-cors-protocol.
+type CORSPolicy struct {
+	// AllowedOrigins are the origins, e.g. "https://clinic.example.com",
+	// allowed to make requests; "*" allows any origin.
+	AllowedOrigins []string
+
+	// AllowedMethods are the methods allowed in cross-origin requests; the
+	// default is GET and POST.
+	AllowedMethods []string
+
+	// AllowedHeaders are the request headers allowed in cross-origin
+	// requests, in addition to CORS-safelisted headers; the default is
+	// Authorization, X-Api-Key, and Idempotency-Key.
+	AllowedHeaders []string
+
+	// AllowCredentials allows requests including cookies or HTTP
+	// authentication. It has no effect when any origin is allowed.
+	AllowCredentials bool
+
+	// MaxAge is how long browsers may cache the result of a preflight
+	// request; zero leaves it to the browser.
+	MaxAge time.Duration
+}
+
+// CORS sets the policy applied to cross-origin requests to all of the
+// handlers, and answered by Preflight. By default, only the JWKS is
+// available to any origin, as required by
+// https://spec.smarthealth.cards/#determining-keys-associated-with-an-issuer;
+// when a policy is given it applies to the JWKS too, so it should allow
+// any origin if the JWKS is served by these handlers.
+func CORS(p CORSPolicy) Option {
+	return func(h *Handlers) {
+		h.cors = &p
+	}
+}
+
+// Preflight responds to a CORS preflight request, i.e. an OPTIONS request,
+// according to the policy given by the CORS option. Requests from origins
+// or for methods which the policy does not allow are rejected with a 403
+// response code.
+//
+// If there is an error, this methods returns the HTTP response code,
+// an additional error message if available, and false. If there is no
+// error, it returns 0, the empty string, and true.
+func (h Handlers) Preflight(w http.ResponseWriter, r *http.Request) (int, string, bool) {
+	r = identify(w, r)
+	p := h.cors
+	if p == nil {
+		p = &CORSPolicy{AllowedOrigins: []string{"*"}, AllowedMethods: []string{http.MethodGet}}
+	}
+
+	if !p.setHeaders(w, r) {
+		return http.StatusForbidden, "origin not allowed", false
+	}
+
+	methods := p.methods()
+	if method := r.Header.Get("Access-Control-Request-Method"); method != "" && !contains(methods, method) {
+		return http.StatusForbidden, "method not allowed", false
+	}
+
+	w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+	if r.Header.Get("Access-Control-Request-Headers") != "" {
+		w.Header().Set("Access-Control-Allow-Headers", strings.Join(p.headers(), ", "))
+	}
+	if p.MaxAge > 0 {
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(p.MaxAge.Seconds())))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return 0, "", true
+}
+
+// setCORSHeaders sets the headers allowing a cross-origin request, if the
+// policy given by the CORS option allows it. If r is nil, e.g. for
+// JWKSJSON, the headers are only set if the policy allows any origin.
+func (h Handlers) setCORSHeaders(w http.ResponseWriter, r *http.Request) {
+	if h.cors != nil {
+		h.cors.setHeaders(w, r)
+	}
+}
+
+// setHeaders sets the headers allowing a cross-origin request and reports
+// whether the request's origin is allowed.
+func (p CORSPolicy) setHeaders(w http.ResponseWriter, r *http.Request) bool {
+	if contains(p.AllowedOrigins, "*") {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		return true
+	}
+
+	if r == nil {
+		return false
+	}
+
+	w.Header().Add("Vary", "Origin")
+
+	origin := r.Header.Get("Origin")
+	if origin == "" || !contains(p.AllowedOrigins, origin) {
+		return false
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	if p.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+	return true
+}
+
+func (p CORSPolicy) methods() []string {
+	if len(p.AllowedMethods) == 0 {
+		return []string{http.MethodGet, http.MethodPost}
+	}
+	return p.AllowedMethods
+}
+
+func (p CORSPolicy) headers() []string {
+	if len(p.AllowedHeaders) == 0 {
+		return []string{"Authorization", "X-Api-Key", IdempotencyKeyHeader}
+	}
+	return p.AllowedHeaders
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
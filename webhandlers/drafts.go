@@ -0,0 +1,337 @@
+package webhandlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/fhirbundle"
+	"github.com/amitkgupta/go-smarthealthcards/v2/summary"
+)
+
+// DraftTokenField is the form field in which a draft token returned by
+// DraftForm is exchanged with ProcessForm for the card it describes.
+const DraftTokenField = "draft_token"
+
+// DefaultDraftTTL is how long draft tokens are valid unless the
+// TwoStepIssuance option gives another duration.
+const DefaultDraftTTL = 15 * time.Minute
+
+// TwoStepIssuance makes issuance from form data a two-step process, so that
+// data-entry errors can be caught before they are signed into a card which
+// cannot be changed once issued. First, DraftForm validates the form data
+// and returns a summary of the card for review along with a draft token,
+// valid for the given duration, or DefaultDraftTTL if it is not positive.
+// Then ProcessForm exchanges the draft token, in the DraftTokenField, for
+// the card; it no longer accepts form data directly. The output format,
+// and page size, are chosen when the token is exchanged. The form served by
+// ServeForm is submitted to DraftForm for review.
+//
+// Draft tokens are authenticated with HMAC-SHA256 under the given secret,
+// which should be shared by every instance of a deployment; if it is empty,
+// a random secret is generated, and tokens are only valid in this process.
+// Tokens are not encrypted, so they reveal the form data to whoever holds
+// them, as the review does.
+//
+// Each draft token is exchanged for a card only once, even if the
+// issuance then fails, e.g. because the requested output format is
+// invalid; the draft must then be submitted again. Redemptions are
+// recorded in this process unless the DraftRedemptions option is given.
+func TwoStepIssuance(secret []byte, ttl time.Duration) Option {
+	return func(h *Handlers) {
+		if len(secret) == 0 {
+			secret = make([]byte, 32)
+			if _, err := rand.Read(secret); err != nil {
+				panic(err)
+			}
+		}
+		if ttl <= 0 {
+			ttl = DefaultDraftTTL
+		}
+		h.draftSecret = secret
+		h.draftTTL = ttl
+	}
+}
+
+// DraftRedeemer records which draft tokens have been exchanged for cards,
+// so that each is exchanged only once, as the handlers of a single process
+// do by default. Deployments with several replicas can implement it to
+// share redemptions between them, as redis.Store does.
+type DraftRedeemer interface {
+	// RedeemDraft records the redemption of the draft token with the
+	// given ID, which expires at the given time, and reports whether it
+	// had not already been redeemed.
+	RedeemDraft(ctx context.Context, id string, expiresAt time.Time) (bool, error)
+}
+
+// DraftRedemptions sets the DraftRedeemer recording the draft tokens
+// exchanged for cards when the TwoStepIssuance option is given.
+func DraftRedemptions(d DraftRedeemer) Option {
+	return func(h *Handlers) {
+		h.draftRedeemer = d
+	}
+}
+
+// memoryDraftRedeemer is the DraftRedeemer of a single process, forgetting
+// tokens once they expire.
+type memoryDraftRedeemer struct {
+	now func() time.Time
+
+	mu       sync.Mutex
+	redeemed map[string]time.Time
+}
+
+func (m *memoryDraftRedeemer) RedeemDraft(ctx context.Context, id string, expiresAt time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	for redeemedID, expiry := range m.redeemed {
+		if !now.Before(expiry) {
+			delete(m.redeemed, redeemedID)
+		}
+	}
+
+	if _, ok := m.redeemed[id]; ok {
+		return false, nil
+	}
+	m.redeemed[id] = expiresAt
+	return true, nil
+}
+
+// Draft is the JSON document written by DraftForm.
+type Draft struct {
+	// Token is the draft token to exchange for the card with ProcessForm.
+	Token string `json:"draftToken"`
+
+	// ExpiresAt is when the token expires.
+	ExpiresAt time.Time `json:"expiresAt"`
+
+	// Summary is the human-readable contents of the card, as rendered by
+	// the summary package, for review.
+	Summary string `json:"summary"`
+
+	// FHIRBundle is the FHIR bundle which would be signed.
+	FHIRBundle fhirbundle.FHIRBundle `json:"fhirBundle"`
+}
+
+// draftPayload is the authenticated content of a draft token.
+type draftPayload struct {
+	ID        string `json:"jti"`
+	Issuer    string `json:"iss"`
+	ExpiresAt int64  `json:"exp"`
+	Form      string `json:"form"`
+}
+
+// errInvalidDraftToken is the error with which draft tokens which are
+// malformed, forged, expired, or for another issuer are rejected.
+var errInvalidDraftToken = errors.New("invalid draft token")
+
+// DraftForm expects the same form data as ProcessForm, and parses and
+// validates it in the same way, but rather than signing a card it writes a
+// Draft holding a summary of the card and a draft token for which
+// ProcessForm issues it, as described by the TwoStepIssuance option. If
+// the card is requested as an HTML page, as by the form served by
+// ServeForm, it instead writes a page showing the summary with a button
+// confirming the issuance. It fails with a 404 response code if the
+// TwoStepIssuance option is not given.
+//
+// If there is an error, this methods returns the HTTP response code,
+// an additional error message if available, and false. If there is no
+// error, it returns 0, the empty string, and true.
+func (h Handlers) DraftForm(w http.ResponseWriter, r *http.Request) (int, string, bool) {
+	return h.guard(h.draftForm)(w, r)
+}
+
+func (h Handlers) draftForm(w http.ResponseWriter, r *http.Request) (int, string, bool) {
+	issuer, ok := h.resolve(r)
+	if !ok {
+		return http.StatusNotFound, "unknown issuer", false
+	}
+	if h.draftSecret == nil {
+		return http.StatusNotFound, "two-step issuance is not enabled", false
+	}
+
+	fhirBundle, err := h.ParseForm(r)
+	if err != nil {
+		h.validationFailed(r, err)
+		return http.StatusBadRequest, h.localize(r, err), false
+	}
+
+	values := url.Values{}
+	for field, v := range r.PostForm {
+		if field != "output" && field != "page_size" && field != DraftTokenField {
+			values[field] = v
+		}
+	}
+	expiresAt := h.now().Add(h.draftTTL).Truncate(time.Second)
+	token, err := h.draftToken(draftPayload{Issuer: issuer.URL, ExpiresAt: expiresAt.Unix(), Form: values.Encode()})
+	if err != nil {
+		return h.internalError(r, err)
+	}
+
+	if outputFormat(r) == "html" {
+		buf := new(bytes.Buffer)
+		if err := draftTemplate.Execute(buf, draftPage{
+			Summary:   summary.Of(fhirBundle).HTML(),
+			Action:    h.routes.Form,
+			Field:     DraftTokenField,
+			Token:     token,
+			ExpiresAt: expiresAt.UTC().Format("15:04 MST"),
+		}); err != nil {
+			return h.internalError(r, err)
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(buf.Bytes())
+		return 0, "", true
+	}
+
+	draftJSON, err := json.Marshal(Draft{
+		Token:      token,
+		ExpiresAt:  expiresAt.UTC(),
+		Summary:    summary.Of(fhirBundle).String(),
+		FHIRBundle: fhirBundle,
+	})
+	if err != nil {
+		return h.internalError(r, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(draftJSON)
+	return 0, "", true
+}
+
+// draftToken returns a draft token holding the given payload, with a
+// random ID.
+func (h Handlers) draftToken(p draftPayload) (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	p.ID = base64.RawURLEncoding.EncodeToString(id)
+
+	payload, err := json.Marshal(p)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(h.draftMAC(encoded)), nil
+}
+
+func (h Handlers) draftMAC(encodedPayload string) []byte {
+	mac := hmac.New(sha256.New, h.draftSecret)
+	mac.Write([]byte(encodedPayload))
+	return mac.Sum(nil)
+}
+
+// redeemDraft replaces the form data of the request with that held by the
+// draft token in its DraftTokenField, keeping the requested output format
+// and page size, so that ProcessForm issues the card reviewed with
+// DraftForm. It returns ReasonMissing or ReasonInvalid, and false, if there
+// is no token or it is not a valid token for the given issuer, or has
+// already been redeemed, and an error if the redemption cannot be
+// recorded.
+func (h Handlers) redeemDraft(r *http.Request, issuer Issuer) (Reason, bool, error) {
+	token := strings.TrimSpace(r.PostFormValue(DraftTokenField))
+	if token == "" {
+		return ReasonMissing, false, nil
+	}
+
+	p, err := h.parseDraftToken(token)
+	if err != nil || p.Issuer != issuer.URL || p.ID == "" {
+		return ReasonInvalid, false, nil
+	}
+
+	values, err := url.ParseQuery(p.Form)
+	if err != nil {
+		return ReasonInvalid, false, nil
+	}
+
+	if first, err := h.draftRedeemer.RedeemDraft(r.Context(), p.ID, time.Unix(p.ExpiresAt, 0)); err != nil {
+		return "", false, err
+	} else if !first {
+		return ReasonInvalid, false, nil
+	}
+	for _, field := range []string{"output", "page_size"} {
+		if v, ok := r.PostForm[field]; ok {
+			values[field] = v
+		}
+	}
+	r.PostForm = values
+	r.Form = values
+	return "", true, nil
+}
+
+// parseDraftToken returns the payload of the given draft token, if it was
+// issued by these handlers and has not expired.
+func (h Handlers) parseDraftToken(token string) (draftPayload, error) {
+	encoded, encodedMAC, ok := strings.Cut(token, ".")
+	if !ok {
+		return draftPayload{}, errInvalidDraftToken
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(encodedMAC)
+	if err != nil || !hmac.Equal(mac, h.draftMAC(encoded)) {
+		return draftPayload{}, errInvalidDraftToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return draftPayload{}, errInvalidDraftToken
+	}
+	var p draftPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return draftPayload{}, errInvalidDraftToken
+	}
+	if !h.now().Before(time.Unix(p.ExpiresAt, 0)) {
+		return draftPayload{}, errInvalidDraftToken
+	}
+	return p, nil
+}
+
+var draftTemplate = template.Must(template.New("draft").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Review the SMART Health Card</title>
+<style>
+body { font-family: sans-serif; margin: 2em auto; max-width: 40em; padding: 0 1em; }
+button { font: inherit; padding: 0.5em 1.5em; }
+</style>
+</head>
+<body>
+<h1>Review the SMART Health Card</h1>
+<p>Check that the card is correct; it cannot be changed once issued.</p>
+{{.Summary}}
+<form method="post" action="{{.Action}}">
+<input type="hidden" name="{{.Field}}" value="{{.Token}}">
+<input type="hidden" name="output" value="html">
+<button type="submit">Confirm and issue</button>
+</form>
+<p>To make corrections, go back to the form. This review expires at {{.ExpiresAt}}.</p>
+</body>
+</html>
+`))
+
+type draftPage struct {
+	Summary   template.HTML
+	Action    string
+	Field     string
+	Token     string
+	ExpiresAt string
+}
@@ -0,0 +1,36 @@
+package webhandlers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestDraftTokenRedeemedOnce(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := New(key, "https://example.com", TwoStepIssuance([]byte("secret"), 0)).Handler()
+
+	w := postForm(h, "/draft", testForm("json"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("draft: status %d: %s", w.Code, w.Body)
+	}
+	var draft Draft
+	if err := json.Unmarshal(w.Body.Bytes(), &draft); err != nil {
+		t.Fatal(err)
+	}
+
+	redeem := url.Values{DraftTokenField: {draft.Token}, "output": {"jws"}}.Encode()
+	if w := postForm(h, "/", redeem); w.Code != http.StatusOK {
+		t.Fatalf("first redemption: status %d: %s", w.Code, w.Body)
+	}
+	if w := postForm(h, "/", redeem); w.Code != http.StatusBadRequest {
+		t.Errorf("second redemption: status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,38 @@
+package webhandlers
+
+import (
+	"net/http"
+	"net/mail"
+	"strings"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/delivery"
+)
+
+// Email sets a mailer with which ProcessForm and ProcessLookup email each
+// card to the address given by the optional "email" form value, in
+// addition to writing it. If the card cannot be emailed, the request fails
+// with a 500 response code.
+func Email(m delivery.Mailer) Option {
+	return func(h *Handlers) {
+		h.mailer = &m
+	}
+}
+
+// emailAddress returns the address given by the "email" form value, if the
+// Email option is given, and false if the address is invalid.
+func (h Handlers) emailAddress(r *http.Request) (string, bool) {
+	if h.mailer == nil {
+		return "", true
+	}
+
+	email := strings.TrimSpace(r.PostFormValue("email"))
+	if email == "" {
+		return "", true
+	}
+
+	address, err := mail.ParseAddress(email)
+	if err != nil {
+		return "", false
+	}
+	return address.Address, true
+}
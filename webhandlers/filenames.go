@@ -0,0 +1,81 @@
+package webhandlers
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/fhirbundle"
+)
+
+// FilenameFunc returns the base name, without an extension, under which a
+// card for the given patient is downloaded, e.g. "salk-jonas-shc". Cards
+// issued by ProcessBundle are named with a zero FHIRBundle.
+type FilenameFunc func(fb fhirbundle.FHIRBundle) string
+
+// Download makes the issuance handlers send cards as attachments, with a
+// Content-Disposition header naming the file as returned by name plus an
+// extension such as ".png", ".zip", or ".pdf", so that browsers save them
+// under a meaningful name rather than "download". The ZIP archive written
+// by ProcessCSV is named "cards.zip". HTML pages are always shown inline.
+//
+// For example, Download(PatientFilename) names a card for Jonas Salk
+// "salk-jonas-shc.png".
+func Download(name FilenameFunc) Option {
+	return func(h *Handlers) {
+		h.filename = name
+	}
+}
+
+// PatientFilename is a FilenameFunc naming cards after the patient's family
+// and given names, lowercased and with accents and punctuation removed,
+// e.g. "salk-jonas-shc". Cards without a patient name are named
+// "smart-health-card".
+func PatientFilename(fb fhirbundle.FHIRBundle) string {
+	var parts []string
+	for _, name := range append([]string{fb.Patient.Name.Family}, fb.Patient.Name.Givens...) {
+		if slug := slugify(name); slug != "" {
+			parts = append(parts, slug)
+		}
+	}
+
+	if len(parts) == 0 {
+		return "smart-health-card"
+	}
+	return strings.Join(append(parts, "shc"), "-")
+}
+
+// slugify lowercases s and replaces runs of anything other than letters and
+// digits with single hyphens.
+func slugify(s string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range s {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			hyphen = false
+			b.WriteRune(unicode.ToLower(r))
+		default:
+			hyphen = true
+		}
+	}
+	return b.String()
+}
+
+// attachment sets the Content-Disposition header for a download of the card
+// for the given patient with the given extension, if the Download option is
+// given.
+func (h Handlers) attachment(w http.ResponseWriter, fb fhirbundle.FHIRBundle, ext string) {
+	if h.filename == nil {
+		return
+	}
+	setAttachment(w, h.filename(fb)+ext)
+}
+
+func setAttachment(w http.ResponseWriter, filename string) {
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+}
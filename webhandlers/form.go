@@ -0,0 +1,262 @@
+package webhandlers
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/fhirbundle"
+)
+
+// FormPage customizes the issuance form served by ServeForm.
+type FormPage struct {
+	// Title is the heading of the page; the default is "Issue a SMART
+	// Health Card".
+	Title string
+
+	// CSS is added after the page's built-in styles, e.g. to apply a
+	// clinic's colors and fonts. The built-in styles take their accent
+	// color and font from the --accent and --font custom properties, so
+	// overriding those on :root is often enough.
+	CSS string
+
+	// Template, if given, replaces the built-in template of the page. It
+	// is executed with a FormData.
+	Template *template.Template
+}
+
+// FormData describes the issuance form to the template which renders it.
+type FormData struct {
+	// Title is the heading of the page.
+	Title string
+
+	// CSS is the page's additional styles, if any.
+	CSS template.CSS
+
+	// Action is the path to which the form is submitted.
+	Action string
+
+	// Patient are the fields describing the patient.
+	Patient []FormField
+
+	// Immunizations are the fields describing each immunization.
+	Immunizations [][]FormField
+
+	// VaccineTypes are the choices for the vaccine type fields.
+	VaccineTypes []fhirbundle.VaccineType
+
+	// Email is the field for an email address to which to send the card,
+	// or nil if the Email option is not given.
+	Email *FormField
+
+	// Performers are the known performers suggested for the performer
+	// fields, as set by the Performers option, if any.
+	Performers []string
+
+	// PerformerOverride is the checkbox accepting performers which are not
+	// among the known performers, or nil if the Performers option is not
+	// given.
+	PerformerOverride *FormField
+}
+
+// FormField describes a single field of the issuance form.
+type FormField struct {
+	// Name is the name of the field in form data, as configured by the
+	// FormFields option.
+	Name string
+
+	// Label is the human-readable label of the field, in the language of
+	// the validation error messages.
+	Label string
+
+	// Type is the type of the field's input element, e.g. "text" or
+	// "date", or "select" for the vaccine type fields.
+	Type string
+
+	// Required is whether the field must be filled in.
+	Required bool
+
+	// List is the id of the datalist element suggesting values for the
+	// field, i.e. "performers" for the performer fields if the Performers
+	// option is given, or is empty.
+	List string
+}
+
+// IssuanceForm customizes the issuance form served by ServeForm.
+func IssuanceForm(p FormPage) Option {
+	return func(h *Handlers) {
+		h.formPage = p
+	}
+}
+
+var formTemplate = template.Must(template.New("form").Funcs(template.FuncMap{
+	"inc": func(i int) int { return i + 1 },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+:root { --accent: #1a5fb4; --font: sans-serif; }
+body { font-family: var(--font); margin: 2em auto; max-width: 40em; padding: 0 1em; }
+h1 { color: var(--accent); }
+fieldset { border: 1px solid #ccc; margin: 0 0 1em; padding: 0.5em 1em 1em; }
+label { display: block; margin-top: 0.75em; }
+input, select { box-sizing: border-box; font: inherit; padding: 0.3em; width: 100%; }
+button { background: var(--accent); border: 0; color: #fff; cursor: pointer; font: inherit; padding: 0.5em 1.5em; }
+</style>
+{{- with .CSS}}
+<style>
+{{.}}
+</style>
+{{- end}}
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<form method="post" action="{{.Action}}">
+<fieldset>
+<legend>Patient</legend>
+{{- range .Patient}}
+{{template "field" .}}
+{{- end}}
+</fieldset>
+{{- range $i, $fields := .Immunizations}}
+<fieldset>
+<legend>Immunization {{inc $i}}</legend>
+{{- range $fields}}
+{{- if eq .Type "select"}}
+<label>{{.Label}}
+<select name="{{.Name}}"{{if .Required}} required{{end}}>
+<option value=""></option>
+{{- range $.VaccineTypes}}
+<option>{{.}}</option>
+{{- end}}
+</select>
+</label>
+{{- else}}
+{{template "field" .}}
+{{- end}}
+{{- end}}
+</fieldset>
+{{- end}}
+{{- with .PerformerOverride}}
+{{template "field" .}}
+{{- end}}
+{{- with .Performers}}
+<datalist id="performers">
+{{- range .}}
+<option value="{{.}}">
+{{- end}}
+</datalist>
+{{- end}}
+{{- with .Email}}
+<fieldset>
+{{template "field" .}}
+</fieldset>
+{{- end}}
+<input type="hidden" name="output" value="html">
+<button type="submit">Issue</button>
+</form>
+</body>
+</html>
+{{- define "field"}}
+<label>{{.Label}}
+<input type="{{.Type}}" name="{{.Name}}"{{with .List}} list="{{.}}"{{end}}{{if .Required}} required{{end}}>
+</label>
+{{- end}}
+`))
+
+// formAction returns the path to which the form served by ServeForm is
+// submitted: the Draft route if the TwoStepIssuance option is given, and
+// the Form route otherwise.
+func (h Handlers) formAction() string {
+	if h.draftSecret != nil {
+		return h.routes.Draft
+	}
+	return h.routes.Form
+}
+
+// ServeForm writes an HTML page with a form for issuing a card, which
+// submits the fields expected by ProcessForm, named and required as
+// configured by the FormFields option, to the Form route configured by the
+// OpenAPIRoutes option, asking for the card as an HTML page. Its labels
+// are in the language of the validation error messages, its vaccine type
+// fields offer the supported fhirbundle.VaccineTypes, its performer fields
+// suggest the performers set by the Performers option, and its date fields
+// use the browser's date picker. It can be customized with the
+// IssuanceForm option, so that a clinic can issue cards with no frontend
+// of its own.
+//
+// If there is an error, this methods returns the HTTP response code,
+// an additional error message if available, and false. If there is no
+// error, it returns 0, the empty string, and true.
+func (h Handlers) ServeForm(w http.ResponseWriter, r *http.Request) (int, string, bool) {
+	r = identify(w, r)
+	return h.compressed(h.serveForm)(w, r)
+}
+
+func (h Handlers) serveForm(w http.ResponseWriter, r *http.Request) (int, string, bool) {
+	if _, ok := h.resolve(r); !ok {
+		return http.StatusNotFound, "unknown issuer", false
+	}
+
+	c := h.catalog(r)
+	field := func(name, inputType string, required bool) FormField {
+		label, ok := c.Fields[name]
+		if !ok {
+			label = name
+		}
+		return FormField{Name: h.fieldName(name), Label: label, Type: inputType, Required: required && !h.optional(name)}
+	}
+
+	data := FormData{
+		Title:  h.formPage.Title,
+		CSS:    template.CSS(h.formPage.CSS),
+		Action: h.formAction(),
+		Patient: []FormField{
+			field("family_name", "text", true),
+			field("given_names", "text", true),
+			field("date_of_birth", "date", true),
+		},
+		VaccineTypes: fhirbundle.VaccineTypes(),
+	}
+	if data.Title == "" {
+		data.Title = "Issue a SMART Health Card"
+	}
+	for i, ordinal := range immunizationOrdinals {
+		performer := field(ordinal+"_immunization_performer", "text", i == 0)
+		if h.performers != nil {
+			performer.List = "performers"
+		}
+		data.Immunizations = append(data.Immunizations, []FormField{
+			field(ordinal+"_immunization_vaccine_type", "select", i == 0),
+			field(ordinal+"_immunization_date", "date", i == 0),
+			performer,
+			field(ordinal+"_immunization_lot_number", "text", i == 0),
+		})
+	}
+	if h.performers != nil {
+		override := field(PerformerOverrideField, "checkbox", false)
+		data.Performers = h.performers
+		data.PerformerOverride = &override
+	}
+	if h.mailer != nil {
+		email := field("email", "email", false)
+		data.Email = &email
+	}
+
+	t := h.formPage.Template
+	if t == nil {
+		t = formTemplate
+	}
+
+	buf := new(bytes.Buffer)
+	if err := t.Execute(buf, data); err != nil {
+		return h.internalError(r, err)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(buf.Bytes())
+	return 0, "", true
+}
@@ -0,0 +1,49 @@
+package webhandlers_test
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/conformance"
+	"github.com/amitkgupta/go-smarthealthcards/v2/fuzz"
+	"github.com/amitkgupta/go-smarthealthcards/v2/verifier"
+)
+
+// FuzzForm runs fuzz.Form on form data, seeded with the patients and
+// immunizations of the golden examples as they would be entered in the
+// form.
+func FuzzForm(f *testing.F) {
+	examples, err := conformance.Golden()
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, ex := range examples {
+		card, _ := verifier.Verify(context.Background(), ex.JWS, verifier.JWKS{})
+		fb := card.FHIRBundle
+
+		values := url.Values{
+			"family_name":   {fb.Patient.Name.Family},
+			"given_names":   {strings.Join(fb.Patient.Name.Givens, " ")},
+			"date_of_birth": {fb.Patient.BirthDate.Format("2006-01-02")},
+		}
+		for i, ordinal := range []string{"first", "second", "third"} {
+			if i == len(fb.Immunizations) {
+				break
+			}
+			imm := fb.Immunizations[i]
+			values.Set(ordinal+"_immunization_performer", imm.Performer)
+			values.Set(ordinal+"_immunization_lot_number", imm.LotNumber)
+			values.Set(ordinal+"_immunization_vaccine_type", string(imm.VaccineType))
+			values.Set(ordinal+"_immunization_date", imm.DatePerformed.Format("2006-01-02"))
+		}
+		f.Add([]byte(values.Encode()))
+	}
+	f.Add([]byte(""))
+	f.Add([]byte("family_name=Salk&date_of_birth=1914-13-28&first_immunization_date=tomorrow"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fuzz.Form(data)
+	})
+}
@@ -0,0 +1,85 @@
+package webhandlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/fhirbundle"
+	"github.com/amitkgupta/go-smarthealthcards/v2/qrcode"
+	"github.com/amitkgupta/go-smarthealthcards/v2/summary"
+)
+
+var cardTemplate = template.Must(template.New("card").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>SMART Health Card</title>
+<style>
+body { font-family: sans-serif; margin: 2em auto; max-width: 40em; padding: 0 1em; }
+.qr { display: inline-block; margin: 0 1em 1em 0; text-align: center; }
+.qr img { width: 100%; max-width: 320px; image-rendering: pixelated; }
+</style>
+</head>
+<body>
+<h1>SMART Health Card</h1>
+{{.Summary}}
+{{- range .QRCodes}}
+<div class="qr">
+<img src="{{.DataURI}}" alt="{{.Label}}">
+<div><a href="{{.DataURI}}" download="{{.Filename}}">Download {{.Label}}</a></div>
+</div>
+{{- end}}
+<p><a href="{{.FileDataURI}}" download="{{.Filename}}.smart-health-card">Download .smart-health-card file</a></p>
+</body>
+</html>
+`))
+
+type cardPage struct {
+	Summary     template.HTML
+	QRCodes     []qrCode
+	FileDataURI template.URL
+	Filename    string
+}
+
+type qrCode struct {
+	DataURI  template.URL
+	Label    string
+	Filename string
+}
+
+// cardHTML renders a page for the card, offering its files for download
+// under the given base name.
+func cardHTML(fb fhirbundle.FHIRBundle, healthCardJWS string, qrPNGs [][]byte, filename string) ([]byte, error) {
+	page := cardPage{
+		Filename: filename,
+		Summary:  summary.Of(fb).HTML(),
+	}
+
+	for i, qrPNG := range qrPNGs {
+		qr := qrCode{
+			DataURI:  template.URL(qrcode.DataURI(qrPNG)),
+			Label:    "QR code",
+			Filename: filename + ".png",
+		}
+		if len(qrPNGs) > 1 {
+			qr.Label = fmt.Sprintf("QR code part %d of %d", i+1, len(qrPNGs))
+			qr.Filename = fmt.Sprintf("%s-part-%d-of-%d.png", filename, i+1, len(qrPNGs))
+		}
+		page.QRCodes = append(page.QRCodes, qr)
+	}
+
+	file, err := smartHealthCardFile(healthCardJWS)
+	if err != nil {
+		return nil, err
+	}
+	page.FileDataURI = template.URL("data:application/smart-health-card;base64," + base64.StdEncoding.EncodeToString(file))
+
+	buf := new(bytes.Buffer)
+	if err := cardTemplate.Execute(buf, page); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
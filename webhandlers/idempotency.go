@@ -0,0 +1,91 @@
+package webhandlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/store"
+)
+
+// IdempotencyKeyHeader is the request header with which clients of the
+// handlers issuing a single card may give a key, unique to the card they
+// are requesting, so that a retried request, e.g. after a double-click or a
+// dropped connection, returns the card issued for the first rather than a
+// new card with a different "nbf" value. See
+// https://datatracker.ietf.org/doc/draft-ietf-httpapi-idempotency-key-header/.
+//
+// The header has effect only when the store given with the Issuances
+// option is a store.IdempotentIssuanceStore. Keys are scoped to the subject
+// of the Identity making the request, if the Authorize option is given.
+// Keys are reserved atomically, so of concurrent requests with the same
+// key, only the first recorded issues a card, which all of them return. A
+// card returned again is not recorded, emailed, or reported to the metrics,
+// logger, or webhook again.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// MaxIdempotencyKeyLength is the longest idempotency key accepted.
+const MaxIdempotencyKeyLength = 255
+
+var (
+	// ErrInvalidIdempotencyKey is the error with which requests are
+	// rejected, with a 400 response code, when their idempotency key is
+	// longer than MaxIdempotencyKeyLength.
+	ErrInvalidIdempotencyKey = errors.New("Idempotency-Key header is too long")
+
+	// ErrIdempotencyKeyReused is the error with which requests are
+	// rejected, with a 422 response code, when their idempotency key was
+	// previously used to request a different card, or the card cannot be
+	// issued again as it was because the issuer's key has since changed.
+	ErrIdempotencyKeyReused = errors.New("Idempotency-Key header was already used for a different card")
+)
+
+// idempotency describes when, and with which idempotency key, a card is
+// issued.
+type idempotency struct {
+	// key is the request's idempotency key, or is empty if none was given
+	// or the issuance store does not support them.
+	key string
+
+	// issuedAt is the issuance time of the card.
+	issuedAt time.Time
+
+	// previous is the issuance of the card previously requested with the
+	// same key, or nil if there is none.
+	previous *store.Issuance
+}
+
+// idempotency returns when, and with which idempotency key, to issue the
+// card requested by r. If the key was used before, the card is issued as of
+// the time it was first issued, so that, as cards requested with an
+// idempotency key are always signed deterministically, it is the same
+// card.
+func (h Handlers) idempotency(r *http.Request) (idempotency, error) {
+	key := strings.TrimSpace(r.Header.Get(IdempotencyKeyHeader))
+	s, ok := h.issuances.(store.IdempotentIssuanceStore)
+	if key == "" || !ok {
+		return idempotency{issuedAt: h.now()}, nil
+	}
+	if len(key) > MaxIdempotencyKeyLength {
+		return idempotency{}, ErrInvalidIdempotencyKey
+	}
+
+	identity, _ := IdentityFromContext(r.Context())
+	previous, found, err := s.IssuanceByIdempotencyKey(r.Context(), identity.Subject, key)
+	if err != nil {
+		return idempotency{}, err
+	}
+	if !found {
+		return idempotency{key: key, issuedAt: h.now()}, nil
+	}
+	return idempotency{key: key, issuedAt: previous.IssuedAt, previous: &previous}, nil
+}
+
+// clock returns a function returning the issuance time, for
+// fhirbundle.WithClock.
+func (i idempotency) clock() func() time.Time {
+	return func() time.Time {
+		return i.issuedAt
+	}
+}
@@ -0,0 +1,61 @@
+package webhandlers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/store"
+)
+
+func TestIdempotencyKeyConcurrentRequests(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuances := &store.Memory{}
+	h := New(key, "https://example.com", Issuances(issuances)).Handler()
+
+	form := testForm("jws")
+
+	const n = 8
+	bodies := make([]string, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r.Header.Set(IdempotencyKeyHeader, "key")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != http.StatusOK {
+				t.Errorf("request %d: status %d: %s", i, w.Code, w.Body)
+			}
+			bodies[i] = w.Body.String()
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 1; i < n; i++ {
+		if bodies[i] != bodies[0] {
+			t.Errorf("request %d returned a different card than request 0", i)
+		}
+	}
+
+	recorded, err := issuances.Issuances(context.Background(), time.Time{}, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recorded) != 1 {
+		t.Errorf("recorded %d issuances, want 1", len(recorded))
+	}
+}
@@ -0,0 +1,221 @@
+package webhandlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/metrics"
+	"github.com/amitkgupta/go-smarthealthcards/v2/store"
+	"github.com/amitkgupta/go-smarthealthcards/v2/webhook"
+)
+
+// Metrics sets where the handlers record the number of cards issued,
+// validation failures by field, signing latency, QR chunk counts, and
+// response sizes. Serve m on a scrape endpoint such as /metrics to expose
+// them to Prometheus.
+func Metrics(m *metrics.Metrics) Option {
+	return func(h *Handlers) {
+		h.metrics = m
+	}
+}
+
+// Logger sets where the handlers log a structured event for each issuance
+// attempt, recording its outcome, the fields and reasons of any validation
+// errors, the size of the signed payload, the number of QR code chunks, and
+// any internal error. Events never include form values or other patient
+// data.
+func Logger(l *slog.Logger) Option {
+	return func(h *Handlers) {
+		h.logger = l
+	}
+}
+
+// OnError sets a function called with the error behind each issuance which
+// fails with a 5xx or 413 response code, e.g. a *jws.SigningError, a
+// store's error, or context.DeadlineExceeded, so that applications can
+// branch on it with errors.Is and errors.As, and report it. Only the
+// errors of 413 responses, such as ErrCardTooLarge, are written to the
+// response; others may reveal internal details.
+func OnError(f func(r *http.Request, err error)) Option {
+	return func(h *Handlers) {
+		h.onError = f
+	}
+}
+
+// Webhook sets a dispatcher which the handlers notify, in the background,
+// of each card they successfully issue.
+func Webhook(d *webhook.Dispatcher) Option {
+	return func(h *Handlers) {
+		h.webhook = d
+	}
+}
+
+type handlerFunc func(w http.ResponseWriter, r *http.Request) (int, string, bool)
+
+// instrument calls the given issuance handler, guarded as by guard,
+// recording the outcome and the size of the response.
+func (h Handlers) instrument(w http.ResponseWriter, r *http.Request, handler handlerFunc) (int, string, bool) {
+	r = identify(w, r)
+	handler = h.guard(handler)
+
+	if h.problemDetails {
+		var fields *[]FieldProblem
+		r, fields = withProblems(r)
+		if code, message, ok := h.record(w, r, handler); !ok {
+			writeProblem(w, r, code, message, *fields)
+		}
+		return 0, "", true
+	}
+
+	return h.record(w, r, handler)
+}
+
+// record calls the given handler, recording its outcome and the size of
+// the response.
+func (h Handlers) record(w http.ResponseWriter, r *http.Request, handler handlerFunc) (int, string, bool) {
+	if h.metrics == nil && h.logger == nil {
+		return handler(w, r)
+	}
+
+	cw := &countingResponseWriter{ResponseWriter: w}
+	code, message, ok := handler(cw, r)
+
+	if h.metrics != nil {
+		if ok {
+			h.metrics.ResponseWritten(cw.n)
+		} else {
+			h.metrics.IssuanceFailed(code)
+		}
+	}
+
+	if h.logger != nil {
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			requestIDAttr(r.Context()),
+		}
+		switch {
+		case ok:
+			h.logger.LogAttrs(r.Context(), slog.LevelInfo, "issuance succeeded",
+				append(attrs, slog.Int("response_bytes", cw.n))...)
+		case code >= http.StatusInternalServerError:
+			h.logger.LogAttrs(r.Context(), slog.LevelError, "issuance failed",
+				append(attrs, slog.Int("status", code))...)
+		default:
+			h.logger.LogAttrs(r.Context(), slog.LevelWarn, "issuance rejected",
+				append(attrs, slog.Int("status", code))...)
+		}
+	}
+
+	return code, message, ok
+}
+
+// guard wraps the given handler so that it is subject to the configured CORS
+// policy, rate limit, authorization, input limits, and response compression,
+// and so that its error messages carry the request's ID.
+func (h Handlers) guard(handler handlerFunc) handlerFunc {
+	limited := h.compressed(h.limit(h.authorize(h.harden(handler))))
+	return func(w http.ResponseWriter, r *http.Request) (int, string, bool) {
+		r = identify(w, r)
+		h.setCORSHeaders(w, r)
+		code, message, ok := limited(w, r)
+		if !ok && !collectingProblems(r) {
+			message = withRequestID(r, message)
+		}
+		return code, message, ok
+	}
+}
+
+// internalError logs the error behind a failed issuance and returns the
+// corresponding HTTP response code.
+func (h Handlers) internalError(r *http.Request, err error) (int, string, bool) {
+	if h.onError != nil {
+		h.onError(r, err)
+	}
+
+	code := errorStatus(err)
+	switch code {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity:
+		h.addProblems(r, err)
+		return code, err.Error(), false
+	}
+
+	if h.logger != nil {
+		h.logger.LogAttrs(r.Context(), slog.LevelError, "issuance error",
+			slog.String("path", r.URL.Path),
+			requestIDAttr(r.Context()),
+			slog.Int("status", code),
+			slog.String("error", err.Error()),
+		)
+	}
+	return code, "", false
+}
+
+func (h Handlers) cardIssued(r *http.Request, issuer Issuer, healthCardJWS string, chunks int) {
+	if h.metrics != nil {
+		h.metrics.CardIssued(issuer.URL, chunks)
+	}
+
+	if h.logger != nil {
+		h.logger.LogAttrs(r.Context(), slog.LevelInfo, "card issued",
+			requestIDAttr(r.Context()),
+			slog.String("issuer", issuer.URL),
+			slog.Int("payload_bytes", len(healthCardJWS)),
+			slog.Int("chunks", chunks),
+		)
+	}
+
+	if h.webhook != nil {
+		h.webhook.Notify(webhook.Event{
+			CardHash: store.CardHash(healthCardJWS),
+			Issuer:   issuer.URL,
+			IssuedAt: h.now(),
+			Chunks:   chunks,
+		})
+	}
+}
+
+// validationFailed records the fields and reasons of validation errors,
+// but never their values, which may identify the patient.
+func (h Handlers) validationFailed(r *http.Request, err error) {
+	h.addProblems(r, err)
+
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		return
+	}
+
+	if h.metrics != nil {
+		for _, e := range errs {
+			h.metrics.ValidationFailed(e.Field, string(e.Reason))
+		}
+	}
+
+	if h.logger != nil {
+		attrs := make([]any, len(errs))
+		for i, e := range errs {
+			attrs[i] = slog.String(e.Field, string(e.Reason))
+		}
+		h.logger.LogAttrs(r.Context(), slog.LevelInfo, "validation failed",
+			requestIDAttr(r.Context()),
+			slog.Group("errors", attrs...),
+		)
+	}
+}
+
+type countingResponseWriter struct {
+	http.ResponseWriter
+	n int
+}
+
+func (w *countingResponseWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.n += n
+	return n, err
+}
+
+// Unwrap returns the underlying ResponseWriter, for http.ResponseController.
+func (w *countingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
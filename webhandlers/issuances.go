@@ -0,0 +1,142 @@
+package webhandlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/audit"
+	"github.com/amitkgupta/go-smarthealthcards/v2/fhirbundle"
+	"github.com/amitkgupta/go-smarthealthcards/v2/store"
+)
+
+// CardHashHeader is the response header in which the handlers issuing a
+// card give its hash, as recorded by the Issuances and Audit options and
+// returned by store.CardHash, so that support staff can later confirm that
+// a card was issued here, e.g. by comparing it with the hash given by
+// VerifyQRCodes, without the card itself being stored.
+const CardHashHeader = "X-Card-Hash"
+
+// Issuances sets where the handlers record each card they sign: the hash of
+// the card, the "kid" of the signing key, the issuer, the time it was
+// signed, the subject of the Identity which requested it, if the Authorize
+// option is given, and the idempotency key with which it was requested, if
+// any; see IdempotencyKeyHeader. If the issuance cannot be recorded, the
+// card is not written and the request fails with a 500 response code.
+func Issuances(s store.IssuanceStore) Option {
+	return func(h *Handlers) {
+		h.issuances = s
+	}
+}
+
+// Audit sets an audit log in which the handlers record each card they sign,
+// identifying the patient only by a salted hash. If the issuance cannot be
+// recorded, the card is not written and the request fails with a 500
+// response code.
+func Audit(l *audit.Log) Option {
+	return func(h *Handlers) {
+		h.audit = l
+	}
+}
+
+// recordIssuance records the issuance of the given card to the given
+// patient, requested with the given idempotency key, if any, if the
+// Issuances or Audit options are given. If an issuance was concurrently
+// recorded with the same idempotency key, it records nothing and returns
+// that issuance instead.
+func (h Handlers) recordIssuance(ctx context.Context, issuer Issuer, patient fhirbundle.Patient, healthCardJWS string, issuedAt time.Time, idempotencyKey string) (*store.Issuance, error) {
+	identity, _ := IdentityFromContext(ctx)
+	requestID, _ := RequestIDFromContext(ctx)
+
+	if h.issuances != nil {
+		i := store.Issuance{
+			CardHash:       store.CardHash(healthCardJWS),
+			KeyID:          keyID(healthCardJWS),
+			Issuer:         issuer.URL,
+			IssuedAt:       issuedAt,
+			Identity:       identity.Subject,
+			IdempotencyKey: idempotencyKey,
+		}
+		if s, ok := h.issuances.(store.IdempotentIssuanceStore); ok && idempotencyKey != "" {
+			previous, found, err := s.RecordIdempotentIssuance(ctx, i)
+			if err != nil {
+				return nil, err
+			}
+			if found {
+				return &previous, nil
+			}
+		} else if err := h.issuances.RecordIssuance(ctx, i); err != nil {
+			return nil, err
+		}
+	}
+
+	if h.audit != nil {
+		if err := h.audit.Record(audit.Event{
+			Time:        issuedAt,
+			Type:        audit.Issuance,
+			PatientHash: h.audit.PatientHash(patient),
+			Issuer:      issuer.URL,
+			CardHash:    store.CardHash(healthCardJWS),
+			Identity:    identity.Subject,
+			RequestID:   requestID,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, nil
+}
+
+// bundlePatient returns the name and birth date of the patient in an FHIR
+// bundle in JSON form, or the zero Patient if it cannot be found.
+func bundlePatient(bundle []byte) fhirbundle.Patient {
+	var b struct {
+		Entries []struct {
+			Resource struct {
+				ResourceType string            `json:"resourceType"`
+				Name         []fhirbundle.Name `json:"name"`
+				BirthDate    string            `json:"birthDate"`
+			} `json:"resource"`
+		} `json:"entry"`
+	}
+	if err := json.Unmarshal(bundle, &b); err != nil {
+		return fhirbundle.Patient{}
+	}
+
+	for _, entry := range b.Entries {
+		if entry.Resource.ResourceType != "Patient" {
+			continue
+		}
+
+		var p fhirbundle.Patient
+		if len(entry.Resource.Name) > 0 {
+			p.Name = entry.Resource.Name[0]
+		}
+		p.BirthDate, _ = time.Parse("2006-01-02", entry.Resource.BirthDate)
+		return p
+	}
+	return fhirbundle.Patient{}
+}
+
+// keyID returns the "kid" from the header of the given JWS.
+func keyID(healthCardJWS string) string {
+	encodedHeader := healthCardJWS
+	if i := strings.IndexByte(encodedHeader, '.'); i >= 0 {
+		encodedHeader = encodedHeader[:i]
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(encodedHeader)
+	if err != nil {
+		return ""
+	}
+
+	var header struct {
+		KeyID string `json:"kid"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return ""
+	}
+	return header.KeyID
+}
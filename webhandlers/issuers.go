@@ -0,0 +1,73 @@
+package webhandlers
+
+import (
+	"crypto/ecdsa"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Issuer is an entity on behalf of which SMART Health Cards are issued,
+// identified by its URL (the "iss" value of the cards it issues) and the
+// private key used to sign its cards. Key is nil for the Handlers returned
+// by NewVerifier, which cannot sign.
+type Issuer struct {
+	URL string
+	Key *ecdsa.PrivateKey
+
+	// PreviousKeys are the public keys of keys which previously signed
+	// the issuer's cards, published in its JWKS along with Key so that
+	// those cards can still be verified.
+	PreviousKeys []*ecdsa.PublicKey
+}
+
+// IssuerResolver determines the issuer on behalf of which to act for a
+// request. It returns false if the request does not correspond to any
+// issuer.
+type IssuerResolver func(r *http.Request) (Issuer, bool)
+
+// ResolveByURL returns an IssuerResolver which, given a map of issuer URLs
+// to their keys, resolves requests whose host matches the host of an issuer
+// URL and whose path is within the path of that issuer URL. For example,
+// a request for https://example.com/clinic-a/.well-known/jwks.json resolves
+// to the issuer https://example.com/clinic-a. If multiple issuer URLs match,
+// the one with the longest path wins.
+func ResolveByURL(keys map[string]*ecdsa.PrivateKey) IssuerResolver {
+	type candidate struct {
+		host, path string
+		issuer     Issuer
+	}
+
+	var candidates []candidate
+	for issuerURL, key := range keys {
+		u, err := url.Parse(issuerURL)
+		if err != nil {
+			continue
+		}
+		candidates = append(candidates, candidate{
+			host:   strings.ToLower(u.Host),
+			path:   strings.TrimSuffix(u.Path, "/"),
+			issuer: Issuer{URL: issuerURL, Key: key},
+		})
+	}
+
+	return func(r *http.Request) (Issuer, bool) {
+		var match *candidate
+		for i, c := range candidates {
+			if c.host != strings.ToLower(r.Host) {
+				continue
+			}
+			if r.URL.Path != c.path && !strings.HasPrefix(r.URL.Path, c.path+"/") {
+				continue
+			}
+			if match == nil || len(c.path) > len(match.path) {
+				match = &candidates[i]
+			}
+		}
+
+		if match == nil {
+			return Issuer{}, false
+		}
+		return match.issuer, true
+	}
+}
@@ -0,0 +1,102 @@
+package webhandlers
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/jws"
+)
+
+// maxCachedKeys bounds the size of a keyCache, in case an IssuerResolver
+// returns newly loaded keys for every request.
+const maxCachedKeys = 1024
+
+// keyCache caches the "kid" of each signing key and the JWKS of each
+// issuer, which would otherwise be recomputed on every request. Entries are
+// keyed by the identity of the keys, which New, NewMultiIssuer, and
+// NewWithKeyring reuse across requests.
+type keyCache struct {
+	mu   sync.Mutex
+	kids map[*ecdsa.PublicKey]string
+	jwks map[string]jwksEntry
+}
+
+// jwksEntry is the JWKS of a set of keys along with the validators with
+// which clients can cache it: a strong ETag derived from its contents and
+// the time it was first served.
+type jwksEntry struct {
+	json     []byte
+	etag     string
+	modified time.Time
+}
+
+func newKeyCache() *keyCache {
+	return &keyCache{
+		kids: map[*ecdsa.PublicKey]string{},
+		jwks: map[string]jwksEntry{},
+	}
+}
+
+// kid returns the kid of the given key.
+func (c *keyCache) kid(key *ecdsa.PublicKey) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.kidLocked(key)
+}
+
+func (c *keyCache) kidLocked(key *ecdsa.PublicKey) string {
+	if kid, ok := c.kids[key]; ok {
+		return kid
+	}
+
+	if len(c.kids) >= maxCachedKeys {
+		c.kids = map[*ecdsa.PublicKey]string{}
+	}
+	kid := jws.KeyID(key)
+	c.kids[key] = kid
+	return kid
+}
+
+// jwksJSON returns the JSON serialization of the JWKS of the issuer's
+// current and previous keys, along with its validators.
+func (c *keyCache) jwksJSON(issuer Issuer) (jwksEntry, error) {
+	keys := issuer.PreviousKeys
+	if issuer.Key != nil {
+		keys = append([]*ecdsa.PublicKey{&issuer.Key.PublicKey}, keys...)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	kids := make([]string, len(keys))
+	for i, key := range keys {
+		kids[i] = c.kidLocked(key)
+	}
+
+	id := strings.Join(kids, ",")
+	if entry, ok := c.jwks[id]; ok {
+		return entry, nil
+	}
+
+	jwksJSON, err := jws.PublicJWKSJSON(keys...)
+	if err != nil {
+		return jwksEntry{}, err
+	}
+
+	sum := sha256.Sum256(jwksJSON)
+	entry := jwksEntry{
+		json:     jwksJSON,
+		etag:     `"` + base64.RawURLEncoding.EncodeToString(sum[:]) + `"`,
+		modified: time.Now().UTC().Truncate(time.Second),
+	}
+
+	if len(c.jwks) >= maxCachedKeys {
+		c.jwks = map[string]jwksEntry{}
+	}
+	c.jwks[id] = entry
+	return entry, nil
+}
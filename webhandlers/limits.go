@@ -0,0 +1,258 @@
+package webhandlers
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/fhirbundle"
+	"github.com/amitkgupta/go-smarthealthcards/v2/qrcode"
+)
+
+// Default input limits; see MaxRequestBytes and MaxFieldLength.
+const (
+	DefaultMaxRequestBytes = 1 << 20
+	DefaultMaxFieldLength  = 256
+)
+
+// MaxRequestBytes sets the maximum size of the body of a request to the
+// issuance handlers; larger requests are rejected with a 413 response code.
+// The default is DefaultMaxRequestBytes. Raise it to accept larger CSV
+// documents in ProcessCSV.
+func MaxRequestBytes(n int64) Option {
+	return func(h *Handlers) {
+		h.maxRequestBytes = n
+	}
+}
+
+// MaxFieldLength sets the maximum length, in bytes, of each form value and
+// CSV cell; longer values fail validation. The default is
+// DefaultMaxFieldLength.
+func MaxFieldLength(n int) Option {
+	return func(h *Handlers) {
+		h.maxFieldLength = n
+	}
+}
+
+// ErrCardTooLarge is the error with which cards are rejected when they
+// would need more than one QR code and the SingleQROnly or
+// RejectMultiChunk option is given.
+var ErrCardTooLarge = errors.New("card does not fit in a single QR code; shorten the names, performers, or lot numbers, or issue fewer immunizations")
+
+// SingleQROnly rejects cards which would need more than one QR code with a
+// 413 response code and a CardTooLargeError as the error message, giving
+// how far over the limit the card is and, for cards issued from form data,
+// which fields are longest and how much they must be shortened, rather
+// than splitting them into chunks, for deployments whose verifiers cannot
+// scan chunked cards. With the ProblemDetails option, the fields are listed
+// in the problem's errors with the ReasonCardTooLarge reason. In
+// ProcessCSV, such rows are reported in errors.csv. The size of the card is
+// estimated before it is signed, so oversized cards are never signed or
+// recorded.
+func SingleQROnly() Option {
+	return RejectMultiChunk(true)
+}
+
+// RejectMultiChunk is like SingleQROnly if reject is true, and restores the
+// default of splitting large cards into multiple QR codes if it is false,
+// e.g. so that the policy can be set from configuration.
+func RejectMultiChunk(reject bool) Option {
+	return func(h *Handlers) {
+		h.singleQROnly = reject
+	}
+}
+
+// CardTooLargeError is the error, wrapping ErrCardTooLarge, with which
+// cards are rejected when they would need more than one QR code and the
+// SingleQROnly or RejectMultiChunk option is given.
+type CardTooLargeError struct {
+	// Size is the estimated length of the card's JWS.
+	Size int
+
+	// Fields lists the longest free-text fields of the card's form data,
+	// longest first, and how much each would have to be shortened for the
+	// card to fit. It is empty if the card was not issued from form data.
+	Fields []OversizedField
+}
+
+// OversizedField is a form field which lengthens a card too large to fit
+// in a single QR code, as listed by CardTooLargeError.
+type OversizedField struct {
+	// Field is the name of the form field, e.g. "given_names".
+	Field string
+
+	// Length is the length of the field's value, in characters.
+	Length int
+
+	// ShrinkBy is how many characters would have to be removed from the
+	// field's value, if it were the only one shortened, for the card to
+	// fit, or zero if shortening it alone is not enough.
+	ShrinkBy int
+}
+
+func (e *CardTooLargeError) Error() string {
+	message := fmt.Sprintf("%v (the card would be %d characters long, %d more than fit)",
+		ErrCardTooLarge, e.Size, e.Size-qrcode.MaxSingleChunkSize)
+	if len(e.Fields) == 0 {
+		return message
+	}
+
+	fields := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		if f.ShrinkBy > 0 {
+			fields[i] = fmt.Sprintf("%s (%d characters; shorten by %d)", f.Field, f.Length, f.ShrinkBy)
+		} else {
+			fields[i] = fmt.Sprintf("%s (%d characters)", f.Field, f.Length)
+		}
+	}
+	return message + "; the longest fields are " + strings.Join(fields, ", ")
+}
+
+func (e *CardTooLargeError) Unwrap() error {
+	return ErrCardTooLarge
+}
+
+// cardTooLarge returns a CardTooLargeError for a JWS of the given size.
+func cardTooLarge(size int) error {
+	return &CardTooLargeError{Size: size}
+}
+
+// maxOversizedFields is how many fields a CardTooLargeError lists.
+const maxOversizedFields = 3
+
+// explainTooLarge adds to a CardTooLargeError the longest free-text fields
+// of the FHIR bundle from which the card was issued, and how much each
+// would have to be shortened for the card, as issued with the given
+// payload options, to fit. Other errors are returned unchanged.
+func explainTooLarge(err error, fhirBundle fhirbundle.FHIRBundle, issuer string, opts ...fhirbundle.PayloadOption) error {
+	var tooLarge *CardTooLargeError
+	if !errors.As(err, &tooLarge) {
+		return err
+	}
+
+	type field struct {
+		name  string
+		value string
+		set   func(fb *fhirbundle.FHIRBundle, value string)
+	}
+	fields := []field{
+		{"family_name", fhirBundle.Patient.Name.Family, func(fb *fhirbundle.FHIRBundle, v string) {
+			fb.Patient.Name.Family = v
+		}},
+		{"given_names", strings.Join(fhirBundle.Patient.Name.Givens, " "), func(fb *fhirbundle.FHIRBundle, v string) {
+			fb.Patient.Name.Givens = strings.Fields(v)
+		}},
+	}
+	for i := range fhirBundle.Immunizations {
+		if i >= len(immunizationOrdinals) {
+			break
+		}
+		i := i
+		fields = append(fields,
+			field{immunizationOrdinals[i] + "_immunization_performer", fhirBundle.Immunizations[i].Performer, func(fb *fhirbundle.FHIRBundle, v string) {
+				fb.Immunizations[i].Performer = v
+			}},
+			field{immunizationOrdinals[i] + "_immunization_lot_number", fhirBundle.Immunizations[i].LotNumber, func(fb *fhirbundle.FHIRBundle, v string) {
+				fb.Immunizations[i].LotNumber = v
+			}},
+		)
+	}
+	sort.SliceStable(fields, func(i, j int) bool {
+		return utf8.RuneCountInString(fields[i].value) > utf8.RuneCountInString(fields[j].value)
+	})
+
+	// fits reports whether the card would fit with the given field's value
+	// truncated to n characters.
+	fits := func(f field, n int) bool {
+		fb := fhirBundle
+		fb.Immunizations = append([]fhirbundle.Immunization(nil), fhirBundle.Immunizations...)
+		f.set(&fb, string([]rune(f.value)[:n]))
+		size, err := fhirbundle.EstimateJWSSize(fb, issuer, opts...)
+		return err == nil && size <= qrcode.MaxSingleChunkSize
+	}
+
+	explained := &CardTooLargeError{Size: tooLarge.Size}
+	for _, f := range fields {
+		length := utf8.RuneCountInString(f.value)
+		if length == 0 || len(explained.Fields) == maxOversizedFields {
+			break
+		}
+
+		o := OversizedField{Field: f.name, Length: length}
+		if fits(f, 0) {
+			n := sort.Search(length, func(n int) bool { return !fits(f, n+1) })
+			o.ShrinkBy = length - n
+		}
+		explained.Fields = append(explained.Fields, o)
+	}
+	return explained
+}
+
+// harden wraps the given issuance handler so that the request body is
+// limited to the configured size and form data is parsed and checked for
+// overlong values and invalid UTF-8 before the handler sees it.
+func (h Handlers) harden(handler handlerFunc) handlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) (int, string, bool) {
+		if r.ContentLength > h.maxRequestBytes {
+			return http.StatusRequestEntityTooLarge, "request body too large", false
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, h.maxRequestBytes)
+
+		var err error
+		switch mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType {
+		case "application/x-www-form-urlencoded":
+			err = r.ParseForm()
+		case "multipart/form-data":
+			err = r.ParseMultipartForm(h.maxRequestBytes)
+		default:
+			return handler(w, r)
+		}
+		if err != nil {
+			if tooLarge(err) {
+				return http.StatusRequestEntityTooLarge, "request body too large", false
+			}
+			return http.StatusBadRequest, "invalid form data", false
+		}
+
+		var errs ValidationErrors
+		for field, values := range r.Form {
+			for _, value := range values {
+				if e, ok := h.checkValue(field, value); !ok {
+					errs = append(errs, e)
+					break
+				}
+			}
+		}
+		if len(errs) > 0 {
+			errs.sort()
+			h.validationFailed(r, errs)
+			return http.StatusBadRequest, h.localize(r, errs), false
+		}
+
+		return handler(w, r)
+	}
+}
+
+// checkValue checks that a single form value or CSV cell is valid UTF-8
+// and within the configured length. Draft tokens, which hold whole forms,
+// are only limited by the size of the request.
+func (h Handlers) checkValue(field, value string) (ValidationError, bool) {
+	if !utf8.ValidString(value) {
+		return ValidationError{Field: field, Reason: ReasonInvalidEncoding}, false
+	}
+	if len(value) > h.maxFieldLength && field != DraftTokenField {
+		return ValidationError{Field: field, Reason: ReasonTooLong}, false
+	}
+	return ValidationError{}, true
+}
+
+// tooLarge reports whether the error was caused by a request body
+// exceeding the limit set by MaxRequestBytes.
+func tooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
@@ -0,0 +1,292 @@
+package webhandlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Catalog holds the user-facing validation error messages for a single
+// language.
+type Catalog struct {
+	// Reasons maps each Reason to a message format, in which %s is
+	// replaced by the label of the field which failed validation.
+	Reasons map[Reason]string
+
+	// Fields maps form field names to human-readable labels. Fields
+	// without a label are referred to by their form field name.
+	Fields map[string]string
+
+	// Separator joins the messages of multiple validation errors.
+	Separator string
+}
+
+func (c Catalog) message(e ValidationError) string {
+	label, ok := c.Fields[e.Field]
+	if !ok {
+		label = e.Field
+	}
+
+	format, ok := c.Reasons[e.Reason]
+	if !ok {
+		format, ok = c.Reasons[ReasonInvalid]
+	}
+	if !ok {
+		return e.Error()
+	}
+
+	return fmt.Sprintf(format, label)
+}
+
+// Localize returns the messages of the given validation errors in the
+// catalog's language, joined by the catalog's separator.
+func (c Catalog) Localize(errs ValidationErrors) string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = c.message(err)
+	}
+
+	separator := c.Separator
+	if separator == "" {
+		separator = "; "
+	}
+	return strings.Join(messages, separator)
+}
+
+// Locale sets the language of user-facing validation error messages,
+// e.g. "es", instead of negotiating it from each request's Accept-Language
+// header.
+func Locale(tag string) Option {
+	return func(h *Handlers) {
+		h.locale = strings.ToLower(tag)
+	}
+}
+
+// AddCatalog adds a catalog of user-facing validation error messages for
+// the language with the given tag, e.g. "de" or "pt-br", replacing any
+// built-in catalog for that language. Built-in catalogs are provided for
+// "en", "es", and "fr".
+func AddCatalog(tag string, c Catalog) Option {
+	return func(h *Handlers) {
+		catalogs := make(map[string]Catalog, len(h.catalogs)+1)
+		for t, c := range h.catalogs {
+			catalogs[t] = c
+		}
+		catalogs[strings.ToLower(tag)] = c
+		h.catalogs = catalogs
+	}
+}
+
+// localize returns the user-facing message for an error returned by
+// ParseForm in the language configured by the Locale option or, failing
+// that, the language preferred by the request.
+func (h Handlers) localize(r *http.Request, err error) string {
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		return err.Error()
+	}
+
+	return h.catalog(r).Localize(errs)
+}
+
+// catalog returns the catalog of validation error messages for the
+// request, as returned by languageCatalog, with the labels of fields
+// renamed by the FormFields option.
+func (h Handlers) catalog(r *http.Request) Catalog {
+	return h.relabel(h.languageCatalog(r))
+}
+
+// languageCatalog returns the catalog for the language configured by the
+// Locale option or, failing that, the language preferred by the request.
+func (h Handlers) languageCatalog(r *http.Request) Catalog {
+	if c, ok := h.catalogs[h.locale]; ok {
+		return c
+	}
+
+	for _, tag := range acceptedLanguages(r.Header.Get("Accept-Language")) {
+		if c, ok := h.catalogs[tag]; ok {
+			return c
+		}
+		if i := strings.IndexByte(tag, '-'); i >= 0 {
+			if c, ok := h.catalogs[tag[:i]]; ok {
+				return c
+			}
+		}
+	}
+
+	return h.catalogs["en"]
+}
+
+// acceptedLanguages returns the lowercased language tags of an
+// Accept-Language header in order of preference.
+func acceptedLanguages(header string) []string {
+	type language struct {
+		tag string
+		q   float64
+	}
+
+	var languages []language
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		tag := strings.ToLower(strings.TrimSpace(fields[0]))
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q > 0 {
+			languages = append(languages, language{tag: tag, q: q})
+		}
+	}
+
+	sort.SliceStable(languages, func(i, j int) bool { return languages[i].q > languages[j].q })
+
+	tags := make([]string, len(languages))
+	for i, l := range languages {
+		tags[i] = l.tag
+	}
+	return tags
+}
+
+var defaultCatalogs = map[string]Catalog{
+	"en": {
+		Reasons: map[Reason]string{
+			ReasonMissing:            "%s is required",
+			ReasonInvalid:            "%s is invalid",
+			ReasonInvalidDate:        "%s is not a valid date",
+			ReasonFutureDate:         "%s is in the future",
+			ReasonBeforeBirthDate:    "%s is before the date of birth",
+			ReasonTooEarly:           "%s is earlier than COVID-19 vaccines were available",
+			ReasonInvalidVaccineType: "%s is not a supported vaccine type",
+			ReasonOutOfOrder:         "%s provided while a previous immunization is blank",
+			ReasonTooLong:            "%s is too long",
+			ReasonInvalidEncoding:    "%s contains invalid characters",
+			ReasonCardTooLarge:       "%s is too long for the card to fit in a single QR code",
+			ReasonUnknownPerformer:   "%s is not a known performer",
+			ReasonInvalidLotNumber:   "%s is not a valid lot number",
+		},
+		Fields: map[string]string{
+			"family_name":                      "Family name",
+			"given_names":                      "Given names",
+			"date_of_birth":                    "Date of birth",
+			"first_immunization_performer":     "First immunization performer",
+			"first_immunization_lot_number":    "First immunization lot number",
+			"first_immunization_vaccine_type":  "First immunization vaccine type",
+			"first_immunization_date":          "First immunization date",
+			"second_immunization_performer":    "Second immunization performer",
+			"second_immunization_lot_number":   "Second immunization lot number",
+			"second_immunization_vaccine_type": "Second immunization vaccine type",
+			"second_immunization_date":         "Second immunization date",
+			"third_immunization_performer":     "Third immunization performer",
+			"third_immunization_lot_number":    "Third immunization lot number",
+			"third_immunization_vaccine_type":  "Third immunization vaccine type",
+			"third_immunization_date":          "Third immunization date",
+			"page_size":                        "Page size",
+			"contact_sheet":                    "Contact sheet",
+			"output":                           "Output",
+			"file":                             "File",
+			"identifier":                       "Identifier",
+			"email":                            "Email",
+			PerformerOverrideField:             "Accept performers not in the list",
+			DraftTokenField:                    "Draft token",
+			ExternalIDField:                    "External ID",
+		},
+	},
+	"es": {
+		Reasons: map[Reason]string{
+			ReasonMissing:            "%s es obligatorio",
+			ReasonInvalid:            "%s no es válido",
+			ReasonInvalidDate:        "%s no es una fecha válida",
+			ReasonFutureDate:         "%s está en el futuro",
+			ReasonBeforeBirthDate:    "%s es anterior a la fecha de nacimiento",
+			ReasonTooEarly:           "%s es anterior a la disponibilidad de las vacunas contra la COVID-19",
+			ReasonInvalidVaccineType: "%s no es un tipo de vacuna admitido",
+			ReasonOutOfOrder:         "%s proporcionado mientras una vacunación anterior está en blanco",
+			ReasonTooLong:            "%s es demasiado largo",
+			ReasonInvalidEncoding:    "%s contiene caracteres no válidos",
+			ReasonCardTooLarge:       "%s es demasiado largo para que la tarjeta quepa en un solo código QR",
+			ReasonUnknownPerformer:   "%s no es un centro conocido",
+			ReasonInvalidLotNumber:   "%s no es un número de lote válido",
+		},
+		Fields: map[string]string{
+			"family_name":                      "Apellido",
+			"given_names":                      "Nombre",
+			"date_of_birth":                    "Fecha de nacimiento",
+			"first_immunization_performer":     "Centro de la primera vacunación",
+			"first_immunization_lot_number":    "Lote de la primera vacunación",
+			"first_immunization_vaccine_type":  "Vacuna de la primera vacunación",
+			"first_immunization_date":          "Fecha de la primera vacunación",
+			"second_immunization_performer":    "Centro de la segunda vacunación",
+			"second_immunization_lot_number":   "Lote de la segunda vacunación",
+			"second_immunization_vaccine_type": "Vacuna de la segunda vacunación",
+			"second_immunization_date":         "Fecha de la segunda vacunación",
+			"third_immunization_performer":     "Centro de la tercera vacunación",
+			"third_immunization_lot_number":    "Lote de la tercera vacunación",
+			"third_immunization_vaccine_type":  "Vacuna de la tercera vacunación",
+			"third_immunization_date":          "Fecha de la tercera vacunación",
+			"page_size":                        "Tamaño de página",
+			"contact_sheet":                    "Hoja de contactos",
+			"output":                           "Formato de salida",
+			"file":                             "Archivo",
+			"identifier":                       "Identificador",
+			"email":                            "Correo electrónico",
+			PerformerOverrideField:             "Aceptar centros que no están en la lista",
+			DraftTokenField:                    "Token de borrador",
+			ExternalIDField:                    "ID externo",
+		},
+	},
+	"fr": {
+		Reasons: map[Reason]string{
+			ReasonMissing:            "%s est obligatoire",
+			ReasonInvalid:            "%s n'est pas valide",
+			ReasonInvalidDate:        "%s n'est pas une date valide",
+			ReasonFutureDate:         "%s est dans le futur",
+			ReasonBeforeBirthDate:    "%s est antérieure à la date de naissance",
+			ReasonTooEarly:           "%s est antérieure à la disponibilité des vaccins contre la COVID-19",
+			ReasonInvalidVaccineType: "%s n'est pas un type de vaccin pris en charge",
+			ReasonOutOfOrder:         "%s fourni alors qu'une vaccination précédente est vide",
+			ReasonTooLong:            "%s est trop long",
+			ReasonInvalidEncoding:    "%s contient des caractères non valides",
+			ReasonCardTooLarge:       "%s est trop long pour que la carte tienne dans un seul code QR",
+			ReasonUnknownPerformer:   "%s n'est pas un lieu connu",
+			ReasonInvalidLotNumber:   "%s n'est pas un numéro de lot valide",
+		},
+		Fields: map[string]string{
+			"family_name":                      "Nom de famille",
+			"given_names":                      "Prénoms",
+			"date_of_birth":                    "Date de naissance",
+			"first_immunization_performer":     "Lieu de la première vaccination",
+			"first_immunization_lot_number":    "Lot de la première vaccination",
+			"first_immunization_vaccine_type":  "Vaccin de la première vaccination",
+			"first_immunization_date":          "Date de la première vaccination",
+			"second_immunization_performer":    "Lieu de la deuxième vaccination",
+			"second_immunization_lot_number":   "Lot de la deuxième vaccination",
+			"second_immunization_vaccine_type": "Vaccin de la deuxième vaccination",
+			"second_immunization_date":         "Date de la deuxième vaccination",
+			"third_immunization_performer":     "Lieu de la troisième vaccination",
+			"third_immunization_lot_number":    "Lot de la troisième vaccination",
+			"third_immunization_vaccine_type":  "Vaccin de la troisième vaccination",
+			"third_immunization_date":          "Date de la troisième vaccination",
+			"page_size":                        "Format de page",
+			"contact_sheet":                    "Planche contact",
+			"output":                           "Format de sortie",
+			"file":                             "Fichier",
+			"identifier":                       "Identifiant",
+			"email":                            "Courriel",
+			PerformerOverrideField:             "Accepter des lieux absents de la liste",
+			DraftTokenField:                    "Jeton de brouillon",
+			ExternalIDField:                    "Identifiant externe",
+		},
+	},
+}
@@ -0,0 +1,63 @@
+package webhandlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/verifier"
+)
+
+// IssuerMetadata sets the display metadata, such as the name and logo, of
+// each issuer, by issuer URL, which ServeIssuerMetadata serves alongside
+// the issuer's JWKS so that wallet apps and verifiers, e.g. with
+// verifier.IssuerMetadataCache, can show who issued a card rather than its
+// bare issuer URL. Metadata with no Issuer set is given the URL it is
+// keyed by.
+func IssuerMetadata(metadata map[string]verifier.IssuerMetadata) Option {
+	return func(h *Handlers) {
+		h.metadata = make(map[string]verifier.IssuerMetadata, len(metadata))
+		for issuerURL, m := range metadata {
+			if m.Issuer == "" {
+				m.Issuer = issuerURL
+			}
+			h.metadata[issuerURL] = m
+		}
+	}
+}
+
+// ServeIssuerMetadata writes the metadata, as set by the IssuerMetadata
+// option, of the issuer determined by the request, as JSON, with the same
+// caching and cross-origin headers as the JWKS. It fails with a 404 response
+// code if the issuer has no metadata.
+//
+// If there is an error, this methods returns the HTTP response code,
+// an additional error message if available, and false. If there is no
+// error, it returns 0, the empty string, and true.
+func (h Handlers) ServeIssuerMetadata(w http.ResponseWriter, r *http.Request) (int, string, bool) {
+	r = identify(w, r)
+	issuer, ok := h.resolve(r)
+	if !ok {
+		return http.StatusNotFound, "unknown issuer", false
+	}
+	metadata, ok := h.metadata[issuer.URL]
+	if !ok {
+		return http.StatusNotFound, "no metadata for issuer", false
+	}
+
+	h.setJWKSCORSHeaders(w, r)
+	return h.compressed(func(w http.ResponseWriter, r *http.Request) (int, string, bool) {
+		data, err := json.Marshal(metadata)
+		if err != nil {
+			return h.internalError(r, err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if h.jwksMaxAge >= 0 {
+			w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(h.jwksMaxAge/time.Second)))
+		}
+		w.Write(data)
+		return 0, "", true
+	})(w, r)
+}
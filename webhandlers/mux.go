@@ -0,0 +1,50 @@
+package webhandlers
+
+import "net/http"
+
+// Handler returns an http.Handler serving the issuance, verification, JWKS,
+// issuer metadata, performers, and OpenAPI endpoints, and the form written
+// by ServeForm, at the paths described by OpenAPIJSON, i.e. DefaultRoutes
+// unless the OpenAPIRoutes option is given, for applications with no
+// routing of their own, such as the shc serve command and tests. Failed
+// requests are answered with http.Error.
+func (h Handlers) Handler() http.Handler {
+	routes := h.routes
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var handler func(http.ResponseWriter, *http.Request) (int, string, bool)
+		switch {
+		case r.Method == http.MethodOptions:
+			handler = h.Preflight
+		case r.Method == http.MethodGet && r.URL.Path == routes.JWKS:
+			handler = h.ServeJWKSJSON
+		case r.Method == http.MethodGet && r.URL.Path == routes.IssuerMetadata:
+			handler = h.ServeIssuerMetadata
+		case r.Method == http.MethodGet && r.URL.Path == routes.Performers:
+			handler = h.ServePerformers
+		case r.Method == http.MethodGet && r.URL.Path == routes.Form:
+			handler = h.ServeForm
+		case r.Method == http.MethodGet && r.URL.Path == routes.OpenAPI:
+			handler = func(w http.ResponseWriter, _ *http.Request) (int, string, bool) {
+				return h.OpenAPIJSON(w)
+			}
+		case r.Method == http.MethodPost && r.URL.Path == routes.Form:
+			handler = h.ProcessForm
+		case r.Method == http.MethodPost && r.URL.Path == routes.Preview:
+			handler = h.PreviewForm
+		case r.Method == http.MethodPost && r.URL.Path == routes.Draft:
+			handler = h.DraftForm
+		case r.Method == http.MethodPost && r.URL.Path == routes.CSV:
+			handler = h.ProcessCSV
+		case r.Method == http.MethodPost && r.URL.Path == routes.Bundle:
+			handler = h.ProcessBundle
+		case r.Method == http.MethodPost && r.URL.Path == routes.Verify:
+			handler = h.VerifyQRCodes
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		if responseCode, errorMessage, ok := handler(w, r); !ok {
+			http.Error(w, errorMessage, responseCode)
+		}
+	})
+}
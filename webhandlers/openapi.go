@@ -0,0 +1,694 @@
+package webhandlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/fhirbundle"
+	"github.com/amitkgupta/go-smarthealthcards/v2/verifier"
+)
+
+// Routes holds the paths at which an application serves each of the
+// handlers, for use in the OpenAPI document written by OpenAPIJSON. Empty
+// paths are omitted from the document, as are the Lookup path unless the
+// Patients option is given, the IssuerMetadata path unless the
+// IssuerMetadata option is given, the Performers path unless the
+// Performers option is given, and the Draft path unless the TwoStepIssuance
+// option is given.
+type Routes struct {
+	Form    string
+	Preview string
+	CSV     string
+	Bundle  string
+	Lookup  string
+	JWKS    string
+	OpenAPI string
+
+	// IssuerMetadata is the path of the issuer's display metadata, served
+	// by ServeIssuerMetadata.
+	IssuerMetadata string
+
+	// Verify is the path at which VerifyQRCodes verifies uploaded QR
+	// codes.
+	Verify string
+
+	// Performers is the path of the known performers, served by
+	// ServePerformers.
+	Performers string
+
+	// Draft is the path at which DraftForm validates form data for review
+	// before the card is issued.
+	Draft string
+}
+
+// DefaultRoutes are the paths described by OpenAPIJSON unless the
+// OpenAPIRoutes option is given, and are those used by the example server.
+var DefaultRoutes = Routes{
+	Form:    "/",
+	Preview: "/preview",
+	CSV:     "/batch",
+	Bundle:  "/bundle",
+	Lookup:  "/lookup",
+	JWKS:    "/.well-known/jwks.json",
+	OpenAPI: "/openapi.json",
+
+	IssuerMetadata: verifier.IssuerMetadataPath,
+	Verify:         "/verify",
+	Performers:     "/performers",
+	Draft:          "/draft",
+}
+
+// OpenAPIRoutes sets the paths described by OpenAPIJSON.
+func OpenAPIRoutes(routes Routes) Option {
+	return func(h *Handlers) {
+		h.routes = routes
+	}
+}
+
+// OpenAPIJSON writes an OpenAPI 3 document describing the issuance, JWKS,
+// and other endpoints served by these handlers, including their form fields
+// and error responses, so that client SDKs can be generated from it.
+//
+// If there is an error, this methods returns the HTTP response code,
+// an additional error message if available, and false. If there is no
+// error, it returns 0, the empty string, and true.
+func (h Handlers) OpenAPIJSON(w http.ResponseWriter) (int, string, bool) {
+	routes := h.routes
+	if h.patients == nil {
+		routes.Lookup = ""
+	}
+	if h.metadata == nil {
+		routes.IssuerMetadata = ""
+	}
+	if h.performers == nil {
+		routes.Performers = ""
+	}
+	if h.draftSecret == nil {
+		routes.Draft = ""
+	}
+
+	doc := openAPIDocument(routes)
+	if h.problemDetails {
+		describeProblems(doc)
+	}
+	if len(h.schema) > 0 {
+		h.describeSchema(doc)
+	}
+	if h.outputSink != nil && routes.CSV != "" {
+		describeOutputSink(doc, routes.CSV)
+	}
+
+	if openAPIJSON, err := json.Marshal(doc); err != nil {
+		return http.StatusInternalServerError, "", false
+	} else {
+		h.setCORSHeaders(w, nil)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(openAPIJSON)
+		return 0, "", true
+	}
+}
+
+type object = map[string]interface{}
+
+func openAPIDocument(routes Routes) object {
+	paths := object{}
+
+	if routes.Form != "" {
+		paths[routes.Form] = object{
+			"get": object{
+				"operationId": "getForm",
+				"summary":     "Get an HTML form for issuing a SMART Health Card",
+				"responses": object{
+					"200": object{
+						"description": "The issuance form",
+						"content":     object{"text/html": object{"schema": stringSchema()}},
+					},
+					"404": errorResponse("Unknown issuer"),
+				},
+			},
+			"post": object{
+				"operationId": "issueFromForm",
+				"summary":     "Issue a SMART Health Card from form data",
+				"parameters":  []object{idempotencyKeyParameter()},
+				"requestBody": object{
+					"required": true,
+					"content": object{
+						"application/x-www-form-urlencoded": object{"schema": object{"$ref": "#/components/schemas/IssuanceForm"}},
+						"multipart/form-data":               object{"schema": object{"$ref": "#/components/schemas/IssuanceForm"}},
+					},
+				},
+				"responses": cardResponses(true),
+			},
+		}
+	}
+
+	if routes.Preview != "" {
+		paths[routes.Preview] = object{
+			"post": object{
+				"operationId": "previewForm",
+				"summary":     "Preview the FHIR bundle of a SMART Health Card from form data without issuing it",
+				"requestBody": object{
+					"required": true,
+					"content": object{
+						"application/x-www-form-urlencoded": object{"schema": object{"$ref": "#/components/schemas/IssuanceForm"}},
+						"multipart/form-data":               object{"schema": object{"$ref": "#/components/schemas/IssuanceForm"}},
+					},
+				},
+				"responses": object{
+					"200": object{
+						"description": "The FHIR bundle which would be signed and the estimated size of the card",
+						"content":     object{"application/json": object{"schema": object{"$ref": "#/components/schemas/Preview"}}},
+					},
+					"400": errorResponse("Invalid input; the message lists every invalid field"),
+					"401": errorResponse("Missing or invalid credentials"),
+					"403": errorResponse("The credentials are not allowed to issue cards"),
+					"404": errorResponse("Unknown issuer"),
+					"413": errorResponse("The request body is too large"),
+					"429": tooManyRequestsResponse(),
+				},
+			},
+		}
+	}
+
+	if routes.Draft != "" {
+		paths[routes.Draft] = object{
+			"post": object{
+				"operationId": "draftFromForm",
+				"summary":     "Validate form data and return a summary of the card for review, with a draft token for which the card is issued",
+				"requestBody": object{
+					"required": true,
+					"content": object{
+						"application/x-www-form-urlencoded": object{"schema": object{"$ref": "#/components/schemas/IssuanceForm"}},
+						"multipart/form-data":               object{"schema": object{"$ref": "#/components/schemas/IssuanceForm"}},
+					},
+				},
+				"responses": object{
+					"200": object{
+						"description": "The draft, or a page for reviewing it if the output is html",
+						"content": object{
+							"application/json": object{"schema": object{"$ref": "#/components/schemas/Draft"}},
+							"text/html":        object{"schema": stringSchema()},
+						},
+					},
+					"400": errorResponse("Invalid input; the message lists every invalid field"),
+					"401": errorResponse("Missing or invalid credentials"),
+					"403": errorResponse("The credentials are not allowed to issue cards"),
+					"404": errorResponse("Unknown issuer"),
+					"413": errorResponse("The request body is too large"),
+					"429": tooManyRequestsResponse(),
+				},
+			},
+		}
+	}
+
+	if routes.CSV != "" {
+		paths[routes.CSV] = object{
+			"post": object{
+				"operationId": "issueFromCSV",
+				"summary":     "Issue a SMART Health Card for each row of a CSV document",
+				"parameters": []object{
+					{
+						"name":   "output",
+						"in":     "query",
+						"schema": object{"type": "string", "enum": []string{"png", "smart-health-card"}, "default": "png"},
+					},
+					{
+						"name":        "contact_sheet",
+						"in":          "query",
+						"description": "Whether to include a cards.pdf contact sheet with one card per page for printing",
+						"schema":      object{"type": "boolean", "default": false},
+					},
+				},
+				"requestBody": object{
+					"required": true,
+					"content": object{
+						"text/csv": object{"schema": object{"type": "string"}},
+						"multipart/form-data": object{"schema": object{
+							"type":       "object",
+							"required":   []string{"file"},
+							"properties": object{"file": object{"type": "string", "format": "binary"}},
+						}},
+					},
+				},
+				"responses": object{
+					"200": object{
+						"description": "A ZIP archive of cards and an errors.csv report",
+						"content":     object{"application/zip": object{"schema": binarySchema()}},
+					},
+					"400": errorResponse("Invalid request"),
+					"401": errorResponse("Missing or invalid credentials"),
+					"403": errorResponse("The credentials are not allowed to issue cards"),
+					"404": errorResponse("Unknown issuer"),
+					"413": errorResponse("The request body is too large"),
+					"429": tooManyRequestsResponse(),
+				},
+			},
+		}
+	}
+
+	if routes.Bundle != "" {
+		paths[routes.Bundle] = object{
+			"post": object{
+				"operationId": "issueFromBundle",
+				"summary":     "Issue a SMART Health Card from an FHIR bundle",
+				"parameters":  []object{idempotencyKeyParameter()},
+				"requestBody": object{
+					"required": true,
+					"content": object{
+						"application/fhir+json": object{"schema": object{"type": "object"}},
+						"application/json":      object{"schema": object{"type": "object"}},
+					},
+				},
+				"responses": cardResponses(false),
+			},
+		}
+	}
+
+	if routes.Lookup != "" {
+		paths[routes.Lookup] = object{
+			"post": object{
+				"operationId": "issueFromLookup",
+				"summary":     "Issue a SMART Health Card for a patient looked up in a registry",
+				"parameters":  []object{idempotencyKeyParameter()},
+				"requestBody": object{
+					"required": true,
+					"content": object{
+						"application/x-www-form-urlencoded": object{"schema": object{
+							"type": "object",
+							"properties": object{
+								"identifier":    stringSchema(),
+								"family_name":   stringSchema(),
+								"given_names":   stringSchema(),
+								"date_of_birth": stringSchema(),
+								"output":        outputSchema(),
+								"email":         object{"type": "string", "format": "email"},
+							},
+						}},
+					},
+				},
+				"responses": cardResponses(true),
+			},
+		}
+	}
+
+	if routes.JWKS != "" {
+		paths[routes.JWKS] = object{
+			"get": object{
+				"operationId": "getJWKS",
+				"summary":     "Get the issuer's JSON Web Key Set",
+				"responses": object{
+					"200": object{
+						"description": "The issuer's JSON Web Key Set",
+						"content":     object{"application/json": object{"schema": object{"$ref": "#/components/schemas/JWKS"}}},
+					},
+					"404": errorResponse("Unknown issuer"),
+				},
+			},
+		}
+	}
+
+	if routes.Verify != "" {
+		paths[routes.Verify] = object{
+			"post": object{
+				"operationId": "verifyQRCodes",
+				"summary":     "Verify a SMART Health Card from images of its QR codes",
+				"requestBody": object{
+					"required": true,
+					"content": object{
+						"multipart/form-data": object{"schema": object{
+							"type":                 "object",
+							"additionalProperties": object{"type": "array", "items": binarySchema()},
+						}},
+					},
+				},
+				"responses": object{
+					"200": object{
+						"description": "The contents of the verified card",
+						"content":     object{"application/json": object{"schema": object{"$ref": "#/components/schemas/VerifiedCard"}}},
+					},
+					"400": errorResponse("No images, or images which are not the QR codes of a well-formed card"),
+					"401": errorResponse("Missing or invalid credentials"),
+					"413": errorResponse("The request body is too large"),
+					"422": errorResponse("The card's signature does not verify, or the card is rejected by the verification policy"),
+					"429": tooManyRequestsResponse(),
+				},
+			},
+		}
+	}
+
+	if routes.IssuerMetadata != "" {
+		paths[routes.IssuerMetadata] = object{
+			"get": object{
+				"operationId": "getIssuerMetadata",
+				"summary":     "Get the issuer's display metadata",
+				"responses": object{
+					"200": object{
+						"description": "The issuer's display metadata",
+						"content":     object{"application/json": object{"schema": object{"$ref": "#/components/schemas/IssuerMetadata"}}},
+					},
+					"404": errorResponse("Unknown issuer, or no metadata for the issuer"),
+				},
+			},
+		}
+	}
+
+	if routes.Performers != "" {
+		paths[routes.Performers] = object{
+			"get": object{
+				"operationId": "getPerformers",
+				"summary":     "Get the known immunization performers, for autocompletion",
+				"parameters": []object{
+					{
+						"name":        "q",
+						"in":          "query",
+						"description": "Only return performers containing this text, ignoring case",
+						"schema":      stringSchema(),
+					},
+				},
+				"responses": object{
+					"200": object{
+						"description": "The known performers, in alphabetical order",
+						"content":     object{"application/json": object{"schema": object{"type": "array", "items": stringSchema()}}},
+					},
+					"404": errorResponse("Unknown issuer, or no known performers"),
+				},
+			},
+		}
+	}
+
+	if routes.OpenAPI != "" {
+		paths[routes.OpenAPI] = object{
+			"get": object{
+				"operationId": "getOpenAPI",
+				"summary":     "Get this OpenAPI document",
+				"responses": object{
+					"200": object{
+						"description": "This OpenAPI document",
+						"content":     object{"application/json": object{"schema": object{"type": "object"}}},
+					},
+				},
+			},
+		}
+	}
+
+	formProperties := object{
+		"family_name": stringSchema(),
+		"given_names": object{
+			"type":        "string",
+			"description": "The given names, separated by whitespace or the configured delimiter; required unless given_name is given",
+		},
+		"given_name": object{
+			"type":        "array",
+			"items":       stringSchema(),
+			"description": "The given names in order, one per repeated field, in place of given_names",
+		},
+		"date_of_birth": dateSchema(),
+		"output":        outputSchema(),
+		"page_size":     object{"type": "string", "enum": []string{"letter", "wallet"}, "default": "letter"},
+		"email":         object{"type": "string", "format": "email"},
+		DraftTokenField: object{
+			"type":        "string",
+			"description": "A draft token returned for review, in place of the other fields, if two-step issuance is enabled",
+		},
+		PerformerOverrideField: object{
+			"type":        "string",
+			"enum":        []string{"true", "on"},
+			"description": "Accept performers which are not among the known performers",
+		},
+	}
+	required := []string{"family_name", "date_of_birth"}
+	for i, ordinal := range immunizationOrdinals {
+		formProperties[ordinal+"_immunization_performer"] = stringSchema()
+		formProperties[ordinal+"_immunization_lot_number"] = stringSchema()
+		formProperties[ordinal+"_immunization_vaccine_type"] = object{"$ref": "#/components/schemas/VaccineType"}
+		formProperties[ordinal+"_immunization_date"] = dateSchema()
+		if i == 0 {
+			required = append(required,
+				ordinal+"_immunization_performer",
+				ordinal+"_immunization_lot_number",
+				ordinal+"_immunization_vaccine_type",
+				ordinal+"_immunization_date",
+			)
+		}
+	}
+
+	reasons := []Reason{
+		ReasonMissing, ReasonInvalid, ReasonInvalidDate, ReasonFutureDate, ReasonBeforeBirthDate,
+		ReasonTooEarly, ReasonInvalidVaccineType, ReasonOutOfOrder, ReasonTooLong, ReasonInvalidEncoding,
+		ReasonCardTooLarge, ReasonUnknownPerformer, ReasonInvalidLotNumber,
+	}
+
+	return object{
+		"openapi": "3.0.3",
+		"info": object{
+			"title":       "SMART Health Cards issuer",
+			"description": "Issues SMART Health Card QR codes for COVID-19 immunizations. See https://spec.smarthealth.cards.",
+			"version":     "2",
+		},
+		"paths": paths,
+		"components": object{
+			"schemas": object{
+				"IssuanceForm": object{
+					"type":       "object",
+					"required":   required,
+					"properties": formProperties,
+				},
+				"VaccineType": object{
+					"type": "string",
+					"enum": fhirbundle.VaccineTypes(),
+				},
+				"ValidationReason": object{
+					"type":        "string",
+					"description": "Reason a form field failed validation.",
+					"enum":        reasons,
+				},
+				"Draft": object{
+					"type":     "object",
+					"required": []string{"draftToken", "expiresAt", "summary", "fhirBundle"},
+					"properties": object{
+						"draftToken": stringSchema(),
+						"expiresAt":  object{"type": "string", "format": "date-time"},
+						"summary":    stringSchema(),
+						"fhirBundle": object{"type": "object"},
+					},
+				},
+				"Preview": object{
+					"type":     "object",
+					"required": []string{"fhirBundle", "estimatedJWSSize", "estimatedChunks"},
+					"properties": object{
+						"fhirBundle":       object{"type": "object"},
+						"estimatedJWSSize": object{"type": "integer"},
+						"estimatedChunks":  object{"type": "integer"},
+					},
+				},
+				"VerifiedCard": object{
+					"type":     "object",
+					"required": []string{"iss", "kid", "nbf", "types", "fhirBundle", "cardHash"},
+					"properties": object{
+						"iss":        stringSchema(),
+						"kid":        stringSchema(),
+						"nbf":        object{"type": "string", "format": "date-time"},
+						"exp":        object{"type": "string", "format": "date-time"},
+						"types":      object{"type": "array", "items": stringSchema()},
+						"fhirBundle": object{"type": "object"},
+						"cardHash":   stringSchema(),
+						"certificates": object{
+							"type": "array",
+							"items": object{
+								"type":     "object",
+								"required": []string{"subject", "issuer", "notAfter"},
+								"properties": object{
+									"subject":  stringSchema(),
+									"issuer":   stringSchema(),
+									"notAfter": object{"type": "string", "format": "date-time"},
+								},
+							},
+						},
+					},
+				},
+				"IssuerMetadata": object{
+					"type":     "object",
+					"required": []string{"iss", "name"},
+					"properties": object{
+						"iss":      stringSchema(),
+						"name":     stringSchema(),
+						"website":  stringSchema(),
+						"logo_uri": stringSchema(),
+						"contact":  stringSchema(),
+					},
+				},
+				"JWKS": object{
+					"type":     "object",
+					"required": []string{"keys"},
+					"properties": object{
+						"keys": object{
+							"type": "array",
+							"items": object{
+								"type": "object",
+								"properties": object{
+									"kty": stringSchema(),
+									"kid": stringSchema(),
+									"use": stringSchema(),
+									"alg": stringSchema(),
+									"crv": stringSchema(),
+									"x":   stringSchema(),
+									"y":   stringSchema(),
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func cardResponses(withOutputModes bool) object {
+	content := object{
+		"image/png":       object{"schema": binarySchema()},
+		"application/zip": object{"schema": binarySchema()},
+	}
+	if withOutputModes {
+		content["application/pdf"] = object{"schema": binarySchema()}
+		content["text/html"] = object{"schema": stringSchema()}
+		content["text/plain"] = object{"schema": stringSchema()}
+		content["application/smart-health-card"] = object{"schema": object{"type": "object"}}
+	}
+
+	return object{
+		"200": object{
+			"description": "The QR code of the card, a ZIP archive of multiple QR codes, or the requested output format",
+			"headers": object{
+				CardHashHeader: object{
+					"description": "The hex-encoded SHA-256 hash of the card's JWS",
+					"schema":      stringSchema(),
+				},
+			},
+			"content": content,
+		},
+		"400": errorResponse("Invalid input; the message lists every invalid field"),
+		"401": errorResponse("Missing or invalid credentials"),
+		"403": errorResponse("The credentials are not allowed to issue cards"),
+		"404": errorResponse("Unknown issuer or patient"),
+		"413": errorResponse("The request body is too large, or the card does not fit in a single QR code and only single QR codes are issued"),
+		"422": errorResponse("The idempotency key was already used to request a different card"),
+		"429": tooManyRequestsResponse(),
+		"503": errorResponse("The request was cancelled or timed out"),
+	}
+}
+
+// describeProblems changes the error responses of the issuance operations
+// of the given document to problem details, as written when the
+// ProblemDetails option is given.
+func describeProblems(doc object) {
+	for _, path := range doc["paths"].(object) {
+		operation, ok := path.(object)["post"].(object)
+		if !ok {
+			continue
+		}
+		for code, response := range operation["responses"].(object) {
+			if code >= "400" {
+				response.(object)["content"] = object{
+					"application/problem+json": object{"schema": object{"$ref": "#/components/schemas/Problem"}},
+				}
+			}
+		}
+	}
+
+	doc["components"].(object)["schemas"].(object)["Problem"] = object{
+		"type":     "object",
+		"required": []string{"type", "title", "status"},
+		"properties": object{
+			"type":   stringSchema(),
+			"title":  stringSchema(),
+			"status": object{"type": "integer"},
+			"detail": stringSchema(),
+			"errors": object{
+				"type": "array",
+				"items": object{
+					"type":     "object",
+					"required": []string{"field", "reason", "message"},
+					"properties": object{
+						"field":   stringSchema(),
+						"reason":  object{"$ref": "#/components/schemas/ValidationReason"},
+						"message": stringSchema(),
+						"shrinkBy": object{
+							"type":        "integer",
+							"description": "For the card_too_large reason, how many characters the field must be shortened by for the card to fit in a single QR code",
+						},
+					},
+				},
+			},
+			"requestId": stringSchema(),
+		},
+	}
+}
+
+// describeSchema renames the fields of the issuance form, and removes
+// optional fields from those required, as configured by the FormFields
+// option.
+func (h Handlers) describeSchema(doc object) {
+	form := doc["components"].(object)["schemas"].(object)["IssuanceForm"].(object)
+
+	properties := object{}
+	for field, schema := range form["properties"].(object) {
+		properties[h.fieldName(field)] = schema
+	}
+	form["properties"] = properties
+
+	var required []string
+	for _, field := range form["required"].([]string) {
+		if !h.optional(field) {
+			required = append(required, h.fieldName(field))
+		}
+	}
+	form["required"] = required
+}
+
+// describeOutputSink describes the response of the CSV batch operation as
+// written when the OutputSink option is given.
+func describeOutputSink(doc object, path string) {
+	operation := doc["paths"].(object)[path].(object)["post"].(object)
+	operation["description"] = "Each row must have a unique " + ExternalIDField + " column, by which the files of its card are named in object storage."
+	operation["responses"].(object)["200"].(object)["description"] = "A ZIP archive of a manifest.csv listing the files written to object storage and an errors.csv report"
+}
+
+// idempotencyKeyParameter describes the Idempotency-Key header of the
+// operations issuing a single card.
+func idempotencyKeyParameter() object {
+	return object{
+		"name":        IdempotencyKeyHeader,
+		"in":          "header",
+		"description": "A key unique to the requested card, so that retrying the request returns the same card",
+		"schema":      object{"type": "string", "maxLength": MaxIdempotencyKeyLength},
+	}
+}
+
+func errorResponse(description string) object {
+	return object{
+		"description": description,
+		"content":     object{"text/plain": object{"schema": stringSchema()}},
+	}
+}
+
+func tooManyRequestsResponse() object {
+	response := errorResponse("Rate limit exceeded; retry after the number of seconds given by the Retry-After header")
+	response["headers"] = object{"Retry-After": object{"schema": object{"type": "integer"}}}
+	return response
+}
+
+func stringSchema() object {
+	return object{"type": "string"}
+}
+
+func dateSchema() object {
+	return object{"type": "string", "example": "2021-06-01"}
+}
+
+func binarySchema() object {
+	return object{"type": "string", "format": "binary"}
+}
+
+func outputSchema() object {
+	return object{"type": "string", "enum": []string{"png", "pdf", "html", "jws", "smart-health-card"}, "default": "png"}
+}
@@ -0,0 +1,184 @@
+package webhandlers
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/fhirbundle"
+	"github.com/amitkgupta/go-smarthealthcards/v2/jws"
+	"github.com/amitkgupta/go-smarthealthcards/v2/qrcode"
+)
+
+// Option customizes the behavior of Handlers; see New.
+type Option func(*Handlers)
+
+// DateFormats sets the layouts, as understood by time.Parse, accepted for
+// the birth date and immunization dates in form data. Layouts are tried in
+// order and the first which parses the value is used. The default accepts
+// only "2006-01-02".
+//
+// For example, DateFormats("2006-01-02", "01/02/2006") additionally accepts
+// US-style MM/DD/YYYY dates, while DateFormats("2006-01-02", "02-01-2006")
+// additionally accepts DD-MM-YYYY dates.
+func DateFormats(layouts ...string) Option {
+	return func(h *Handlers) {
+		h.dateLayouts = layouts
+	}
+}
+
+// GivenNamesDelimiter sets the delimiter on which the "given_names" form
+// field and CSV column are split into given names, e.g. "," for forms asking
+// for "Mary Ann, Louise", in place of whitespace, so that multi-word given
+// names are kept whole. Repeated "given_name" fields, one per given name,
+// are accepted regardless.
+func GivenNamesDelimiter(delimiter string) Option {
+	return func(h *Handlers) {
+		h.givenNamesDelimiter = delimiter
+	}
+}
+
+// LotNumberValidator reports whether the given lot number is plausible for
+// a vaccine of the given type.
+type LotNumberValidator func(lotNumber string, vaccineType fhirbundle.VaccineType) bool
+
+// LotNumbers sets a function checking each lot number in form data and CSV
+// rows, e.g. against a manufacturer's lot format, so that obviously invalid
+// lot numbers, such as "000000", fail validation with
+// ReasonInvalidLotNumber rather than being signed into cards which cannot
+// be changed once issued. Blank lot numbers are not checked.
+func LotNumbers(valid LotNumberValidator) Option {
+	return func(h *Handlers) {
+		h.validLotNumber = valid
+	}
+}
+
+// LotNumberPattern is like LotNumbers, accepting only lot numbers matching
+// the given regular expression, e.g. `^[A-Z0-9-]{4,20}$`, for any vaccine
+// type. The expression should be anchored to match whole lot numbers.
+func LotNumberPattern(pattern *regexp.Regexp) Option {
+	return LotNumbers(func(lotNumber string, _ fhirbundle.VaccineType) bool {
+		return pattern.MatchString(lotNumber)
+	})
+}
+
+// EarliestImmunizationDate sets the earliest date accepted for an
+// immunization. The default is December 1, 2020, shortly before the first
+// COVID-19 vaccines were authorized; the zero time disables the check.
+func EarliestImmunizationDate(t time.Time) Option {
+	return func(h *Handlers) {
+		h.earliestImmunizationDate = t
+	}
+}
+
+// Clock sets the function returning the current time, in place of
+// time.Now, which the handlers use as the issuance time of cards, i.e.
+// their "nbf" value and the time recorded for them, and to reject future
+// dates, so that tests and replayed issuances control the timestamp.
+func Clock(now func() time.Time) Option {
+	return func(h *Handlers) {
+		h.now = now
+	}
+}
+
+// DeterministicSignatures signs cards as with jws.Deterministic, so that,
+// along with Clock, issuing the same data always yields the same card, e.g.
+// for golden-file tests.
+func DeterministicSignatures() Option {
+	return func(h *Handlers) {
+		h.deterministic = true
+	}
+}
+
+// NormalizeNames normalizes patients' names in the cards issued from form
+// data, CSV rows, and patient records, as with fhirbundle.NormalizeNames or,
+// if transliterate is true, fhirbundle.TransliterateNames, for verifier
+// apps which fail to match cards to IDs whose names are encoded
+// differently. Cards issued from FHIR bundles are signed as given.
+func NormalizeNames(transliterate bool) Option {
+	return func(h *Handlers) {
+		if transliterate {
+			h.payloadOpts = []fhirbundle.PayloadOption{fhirbundle.TransliterateNames()}
+		} else {
+			h.payloadOpts = []fhirbundle.PayloadOption{fhirbundle.NormalizeNames()}
+		}
+	}
+}
+
+// payloadOptions returns the options with which to construct the JWS
+// payload of a card issued at the time returned by now.
+func (h Handlers) payloadOptions(now func() time.Time) []fhirbundle.PayloadOption {
+	return append([]fhirbundle.PayloadOption{fhirbundle.WithClock(now)}, h.payloadOpts...)
+}
+
+// DefaultJWKSMaxAge is how long clients may cache the JWKS unless the
+// JWKSMaxAge option is given.
+const DefaultJWKSMaxAge = time.Hour
+
+// JWKSMaxAge sets how long clients, such as verifiers and wallet apps, may
+// cache the JWKS before checking for changes, as the max-age of its
+// Cache-Control header. Shorten it ahead of rotating keys with the keyring
+// so that new keys are picked up promptly. A negative duration omits the
+// Cache-Control header.
+func JWKSMaxAge(d time.Duration) Option {
+	return func(h *Handlers) {
+		h.jwksMaxAge = d
+	}
+}
+
+// LabelQRCodes labels each QR code PNG written by the handlers, on its own
+// or in a ZIP archive, with the patient's name and birth date and, for
+// cards needing multiple QR codes, which part of the card it is, as
+// described by qrcode.Options.Label, so that cards printed together are
+// not mixed up.
+func LabelQRCodes() Option {
+	return func(h *Handlers) {
+		h.labelQRCodes = true
+	}
+}
+
+// SelfTestKeys makes New, NewWithKeyring, and NewMultiIssuer check each
+// signing key with jws.SelfTest, and panic if it fails, so that a
+// misconfigured key fails fast when the application starts rather than at
+// the first patient's request.
+func SelfTestKeys() Option {
+	return func(h *Handlers) {
+		h.selfTestKeys = true
+	}
+}
+
+// selfTest checks the signing key of the given issuer as described by
+// SelfTestKeys.
+func (h Handlers) selfTest(issuer string, key *ecdsa.PrivateKey) {
+	if !h.selfTestKeys {
+		return
+	}
+	if err := jws.SelfTest(key); err != nil {
+		panic(fmt.Sprintf("webhandlers: signing key of %s: %v", issuer, err))
+	}
+}
+
+// QRStyle renders each QR code PNG written by the handlers, on its own or
+// in a ZIP archive, in the given style, e.g. in an issuer's colors with its
+// logo; the style should have been checked with its Validate method.
+func QRStyle(s qrcode.Style) Option {
+	return func(h *Handlers) {
+		h.qrStyle = s
+	}
+}
+
+// qrOptions returns the options with which to render the QR code PNGs of
+// a card issued to the given patient.
+func (h Handlers) qrOptions(p fhirbundle.Patient) qrcode.Options {
+	if !h.labelQRCodes {
+		return qrcode.Options{Style: h.qrStyle}
+	}
+
+	label := strings.Join(append(append([]string{}, p.Name.Givens...), p.Name.Family), " ")
+	if !p.BirthDate.IsZero() {
+		label += ", " + p.BirthDate.Format("2006-01-02")
+	}
+	return qrcode.Options{Label: strings.TrimSpace(label), Style: h.qrStyle}
+}
@@ -0,0 +1,113 @@
+package webhandlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/fhirbundle"
+)
+
+// ErrPatientNotFound should be returned by a PatientSource when no patient
+// matches the query.
+var ErrPatientNotFound = errors.New("patient not found")
+
+// PatientQuery identifies a patient to look up in a PatientSource, either
+// by an identifier such as a medical record number, or by name and birth
+// date.
+type PatientQuery struct {
+	Identifier string
+	FamilyName string
+	GivenNames []string
+	BirthDate  time.Time
+}
+
+// PatientSource looks up the immunization records of a patient, e.g. in a
+// state immunization information system, a SQL database, or an EHR. For
+// example, a PatientSourceFunc wrapping a smartonfhir.Client can look up
+// patients by identifier.
+type PatientSource interface {
+	// LookupPatient returns the core relevant data for an FHIR bundle
+	// representing the patient's COVID-19 immunizations, or
+	// ErrPatientNotFound if no patient matches the query.
+	LookupPatient(ctx context.Context, q PatientQuery) (fhirbundle.FHIRBundle, error)
+}
+
+// PatientSourceFunc adapts a function to a PatientSource.
+type PatientSourceFunc func(ctx context.Context, q PatientQuery) (fhirbundle.FHIRBundle, error)
+
+// LookupPatient calls f(ctx, q).
+func (f PatientSourceFunc) LookupPatient(ctx context.Context, q PatientQuery) (fhirbundle.FHIRBundle, error) {
+	return f(ctx, q)
+}
+
+// Patients sets the source in which ProcessLookup looks up patients.
+func Patients(source PatientSource) Option {
+	return func(h *Handlers) {
+		h.patients = source
+	}
+}
+
+// ProcessLookup expects the request to provide form data identifying a
+// patient, either by an "identifier" value or by "family_name",
+// "given_names", and "date_of_birth" values, looks up the patient's
+// immunizations in the PatientSource configured with the Patients option,
+// and issues a SMART Health Card in the same way as ProcessForm.
+//
+// If there is an error, this methods returns the HTTP response code,
+// an additional error message if available, and false. If there is no
+// error, it returns 0, the empty string, and true.
+func (h Handlers) ProcessLookup(w http.ResponseWriter, r *http.Request) (int, string, bool) {
+	return h.instrument(w, r, h.processLookup)
+}
+
+func (h Handlers) processLookup(w http.ResponseWriter, r *http.Request) (int, string, bool) {
+	if h.patients == nil {
+		return http.StatusNotImplemented, "patient lookup is not configured", false
+	}
+
+	issuer, ok := h.resolve(r)
+	if !ok {
+		return http.StatusNotFound, "unknown issuer", false
+	}
+
+	q := PatientQuery{Identifier: strings.TrimSpace(r.PostFormValue("identifier"))}
+	if q.Identifier == "" {
+		var errs ValidationErrors
+
+		q.FamilyName = strings.TrimSpace(r.PostFormValue(h.fieldName("family_name")))
+		if q.FamilyName == "" {
+			errs = append(errs, ValidationError{Field: h.fieldName("family_name"), Reason: ReasonMissing})
+		}
+
+		q.GivenNames = h.givenNames(r.PostForm[h.fieldName("given_name")], r.PostFormValue(h.fieldName("given_names")))
+		if len(q.GivenNames) == 0 {
+			errs = append(errs, ValidationError{Field: h.fieldName("given_names"), Reason: ReasonMissing})
+		}
+
+		birthDateString := strings.TrimSpace(r.PostFormValue(h.fieldName("date_of_birth")))
+		if birthDateString == "" {
+			errs = append(errs, ValidationError{Field: h.fieldName("date_of_birth"), Reason: ReasonMissing})
+		} else if birthDate, err := h.parseDate(birthDateString); err != nil {
+			errs = append(errs, ValidationError{Field: h.fieldName("date_of_birth"), Reason: ReasonInvalidDate})
+		} else {
+			q.BirthDate = birthDate
+		}
+
+		if len(errs) > 0 {
+			h.validationFailed(r, errs)
+			return http.StatusBadRequest, h.localize(r, errs), false
+		}
+	}
+
+	fhirBundle, err := h.patients.LookupPatient(r.Context(), q)
+	if errors.Is(err, ErrPatientNotFound) {
+		return http.StatusNotFound, ErrPatientNotFound.Error(), false
+	} else if err != nil {
+		return h.internalError(r, err)
+	}
+
+	return h.issue(w, r, issuer, fhirBundle)
+}
@@ -0,0 +1,112 @@
+package webhandlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// PerformerOverrideField is the form field, or CSV column, which, when set
+// to "true" or "on", e.g. by a checkbox, accepts immunization performers
+// which are not among those set by the Performers option, e.g. for a new
+// clinic site not yet added to the list.
+const PerformerOverrideField = "performer_override"
+
+// Performers sets the known performers of immunizations, e.g. the names of
+// a health system's clinic sites, which ServePerformers serves for the
+// autocompletion of the performer fields of issuance forms, and which the
+// form served by ServeForm suggests. Submitted performers must then be one
+// of them, ignoring case and extra whitespace, and are replaced by their
+// spelling in the list, so that typos are not signed into cards; others
+// fail validation with ReasonUnknownPerformer unless the
+// PerformerOverrideField is set.
+func Performers(performers []string) Option {
+	return func(h *Handlers) {
+		h.performers = make([]string, 0, len(performers))
+		seen := make(map[string]bool, len(performers))
+		for _, p := range performers {
+			p = strings.Join(strings.Fields(p), " ")
+			if p == "" || seen[performerKey(p)] {
+				continue
+			}
+			seen[performerKey(p)] = true
+			h.performers = append(h.performers, p)
+		}
+		sort.Strings(h.performers)
+	}
+}
+
+// performerKey returns the form of a performer in which it is compared
+// with the known performers.
+func performerKey(performer string) string {
+	return strings.ToLower(strings.Join(strings.Fields(performer), " "))
+}
+
+// knownPerformer returns the known performer matching the given one, and
+// whether there is one. Any performer is known if the Performers option is
+// not given.
+func (h Handlers) knownPerformer(performer string) (string, bool) {
+	if h.performers == nil {
+		return performer, true
+	}
+
+	key := performerKey(performer)
+	for _, p := range h.performers {
+		if performerKey(p) == key {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// overridesPerformers reports whether the given value of the
+// PerformerOverrideField accepts unknown performers.
+func overridesPerformers(value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "true", "on":
+		return true
+	}
+	return false
+}
+
+// ServePerformers writes the known performers set by the Performers option
+// as a JSON array of strings, for the autocompletion of the performer
+// fields of issuance forms. If the "q" query parameter is given, only
+// performers containing it, ignoring case, are written. It fails with a 404
+// response code if the Performers option is not given.
+//
+// If there is an error, this methods returns the HTTP response code,
+// an additional error message if available, and false. If there is no
+// error, it returns 0, the empty string, and true.
+func (h Handlers) ServePerformers(w http.ResponseWriter, r *http.Request) (int, string, bool) {
+	r = identify(w, r)
+	if _, ok := h.resolve(r); !ok {
+		return http.StatusNotFound, "unknown issuer", false
+	}
+	if h.performers == nil {
+		return http.StatusNotFound, "no performers", false
+	}
+
+	h.setCORSHeaders(w, r)
+	return h.compressed(func(w http.ResponseWriter, r *http.Request) (int, string, bool) {
+		performers := h.performers
+		if q := performerKey(r.URL.Query().Get("q")); q != "" {
+			performers = []string{}
+			for _, p := range h.performers {
+				if strings.Contains(performerKey(p), q) {
+					performers = append(performers, p)
+				}
+			}
+		}
+
+		data, err := json.Marshal(performers)
+		if err != nil {
+			return h.internalError(r, err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+		return 0, "", true
+	})(w, r)
+}
@@ -0,0 +1,66 @@
+package webhandlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/fhirbundle"
+	"github.com/amitkgupta/go-smarthealthcards/v2/qrcode"
+)
+
+// Preview is the JSON document written by PreviewForm.
+type Preview struct {
+	// FHIRBundle is the FHIR bundle which would be signed.
+	FHIRBundle fhirbundle.FHIRBundle `json:"fhirBundle"`
+
+	// EstimatedJWSSize is the estimated length of the card's JWS.
+	EstimatedJWSSize int `json:"estimatedJWSSize"`
+
+	// EstimatedChunks is the estimated number of QR codes needed to
+	// represent the card.
+	EstimatedChunks int `json:"estimatedChunks"`
+}
+
+// PreviewForm expects the same form data as ProcessForm, and parses and
+// validates it in the same way, but rather than signing a card it writes a
+// Preview of the FHIR bundle that would be signed and the number of QR
+// codes it would need, so that the data can be checked before the card is
+// issued.
+//
+// If there is an error, this methods returns the HTTP response code,
+// an additional error message if available, and false. If there is no
+// error, it returns 0, the empty string, and true.
+func (h Handlers) PreviewForm(w http.ResponseWriter, r *http.Request) (int, string, bool) {
+	return h.guard(h.previewForm)(w, r)
+}
+
+func (h Handlers) previewForm(w http.ResponseWriter, r *http.Request) (int, string, bool) {
+	issuer, ok := h.resolve(r)
+	if !ok {
+		return http.StatusNotFound, "unknown issuer", false
+	}
+
+	fhirBundle, err := h.ParseForm(r)
+	if err != nil {
+		h.validationFailed(r, err)
+		return http.StatusBadRequest, h.localize(r, err), false
+	}
+
+	size, err := fhirbundle.EstimateJWSSize(fhirBundle, issuer.URL, h.payloadOptions(h.now)...)
+	if err != nil {
+		return h.internalError(r, err)
+	}
+
+	previewJSON, err := json.Marshal(Preview{
+		FHIRBundle:       fhirBundle,
+		EstimatedJWSSize: size,
+		EstimatedChunks:  qrcode.ChunkCountWithOptions(size, h.qrOptions(fhirBundle.Patient)),
+	})
+	if err != nil {
+		return h.internalError(r, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(previewJSON)
+	return 0, "", true
+}
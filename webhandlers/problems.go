@@ -0,0 +1,136 @@
+package webhandlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// Problem is an RFC 7807 problem details object, written as the body of
+// error responses when the ProblemDetails option is given. See
+// https://datatracker.ietf.org/doc/html/rfc7807.
+type Problem struct {
+	// Type is "about:blank", since the status code alone identifies the
+	// type of problem.
+	Type string `json:"type"`
+
+	// Title is the text of the status code, e.g. "Bad Request".
+	Title string `json:"title"`
+
+	// Status is the HTTP response code.
+	Status int `json:"status"`
+
+	// Detail is the error message which the handler would otherwise have
+	// returned, if any.
+	Detail string `json:"detail,omitempty"`
+
+	// Errors lists each field which failed validation, if any.
+	Errors []FieldProblem `json:"errors,omitempty"`
+
+	// RequestID is the ID of the request, as described by
+	// RequestIDHeader.
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// FieldProblem describes a single form field or CSV cell which failed
+// validation.
+type FieldProblem struct {
+	// Field is the name of the form field, e.g. "date_of_birth".
+	Field string `json:"field"`
+
+	// Reason describes why the field failed validation.
+	Reason Reason `json:"reason"`
+
+	// Message is the user-facing message for the error, localized as
+	// described by ProcessForm.
+	Message string `json:"message"`
+
+	// ShrinkBy is, for the ReasonCardTooLarge reason, how many characters
+	// the field must be shortened by for the card to fit in a single QR
+	// code, as given by OversizedField, or zero if shortening it alone is
+	// not enough.
+	ShrinkBy int `json:"shrinkBy,omitempty"`
+}
+
+// ProblemDetails makes the issuance handlers write their error responses
+// themselves, as application/problem+json bodies holding a Problem with
+// the fields and reasons of any validation errors, for API clients which
+// would rather not parse plain text messages. Since nothing then remains
+// for the caller to write, the handlers return 0, the empty string, and
+// true even when the request failed; metrics and logs still record the
+// failure.
+func ProblemDetails() Option {
+	return func(h *Handlers) {
+		h.problemDetails = true
+	}
+}
+
+type problemKey struct{}
+
+// withProblems returns a request whose context collects the validation
+// errors of the request for its problem details.
+func withProblems(r *http.Request) (*http.Request, *[]FieldProblem) {
+	fields := new([]FieldProblem)
+	return r.WithContext(context.WithValue(r.Context(), problemKey{}, fields)), fields
+}
+
+// collectingProblems reports whether the validation errors of the request
+// are being collected for its problem details.
+func collectingProblems(r *http.Request) bool {
+	_, ok := r.Context().Value(problemKey{}).(*[]FieldProblem)
+	return ok
+}
+
+// addProblems records the given validation errors, or the fields listed by
+// a CardTooLargeError, for the problem details of the request, if the
+// ProblemDetails option is given.
+func (h Handlers) addProblems(r *http.Request, err error) {
+	fields, ok := r.Context().Value(problemKey{}).(*[]FieldProblem)
+	if !ok {
+		return
+	}
+
+	var tooLarge *CardTooLargeError
+	if errors.As(err, &tooLarge) {
+		c := h.catalog(r)
+		for _, f := range tooLarge.Fields {
+			e := ValidationError{Field: f.Field, Reason: ReasonCardTooLarge}
+			*fields = append(*fields, FieldProblem{Field: f.Field, Reason: e.Reason, Message: c.message(e), ShrinkBy: f.ShrinkBy})
+		}
+		return
+	}
+
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		return
+	}
+
+	c := h.catalog(r)
+	for _, e := range errs {
+		*fields = append(*fields, FieldProblem{Field: e.Field, Reason: e.Reason, Message: c.message(e)})
+	}
+}
+
+// writeProblem writes the problem details of a failed request.
+func writeProblem(w http.ResponseWriter, r *http.Request, code int, message string, fields []FieldProblem) {
+	requestID, _ := RequestIDFromContext(r.Context())
+	body, err := json.Marshal(Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(code),
+		Status:    code,
+		Detail:    message,
+		Errors:    fields,
+		RequestID: requestID,
+	})
+	if err != nil {
+		http.Error(w, withRequestID(r, message), code)
+		return
+	}
+
+	w.Header().Del("Content-Disposition")
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	w.Write(body)
+}
@@ -0,0 +1,167 @@
+package webhandlers
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimitKey determines the key by which a RateLimiter groups requests,
+// e.g. the client's IP address or API key. Requests for which it returns
+// the empty string are not limited.
+type RateLimitKey func(r *http.Request) string
+
+// ByRemoteIP is a RateLimitKey which groups requests by the IP address of
+// the connecting client. Behind a reverse proxy, use ByHeader with a header
+// set by the proxy instead.
+func ByRemoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ByHeader returns a RateLimitKey which groups requests by the value of the
+// given header, e.g. "X-Api-Key" or "X-Real-Ip".
+func ByHeader(name string) RateLimitKey {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// RateLimiter limits the rate of requests per key with a token bucket: each
+// key may make a burst of requests at once, after which its requests are
+// allowed at a steady rate. It is safe for concurrent use.
+type RateLimiter struct {
+	rate  float64
+	burst float64
+	key   RateLimitKey
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a RateLimiter allowing each key, as determined by
+// the given RateLimitKey, perSecond requests per second with bursts of up to
+// burst requests.
+func NewRateLimiter(perSecond float64, burst int, key RateLimitKey) *RateLimiter {
+	return &RateLimiter{
+		rate:    perSecond,
+		burst:   float64(burst),
+		key:     key,
+		buckets: map[string]*bucket{},
+	}
+}
+
+// Allow reports whether the request may proceed and, if not, how long its
+// key must wait before its next request would be allowed.
+func (l *RateLimiter) Allow(r *http.Request) (time.Duration, bool) {
+	key := l.key(r)
+	if key == "" {
+		return 0, true
+	}
+
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		if l.rate <= 0 {
+			return time.Duration(math.MaxInt64), false
+		}
+		return time.Duration((1 - b.tokens) / l.rate * float64(time.Second)), false
+	}
+
+	b.tokens--
+	return 0, true
+}
+
+// sweep forgets keys whose buckets have refilled, so that the number of
+// buckets does not grow without bound. It must be called with l.mu held.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Middleware returns an http.Handler which responds with 429 Too Many
+// Requests and a Retry-After header to requests exceeding the limit, and
+// otherwise calls next. It can be used to limit endpoints other than those
+// served by Handlers; for the issuance handlers, use the RateLimit option.
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if retryAfter, ok := l.Allow(r); !ok {
+			setRetryAfter(w, retryAfter)
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Limiter decides whether requests may proceed, as RateLimiter does for the
+// requests to a single process. Deployments with several replicas can
+// implement it to share limits between them, as redis.RateLimiter does.
+type Limiter interface {
+	// Allow reports whether the request may proceed and, if not, how long
+	// its key must wait before its next request would be allowed.
+	Allow(r *http.Request) (time.Duration, bool)
+}
+
+// RateLimit sets a Limiter, e.g. a RateLimiter, limiting the requests
+// accepted by ProcessForm, ProcessCSV, ProcessBundle, and ProcessLookup.
+// Requests exceeding the limit are rejected with a 429 response code and a
+// Retry-After header.
+func RateLimit(l Limiter) Option {
+	return func(h *Handlers) {
+		h.limiter = l
+	}
+}
+
+// limit wraps the given issuance handler with the configured rate limit.
+func (h Handlers) limit(handler handlerFunc) handlerFunc {
+	if h.limiter == nil {
+		return handler
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) (int, string, bool) {
+		if retryAfter, ok := h.limiter.Allow(r); !ok {
+			setRetryAfter(w, retryAfter)
+			return http.StatusTooManyRequests, "rate limit exceeded", false
+		}
+		return handler(w, r)
+	}
+}
+
+func setRetryAfter(w http.ResponseWriter, d time.Duration) {
+	w.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10))
+}
@@ -0,0 +1,88 @@
+package webhandlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+)
+
+// RequestIDHeader is the header carrying the ID of each request, which the
+// handlers take from the request if it has a valid one, e.g. assigned by a
+// load balancer, and otherwise generate. The ID is written in this header
+// of every response, included in log and audit events, and appended to
+// error messages, so that a failed issuance reported by a patient can be
+// found in the server's logs.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds the length of request IDs taken from requests.
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// RequestIDFromContext returns the ID of a request, as described by
+// RequestIDHeader, from the request's context.
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey{}).(string)
+	return id, ok
+}
+
+// identify returns a request whose context holds the ID of the given
+// request, taken from its RequestIDHeader or generated, and writes the ID
+// in the response's RequestIDHeader. Requests which already have an ID are
+// returned as is.
+func identify(w http.ResponseWriter, r *http.Request) *http.Request {
+	if _, ok := RequestIDFromContext(r.Context()); ok {
+		return r
+	}
+
+	id := r.Header.Get(RequestIDHeader)
+	if !validRequestID(id) {
+		id = newRequestID()
+	}
+
+	w.Header().Set(RequestIDHeader, id)
+	return r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id))
+}
+
+// validRequestID reports whether the given request ID can be safely
+// echoed in responses and logs, i.e. is non-empty, not too long, and made
+// up of printable ASCII characters.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// withRequestID appends the ID of the request to an error message, so that
+// it is shown to the user who might report it.
+func withRequestID(r *http.Request, message string) string {
+	id, ok := RequestIDFromContext(r.Context())
+	switch {
+	case !ok:
+		return message
+	case message == "":
+		return "request ID " + id
+	}
+	return message + " (request ID " + id + ")"
+}
+
+// requestIDAttr returns the log attribute holding the ID of the request
+// with the given context.
+func requestIDAttr(ctx context.Context) slog.Attr {
+	id, _ := RequestIDFromContext(ctx)
+	return slog.String("request_id", id)
+}
@@ -0,0 +1,84 @@
+package webhandlers
+
+import "strings"
+
+// FieldSchema customizes one of the fields of the form data expected by
+// ProcessForm, which are also the columns of the CSV documents expected by
+// ProcessCSV.
+type FieldSchema struct {
+	// Name is the name of the field in form data and CSV header rows, in
+	// place of its default name, e.g. "surname" for "family_name". It is
+	// also the field reported in ValidationErrors. The empty string keeps
+	// the default name.
+	Name string
+
+	// Optional allows the field to be left blank. Only the family name,
+	// given names, immunization performer, and immunization lot number
+	// fields may be optional, and a patient must still be given a family
+	// name or given names; the birth date, vaccine type, and immunization
+	// date fields are always required.
+	Optional bool
+}
+
+// FormSchema maps the default names of form fields, e.g. "family_name" or
+// "first_immunization_lot_number", to their customizations.
+type FormSchema map[string]FieldSchema
+
+// FormFields sets the schema of the form data and CSV columns expected by
+// the handlers, so that existing intake forms, whose fields may be named
+// differently or may not collect every value, can be used without being
+// rewritten. Labels in the catalogs of validation error messages apply to
+// renamed fields under their new names.
+func FormFields(s FormSchema) Option {
+	return func(h *Handlers) {
+		h.schema = s
+	}
+}
+
+// fieldName returns the name in form data of the field with the given
+// default name.
+func (h Handlers) fieldName(field string) string {
+	if name := h.schema[field].Name; name != "" {
+		return name
+	}
+	return field
+}
+
+// optional reports whether the field with the given default name may be
+// left blank.
+func (h Handlers) optional(field string) bool {
+	if !h.schema[field].Optional {
+		return false
+	}
+	return field == "family_name" || field == "given_names" ||
+		strings.HasSuffix(field, "_immunization_performer") ||
+		strings.HasSuffix(field, "_immunization_lot_number")
+}
+
+// renameFields replaces the default names of the fields of the given
+// errors with their names in form data.
+func (h Handlers) renameFields(errs ValidationErrors) {
+	for i := range errs {
+		errs[i].Field = h.fieldName(errs[i].Field)
+	}
+}
+
+// relabel returns the given catalog with the labels of renamed fields
+// also available under their new names.
+func (h Handlers) relabel(c Catalog) Catalog {
+	if len(h.schema) == 0 {
+		return c
+	}
+
+	fields := make(map[string]string, len(c.Fields)+len(h.schema))
+	for field, label := range c.Fields {
+		fields[field] = label
+	}
+	for field, s := range h.schema {
+		if label, ok := c.Fields[field]; ok && s.Name != "" {
+			fields[s.Name] = label
+		}
+	}
+	c.Fields = fields
+	return c
+}
@@ -0,0 +1,45 @@
+package webhandlers
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/sink"
+)
+
+// ExternalIDField is the CSV column identifying the patient of each row in
+// another system, e.g. by a medical record number, by which the files of
+// the row's card are named when the OutputSink option is given.
+const ExternalIDField = "external_id"
+
+// OutputSink sets a sink, e.g. a *sink.S3 or *sink.GCS, to which
+// ProcessCSV writes the files of each row's card, named by the row's
+// ExternalIDField, e.g. 12345.smart-health-card or 12345/1.png, in place
+// of writing them to the ZIP archive of its response. The archive then
+// contains a manifest.csv listing the row number, external ID, and name of
+// every file written, alongside errors.csv, which also lists the rows
+// whose files could not be written.
+//
+// Every row must then have a unique external ID of letters, digits, ".",
+// "_", and "-", starting with a letter or digit; rows without one fail
+// validation.
+func OutputSink(s sink.Sink) Option {
+	return func(h *Handlers) {
+		h.outputSink = s
+	}
+}
+
+var externalIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// checkExternalID checks the external ID of a row of a CSV batch, which
+// must not be among those of earlier rows.
+func checkExternalID(value string, seen map[string]bool) (string, ValidationError, bool) {
+	id := strings.TrimSpace(value)
+	switch {
+	case id == "":
+		return "", ValidationError{Field: ExternalIDField, Reason: ReasonMissing}, false
+	case !externalIDPattern.MatchString(id), seen[id]:
+		return "", ValidationError{Field: ExternalIDField, Reason: ReasonInvalid}, false
+	}
+	return id, ValidationError{}, true
+}
@@ -0,0 +1,139 @@
+package webhandlers
+
+import (
+	"sort"
+	"strings"
+)
+
+// Reason is a machine-readable code describing why a form field failed
+// validation.
+type Reason string
+
+// Reasons a form field can fail validation.
+const (
+	// ReasonMissing indicates a required field was blank.
+	ReasonMissing Reason = "missing"
+
+	// ReasonInvalid indicates a field had a value which is not allowed.
+	ReasonInvalid Reason = "invalid"
+
+	// ReasonInvalidDate indicates a field was not a valid date in any of
+	// the accepted formats.
+	ReasonInvalidDate Reason = "invalid_date"
+
+	// ReasonFutureDate indicates a date field was in the future.
+	ReasonFutureDate Reason = "future_date"
+
+	// ReasonBeforeBirthDate indicates an immunization date preceded the
+	// patient's birth date.
+	ReasonBeforeBirthDate Reason = "before_birth_date"
+
+	// ReasonTooEarly indicates an immunization date preceded the earliest
+	// plausible immunization date.
+	ReasonTooEarly Reason = "too_early"
+
+	// ReasonInvalidVaccineType indicates a field was not one of the
+	// supported fhirbundle.VaccineType values.
+	ReasonInvalidVaccineType Reason = "invalid_vaccine_type"
+
+	// ReasonOutOfOrder indicates an immunization field was provided while
+	// a preceding immunization was left blank.
+	ReasonOutOfOrder Reason = "out_of_order"
+
+	// ReasonTooLong indicates a field was longer than the limit set by the
+	// MaxFieldLength option.
+	ReasonTooLong Reason = "too_long"
+
+	// ReasonInvalidEncoding indicates a field was not valid UTF-8.
+	ReasonInvalidEncoding Reason = "invalid_encoding"
+
+	// ReasonCardTooLarge indicates a field was among the longest of a card
+	// too large to fit in a single QR code; see CardTooLargeError.
+	ReasonCardTooLarge Reason = "card_too_large"
+
+	// ReasonUnknownPerformer indicates a performer field was not one of
+	// the performers set by the Performers option.
+	ReasonUnknownPerformer Reason = "unknown_performer"
+
+	// ReasonInvalidLotNumber indicates a lot number field was rejected by
+	// the LotNumbers or LotNumberPattern option.
+	ReasonInvalidLotNumber Reason = "invalid_lot_number"
+)
+
+// ValidationError describes a problem with a single form field.
+type ValidationError struct {
+	// Field is the name of the form field, e.g. "date_of_birth".
+	Field string
+
+	// Reason describes why the field failed validation.
+	Reason Reason
+}
+
+func (e ValidationError) Error() string {
+	switch e.Reason {
+	case ReasonMissing:
+		return e.Field + " is required"
+	case ReasonInvalidDate:
+		return e.Field + " is not a valid date"
+	case ReasonFutureDate:
+		return e.Field + " is in the future"
+	case ReasonBeforeBirthDate:
+		return e.Field + " is before the date of birth"
+	case ReasonTooEarly:
+		return e.Field + " is earlier than COVID-19 vaccines were available"
+	case ReasonInvalidVaccineType:
+		return e.Field + " is not a supported vaccine type"
+	case ReasonOutOfOrder:
+		return e.Field + " provided while a previous immunization is blank"
+	case ReasonTooLong:
+		return e.Field + " is too long"
+	case ReasonInvalidEncoding:
+		return e.Field + " is not valid UTF-8 text"
+	case ReasonCardTooLarge:
+		return e.Field + " is too long for the card to fit in a single QR code"
+	case ReasonUnknownPerformer:
+		return e.Field + " is not a known performer"
+	case ReasonInvalidLotNumber:
+		return e.Field + " is not a valid lot number"
+	}
+	return e.Field + " is invalid"
+}
+
+// ValidationErrors is the error returned when form data fails validation,
+// listing every field which failed rather than only the first.
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// sort orders the errors by the position of their fields in the form so
+// that the combined message is stable.
+func (e ValidationErrors) sort() {
+	sort.SliceStable(e, func(i, j int) bool {
+		return fieldPosition(e[i].Field) < fieldPosition(e[j].Field)
+	})
+}
+
+func fieldPosition(field string) int {
+	fields := []string{"family_name", "given_names", "given_name", "date_of_birth"}
+	for _, ordinal := range immunizationOrdinals {
+		fields = append(fields,
+			ordinal+"_immunization_performer",
+			ordinal+"_immunization_lot_number",
+			ordinal+"_immunization_vaccine_type",
+			ordinal+"_immunization_date",
+		)
+	}
+
+	for i, f := range fields {
+		if f == field {
+			return i
+		}
+	}
+	return len(fields)
+}
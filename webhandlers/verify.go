@@ -0,0 +1,163 @@
+package webhandlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/qrcode"
+	"github.com/amitkgupta/go-smarthealthcards/v2/store"
+	"github.com/amitkgupta/go-smarthealthcards/v2/verifier"
+)
+
+// VerifiedCard is the JSON document written by VerifyQRCodes.
+type VerifiedCard struct {
+	// Issuer is the issuer URL, the "iss" value of the card.
+	Issuer string `json:"iss"`
+
+	// KeyID is the "kid" of the key which signed the card.
+	KeyID string `json:"kid"`
+
+	// NotBefore is when the card was issued, its "nbf" value.
+	NotBefore time.Time `json:"nbf"`
+
+	// Expires is when the card expires, its "exp" value, if it does.
+	Expires *time.Time `json:"exp,omitempty"`
+
+	// Types are the types of the card's verifiable credential.
+	Types []string `json:"types"`
+
+	// FHIRBundle is the card's FHIR bundle.
+	FHIRBundle json.RawMessage `json:"fhirBundle"`
+
+	// CardHash is the hash of the card's JWS, as given by the
+	// CardHashHeader of the response which issued it.
+	CardHash string `json:"cardHash"`
+
+	// Certificates describe the verified certificate chain of the key
+	// which signed the card, from the key's certificate to the root's, if
+	// it was checked against the TrustedRoots of the Verification policy.
+	Certificates []VerifiedCertificate `json:"certificates,omitempty"`
+}
+
+// VerifiedCertificate describes a certificate in the chain of a
+// VerifiedCard.
+type VerifiedCertificate struct {
+	// Subject and Issuer are the distinguished names of the certificate's
+	// subject and issuer.
+	Subject string `json:"subject"`
+	Issuer  string `json:"issuer"`
+
+	// NotAfter is when the certificate expires.
+	NotAfter time.Time `json:"notAfter"`
+}
+
+// Verification sets the keys with which VerifyQRCodes verifies cards, and
+// the policy, such as the trusted issuers, with which it accepts them. By
+// default, each issuer's keys are fetched from its JWKS, as by
+// verifier.IssuerJWKS, and any validly signed card is accepted.
+func Verification(keys verifier.KeySource, policy verifier.VerifyOptions) Option {
+	return func(h *Handlers) {
+		h.verifyKeys = keys
+		h.verifyPolicy = policy
+	}
+}
+
+// VerifyQRCodes expects the request to provide one or more QR code images,
+// as files in multipart form data under any names, holding either a whole
+// card or all of its chunks in any order. This method decodes them,
+// reassembles the card's JWS, verifies it as configured by the Verification
+// option, and writes the card's contents as a VerifiedCard, so that these
+// handlers can also serve as a self-contained verifier.
+//
+// It fails with a 400 response code if the images cannot be decoded into a
+// well-formed card, and with a 422 response code if the card does not
+// verify or is rejected by the verification policy.
+//
+// If there is an error, this methods returns the HTTP response code,
+// an additional error message if available, and false. If there is no
+// error, it returns 0, the empty string, and true.
+func (h Handlers) VerifyQRCodes(w http.ResponseWriter, r *http.Request) (int, string, bool) {
+	return h.guard(h.verifyQRCodes)(w, r)
+}
+
+func (h Handlers) verifyQRCodes(w http.ResponseWriter, r *http.Request) (int, string, bool) {
+	if err := r.ParseMultipartForm(h.maxRequestBytes); tooLarge(err) {
+		return http.StatusRequestEntityTooLarge, "request body too large", false
+	} else if err != nil {
+		return http.StatusBadRequest, h.localize(r, ValidationErrors{{Field: "file", Reason: ReasonMissing}}), false
+	}
+
+	var names []string
+	for name := range r.MultipartForm.File {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var images [][]byte
+	for _, name := range names {
+		for _, fh := range r.MultipartForm.File[name] {
+			f, err := fh.Open()
+			if err != nil {
+				return h.internalError(r, err)
+			}
+			image, err := io.ReadAll(f)
+			f.Close()
+			if err != nil {
+				return h.internalError(r, err)
+			}
+			images = append(images, image)
+		}
+	}
+	if len(images) == 0 {
+		return http.StatusBadRequest, h.localize(r, ValidationErrors{{Field: "file", Reason: ReasonMissing}}), false
+	}
+
+	healthCardJWS, err := qrcode.Decode(images...)
+	if err != nil {
+		return http.StatusBadRequest, "cannot read the QR codes: " + err.Error(), false
+	}
+
+	keys := h.verifyKeys
+	if keys == nil {
+		keys = verifier.IssuerJWKS{}
+	}
+	card, err := verifier.VerifyWithOptions(r.Context(), healthCardJWS, keys, h.verifyPolicy)
+	if errors.Is(err, verifier.ErrMalformed) {
+		return http.StatusBadRequest, err.Error(), false
+	} else if err != nil {
+		return http.StatusUnprocessableEntity, "card not verified: " + err.Error(), false
+	}
+
+	verified := VerifiedCard{
+		Issuer:     card.Issuer,
+		KeyID:      card.KeyID,
+		NotBefore:  card.NotBefore.UTC(),
+		Types:      card.Types,
+		FHIRBundle: card.Bundle,
+		CardHash:   store.CardHash(healthCardJWS),
+	}
+	if !card.Expires.IsZero() {
+		expires := card.Expires.UTC()
+		verified.Expires = &expires
+	}
+	for _, cert := range card.Certificates {
+		verified.Certificates = append(verified.Certificates, VerifiedCertificate{
+			Subject:  cert.Subject.String(),
+			Issuer:   cert.Issuer.String(),
+			NotAfter: cert.NotAfter.UTC(),
+		})
+	}
+
+	verifiedJSON, err := json.Marshal(verified)
+	if err != nil {
+		return h.internalError(r, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(verifiedJSON)
+	return 0, "", true
+}
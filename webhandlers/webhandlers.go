@@ -3,50 +3,264 @@
 package webhandlers
 
 import (
-	"archive/zip"
+	"bytes"
+	"context"
 	"crypto/ecdsa"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
+	"github.com/amitkgupta/go-smarthealthcards/v2/audit"
+	"github.com/amitkgupta/go-smarthealthcards/v2/delivery"
 	"github.com/amitkgupta/go-smarthealthcards/v2/fhirbundle"
-	"github.com/amitkgupta/go-smarthealthcards/v2/jws"
+	shcissuer "github.com/amitkgupta/go-smarthealthcards/v2/issuer"
+	"github.com/amitkgupta/go-smarthealthcards/v2/keyring"
+	"github.com/amitkgupta/go-smarthealthcards/v2/metrics"
+	"github.com/amitkgupta/go-smarthealthcards/v2/pdf"
 	"github.com/amitkgupta/go-smarthealthcards/v2/qrcode"
+	"github.com/amitkgupta/go-smarthealthcards/v2/sink"
+	"github.com/amitkgupta/go-smarthealthcards/v2/store"
+	"github.com/amitkgupta/go-smarthealthcards/v2/verifier"
+	"github.com/amitkgupta/go-smarthealthcards/v2/webhook"
 )
 
-// Handlers should not be instantiated directly; use the New
-// function in this package instead.
+// Handlers should not be instantiated directly; use the New,
+// NewMultiIssuer, NewWithKeyring, NewWithResolver, or NewVerifier
+// functions in this package instead.
 type Handlers struct {
-	key    *ecdsa.PrivateKey
-	issuer string
+	issuer  func() Issuer
+	resolve IssuerResolver
+
+	dateLayouts              []string
+	earliestImmunizationDate time.Time
+	now                      func() time.Time
+	deterministic            bool
+	payloadOpts              []fhirbundle.PayloadOption
+	givenNamesDelimiter      string
+	performers               []string
+	validLotNumber           LotNumberValidator
+	draftSecret              []byte
+	draftTTL                 time.Duration
+	draftRedeemer            DraftRedeemer
+	batchConcurrency         int
+
+	locale   string
+	catalogs map[string]Catalog
+
+	patients PatientSource
+
+	routes Routes
+
+	metrics *metrics.Metrics
+	logger  *slog.Logger
+	onError func(r *http.Request, err error)
+	limiter Limiter
+
+	authorizer Authorizer
+	cors       *CORSPolicy
+
+	maxRequestBytes int64
+	maxFieldLength  int
+	singleQROnly    bool
+	problemDetails  bool
+	compress        bool
+	labelQRCodes    bool
+	selfTestKeys    bool
+	qrStyle         qrcode.Style
+	metadata        map[string]verifier.IssuerMetadata
+	verifyKeys      verifier.KeySource
+	verifyPolicy    verifier.VerifyOptions
+
+	schema   FormSchema
+	formPage FormPage
+
+	filename FilenameFunc
+
+	issuances store.IssuanceStore
+	audit     *audit.Log
+	webhook   *webhook.Dispatcher
+	mailer    *delivery.Mailer
+
+	outputSink sink.Sink
+
+	keyring         *keyring.Keyring
+	adminAuthorizer Authorizer
+
+	keys       *keyCache
+	jwksMaxAge time.Duration
 }
 
 // New returns an object with methods that can be used in a web-based
 // application for issuing SMART Health Card QR codes for COVID-19
-// immunizations.
-func New(key *ecdsa.PrivateKey, issuer string) Handlers {
-	return Handlers{key: key, issuer: issuer}
+// immunizations. Its behavior can be customized with the given options.
+func New(key *ecdsa.PrivateKey, issuer string, opts ...Option) Handlers {
+	i := Issuer{URL: issuer, Key: key}
+	h := NewWithResolver(func(*http.Request) (Issuer, bool) { return i, true }, opts...)
+	h.issuer = func() Issuer { return i }
+	h.selfTest(issuer, key)
+	return h
+}
+
+// NewWithKeyring is like New, but signs with the active key of the given
+// keyring and publishes all of its active and inactive keys in the JWKS, so
+// that keys can be rotated while the application is running, e.g. with
+// RotateKey.
+func NewWithKeyring(k *keyring.Keyring, issuer string, opts ...Option) Handlers {
+	current := func() Issuer {
+		publicKeys := k.PublicKeys()
+		return Issuer{URL: issuer, Key: k.SigningKey(), PreviousKeys: publicKeys[1:]}
+	}
+	h := NewWithResolver(func(*http.Request) (Issuer, bool) { return current(), true }, opts...)
+	h.issuer = current
+	h.keyring = k
+	h.selfTest(issuer, k.SigningKey())
+	return h
+}
+
+// NewMultiIssuer is like New, but signs on behalf of multiple issuers, e.g.
+// multiple clinic locations, given a map of issuer URLs to their keys. The
+// issuer for each request is determined by ResolveByURL.
+func NewMultiIssuer(keys map[string]*ecdsa.PrivateKey, opts ...Option) Handlers {
+	h := NewWithResolver(ResolveByURL(keys), opts...)
+	for issuer, key := range keys {
+		h.selfTest(issuer, key)
+	}
+	return h
+}
+
+// NewVerifier is like New, but holds only the public keys of the issuer,
+// so that verification services never hold private keys. Its Handlers
+// publish the keys in the issuer's JWKS and verify cards with
+// VerifyQRCodes, by default against those keys only, unless the
+// Verification option is given; they serve no issuance endpoints, and
+// their issuing methods fail with a 500 response code.
+func NewVerifier(issuer string, keys []*ecdsa.PublicKey, opts ...Option) Handlers {
+	i := Issuer{URL: issuer, PreviousKeys: keys}
+	h := NewWithResolver(func(*http.Request) (Issuer, bool) { return i, true }, opts...)
+	h.issuer = func() Issuer { return i }
+
+	h.routes = Routes{
+		JWKS:           h.routes.JWKS,
+		OpenAPI:        h.routes.OpenAPI,
+		IssuerMetadata: h.routes.IssuerMetadata,
+		Verify:         h.routes.Verify,
+	}
+	if h.verifyKeys == nil {
+		publicKeys, err := verifier.PublicKeys(keys...)
+		if err != nil {
+			panic(fmt.Sprintf("webhandlers: public keys of %s: %v", issuer, err))
+		}
+		h.verifyKeys = publicKeys
+	}
+	return h
+}
+
+// NewWithResolver is like New, but determines the issuer on behalf of which
+// to act for each request by calling the given resolver, e.g. based on the
+// request's host, path, or headers.
+func NewWithResolver(resolve IssuerResolver, opts ...Option) Handlers {
+	h := Handlers{
+		resolve:                  resolve,
+		dateLayouts:              []string{"2006-01-02"},
+		earliestImmunizationDate: time.Date(2020, time.December, 1, 0, 0, 0, 0, time.UTC),
+		now:                      time.Now,
+		catalogs:                 defaultCatalogs,
+		routes:                   DefaultRoutes,
+		maxRequestBytes:          DefaultMaxRequestBytes,
+		maxFieldLength:           DefaultMaxFieldLength,
+		keys:                     newKeyCache(),
+		jwksMaxAge:               DefaultJWKSMaxAge,
+	}
+	for _, opt := range opts {
+		opt(&h)
+	}
+	if h.draftSecret != nil && h.draftRedeemer == nil {
+		h.draftRedeemer = &memoryDraftRedeemer{now: h.now, redeemed: map[string]time.Time{}}
+	}
+	return h
 }
 
 // JWKSJSON writes the JSON representation of the JSON Web Key Set
 // representation of the public information of the associated private
 // key.
 //
+// This method can only be used with Handlers created by New,
+// NewWithKeyring, or NewVerifier; use ServeJWKSJSON for Handlers acting on behalf of multiple issuers.
+//
 // If there is an error, this methods returns the HTTP response code,
 // an additional error message if available, and false. If there is no
 // error, it returns 0, the empty string, and true.
 func (h Handlers) JWKSJSON(w http.ResponseWriter) (int, string, bool) {
-	if jwksJSON, err := jws.JWKSJSON(h.key); err != nil {
-		return http.StatusInternalServerError, "", false
-	} else {
+	if h.issuer == nil {
+		return http.StatusInternalServerError, "issuer cannot be determined without a request", false
+	}
+
+	h.setJWKSCORSHeaders(w, nil)
+	return h.writeJWKSJSON(w, nil, h.issuer())
+}
+
+// ServeJWKSJSON is like JWKSJSON, but writes the JSON Web Key Set of the
+// issuer determined by the request. It answers conditional requests, e.g.
+// with an If-None-Match header matching the JWKS's ETag, with a 304 (Not
+// Modified) response code, so that verifiers and wallet apps polling the
+// JWKS need not download it again until the keys change.
+//
+// If there is an error, this methods returns the HTTP response code,
+// an additional error message if available, and false. If there is no
+// error, it returns 0, the empty string, and true.
+func (h Handlers) ServeJWKSJSON(w http.ResponseWriter, r *http.Request) (int, string, bool) {
+	r = identify(w, r)
+	issuer, ok := h.resolve(r)
+	if !ok {
+		return http.StatusNotFound, "unknown issuer", false
+	}
+
+	h.setJWKSCORSHeaders(w, r)
+	return h.compressed(func(w http.ResponseWriter, r *http.Request) (int, string, bool) {
+		return h.writeJWKSJSON(w, r, issuer)
+	})(w, r)
+}
+
+// setJWKSCORSHeaders sets the headers allowing cross-origin requests for
+// the JWKS, which are allowed from any origin unless the CORS option says
+// otherwise.
+func (h Handlers) setJWKSCORSHeaders(w http.ResponseWriter, r *http.Request) {
+	if h.cors == nil {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(jwksJSON)
+		return
+	}
+	h.setCORSHeaders(w, r)
+}
+
+// writeJWKSJSON writes the JWKS of the given issuer along with headers with
+// which clients can cache it, answering the request if it is conditional.
+func (h Handlers) writeJWKSJSON(w http.ResponseWriter, r *http.Request, issuer Issuer) (int, string, bool) {
+	entry, err := h.keys.jwksJSON(issuer)
+	if err != nil {
+		return http.StatusInternalServerError, "", false
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", entry.etag)
+	if h.jwksMaxAge >= 0 {
+		w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(h.jwksMaxAge/time.Second)))
+	}
+
+	if r == nil {
+		w.Header().Set("Last-Modified", entry.modified.Format(http.TimeFormat))
+		w.Write(entry.json)
 		return 0, "", true
 	}
+
+	http.ServeContent(w, r, "", entry.modified, bytes.NewReader(entry.json))
+	return 0, "", true
 }
 
 // ProcessForm expects the request to provide form data representing a patient
@@ -58,177 +272,640 @@ func (h Handlers) JWKSJSON(w http.ResponseWriter) (int, string, bool) {
 // which can be combined into a single SMART Health Card with the immunization
 // data.
 //
+// The card is issued on behalf of the issuer determined by the request;
+// if there is no such issuer, this method returns a 404 response code.
+// If the request's context is done before the card has been signed and
+// encoded, this method returns a 503 response code.
+//
+// If the form data includes an "output" value of "pdf", this method instead
+// writes a printable PDF document laying out the QR code(s) along with a
+// summary of the patient's immunizations. The "page_size" form value selects
+// between "letter" (the default) and "wallet" sized pages.
+//
+// If the form data includes an "output" value of "html", or no "output" value
+// is given and the request's Accept header prefers text/html, this method
+// instead writes an HTML page embedding the QR code(s) along with a summary of
+// the patient's immunizations and links to download the QR code(s) and a
+// .smart-health-card file.
+//
+// If the form data includes an "output" value of "jws", this method instead
+// writes the compact serialization of the card's JWS as plain text, for
+// callers which render QR codes themselves. If it includes an "output" value
+// of "smart-health-card", this method writes a .smart-health-card file, i.e.
+// a JSON document whose "verifiableCredential" array holds the JWS. See
+// https://spec.smarthealth.cards/#via-file-download.
+//
+// If the Email option is given and the form data includes an "email" value,
+// the card is also emailed to that address before it is written.
+//
+// If the TwoStepIssuance option is given, this method expects a draft
+// token returned by DraftForm, along with the output format and page size,
+// rather than the form data itself.
+//
+// Validation error messages are written in the language configured by the
+// Locale option or, failing that, the language preferred by the request's
+// Accept-Language header among the available catalogs, defaulting to
+// English.
+//
 // If there is an error, this methods returns the HTTP response code,
 // an additional error message if available, and false. If there is no
 // error, it returns 0, the empty string, and true.
 func (h Handlers) ProcessForm(w http.ResponseWriter, r *http.Request) (int, string, bool) {
-	fhirBundle, err := parseInput(r)
+	return h.instrument(w, r, h.processForm)
+}
+
+func (h Handlers) processForm(w http.ResponseWriter, r *http.Request) (int, string, bool) {
+	issuer, ok := h.resolve(r)
+	if !ok {
+		return http.StatusNotFound, "unknown issuer", false
+	}
+
+	if h.draftSecret != nil {
+		reason, ok, err := h.redeemDraft(r, issuer)
+		if err != nil {
+			return h.internalError(r, err)
+		} else if !ok {
+			errs := ValidationErrors{{Field: DraftTokenField, Reason: reason}}
+			h.validationFailed(r, errs)
+			return http.StatusBadRequest, h.localize(r, errs), false
+		}
+	}
+
+	fhirBundle, err := h.ParseForm(r)
 	if err != nil {
-		return http.StatusBadRequest, err.Error(), false
+		h.validationFailed(r, err)
+		return http.StatusBadRequest, h.localize(r, err), false
 	}
 
-	payload, err := json.Marshal(fhirbundle.NewJWSPayload(fhirBundle, h.issuer))
+	return h.issue(w, r, issuer, fhirBundle)
+}
+
+// issue signs a SMART Health Card for the given FHIR bundle on behalf of the
+// given issuer and writes it in the output format requested, as described
+// by ProcessForm.
+func (h Handlers) issue(w http.ResponseWriter, r *http.Request, issuer Issuer, fhirBundle fhirbundle.FHIRBundle) (int, string, bool) {
+	email, ok := h.emailAddress(r)
+	if !ok {
+		errs := ValidationErrors{{Field: "email", Reason: ReasonInvalid}}
+		h.validationFailed(r, errs)
+		return http.StatusBadRequest, h.localize(r, errs), false
+	}
+
+	idem, err := h.idempotency(r)
 	if err != nil {
-		return http.StatusInternalServerError, "", false
+		return h.internalError(r, err)
 	}
 
-	healthCardJWS, err := jws.SignAndSerialize(payload, h.key)
+	card, replay, err := h.sign(r.Context(), issuer, fhirBundle.Patient, idem, func(i *shcissuer.Issuer) (shcissuer.Card, error) {
+		return i.Issue(r.Context(), fhirBundle)
+	})
 	if err != nil {
-		return http.StatusInternalServerError, "", false
+		return h.internalError(r, explainTooLarge(err, fhirBundle, issuer.URL, h.payloadOptions(idem.clock())...))
+	}
+	healthCardJWS := card.JWS
+	w.Header().Set(CardHashHeader, store.CardHash(healthCardJWS))
+
+	// A replayed card was already emailed and reported as issued.
+	cardIssued := func(chunks int) {
+		if !replay {
+			h.cardIssued(r, issuer, healthCardJWS, chunks)
+		}
+	}
+
+	if email != "" && !replay {
+		if err := h.mailer.DeliverCard(r.Context(), email, fhirBundle, healthCardJWS, nil); err != nil {
+			return h.internalError(r, err)
+		}
+	}
+
+	output := outputFormat(r)
+	switch output {
+	case "jws":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(healthCardJWS))
+		cardIssued(0)
+		return 0, "", true
+	case "smart-health-card":
+		w.Header().Set("Content-Type", "application/smart-health-card")
+		h.attachment(w, fhirBundle, ".smart-health-card")
+		w.Write(card.File)
+		cardIssued(0)
+		return 0, "", true
+	}
+
+	qrOpts := h.qrOptions(fhirBundle.Patient)
+	if output != "pdf" && output != "html" {
+		h.attachment(w, fhirBundle, qrCodesExtension(healthCardJWS, qrOpts))
+		if err := writeQRCodes(w, healthCardJWS, qrOpts); err != nil {
+			return h.internalError(r, err)
+		}
+
+		cardIssued(qrcode.ChunkCountWithOptions(len(healthCardJWS), qrOpts))
+		return 0, "", true
 	}
 
-	qrPNGs, err := qrcode.Encode(healthCardJWS)
+	// The PDF and HTML show the patient's name themselves, so the QR codes
+	// are not labeled with it.
+	qrOpts.Label = ""
+	qrPNGs, err := qrcode.EncodeWithOptionsContext(r.Context(), healthCardJWS, qrOpts)
 	if err != nil {
-		return http.StatusInternalServerError, "", false
+		return h.internalError(r, err)
 	}
 
-	if len(qrPNGs) == 1 {
-		w.Header().Set("Content-Type", "image/png")
-		w.Write(qrPNGs[0])
-	} else {
-		zw := zip.NewWriter(w)
-
-		for i, qrPNG := range qrPNGs {
-			if f, err := zw.Create(fmt.Sprintf("%d.png", i+1)); err != nil {
-				return http.StatusInternalServerError, "", false
-			} else if _, err = f.Write(qrPNG); err != nil {
-				return http.StatusInternalServerError, "", false
-			}
+	switch output {
+	case "pdf":
+		pageSize := pdf.PageSize(strings.TrimSpace(r.PostFormValue("page_size")))
+		if pageSize != "" && pageSize != pdf.Letter && pageSize != pdf.WalletCard {
+			errs := ValidationErrors{{Field: "page_size", Reason: ReasonInvalid}}
+			h.validationFailed(r, errs)
+			return http.StatusBadRequest, h.localize(r, errs), false
 		}
 
-		if err := zw.Close(); err != nil {
-			return http.StatusInternalServerError, "", false
+		pdfBytes, err := pdf.Card(fhirBundle, qrPNGs, pageSize)
+		if err != nil {
+			return h.internalError(r, err)
 		}
 
-		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Type", "application/pdf")
+		h.attachment(w, fhirBundle, ".pdf")
+		w.Write(pdfBytes)
+	case "html":
+		filename := "card"
+		if h.filename != nil {
+			filename = h.filename(fhirBundle)
+		}
+
+		htmlBytes, err := cardHTML(fhirBundle, healthCardJWS, qrPNGs, filename)
+		if err != nil {
+			return h.internalError(r, err)
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(htmlBytes)
 	}
 
+	cardIssued(len(qrPNGs))
 	return 0, "", true
 }
 
-func parseInput(r *http.Request) (fhirbundle.FHIRBundle, error) {
-	familyName := strings.TrimSpace(r.PostFormValue("family_name"))
-	givenNames := strings.TrimSpace(r.PostFormValue("given_names"))
-	birthDateString := strings.TrimSpace(r.PostFormValue("date_of_birth"))
+// ProcessBundle expects the request body to be an already constructed FHIR
+// bundle in JSON form, e.g. exported from an EHR, rather than form data. This
+// method validates the bundle with fhirbundle.ValidateJSON, creates and signs
+// a JSON Web Signature encapsulating it, and writes the resulting QR code(s)
+// in the same way as ProcessForm does by default.
+//
+// If there is an error, this methods returns the HTTP response code,
+// an additional error message if available, and false. If there is no
+// error, it returns 0, the empty string, and true.
+func (h Handlers) ProcessBundle(w http.ResponseWriter, r *http.Request) (int, string, bool) {
+	return h.instrument(w, r, h.processBundle)
+}
 
-	firstImmunizationPerformer := strings.TrimSpace(r.PostFormValue("first_immunization_performer"))
-	firstImmunizationLotNumber := strings.TrimSpace(r.PostFormValue("first_immunization_lot_number"))
-	firstImmunizationVaccineTypeString := strings.TrimSpace(r.PostFormValue("first_immunization_vaccine_type"))
-	firstImmunizationDateString := strings.TrimSpace(r.PostFormValue("first_immunization_date"))
+func (h Handlers) processBundle(w http.ResponseWriter, r *http.Request) (int, string, bool) {
+	issuer, ok := h.resolve(r)
+	if !ok {
+		return http.StatusNotFound, "unknown issuer", false
+	}
 
-	secondImmunizationPerformer := strings.TrimSpace(r.PostFormValue("second_immunization_performer"))
-	secondImmunizationLotNumber := strings.TrimSpace(r.PostFormValue("second_immunization_lot_number"))
-	secondImmunizationVaccineTypeString := strings.TrimSpace(r.PostFormValue("second_immunization_vaccine_type"))
-	secondImmunizationDateString := strings.TrimSpace(r.PostFormValue("second_immunization_date"))
+	bundle, err := io.ReadAll(r.Body)
+	if tooLarge(err) {
+		return http.StatusRequestEntityTooLarge, "request body too large", false
+	} else if err != nil {
+		return http.StatusBadRequest, "", false
+	}
 
-	thirdImmunizationPerformer := strings.TrimSpace(r.PostFormValue("third_immunization_performer"))
-	thirdImmunizationLotNumber := strings.TrimSpace(r.PostFormValue("third_immunization_lot_number"))
-	thirdImmunizationVaccineTypeString := strings.TrimSpace(r.PostFormValue("third_immunization_vaccine_type"))
-	thirdImmunizationDateString := strings.TrimSpace(r.PostFormValue("third_immunization_date"))
+	if !utf8.Valid(bundle) {
+		return http.StatusBadRequest, "bundle is not valid UTF-8 text", false
+	}
 
-	if familyName == "" || givenNames == "" || birthDateString == "" ||
-		firstImmunizationPerformer == "" || firstImmunizationLotNumber == "" ||
-		firstImmunizationVaccineTypeString == "" || firstImmunizationDateString == "" {
-		return fhirbundle.FHIRBundle{}, errors.New("patient information or first immunization information missing")
+	if err := fhirbundle.ValidateJSON(bundle); err != nil {
+		return http.StatusBadRequest, err.Error(), false
 	}
 
-	if (secondImmunizationPerformer != "" || secondImmunizationLotNumber != "" ||
-		secondImmunizationVaccineTypeString != "" || secondImmunizationDateString != "") &&
-		(secondImmunizationPerformer == "" || secondImmunizationLotNumber == "" ||
-			secondImmunizationVaccineTypeString == "" || secondImmunizationDateString == "") {
-		return fhirbundle.FHIRBundle{}, errors.New("second immunization information only partially complete")
+	idem, err := h.idempotency(r)
+	if err != nil {
+		return h.internalError(r, err)
 	}
 
-	if (thirdImmunizationPerformer != "" || thirdImmunizationLotNumber != "" ||
-		thirdImmunizationVaccineTypeString != "" || thirdImmunizationDateString != "") &&
-		(secondImmunizationPerformer == "") {
-		return fhirbundle.FHIRBundle{}, errors.New("third immunization information provided while second immunization is blank")
+	card, replay, err := h.sign(r.Context(), issuer, bundlePatient(bundle), idem, func(i *shcissuer.Issuer) (shcissuer.Card, error) {
+		return i.IssueJSON(r.Context(), bundle)
+	})
+	if err != nil {
+		return h.internalError(r, err)
 	}
+	healthCardJWS := card.JWS
+	w.Header().Set(CardHashHeader, store.CardHash(healthCardJWS))
 
-	if (thirdImmunizationPerformer != "" || thirdImmunizationLotNumber != "" ||
-		thirdImmunizationVaccineTypeString != "" || thirdImmunizationDateString != "") &&
-		(thirdImmunizationPerformer == "" || thirdImmunizationLotNumber == "" ||
-			thirdImmunizationVaccineTypeString == "" || thirdImmunizationDateString == "") {
-		return fhirbundle.FHIRBundle{}, errors.New("third immunization information only partially complete")
+	qrOpts := h.qrOptions(bundlePatient(bundle))
+	h.attachment(w, fhirbundle.FHIRBundle{}, qrCodesExtension(healthCardJWS, qrOpts))
+	if err := writeQRCodes(w, healthCardJWS, qrOpts); err != nil {
+		return h.internalError(r, err)
 	}
 
-	birthDate, err := time.Parse("2006-01-02", birthDateString)
-	if err != nil {
-		return fhirbundle.FHIRBundle{}, errors.New("invalid patient birth date")
+	if !replay {
+		h.cardIssued(r, issuer, healthCardJWS, qrcode.ChunkCountWithOptions(len(healthCardJWS), qrOpts))
 	}
+	return 0, "", true
+}
 
-	patient := fhirbundle.Patient{
-		Name: fhirbundle.Name{
-			Family: familyName,
-			Givens: strings.Fields(givenNames),
-		},
-		BirthDate: birthDate,
+// qrCodesExtension returns the extension of the file written by
+// writeQRCodes with the given options.
+func qrCodesExtension(healthCardJWS string, opts qrcode.Options) string {
+	if qrcode.ChunkCountWithOptions(len(healthCardJWS), opts) == 1 {
+		return ".png"
 	}
+	return ".zip"
+}
 
-	firstImmunizationDate, err := time.Parse("2006-01-02", firstImmunizationDateString)
-	if err != nil {
-		return fhirbundle.FHIRBundle{}, errors.New("invalid first immunization date")
+// writeQRCodes writes either a single QR code PNG or, if the JWS needs
+// multiple QR codes, a ZIP archive of their PNGs, as written by
+// qrcode.EncodeZIPTo. A single PNG is encoded before it is written, so that
+// its Content-Length is known and browsers can show the download's
+// progress; an archive is streamed as each PNG is rendered, so that only
+// one is held in memory at a time. If the JWS cannot be encoded, nothing is
+// written and any Content-Disposition header is removed, so that the error
+// is not downloaded as the card. If rendering fails once the archive has
+// started to be written, the response is abandoned with
+// http.ErrAbortHandler, so that the client sees a failed download rather
+// than an archive with an error message appended to it.
+func writeQRCodes(w http.ResponseWriter, healthCardJWS string, opts qrcode.Options) error {
+	if qrcode.ChunkCountWithOptions(len(healthCardJWS), opts) == 1 {
+		buf := new(bytes.Buffer)
+		if err := qrcode.EncodeTo(buf, healthCardJWS, opts); err != nil {
+			w.Header().Del("Content-Disposition")
+			return err
+		}
+
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+		_, err := w.Write(buf.Bytes())
+		return err
 	}
 
-	firstImmunizationVaccineType := fhirbundle.VaccineType(firstImmunizationVaccineTypeString)
-	switch firstImmunizationVaccineType {
-	case fhirbundle.Pfizer, fhirbundle.Moderna, fhirbundle.JohnsonAndJohnson,
-		fhirbundle.AstraZeneca, fhirbundle.Sinopharm, fhirbundle.COVAXIN:
-	default:
-		return fhirbundle.FHIRBundle{}, errors.New("invalid first immunization vaccine type")
+	zw := &zipResponseWriter{w: w}
+	if err := qrcode.EncodeZIPTo(zw, healthCardJWS, opts); err != nil {
+		if !zw.started {
+			w.Header().Del("Content-Disposition")
+			return err
+		}
+		panic(http.ErrAbortHandler)
 	}
+	return nil
+}
 
-	immunizations := []fhirbundle.Immunization{
-		{
-			DatePerformed: firstImmunizationDate,
-			Performer:     firstImmunizationPerformer,
-			LotNumber:     firstImmunizationLotNumber,
-			VaccineType:   firstImmunizationVaccineType,
-		},
+// zipResponseWriter writes a ZIP archive to a response, setting its
+// Content-Type only once the archive starts to be written.
+type zipResponseWriter struct {
+	w       http.ResponseWriter
+	started bool
+}
+
+func (zw *zipResponseWriter) Write(p []byte) (int, error) {
+	if !zw.started {
+		zw.w.Header().Set("Content-Type", "application/zip")
+		zw.started = true
+	}
+	return zw.w.Write(p)
+}
+
+// errNoSigningKey is the error with which the Handlers returned by
+// NewVerifier fail to issue cards.
+var errNoSigningKey = errors.New("webhandlers: no signing key; these handlers only verify cards")
+
+// sign issues a SMART Health Card for the given patient on behalf of the
+// given issuer at the time given by idem, by calling issue with the
+// issuer.Issuer returned by cardIssuer, and records its issuance. If the
+// card was previously issued with the same idempotency key, including by a
+// concurrent request, it is issued again as it was then, checked to be the
+// same card, and not recorded again; sign then reports that it is a replay.
+func (h Handlers) sign(ctx context.Context, issuer Issuer, patient fhirbundle.Patient, idem idempotency, issue func(*shcissuer.Issuer) (shcissuer.Card, error)) (card shcissuer.Card, replay bool, err error) {
+	if issuer.Key == nil {
+		return shcissuer.Card{}, false, errNoSigningKey
 	}
 
-	if secondImmunizationPerformer != "" {
-		secondImmunizationDate, err := time.Parse("2006-01-02", secondImmunizationDateString)
-		if err != nil {
-			return fhirbundle.FHIRBundle{}, errors.New("invalid second immunization date")
+	start := time.Now()
+	card, err = issue(h.cardIssuer(issuer, idem))
+	var tooLarge *shcissuer.TooLargeError
+	if errors.As(err, &tooLarge) {
+		return shcissuer.Card{}, false, cardTooLarge(tooLarge.Size)
+	} else if err != nil {
+		return shcissuer.Card{}, false, err
+	}
+	if h.metrics != nil {
+		h.metrics.Signed(time.Since(start))
+	}
+
+	if idem.previous == nil {
+		previous, err := h.recordIssuance(ctx, issuer, patient, card.JWS, idem.issuedAt, idem.key)
+		if err != nil || previous == nil {
+			return card, false, err
 		}
 
-		secondImmunizationVaccineType := fhirbundle.VaccineType(secondImmunizationVaccineTypeString)
-		switch secondImmunizationVaccineType {
-		case fhirbundle.Pfizer, fhirbundle.Moderna, fhirbundle.JohnsonAndJohnson,
-			fhirbundle.AstraZeneca, fhirbundle.Sinopharm, fhirbundle.COVAXIN:
-		default:
-			return fhirbundle.FHIRBundle{}, errors.New("invalid second immunization vaccine type")
+		// A concurrent request with the same key was recorded first, so
+		// return its card instead.
+		idem = idempotency{key: idem.key, issuedAt: previous.IssuedAt, previous: previous}
+		if card, err = issue(h.cardIssuer(issuer, idem)); err != nil {
+			return shcissuer.Card{}, false, err
 		}
+	}
 
-		immunizations = append(immunizations, fhirbundle.Immunization{
-			DatePerformed: secondImmunizationDate,
-			Performer:     secondImmunizationPerformer,
-			LotNumber:     secondImmunizationLotNumber,
-			VaccineType:   secondImmunizationVaccineType,
-		})
+	if store.CardHash(card.JWS) != idem.previous.CardHash {
+		return shcissuer.Card{}, false, ErrIdempotencyKeyReused
 	}
+	return card, true, nil
+}
 
-	if thirdImmunizationPerformer != "" {
-		thirdImmunizationDate, err := time.Parse("2006-01-02", thirdImmunizationDateString)
-		if err != nil {
-			return fhirbundle.FHIRBundle{}, errors.New("invalid third immunization date")
+// cardIssuer returns the issuer.Issuer with which the handlers sign cards
+// on behalf of the given issuer at the time given by idem. It skips
+// rendering QR codes, which the handlers render as each output format
+// requires.
+func (h Handlers) cardIssuer(issuer Issuer, idem idempotency) *shcissuer.Issuer {
+	opts := []shcissuer.Option{
+		shcissuer.WithoutPNGs(),
+		shcissuer.KeyID(h.keys.kid(&issuer.Key.PublicKey)),
+		shcissuer.PayloadOptions(h.payloadOptions(idem.clock())...),
+	}
+	if h.deterministic || idem.key != "" {
+		opts = append(opts, shcissuer.Deterministic())
+	}
+	if h.singleQROnly {
+		opts = append(opts, shcissuer.MaxSize(qrcode.MaxSingleChunkSize))
+	}
+	return shcissuer.New(issuer.Key, issuer.URL, opts...)
+}
+
+// smartHealthCardFile returns the contents of a .smart-health-card file
+// containing the given JWS. See
+// https://spec.smarthealth.cards/#via-file-download.
+func smartHealthCardFile(healthCardJWS string) ([]byte, error) {
+	return shcissuer.File(healthCardJWS)
+}
+
+func (h Handlers) parseDate(value string) (time.Time, error) {
+	var err error
+	for _, layout := range h.dateLayouts {
+		var t time.Time
+		if t, err = time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// errorStatus returns the HTTP response code for an internal error,
+// distinguishing requests which were cancelled or ran out of time, cards
+// which are too large, and misused idempotency keys.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, ErrCardTooLarge) || errors.Is(err, qrcode.ErrPayloadTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrInvalidIdempotencyKey):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrIdempotencyKeyReused):
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusInternalServerError
+}
+
+// outputFormat returns "png", "pdf", "html", "jws", or "smart-health-card"
+// based on the "output" form value, falling back to the request's Accept
+// header.
+func outputFormat(r *http.Request) string {
+	switch output := strings.TrimSpace(r.PostFormValue("output")); output {
+	case "pdf", "html", "png", "jws", "smart-health-card":
+		return output
+	}
+
+	accept := r.Header.Get("Accept")
+	if i := strings.IndexAny(accept, ",;"); i >= 0 {
+		accept = accept[:i]
+	}
+	if strings.TrimSpace(accept) == "text/html" {
+		return "html"
+	}
+
+	return "png"
+}
+
+var immunizationOrdinals = []string{"first", "second", "third"}
+
+// givenNames returns the given names in the values of the repeated
+// "given_name" field or, if there are none, in the value of the
+// "given_names" field, split as configured by the GivenNamesDelimiter
+// option.
+func (h Handlers) givenNames(givenName []string, givenNames string) []string {
+	var givens []string
+	for _, given := range givenName {
+		if given = strings.TrimSpace(given); given != "" {
+			givens = append(givens, given)
+		}
+	}
+	if len(givens) > 0 {
+		return givens
+	}
+
+	if h.givenNamesDelimiter == "" {
+		return strings.Fields(givenNames)
+	}
+	for _, given := range strings.Split(givenNames, h.givenNamesDelimiter) {
+		if given = strings.TrimSpace(given); given != "" {
+			givens = append(givens, given)
+		}
+	}
+	return givens
+}
+
+// ParseForm extracts the form values representing a patient and his or her
+// COVID-19 immunizations from the request, as expected by ProcessForm, and
+// constructs an FHIR bundle from them.
+//
+// The names of the fields, and which of them are required, can be changed
+// with the FormFields option.
+//
+// Dates are parsed with the layouts configured by the DateFormats option and
+// checked for plausibility: the birth date and immunization dates must not
+// be in the future, immunizations must not precede the birth date, and
+// immunizations must not precede the date configured by the
+// EarliestImmunizationDate option.
+//
+// The patient's given names are taken from the "given_names" field, split
+// on whitespace or on the delimiter set by the GivenNamesDelimiter option,
+// or, in order to keep multi-word given names such as "Mary Ann" whole,
+// from repeated "given_name" fields, one per given name, which take
+// precedence if given.
+//
+// If the form data is invalid, the returned error is a ValidationErrors
+// listing every field which failed validation.
+func (h Handlers) ParseForm(r *http.Request) (fhirbundle.FHIRBundle, error) {
+	return h.parseValues(func(field string) []string {
+		// PostFormValue parses the form data if it has not been parsed.
+		r.PostFormValue(field)
+		return r.PostForm[field]
+	})
+}
+
+// ParseFormValues is like ParseForm, but takes the form values directly
+// rather than a request, e.g. for fuzzing.
+func (h Handlers) ParseFormValues(values url.Values) (fhirbundle.FHIRBundle, error) {
+	return h.parseValues(func(field string) []string { return values[field] })
+}
+
+// parseValues implements ParseForm given a function which looks up the
+// values of each form field.
+func (h Handlers) parseValues(values func(field string) []string) (fhirbundle.FHIRBundle, error) {
+	var errs ValidationErrors
+
+	value := func(field string) string {
+		if v := values(field); len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+
+	familyName := strings.TrimSpace(value(h.fieldName("family_name")))
+	givens := h.givenNames(values(h.fieldName("given_name")), value(h.fieldName("given_names")))
+	givenNames := strings.Join(givens, " ")
+	birthDateString := strings.TrimSpace(value(h.fieldName("date_of_birth")))
+
+	for field, value := range map[string]string{
+		"family_name":   familyName,
+		"given_names":   givenNames,
+		"date_of_birth": birthDateString,
+	} {
+		if value == "" && !h.optional(field) {
+			errs = append(errs, ValidationError{Field: field, Reason: ReasonMissing})
+		}
+	}
+	if familyName == "" && givenNames == "" && h.optional("family_name") && h.optional("given_names") {
+		errs = append(errs, ValidationError{Field: "family_name", Reason: ReasonMissing})
+	}
+
+	now := h.now()
+
+	birthDate, err := h.parseDate(birthDateString)
+	if err != nil && birthDateString != "" {
+		errs = append(errs, ValidationError{Field: "date_of_birth", Reason: ReasonInvalidDate})
+	} else if birthDate.After(now) {
+		errs = append(errs, ValidationError{Field: "date_of_birth", Reason: ReasonFutureDate})
+	}
+
+	overridePerformers := overridesPerformers(value(h.fieldName(PerformerOverrideField)))
+
+	var immunizations []fhirbundle.Immunization
+	previousBlank := false
+	for i, ordinal := range immunizationOrdinals {
+		performerField := ordinal + "_immunization_performer"
+		lotNumberField := ordinal + "_immunization_lot_number"
+		vaccineTypeField := ordinal + "_immunization_vaccine_type"
+		dateField := ordinal + "_immunization_date"
+
+		values := map[string]string{
+			performerField:   strings.TrimSpace(value(h.fieldName(performerField))),
+			lotNumberField:   strings.TrimSpace(value(h.fieldName(lotNumberField))),
+			vaccineTypeField: strings.TrimSpace(value(h.fieldName(vaccineTypeField))),
+			dateField:        strings.TrimSpace(value(h.fieldName(dateField))),
+		}
+
+		blank := true
+		for _, value := range values {
+			if value != "" {
+				blank = false
+			}
+		}
+
+		// The first immunization is required; subsequent immunizations
+		// are optional but must be provided in order and in full.
+		if blank && i > 0 {
+			previousBlank = true
+			continue
+		}
+
+		if previousBlank {
+			for _, field := range []string{performerField, lotNumberField, vaccineTypeField, dateField} {
+				if values[field] != "" {
+					errs = append(errs, ValidationError{Field: field, Reason: ReasonOutOfOrder})
+				}
+			}
+			continue
+		}
+
+		complete := true
+		for _, field := range []string{performerField, lotNumberField, vaccineTypeField, dateField} {
+			if values[field] == "" && !h.optional(field) {
+				errs = append(errs, ValidationError{Field: field, Reason: ReasonMissing})
+				complete = false
+			}
+		}
+
+		if values[lotNumberField] != "" && h.validLotNumber != nil &&
+			!h.validLotNumber(values[lotNumberField], fhirbundle.VaccineType(values[vaccineTypeField])) {
+			errs = append(errs, ValidationError{Field: lotNumberField, Reason: ReasonInvalidLotNumber})
+			complete = false
+		}
+
+		if values[performerField] != "" && !overridePerformers {
+			if performer, ok := h.knownPerformer(values[performerField]); ok {
+				values[performerField] = performer
+			} else {
+				errs = append(errs, ValidationError{Field: performerField, Reason: ReasonUnknownPerformer})
+				complete = false
+			}
+		}
+
+		datePerformed, err := h.parseDate(values[dateField])
+		if err != nil && values[dateField] != "" {
+			errs = append(errs, ValidationError{Field: dateField, Reason: ReasonInvalidDate})
+			complete = false
+		} else if err == nil {
+			var reason Reason
+			switch {
+			case datePerformed.After(now):
+				reason = ReasonFutureDate
+			case !birthDate.IsZero() && datePerformed.Before(birthDate):
+				reason = ReasonBeforeBirthDate
+			case datePerformed.Before(h.earliestImmunizationDate):
+				reason = ReasonTooEarly
+			}
+			if reason != "" {
+				errs = append(errs, ValidationError{Field: dateField, Reason: reason})
+				complete = false
+			}
 		}
 
-		thirdImmunizationVaccineType := fhirbundle.VaccineType(thirdImmunizationVaccineTypeString)
-		switch thirdImmunizationVaccineType {
+		vaccineType := fhirbundle.VaccineType(values[vaccineTypeField])
+		switch vaccineType {
 		case fhirbundle.Pfizer, fhirbundle.Moderna, fhirbundle.JohnsonAndJohnson,
 			fhirbundle.AstraZeneca, fhirbundle.Sinopharm, fhirbundle.COVAXIN:
+		case "":
 		default:
-			return fhirbundle.FHIRBundle{}, errors.New("invalid third immunization vaccine type")
+			errs = append(errs, ValidationError{Field: vaccineTypeField, Reason: ReasonInvalidVaccineType})
+			complete = false
 		}
 
-		immunizations = append(immunizations, fhirbundle.Immunization{
-			DatePerformed: thirdImmunizationDate,
-			Performer:     thirdImmunizationPerformer,
-			LotNumber:     thirdImmunizationLotNumber,
-			VaccineType:   thirdImmunizationVaccineType,
-		})
+		if complete {
+			immunizations = append(immunizations, fhirbundle.Immunization{
+				DatePerformed: datePerformed,
+				Performer:     values[performerField],
+				LotNumber:     values[lotNumberField],
+				VaccineType:   vaccineType,
+			})
+		}
+	}
+
+	if len(errs) > 0 {
+		errs.sort()
+		h.renameFields(errs)
+		return fhirbundle.FHIRBundle{}, errs
+	}
+
+	patient := fhirbundle.Patient{
+		Name: fhirbundle.Name{
+			Family: familyName,
+			Givens: givens,
+		},
+		BirthDate: birthDate,
 	}
 
 	return fhirbundle.FHIRBundle{Patient: patient, Immunizations: immunizations}, nil
@@ -0,0 +1,91 @@
+package webhandlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/amitkgupta/go-smarthealthcards/v2/qrcode"
+)
+
+func TestWriteQRCodes(t *testing.T) {
+	tests := []struct {
+		name              string
+		length            int
+		wantContentType   string
+		wantContentLength bool
+		wantFiles         int
+	}{
+		{"single QR code", 500, "image/png", true, 0},
+		{"several QR codes", 2500, "application/zip", false, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			if err := writeQRCodes(w, strings.Repeat("a", tt.length/2)+"."+strings.Repeat("b", tt.length/2), qrcode.Options{}); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := w.Header().Get("Content-Type"); got != tt.wantContentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantContentType)
+			}
+			if got := w.Header().Get("Content-Length") != ""; got != tt.wantContentLength {
+				t.Errorf("Content-Length set = %v, want %v", got, tt.wantContentLength)
+			}
+			if tt.wantFiles == 0 {
+				return
+			}
+
+			body := w.Body.Bytes()
+			zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(zr.File) != tt.wantFiles {
+				t.Errorf("archive has %d files, want %d", len(zr.File), tt.wantFiles)
+			}
+		})
+	}
+}
+
+func TestWriteQRCodesInvalidContent(t *testing.T) {
+	w := httptest.NewRecorder()
+	w.Header().Set("Content-Disposition", `attachment; filename="card.zip"`)
+	if err := writeQRCodes(w, strings.Repeat("!", 2500), qrcode.Options{}); err == nil {
+		t.Fatal("writeQRCodes succeeded, want an error")
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("wrote %d bytes, want none", w.Body.Len())
+	}
+	if got := w.Header().Get("Content-Disposition"); got != "" {
+		t.Errorf("Content-Disposition = %q, want none", got)
+	}
+}
+
+// testForm returns the encoded form data of a valid card, requested in the
+// given output format.
+func testForm(output string) string {
+	return url.Values{
+		"family_name":                     {"Salk"},
+		"given_names":                     {"Jonas"},
+		"date_of_birth":                   {"1914-10-28"},
+		"first_immunization_performer":    {"MyLocalHospital"},
+		"first_immunization_lot_number":   {"LN01234"},
+		"first_immunization_vaccine_type": {"Pfizer"},
+		"first_immunization_date":         {"2021-06-01"},
+		"output":                          {output},
+	}.Encode()
+}
+
+// postForm posts the given encoded form data to h at the given path.
+func postForm(h http.Handler, path, form string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
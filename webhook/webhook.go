@@ -0,0 +1,196 @@
+// Package webhook notifies downstream systems, such as billing systems or
+// immunization registries, of each SMART Health Card issued, by POSTing a
+// signed JSON event to a configured URL.
+//
+// Each request carries an X-SHC-Signature header of the form
+// "t=<unix time>,v1=<hex HMAC-SHA256>", where the HMAC is keyed with the
+// shared secret and computed over the unix time, a period, and the request
+// body. Receivers should recompute it, compare it in constant time, and
+// reject stale timestamps to prevent replays.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event describes the issuance of a single card.
+type Event struct {
+	// CardHash is the hex-encoded SHA-256 hash of the card's JWS.
+	CardHash string `json:"cardHash"`
+
+	// Issuer is the issuer URL of the card.
+	Issuer string `json:"issuer"`
+
+	// IssuedAt is when the card was issued.
+	IssuedAt time.Time `json:"issuedAt"`
+
+	// Chunks is the number of QR codes representing the card, or 0 if the
+	// card was not encoded as QR codes.
+	Chunks int `json:"chunks"`
+}
+
+// Dispatcher POSTs events to a webhook URL, retrying failed deliveries with
+// exponential backoff. It is safe for concurrent use.
+type Dispatcher struct {
+	// URL is the webhook URL to which events are POSTed.
+	URL string
+
+	// Secret is the key with which events are signed.
+	Secret []byte
+
+	// MaxAttempts is the number of times delivery of an event is attempted
+	// before giving up; it defaults to 5.
+	MaxAttempts int
+
+	// Backoff is the delay before the first retry, doubling with each
+	// subsequent retry; it defaults to one second.
+	Backoff time.Duration
+
+	// OnError, if not nil, is called with each event which could not be
+	// delivered by Notify and the error from the final attempt.
+	OnError func(Event, error)
+
+	// HTTPClient is used to make requests; it defaults to
+	// http.DefaultClient.
+	HTTPClient *http.Client
+
+	wg sync.WaitGroup
+}
+
+// Notify delivers the event in the background, so that issuance need not
+// wait for the webhook. Use Wait to wait for pending deliveries, e.g. on
+// shutdown.
+func (d *Dispatcher) Notify(e Event) {
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		if err := d.Send(context.Background(), e); err != nil && d.OnError != nil {
+			d.OnError(e, err)
+		}
+	}()
+}
+
+// Wait waits for all deliveries started by Notify to finish.
+func (d *Dispatcher) Wait() {
+	d.wg.Wait()
+}
+
+// Send delivers the event, retrying failed attempts with exponential
+// backoff, and returns the error from the final attempt if none succeed.
+// Responses with 2xx status codes are successful; 4xx responses other than
+// 408 and 429 are not retried.
+func (d *Dispatcher) Send(ctx context.Context, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	maxAttempts := d.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 5
+	}
+	backoff := d.Backoff
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+
+	for attempt := 1; ; attempt++ {
+		retry, err := d.post(ctx, body)
+		if err == nil || !retry || attempt == maxAttempts {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// post makes a single delivery attempt and reports whether a failed
+// attempt may be retried.
+func (d *Dispatcher) post(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-SHC-Signature", Signature(d.Secret, time.Now(), body))
+
+	httpClient := d.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return true, fmt.Errorf("POST %s: unexpected status %s", d.URL, resp.Status)
+	default:
+		return false, fmt.Errorf("POST %s: unexpected status %s", d.URL, resp.Status)
+	}
+}
+
+// Signature returns the value of the X-SHC-Signature header for a request
+// with the given body sent at the given time, signed with the given
+// secret.
+func Signature(secret []byte, t time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks that the given X-SHC-Signature header value is a valid
+// signature of the given body with the given secret, made no more than
+// maxAge ago.
+func Verify(secret []byte, header string, body []byte, maxAge time.Duration) error {
+	var timestamp, signature string
+	for _, part := range strings.Split(header, ",") {
+		switch {
+		case strings.HasPrefix(part, "t="):
+			timestamp = part[len("t="):]
+		case strings.HasPrefix(part, "v1="):
+			signature = part[len("v1="):]
+		}
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || signature == "" {
+		return errors.New("malformed signature")
+	}
+
+	t := time.Unix(unix, 0)
+	if time.Since(t) > maxAge {
+		return errors.New("signature expired")
+	}
+
+	if !hmac.Equal([]byte(Signature(secret, t, body)), []byte("t="+timestamp+",v1="+signature)) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}